@@ -4,20 +4,27 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/kaz/pprotein/integration/echov4"
+	"github.com/kaz/pprotein/internal/analyze"
+	"github.com/kaz/pprotein/internal/analyze/config"
 	"github.com/kaz/pprotein/internal/collect"
 	"github.com/kaz/pprotein/internal/collect/group"
+	"github.com/kaz/pprotein/internal/data"
 	"github.com/kaz/pprotein/internal/event"
 	"github.com/kaz/pprotein/internal/extproc/alp"
 	"github.com/kaz/pprotein/internal/extproc/slp"
 	"github.com/kaz/pprotein/internal/mcp"
 	"github.com/kaz/pprotein/internal/memo"
 	pprofcollect "github.com/kaz/pprotein/internal/pprof"
+	"github.com/kaz/pprotein/internal/schema"
 	"github.com/kaz/pprotein/internal/storage"
+	"github.com/kaz/pprotein/internal/trace"
 	"github.com/kaz/pprotein/view"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 )
 
 // MCP request structure
@@ -48,8 +55,95 @@ type MySQLConnection struct {
 }
 
 // MCP server settings
-func setupMCP(mcpPort string, apiPort string) {
-	mcp.SetupMCP(mcpPort, apiPort)
+func setupMCP(mcpPort string, apiPort string, store storage.Storage) {
+	mcp.SetupMCP(mcpPort, apiPort, store)
+}
+
+// Responses shorter than this are sent as is, since gzip barely shrinks them
+const gzipMinLength = 1024
+
+// newAPIGroup returns the group of the API, whose responses are not cached and are compressed for clients accepting gzip.
+// The event streams are left uncompressed so that each event reaches the client as soon as it is sent.
+func newAPIGroup(e *echo.Echo) *echo.Group {
+	return e.Group("/api", func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Response().Header().Set("Cache-Control", "no-store")
+			return next(c)
+		}
+	}, middleware.GzipWithConfig(middleware.GzipConfig{
+		MinLength: gzipMinLength,
+		Skipper: func(c echo.Context) bool {
+			return strings.HasPrefix(c.Path(), "/api/event")
+		},
+	}))
+}
+
+// registerCollectors registers the endpoints of the enabled types
+func registerCollectors(api *echo.Group, store storage.Storage, hub *event.Hub) error {
+	if collect.TypeEnabled("pprof") {
+		pprofOpts := &collect.Options{
+			Type:     "pprof",
+			Ext:      "-pprof.pb.gz",
+			Store:    store,
+			EventHub: hub,
+		}
+		if err := pprofcollect.NewHandler(pprofOpts).Register(api.Group("/pprof")); err != nil {
+			return err
+		}
+	}
+	if collect.TypeEnabled("httplog") {
+		alpOpts := &collect.Options{
+			Type:     "httplog",
+			Ext:      "-httplog.log",
+			Store:    store,
+			EventHub: hub,
+		}
+		alpHandler, err := alp.NewHandler(alpOpts, store)
+		if err != nil {
+			return err
+		}
+		if err := alpHandler.Register(api.Group("/httplog")); err != nil {
+			return err
+		}
+	}
+	if collect.TypeEnabled("slowlog") {
+		slpOpts := &collect.Options{
+			Type:     "slowlog",
+			Ext:      "-slowlog.log",
+			Store:    store,
+			EventHub: hub,
+		}
+		slpHandler, err := slp.NewHandler(slpOpts, store)
+		if err != nil {
+			return err
+		}
+		if err := slpHandler.Register(api.Group("/slowlog")); err != nil {
+			return err
+		}
+	}
+	if collect.TypeEnabled("memo") {
+		memoOpts := &collect.Options{
+			Type:     "memo",
+			Ext:      "-memo.log",
+			Store:    store,
+			EventHub: hub,
+		}
+		if err := memo.NewHandler(memoOpts).Register(api.Group("/memo")); err != nil {
+			return err
+		}
+	}
+	if collect.TypeEnabled("trace") {
+		traceOpts := &collect.Options{
+			Type:     "trace",
+			Ext:      "-trace.out",
+			Store:    store,
+			EventHub: hub,
+		}
+		if err := trace.NewHandler(traceOpts).Register(api.Group("/trace")); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func start() error {
@@ -63,11 +157,20 @@ func start() error {
 		mcpPort = "9001"
 	}
 
-	store, err := storage.New("data")
+	store, err := storage.NewFromEnv(storage.DataDir())
 	if err != nil {
 		return err
 	}
 
+	if err := config.LoadFromEnv(); err != nil {
+		return err
+	}
+	if err := collect.LoadTypesFromEnv(); err != nil {
+		return err
+	}
+	// Runs for the lifetime of the process
+	collect.StartCacheEviction(store, collect.CacheRetentionFromEnv())
+
 	e := echo.New()
 	echov4.Integrate(e)
 
@@ -77,61 +180,12 @@ func start() error {
 	}
 	e.GET("/*", echo.WrapHandler(http.FileServer(http.FS(fs))))
 
-	api := e.Group("/api", func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			c.Response().Header().Set("Cache-Control", "no-store")
-			return next(c)
-		}
-	})
+	api := newAPIGroup(e)
 
 	hub := event.NewHub()
 	hub.RegisterHandlers(api.Group("/event"))
 
-	pprofOpts := &collect.Options{
-		Type:     "pprof",
-		Ext:      "-pprof.pb.gz",
-		Store:    store,
-		EventHub: hub,
-	}
-	if err := pprofcollect.NewHandler(pprofOpts).Register(api.Group("/pprof")); err != nil {
-		return err
-	}
-
-	alpOpts := &collect.Options{
-		Type:     "httplog",
-		Ext:      "-httplog.log",
-		Store:    store,
-		EventHub: hub,
-	}
-	alpHandler, err := alp.NewHandler(alpOpts, store)
-	if err != nil {
-		return err
-	}
-	if err := alpHandler.Register(api.Group("/httplog")); err != nil {
-		return err
-	}
-
-	slpOpts := &collect.Options{
-		Type:     "slowlog",
-		Ext:      "-slowlog.log",
-		Store:    store,
-		EventHub: hub,
-	}
-	slpHandler, err := slp.NewHandler(slpOpts, store)
-	if err != nil {
-		return err
-	}
-	if err := slpHandler.Register(api.Group("/slowlog")); err != nil {
-		return err
-	}
-
-	memoOpts := &collect.Options{
-		Type:     "memo",
-		Ext:      "-memo.log",
-		Store:    store,
-		EventHub: hub,
-	}
-	if err := memo.NewHandler(memoOpts).Register(api.Group("/memo")); err != nil {
+	if err := registerCollectors(api, store, hub); err != nil {
 		return err
 	}
 
@@ -140,32 +194,21 @@ func start() error {
 		return err
 	}
 	grp.RegisterHandlers(api.Group("/group"))
+	grp.RegisterAnalysisHandlers(api)
+	api.GET("/trend", grp.HandleTrend)
+	api.GET("/stats", grp.HandleStats(mcp.Running))
+	api.GET("/config", handleRuntimeConfig(port, mcpPort, grp))
 
-	// Call setupMCP first and start the MCP server on a separate port
-	setupMCP(mcpPort, port)
-
-	// Implementation of a simple deletion endpoint
-	api.DELETE("/data/:type/:id", func(c echo.Context) error {
-		dataType := c.Param("type")
-		id := c.Param("id")
-
-		// Delete metadata from KV store
-		if err := store.Delete(dataType, id); err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{
-				"error": err.Error(),
-			})
-		}
+	analyze.NewHandler().RegisterHandlers(api.Group("/analyze"))
+	config.RegisterHandlers(api.Group("/thresholds"))
+	api.GET("/schema", schema.HandleSchema)
 
-		// Also delete the file (if it exists)
-		path, _ := store.GetFilePath(id)
-		os.Remove(path) // Ignore error (file may not exist)
+	// Call setupMCP first and start the MCP server on a separate port
+	setupMCP(mcpPort, port, store)
 
-		return c.JSON(http.StatusOK, map[string]string{
-			"status": "deleted",
-			"type":   dataType,
-			"id":     id,
-		})
-	})
+	dataHandler := data.NewHandler(store)
+	dataHandler.RegisterHandlers(api.Group("/data"))
+	dataHandler.RegisterRawHandlers(api.Group("/raw"))
 
 	// Display MCP port in server startup log as well
 	log.Printf("Starting pprotein server on port %s, MCP server on port %s", port, mcpPort)
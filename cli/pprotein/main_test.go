@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/kaz/pprotein/internal/collect/group"
+	"github.com/kaz/pprotein/internal/event"
+	"github.com/kaz/pprotein/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+func TestRegisterCollectorsWithRestrictedTypes(t *testing.T) {
+	t.Cleanup(func() { collect.SetTypes(nil) })
+	t.Setenv(collect.TypesEnv, "pprof, slowlog")
+	if err := collect.LoadTypesFromEnv(); err != nil {
+		t.Fatalf("Failed to load types: %v", err)
+	}
+
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	e := echo.New()
+	if err := registerCollectors(e.Group("/api"), store, event.NewHub()); err != nil {
+		t.Fatalf("Failed to register collectors: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		expected int
+	}{
+		{name: "Enabled pprof", path: "/api/pprof", expected: http.StatusOK},
+		{name: "Enabled slowlog", path: "/api/slowlog", expected: http.StatusOK},
+		{name: "Disabled httplog", path: "/api/httplog", expected: http.StatusNotFound},
+		{name: "Disabled memo", path: "/api/memo", expected: http.StatusNotFound},
+		{name: "Disabled trace", path: "/api/trace", expected: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.expected {
+				t.Errorf("Status is different from expected. Expected: %d, Actual: %d", tt.expected, rec.Code)
+			}
+		})
+	}
+
+	if got := collect.Types(); len(got) != 2 || got[0] != "pprof" || got[1] != "slowlog" {
+		t.Errorf("Enabled types are different from expected. Actual: %v", got)
+	}
+
+	t.Setenv(collect.TypesEnv, "pprof,unknown")
+	if err := collect.LoadTypesFromEnv(); err == nil {
+		t.Errorf("Unknown type is accepted")
+	}
+}
+
+func TestRuntimeConfig(t *testing.T) {
+	dataDir := t.TempDir()
+	t.Setenv(storage.DataDirEnv, dataDir)
+	t.Setenv(storage.StorageEnv, "s3://isucon:storage-secret@bucket/prefix")
+	t.Setenv(group.WebhookURLEnv, "https://hooks.example.com/services/webhook-token")
+
+	store, err := storage.New(dataDir, storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	grp, err := group.NewCollector(store, "9000")
+	if err != nil {
+		t.Fatalf("Failed to create group collector: %v", err)
+	}
+
+	e := echo.New()
+	e.GET("/api/config", handleRuntimeConfig("9000", "9001", grp))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/config", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+	}
+
+	var cfg runtimeConfig
+	if err := json.Unmarshal(rec.Body.Bytes(), &cfg); err != nil {
+		t.Fatalf("Failed to decode config: %v", err)
+	}
+	if cfg.Storage.DataDir != dataDir {
+		t.Errorf("Data dir is different from expected. Expected: %s, Actual: %s", dataDir, cfg.Storage.DataDir)
+	}
+	if !cfg.Group.Webhook || cfg.MCP.Port != "9001" {
+		t.Errorf("Config is different from expected: %s", rec.Body)
+	}
+
+	for _, secret := range []string{"storage-secret", "webhook-token"} {
+		if strings.Contains(rec.Body.String(), secret) {
+			t.Errorf("Config contains a secret %q: %s", secret, rec.Body)
+		}
+	}
+}
+
+func TestAPIGroupGzip(t *testing.T) {
+	large := `{"queries":[` + strings.Repeat(`{"query":"SELECT * FROM users WHERE id = ?"},`, 100) + `{}]}`
+	small := `{"status":"ok"}`
+
+	e := echo.New()
+	api := newAPIGroup(e)
+	api.GET("/large", func(c echo.Context) error { return c.String(http.StatusOK, large) })
+	api.GET("/small", func(c echo.Context) error { return c.String(http.StatusOK, small) })
+	api.GET("/event", func(c echo.Context) error { return c.String(http.StatusOK, large) })
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		expected       string
+		wantGzip       bool
+	}{
+		{name: "Client accepting gzip", path: "/api/large", acceptEncoding: "gzip", expected: large, wantGzip: true},
+		{name: "Client not accepting gzip", path: "/api/large", expected: large, wantGzip: false},
+		{name: "Response below the threshold", path: "/api/small", acceptEncoding: "gzip", expected: small, wantGzip: false},
+		{name: "Event stream", path: "/api/event", acceptEncoding: "gzip", expected: large, wantGzip: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set(echo.HeaderAcceptEncoding, tt.acceptEncoding)
+			}
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+			}
+			if cacheControl := rec.Header().Get("Cache-Control"); cacheControl != "no-store" {
+				t.Errorf("Cache-Control is different from expected. Expected: no-store, Actual: %q", cacheControl)
+			}
+
+			body := rec.Body.Bytes()
+			if encoding := rec.Header().Get(echo.HeaderContentEncoding); (encoding == "gzip") != tt.wantGzip {
+				t.Fatalf("Content-Encoding is different from expected. Expected gzip: %v, Actual: %q", tt.wantGzip, encoding)
+			}
+			if tt.wantGzip {
+				zr, err := gzip.NewReader(bytes.NewReader(body))
+				if err != nil {
+					t.Fatalf("Failed to open gzip body: %v", err)
+				}
+				if body, err = io.ReadAll(zr); err != nil {
+					t.Fatalf("Failed to decompress body: %v", err)
+				}
+			}
+
+			if string(body) != tt.expected {
+				t.Errorf("Body is different from expected. Expected: %s, Actual: %s", tt.expected, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/kaz/pprotein/internal/analyze/config"
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/kaz/pprotein/internal/collect/group"
+	"github.com/kaz/pprotein/internal/mcp"
+	"github.com/kaz/pprotein/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// runtimeConfig is the effective configuration of the instance.
+	// Secrets such as passwords and tokens are left out, so that it is safe to show.
+	runtimeConfig struct {
+		Port       string            `json:"port"`
+		Storage    storageConfig     `json:"storage"`
+		Types      []string          `json:"types"`
+		Thresholds config.Thresholds `json:"thresholds"`
+		Group      group.Settings    `json:"group"`
+		MCP        mcpConfig         `json:"mcp"`
+	}
+
+	storageConfig struct {
+		DataDir string `json:"data_dir"`
+		// Backend given in PPROTEIN_STORAGE with any password redacted, empty for the local filesystem
+		Backend      string `json:"backend,omitempty"`
+		Layout       string `json:"layout"`
+		MaxFileSize  int64  `json:"max_file_size"`
+		MaxTotalSize int64  `json:"max_total_size"`
+		MaxBodySize  int64  `json:"max_body_size"`
+		// Retention of the cached analysis results, where zero means no limit
+		CacheTTL     string `json:"cache_ttl"`
+		CacheMaxSize int64  `json:"cache_max_size"`
+	}
+
+	mcpConfig struct {
+		Port string `json:"port"`
+		mcp.Settings
+	}
+)
+
+// currentRuntimeConfig collects the configuration the instance is running with
+func currentRuntimeConfig(port, mcpPort string, grp *group.Collector) *runtimeConfig {
+	storageCfg := storageConfig{DataDir: storage.DataDir(), MaxBodySize: storage.MaxBodySizeFromEnv()}
+	if raw := os.Getenv(storage.StorageEnv); raw != "" {
+		if u, err := url.Parse(raw); err == nil {
+			storageCfg.Backend = u.Redacted()
+		} else {
+			storageCfg.Backend = "(invalid)"
+		}
+	}
+	if layout, err := storage.LayoutFromEnv(); err == nil {
+		storageCfg.Layout = string(layout)
+	}
+	retention := collect.CacheRetentionFromEnv()
+	storageCfg.CacheTTL, storageCfg.CacheMaxSize = retention.TTL.String(), retention.MaxSize
+	if limits, err := storage.LimitsFromEnv(); err == nil {
+		storageCfg.MaxFileSize, storageCfg.MaxTotalSize = limits.MaxFileSize, limits.MaxTotalSize
+	}
+
+	return &runtimeConfig{
+		Port:       port,
+		Storage:    storageCfg,
+		Types:      collect.Types(),
+		Thresholds: config.Current(),
+		Group:      grp.Settings(),
+		MCP:        mcpConfig{Port: mcpPort, Settings: mcp.CurrentSettings()},
+	}
+}
+
+// handleRuntimeConfig returns the handler serving the effective configuration of the instance
+func handleRuntimeConfig(port, mcpPort string, grp *group.Collector) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, currentRuntimeConfig(port, mcpPort, grp))
+	}
+}
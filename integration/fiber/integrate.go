@@ -0,0 +1,23 @@
+package fiber
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/kaz/pprotein/integration"
+)
+
+func Integrate(app *fiber.App) {
+	EnableDebugHandler(app)
+	EnableDebugMode(app)
+}
+
+func EnableDebugHandler(app *fiber.App) {
+	app.All("/debug/*", adaptor.HTTPHandler(integration.NewDebugHandler()))
+}
+
+func EnableDebugMode(app *fiber.App) {
+	app.Use(logger.New())
+	app.Use(recover.New())
+}
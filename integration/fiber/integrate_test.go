@@ -0,0 +1,39 @@
+package fiber
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestIntegrate(t *testing.T) {
+	app := fiber.New()
+	Integrate(app)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	if err != nil {
+		t.Fatalf("Failed to request pprof index: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Status code is different from expected. Expected: %d, Actual: %d", http.StatusOK, resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "goroutine") {
+		t.Errorf("pprof index does not list profiles: %s", body)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/debug/pprof/goroutine?debug=1", nil))
+	if err != nil {
+		t.Fatalf("Failed to request goroutine profile: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Status code is different from expected. Expected: %d, Actual: %d", http.StatusOK, resp.StatusCode)
+	}
+}
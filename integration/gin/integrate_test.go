@@ -0,0 +1,25 @@
+package gin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIntegrate(t *testing.T) {
+	r := gin.New()
+	Integrate(r)
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/goroutine"} {
+		t.Run(path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("Status code is different from expected. Expected: %d, Actual: %d", http.StatusOK, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package stdhttp
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/kaz/pprotein/integration"
+)
+
+// Integrate registers the debug handlers on the ServeMux
+func Integrate(mux *http.ServeMux) {
+	EnableDebugHandler(mux)
+}
+
+func EnableDebugHandler(mux *http.ServeMux) {
+	mux.Handle("/debug/", integration.NewDebugHandler())
+}
+
+// Middleware serves the debug handlers under /debug/ and passes other requests to next.
+// It can wrap any http.Handler based router such as chi.
+func Middleware(next http.Handler) http.Handler {
+	debugHandler := integration.NewDebugHandler()
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/debug/") {
+			debugHandler.ServeHTTP(rw, r)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
@@ -0,0 +1,59 @@
+package stdhttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIntegrate(t *testing.T) {
+	mux := http.NewServeMux()
+	Integrate(mux)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/debug/pprof/")
+	if err != nil {
+		t.Fatalf("Failed to request pprof index: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Status code is different from expected. Expected: %d, Actual: %d", http.StatusOK, resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "goroutine") {
+		t.Errorf("pprof index does not list profiles: %s", body)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	app := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		io.WriteString(rw, "app")
+	})
+
+	server := httptest.NewServer(Middleware(app))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/debug/pprof/cmdline")
+	if err != nil {
+		t.Fatalf("Failed to request pprof cmdline: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Status code of debug route is different from expected. Expected: %d, Actual: %d", http.StatusOK, resp.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL + "/api/users")
+	if err != nil {
+		t.Fatalf("Failed to request app route: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "app" {
+		t.Errorf("Request was not passed to the app: %s", body)
+	}
+}
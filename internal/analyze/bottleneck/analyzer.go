@@ -0,0 +1,179 @@
+package bottleneck
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/kaz/pprotein/internal/analyze/httplog"
+	"github.com/kaz/pprotein/internal/analyze/slowlog"
+)
+
+// DefaultWindow is the width of the time windows requests and queries are correlated in
+const DefaultWindow = 10 * time.Second
+
+// Options controls the bottleneck analysis
+type Options struct {
+	Window     time.Duration  // Width of the time windows (DefaultWindow if zero)
+	TimeLayout string         // Layout of the time field of the HTTP log (defaults to RFC3339 or nginx $time_local)
+	Format     httplog.Format // Layout of the fields of the HTTP log (LTSV if zero)
+	Limit      int            // Maximum number of causes (10 if zero)
+}
+
+// Cause is an endpoint which is likely slow because of a query pattern running at the same time
+type Cause struct {
+	Endpoint        string  `json:"endpoint"`        // Patternized URI
+	Pattern         string  `json:"pattern"`         // Query fingerprint
+	EndpointAvgTime float64 `json:"endpoint_avg"`    // Average processing time of the endpoint (seconds)
+	EndpointTime    float64 `json:"endpoint_time"`   // Total processing time of the endpoint (seconds)
+	QueryTime       float64 `json:"query_time"`      // Total execution time of the query pattern (seconds)
+	OverlapTime     float64 `json:"overlap_time"`    // Time both spent in the same windows, which ranks the causes (seconds)
+	OverlapWindows  int     `json:"overlap_windows"` // Number of windows both appear in
+	Correlation     float64 `json:"correlation"`     // Pearson correlation of the time spent per window (0 if undefined)
+	Message         string  `json:"message"`         // Human-readable explanation
+}
+
+// Result is the ranked list of likely root causes
+type Result struct {
+	Window  string   `json:"window"`
+	Windows int      `json:"windows"`
+	Causes  []*Cause `json:"causes"`
+}
+
+// series is the time spent per window
+type series map[int64]float64
+
+// Analyze correlates the endpoints of the HTTP log with the query patterns of the slow log by time window.
+// A pair ranks higher the more time both of them spent in the same windows.
+func Analyze(httplogContent, slowlogContent []byte, opts Options) (*Result, error) {
+	window := opts.Window
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+
+	queries, err := slowlog.Queries(slowlogContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse slowlog: %w", err)
+	}
+
+	windows := map[int64]bool{}
+	bucket := func(ts time.Time) int64 {
+		w := ts.UnixNano() / int64(window)
+		windows[w] = true
+		return w
+	}
+
+	endpoints := map[string]series{}
+	endpointCounts := map[string]int{}
+	requests, err := httplog.Requests(httplogContent, opts.Format, opts.TimeLayout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse httplog: %w", err)
+	}
+	for _, req := range requests {
+		if req.Endpoint == "" {
+			continue
+		}
+		if _, ok := endpoints[req.Endpoint]; !ok {
+			endpoints[req.Endpoint] = series{}
+		}
+		endpoints[req.Endpoint][bucket(req.Time)] += req.ReqTime
+		endpointCounts[req.Endpoint]++
+	}
+
+	patterns := map[string]series{}
+	for _, q := range queries {
+		if q.Time.IsZero() {
+			continue
+		}
+		if _, ok := patterns[q.Fingerprint]; !ok {
+			patterns[q.Fingerprint] = series{}
+		}
+		patterns[q.Fingerprint][bucket(q.Time)] += q.QueryTime
+	}
+
+	var causes []*Cause
+	for endpoint, es := range endpoints {
+		for pattern, ps := range patterns {
+			overlap, overlapWindows := 0.0, 0
+			for w, e := range es {
+				if p, ok := ps[w]; ok {
+					overlap += math.Min(e, p)
+					overlapWindows++
+				}
+			}
+			if overlapWindows == 0 {
+				continue
+			}
+
+			cause := &Cause{
+				Endpoint:       endpoint,
+				Pattern:        pattern,
+				EndpointTime:   es.total(),
+				QueryTime:      ps.total(),
+				OverlapTime:    overlap,
+				OverlapWindows: overlapWindows,
+				Correlation:    correlation(es, ps, windows),
+			}
+			cause.EndpointAvgTime = cause.EndpointTime / float64(endpointCounts[endpoint])
+			cause.Message = fmt.Sprintf("endpoint %s is slow (avg %.3fs) and overlaps with query pattern %q spending %.3fs in %d windows",
+				endpoint, cause.EndpointAvgTime, pattern, cause.QueryTime, overlapWindows)
+			causes = append(causes, cause)
+		}
+	}
+
+	sort.Slice(causes, func(i, j int) bool {
+		if causes[i].OverlapTime != causes[j].OverlapTime {
+			return causes[i].OverlapTime > causes[j].OverlapTime
+		}
+		if causes[i].Correlation != causes[j].Correlation {
+			return causes[i].Correlation > causes[j].Correlation
+		}
+		if causes[i].Endpoint != causes[j].Endpoint {
+			return causes[i].Endpoint < causes[j].Endpoint
+		}
+		return causes[i].Pattern < causes[j].Pattern
+	})
+	if len(causes) > limit {
+		causes = causes[:limit]
+	}
+	if causes == nil {
+		causes = []*Cause{}
+	}
+
+	return &Result{Window: window.String(), Windows: len(windows), Causes: causes}, nil
+}
+
+// total returns the time spent in all windows
+func (s series) total() float64 {
+	total := 0.0
+	for _, v := range s {
+		total += v
+	}
+	return total
+}
+
+// correlation returns the Pearson correlation of the series over the windows, or 0 if it is undefined
+func correlation(a, b series, windows map[int64]bool) float64 {
+	n := float64(len(windows))
+	if n < 2 {
+		return 0
+	}
+
+	meanA, meanB := a.total()/n, b.total()/n
+	cov, varA, varB := 0.0, 0.0, 0.0
+	for w := range windows {
+		da, db := a[w]-meanA, b[w]-meanB
+		cov += da * db
+		varA += da * da
+		varB += db * db
+	}
+	if varA == 0 || varB == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(varA*varB)
+}
@@ -0,0 +1,76 @@
+package bottleneck
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalyze(t *testing.T) {
+	base := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	// /api/users/:id is slow only while the users query is slow, and /api/health is constantly fast
+	var httplogContent, slowlogContent strings.Builder
+	for i := 0; i < 6; i++ {
+		ts := base.Add(time.Duration(i) * 10 * time.Second)
+		reqtime, queryTime := 0.010, 0.0
+		if i%2 == 0 {
+			reqtime, queryTime = 1.500, 1.200
+		}
+		fmt.Fprintf(&httplogContent, "time:%s\tmethod:GET\turi:/api/users/%d\tstatus:200\treqtime:%.3f\n", ts.Format(time.RFC3339), i, reqtime)
+		fmt.Fprintf(&httplogContent, "time:%s\tmethod:GET\turi:/api/health\tstatus:200\treqtime:0.001\n", ts.Add(time.Second).Format(time.RFC3339))
+
+		if queryTime > 0 {
+			fmt.Fprintf(&slowlogContent, `# Time: %s
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: %f  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 100000
+SET timestamp=%d;
+SELECT * FROM users WHERE name = 'user%d';
+
+`, ts.Format("2006-01-02T15:04:05.000000Z"), queryTime, ts.Unix(), i)
+		}
+		fmt.Fprintf(&slowlogContent, `# Time: %s
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 0.010000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 1
+SET timestamp=%d;
+SELECT * FROM settings WHERE id = %d;
+
+`, ts.Add(2*time.Second).Format("2006-01-02T15:04:05.000000Z"), ts.Unix()+2, i)
+	}
+
+	result, err := Analyze([]byte(httplogContent.String()), []byte(slowlogContent.String()), Options{})
+	if err != nil {
+		t.Fatalf("Failed to analyze bottleneck: %v", err)
+	}
+
+	if result.Windows != 6 {
+		t.Errorf("Window count is different from expected. Expected: 6, Actual: %d", result.Windows)
+	}
+	if len(result.Causes) == 0 {
+		t.Fatalf("No causes are found")
+	}
+
+	top := result.Causes[0]
+	if top.Endpoint != "/api/users/:id" {
+		t.Errorf("Top endpoint is different from expected. Expected: /api/users/:id, Actual: %s", top.Endpoint)
+	}
+	if !strings.Contains(top.Pattern, "from users") {
+		t.Errorf("Top pattern is different from expected. Expected: select * from users ..., Actual: %s", top.Pattern)
+	}
+	if top.OverlapWindows != 3 {
+		t.Errorf("Overlap window count is different from expected. Expected: 3, Actual: %d", top.OverlapWindows)
+	}
+	if top.Correlation < 0.99 {
+		t.Errorf("Correlation is lower than expected. Expected: 1, Actual: %f", top.Correlation)
+	}
+	if top.Message == "" {
+		t.Errorf("Message is empty")
+	}
+
+	for _, cause := range result.Causes {
+		if cause.Endpoint == "/api/health" && cause.OverlapTime > top.OverlapTime {
+			t.Errorf("Fast endpoint is ranked above the correlated one: %+v", cause)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Environment variables overriding the default thresholds
+const (
+	SlowlogThresholdEnv = "PPROTEIN_SLOWLOG_THRESHOLD"
+	HttplogThresholdEnv = "PPROTEIN_HTTPLOG_THRESHOLD"
+	HotspotPercentEnv   = "PPROTEIN_HOTSPOT_PERCENT"
+	CallPathDepthEnv    = "PPROTEIN_CALL_PATH_DEPTH"
+	GCPercentEnv        = "PPROTEIN_GC_PERCENT"
+)
+
+// Thresholds are the sensitivities of the analyzers
+type Thresholds struct {
+	// Minimum query time in seconds to be listed as a slow query
+	SlowlogSeconds float64 `json:"slowlog_seconds"`
+	// Minimum response time in seconds to be listed as a slow request
+	HttplogSeconds float64 `json:"httplog_seconds"`
+	// Share of the total in percent above which a function is called out as a hotspot in the pprof report
+	HotspotPercent float64 `json:"hotspot_percent"`
+	// Number of frames above which a call path is called out as deep in the pprof report
+	CallPathDepth int `json:"call_path_depth"`
+	// Share of a CPU profile in percent spent in garbage collection above which it is called out as GC-heavy
+	GCPercent float64 `json:"gc_percent"`
+}
+
+var (
+	mu      sync.RWMutex
+	current = Default()
+)
+
+// Default returns the built-in thresholds
+func Default() Thresholds {
+	return Thresholds{
+		SlowlogSeconds: 0.5,
+		HttplogSeconds: 0.5,
+		HotspotPercent: 10,
+		CallPathDepth:  40,
+		GCPercent:      25,
+	}
+}
+
+// Current returns the thresholds in effect
+func Current() Thresholds {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Set replaces the thresholds in effect
+func Set(t Thresholds) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	current = t
+	return nil
+}
+
+// LoadFromEnv overrides the thresholds in effect with the ones given in the environment
+func LoadFromEnv() error {
+	t := Current()
+	for env, field := range map[string]*float64{
+		SlowlogThresholdEnv: &t.SlowlogSeconds,
+		HttplogThresholdEnv: &t.HttplogSeconds,
+		HotspotPercentEnv:   &t.HotspotPercent,
+		GCPercentEnv:        &t.GCPercent,
+	} {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", env, err)
+		}
+		*field = f
+	}
+	if v := os.Getenv(CallPathDepthEnv); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", CallPathDepthEnv, err)
+		}
+		t.CallPathDepth = n
+	}
+	return Set(t)
+}
+
+func (t Thresholds) validate() error {
+	if t.SlowlogSeconds < 0 || t.HttplogSeconds < 0 {
+		return fmt.Errorf("thresholds must not be negative")
+	}
+	if t.HotspotPercent < 0 || t.HotspotPercent > 100 {
+		return fmt.Errorf("hotspot percent must be between 0 and 100")
+	}
+	if t.GCPercent < 0 || t.GCPercent > 100 {
+		return fmt.Errorf("GC percent must be between 0 and 100")
+	}
+	if t.CallPathDepth <= 0 {
+		return fmt.Errorf("call path depth must be positive")
+	}
+	return nil
+}
+
+// RegisterHandlers registers the endpoints to view and update the thresholds
+func RegisterHandlers(g *echo.Group) {
+	g.GET("", getThresholds)
+	g.PUT("", putThresholds)
+}
+
+func getThresholds(c echo.Context) error {
+	return c.JSON(http.StatusOK, Current())
+}
+
+// putThresholds updates the thresholds. Fields missing in the request body keep their values.
+func putThresholds(c echo.Context) error {
+	t := Current()
+	if err := c.Bind(&t); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to parse request body: %v", err))
+	}
+	if err := Set(t); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, t)
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestLoadFromEnv(t *testing.T) {
+	t.Cleanup(func() { Set(Default()) })
+	t.Setenv(SlowlogThresholdEnv, "0.05")
+	t.Setenv(HotspotPercentEnv, "25")
+	t.Setenv(CallPathDepthEnv, "20")
+	t.Setenv(GCPercentEnv, "40")
+
+	if err := LoadFromEnv(); err != nil {
+		t.Fatalf("Failed to load thresholds: %v", err)
+	}
+
+	expected := Thresholds{SlowlogSeconds: 0.05, HttplogSeconds: Default().HttplogSeconds, HotspotPercent: 25, CallPathDepth: 20, GCPercent: 40}
+	if got := Current(); got != expected {
+		t.Errorf("Thresholds are different from expected. Expected: %+v, Actual: %+v", expected, got)
+	}
+
+	t.Setenv(HttplogThresholdEnv, "-1")
+	if err := LoadFromEnv(); err == nil {
+		t.Errorf("Negative threshold is accepted")
+	}
+}
+
+func TestPutThresholds(t *testing.T) {
+	t.Cleanup(func() { Set(Default()) })
+
+	e := echo.New()
+	RegisterHandlers(e.Group("/api/thresholds"))
+
+	req := httptest.NewRequest(http.MethodPut, "/api/thresholds", strings.NewReader(`{"httplog_seconds": 1.5}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+	}
+
+	// Fields missing in the request keep their values
+	expected := Default()
+	expected.HttplogSeconds = 1.5
+	if got := Current(); got != expected {
+		t.Errorf("Thresholds are different from expected. Expected: %+v, Actual: %+v", expected, got)
+	}
+}
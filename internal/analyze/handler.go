@@ -0,0 +1,318 @@
+package analyze
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kaz/pprotein/internal/analyze/config"
+	"github.com/kaz/pprotein/internal/analyze/httplog"
+	"github.com/kaz/pprotein/internal/analyze/meta"
+	"github.com/kaz/pprotein/internal/analyze/pprof"
+	"github.com/kaz/pprotein/internal/analyze/slowlog"
+	"github.com/kaz/pprotein/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	maxBodySize int64 // Request bodies larger than this are rejected with 413, unlimited if 0
+}
+
+func NewHandler() *Handler {
+	return &Handler{maxBodySize: storage.MaxBodySizeFromEnv()}
+}
+
+func (h *Handler) RegisterHandlers(g *echo.Group) {
+	g.POST("/:type", h.analyze)
+	g.POST("/pprof/symbolized", h.analyzeSymbolized)
+}
+
+// limitBody caps the request body at the configured size, as the analysis endpoints read it into memory
+func (h *Handler) limitBody(c echo.Context) {
+	if h.maxBodySize > 0 {
+		c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, h.maxBodySize)
+	}
+}
+
+// readError returns 413 if reading the body failed for exceeding the size limit, or 400 otherwise
+func readError(what string, err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("%s exceeds the limit of %d bytes", what, maxBytesErr.Limit))
+	}
+	return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to read %s: %v", what, err))
+}
+
+// analysisError returns 413 if a gzipped body expanded beyond the size limit, or 400 otherwise
+func analysisError(what string, err error) error {
+	if errors.Is(err, storage.ErrSizeLimitExceeded) {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to analyze %s: %v", what, err))
+}
+
+// analyze analyzes the raw file in the request body and returns the result inline without storing anything.
+// The slowlog and httplog histogram buckets can be given as comma-separated upper bounds in seconds with buckets,
+// and the slowlog queries are grouped by the fingerprint strategy given with fingerprint (percona or literals).
+// A slowlog exported from the mysql.slow_log table as a JSON array is read with format=json.
+// An httplog with another field separator or labels is read with delimiter and labels (e.g. labels=reqtime=duration).
+// Both are limited to the time range between the RFC 3339 timestamps from and to, where the httplog time field
+// is parsed with time_layout if given. Slowlog query patterns matching any of the exclude regexes are dropped.
+func (h *Handler) analyze(c echo.Context) error {
+	h.limitBody(c)
+	content, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return readError("body", err)
+	}
+	if len(content) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "request body is empty")
+	}
+
+	// Thresholds in seconds for listing slow queries and requests, which default to the configured ones
+	thresholds := config.Current()
+	slowlogThreshold, httplogThreshold := thresholds.SlowlogSeconds, thresholds.HttplogSeconds
+	if v := c.QueryParam("threshold"); v != "" {
+		threshold, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid threshold: %v", err))
+		}
+		slowlogThreshold, httplogThreshold = threshold, threshold
+	}
+
+	// Time range of the slowlog events and the httplog requests
+	from, to, err := meta.ParseTimeRange(c.QueryParam("from"), c.QueryParam("to"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	switch typ := c.Param("type"); typ {
+	case "pprof":
+		return h.analyzePprof(c, content, "")
+	case "slowlog":
+		buckets, err := parseBuckets(c.QueryParam("buckets"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid buckets: %v", err))
+		}
+		exclude := c.QueryParams()["exclude"]
+		for _, pattern := range exclude {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid exclude %q: %v", pattern, err))
+			}
+		}
+		result, err := slowlog.AnalyzeWithOptions(c.Request().Context(), content, slowlog.Options{
+			Threshold:   slowlogThreshold,
+			From:        from,
+			To:          to,
+			Exclude:     exclude,
+			Buckets:     buckets,
+			Fingerprint: c.QueryParam("fingerprint"),
+			Format:      c.QueryParam("format"),
+		})
+		if err != nil {
+			return analysisError("slowlog", err)
+		}
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, []byte(result))
+	case "httplog":
+		buckets, err := parseBuckets(c.QueryParam("buckets"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid buckets: %v", err))
+		}
+		labels, err := httplog.ParseLabels(c.QueryParam("labels"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid labels: %v", err))
+		}
+		result, err := httplog.AnalyzeWithOptions(c.Request().Context(), content, httplog.Options{
+			SlowThreshold: httplogThreshold,
+			From:          from,
+			To:            to,
+			TimeLayout:    c.QueryParam("time_layout"),
+			Buckets:       buckets,
+			Format:        httplog.Format{Delimiter: c.QueryParam("delimiter"), Labels: labels},
+		})
+		if err != nil {
+			return analysisError("httplog", err)
+		}
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, []byte(result))
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unsupported type: %s", typ))
+	}
+}
+
+// parseBuckets parses the comma-separated upper bounds of histogram buckets in seconds
+func parseBuckets(v string) ([]float64, error) {
+	if v == "" {
+		return nil, nil
+	}
+	var buckets []float64
+	for _, s := range strings.Split(v, ",") {
+		bucket, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+// analyzeSymbolized analyzes the profile uploaded with the profiled binary as the multipart form files profile and binary,
+// symbolizing the locations without symbol info from the Go symbol table of the binary like a stripped profile needs.
+// Neither is stored; the binary is written to a temporary file only while the profile is analyzed.
+// The query params are the same as the ones of the pprof analysis except that format=peek isn't supported.
+func (h *Handler) analyzeSymbolized(c echo.Context) error {
+	h.limitBody(c)
+	content, err := readFormFile(c, "profile")
+	if err != nil {
+		return err
+	}
+	if c.QueryParam("format") == "peek" {
+		return echo.NewHTTPError(http.StatusBadRequest, "format=peek doesn't support symbolization")
+	}
+
+	header, err := c.FormFile("binary")
+	if err != nil {
+		return formFileError("binary", err)
+	}
+	src, err := header.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to read binary: %v", err))
+	}
+	defer src.Close()
+
+	binary, err := os.CreateTemp("", "pprotein-binary-*")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to create temporary file: %v", err))
+	}
+	defer os.Remove(binary.Name())
+	_, err = io.Copy(binary, src)
+	if closeErr := binary.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to write binary: %v", err))
+	}
+
+	return h.analyzePprof(c, content, binary.Name())
+}
+
+// readFormFile reads the whole multipart form file of the name
+func readFormFile(c echo.Context, name string) ([]byte, error) {
+	header, err := c.FormFile(name)
+	if err != nil {
+		return nil, formFileError(name, err)
+	}
+	f, err := header.Open()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to read %s: %v", name, err))
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to read %s: %v", name, err))
+	}
+	return content, nil
+}
+
+// formFileError returns 413 if parsing the form failed for exceeding the size limit, or 400 for the missing file otherwise
+func formFileError(name string, err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return readError("body", err)
+	}
+	return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s is required: %v", name, err))
+}
+
+// analyzePprof returns a text report by default, or JSON with format=speedscope or format=detailed_json.
+// The text report ranks hotspots by ranking (by_value or by_count), drops runtime frames with hide_runtime=true
+// and adds a table per sample type with all_sample_types=true. Entries below min_percent of the total are omitted from it.
+// The detailed JSON can be restricted to one sample type with sample_type.
+// The detailed JSON is capped with max_samples and max_locations.
+// format=peek returns the direct callers and callees of the functions matching the regex in func.
+// format=goroutines groups the goroutines of a goroutine profile by function and state,
+// marking the blocked groups of at least min_pool goroutines as large.
+// The profile is symbolized with the binary at binaryPath if given.
+func (h *Handler) analyzePprof(c echo.Context, content []byte, binaryPath string) error {
+	switch format := c.QueryParam("format"); format {
+	case "", "text":
+		minPercent := 0.0
+		if v := c.QueryParam("min_percent"); v != "" {
+			var err error
+			if minPercent, err = strconv.ParseFloat(v, 64); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid min_percent: %v", err))
+			}
+		}
+		report, err := pprof.GenerateTextReportWithOptions(content, pprof.Options{
+			BinaryPath:     binaryPath,
+			MinPercent:     minPercent,
+			Ranking:        c.QueryParam("ranking"),
+			HideRuntime:    c.QueryParam("hide_runtime") == "true",
+			AllSampleTypes: c.QueryParam("all_sample_types") == "true",
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to analyze profile: %v", err))
+		}
+		return c.String(http.StatusOK, report)
+	case "speedscope":
+		profileType := c.QueryParam("profile_type")
+		if profileType == "" {
+			profileType = "unknown"
+		}
+		analyze := pprof.Analyze
+		if binaryPath != "" {
+			analyze = func(content []byte, profileType string) (string, error) {
+				return pprof.AnalyzeWithOptions(content, profileType, pprof.Options{BinaryPath: binaryPath})
+			}
+		}
+		result, err := analyze(content, profileType)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to analyze profile: %v", err))
+		}
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, []byte(result))
+	case "detailed_json":
+		opts := pprof.Options{BinaryPath: binaryPath, SampleType: c.QueryParam("sample_type")}
+		for param, dst := range map[string]*int{"max_samples": &opts.MaxSamples, "max_locations": &opts.MaxLocations} {
+			if v := c.QueryParam(param); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 0 {
+					return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid %s: %s", param, v))
+				}
+				*dst = n
+			}
+		}
+		result, err := pprof.ConvertToDetailedJSONWithOptions(content, opts)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to analyze profile: %v", err))
+		}
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, []byte(result))
+	case "peek":
+		funcRegex := c.QueryParam("func")
+		if funcRegex == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "func is required")
+		}
+		result, err := pprof.Peek(content, funcRegex, c.QueryParam("sample_type"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to analyze profile: %v", err))
+		}
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, []byte(result))
+	case "goroutines":
+		opts := pprof.GoroutineOptions{}
+		if v := c.QueryParam("min_pool"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n <= 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid min_pool: %s", v))
+			}
+			opts.MinPool = n
+		}
+		result, err := pprof.AnalyzeGoroutines(content, opts)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to analyze profile: %v", err))
+		}
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, []byte(result))
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unsupported format: %s", format))
+	}
+}
@@ -0,0 +1,344 @@
+package analyze
+
+import (
+	"bytes"
+	"debug/elf"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/google/pprof/profile"
+	"github.com/kaz/pprotein/internal/analyze/config"
+	"github.com/kaz/pprotein/internal/analyze/slowlog"
+	"github.com/labstack/echo/v4"
+)
+
+func newTestServer() *echo.Echo {
+	e := echo.New()
+	NewHandler().RegisterHandlers(e.Group("/api/analyze"))
+	return e
+}
+
+func postFile(e *echo.Echo, path string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAnalyzePprof(t *testing.T) {
+	fn := &profile.Function{ID: 1, Name: "main.handler", Filename: "main.go"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn, Line: 10}}}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Function:   []*profile.Function{fn},
+		Location:   []*profile.Location{loc},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{1000}}},
+	}
+	var buf bytes.Buffer
+	if err := prof.Write(&buf); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+
+	e := newTestServer()
+
+	rec := postFile(e, "/api/analyze/pprof", buf.Bytes())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), "main.handler") {
+		t.Errorf("Text report does not contain the hotspot function:\n%s", rec.Body)
+	}
+
+	rec = postFile(e, "/api/analyze/pprof?format=speedscope&profile_type=cpu", buf.Bytes())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode analysis: %v", err)
+	}
+	if metadata, _ := result["metadata"].(map[string]interface{}); metadata["profileType"] != "cpu" {
+		t.Errorf("Profile type is different from expected. Expected: cpu, Actual: %v", metadata["profileType"])
+	}
+
+	if rec := postFile(e, "/api/analyze/pprof", []byte("not a profile")); rec.Code != http.StatusBadRequest {
+		t.Errorf("Invalid profile should be rejected, but got status %d", rec.Code)
+	}
+}
+
+func TestAnalyzeSlowlog(t *testing.T) {
+	sampleLog := []byte(`# Time: 2023-04-01T12:00:00.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 1.000000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 10000
+SET timestamp=1680350400;
+SELECT * FROM users WHERE id = 1;
+`)
+
+	rec := postFile(newTestServer(), "/api/analyze/slowlog?threshold=0.1", sampleLog)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+	}
+
+	result := &slowlog.AnalysisResult{}
+	if err := json.Unmarshal(rec.Body.Bytes(), result); err != nil {
+		t.Fatalf("Failed to decode analysis: %v", err)
+	}
+	if result.TotalQueries != 1 {
+		t.Errorf("Total query count is different from expected. Expected: 1, Actual: %d", result.TotalQueries)
+	}
+	if len(result.SlowestQueries) != 1 {
+		t.Errorf("Slow query count is different from expected. Expected: 1, Actual: %d", len(result.SlowestQueries))
+	}
+}
+
+func TestAnalyzeSlowlogConfiguredThreshold(t *testing.T) {
+	sampleLog := []byte(`# Time: 2023-04-01T12:00:00.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 0.300000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 10
+SET timestamp=1680350400;
+SELECT * FROM users WHERE id = 1;
+# Time: 2023-04-01T12:00:01.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 1.000000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 10000
+SET timestamp=1680350401;
+SELECT * FROM posts WHERE user_id = 1;
+`)
+	t.Cleanup(func() { config.Set(config.Default()) })
+
+	tests := []struct {
+		name      string
+		threshold float64
+		expected  int
+	}{
+		{name: "Default", threshold: config.Default().SlowlogSeconds, expected: 1},
+		{name: "Lowered", threshold: 0.1, expected: 2},
+		{name: "Raised", threshold: 2, expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thresholds := config.Default()
+			thresholds.SlowlogSeconds = tt.threshold
+			if err := config.Set(thresholds); err != nil {
+				t.Fatalf("Failed to set thresholds: %v", err)
+			}
+
+			rec := postFile(newTestServer(), "/api/analyze/slowlog", sampleLog)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+			}
+
+			result := &slowlog.AnalysisResult{}
+			if err := json.Unmarshal(rec.Body.Bytes(), result); err != nil {
+				t.Fatalf("Failed to decode analysis: %v", err)
+			}
+			if len(result.SlowestQueries) != tt.expected {
+				t.Errorf("Slow query count is different from expected. Expected: %d, Actual: %d", tt.expected, len(result.SlowestQueries))
+			}
+		})
+	}
+}
+
+func TestAnalyzeFilters(t *testing.T) {
+	slowLog := []byte(`# Time: 2023-04-01T12:00:00.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 0.300000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 10
+SET timestamp=1680350400;
+SELECT * FROM users WHERE id = 1;
+# Time: 2023-04-01T12:00:01.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 1.000000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 10000
+SET timestamp=1680350401;
+SELECT * FROM posts WHERE user_id = 1;
+`)
+	httpLog := []byte("time:01/Apr/2023:11:59:00 +0000\tmethod:GET\turi:/api/health\tstatus:200\treqtime:0.001\n" +
+		"time:01/Apr/2023:12:00:10 +0000\tmethod:GET\turi:/api/users\tstatus:200\treqtime:0.300\n")
+
+	tests := []struct {
+		name     string
+		path     string
+		body     []byte
+		status   int
+		expected int // Queries or requests counted
+	}{
+		{name: "Slowlog from", path: "/api/analyze/slowlog?from=2023-04-01T12:00:00.5Z", body: slowLog, status: http.StatusOK, expected: 1},
+		{name: "Slowlog to", path: "/api/analyze/slowlog?to=2023-04-01T12:00:00.5Z", body: slowLog, status: http.StatusOK, expected: 1},
+		{name: "Slowlog exclude", path: "/api/analyze/slowlog?exclude=posts&exclude=%5Ecommit", body: slowLog, status: http.StatusOK, expected: 1},
+		{name: "Httplog time range with layout", path: "/api/analyze/httplog?from=2023-04-01T12:00:00Z&time_layout=02/Jan/2006:15:04:05%20-0700", body: httpLog, status: http.StatusOK, expected: 1},
+		{name: "Malformed from", path: "/api/analyze/slowlog?from=yesterday", body: slowLog, status: http.StatusBadRequest},
+		{name: "Reversed range", path: "/api/analyze/httplog?from=2023-04-01T12:00:00Z&to=2023-04-01T11:00:00Z", body: httpLog, status: http.StatusBadRequest},
+		{name: "Invalid exclude", path: "/api/analyze/slowlog?exclude=%28", body: slowLog, status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postFile(newTestServer(), tt.path, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("Status is different from expected. Expected: %d, Actual: %d, body=%s", tt.status, rec.Code, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var result struct {
+				TotalQueries  int                        `json:"total_queries"`
+				EndpointStats map[string]json.RawMessage `json:"endpoint_stats"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to decode analysis: %v", err)
+			}
+			// The trailing empty line of the httplog is counted as an empty URI
+			delete(result.EndpointStats, "")
+			if counted := result.TotalQueries + len(result.EndpointStats); counted != tt.expected {
+				t.Errorf("Counted entries are different from expected. Expected: %d, Actual: %d, body=%s", tt.expected, counted, rec.Body)
+			}
+		})
+	}
+}
+
+func TestAnalyzeMaxBodySize(t *testing.T) {
+	fn := &profile.Function{ID: 1, Name: "main.handler", Filename: "main.go"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn, Line: 10}}}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Function:   []*profile.Function{fn},
+		Location:   []*profile.Location{loc},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{1000}}},
+	}
+	var buf bytes.Buffer
+	if err := prof.Write(&buf); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+
+	// The symbolized endpoint gets the profile and a binary, which is garbage but rejected only after the body is read
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	for name, content := range map[string][]byte{"profile": buf.Bytes(), "binary": []byte("not a binary")} {
+		w, err := mw.CreateFormFile(name, name)
+		if err != nil {
+			t.Fatalf("Failed to create form file: %v", err)
+		}
+		w.Write(content)
+	}
+	mw.Close()
+
+	tests := []struct {
+		name        string
+		path        string
+		body        []byte
+		contentType string
+		limit       int64
+		expected    int
+	}{
+		{name: "Just under the limit", path: "/api/analyze/pprof", body: buf.Bytes(), limit: int64(buf.Len()), expected: http.StatusOK},
+		{name: "Just over the limit", path: "/api/analyze/pprof", body: buf.Bytes(), limit: int64(buf.Len() - 1), expected: http.StatusRequestEntityTooLarge},
+		{name: "Unlimited", path: "/api/analyze/pprof", body: buf.Bytes(), limit: 0, expected: http.StatusOK},
+		{name: "Form just under the limit", path: "/api/analyze/pprof/symbolized", body: form.Bytes(), contentType: mw.FormDataContentType(), limit: int64(form.Len()), expected: http.StatusBadRequest},
+		{name: "Form just over the limit", path: "/api/analyze/pprof/symbolized", body: form.Bytes(), contentType: mw.FormDataContentType(), limit: int64(form.Len() - 1), expected: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			(&Handler{maxBodySize: tt.limit}).RegisterHandlers(e.Group("/api/analyze"))
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set(echo.HeaderContentType, tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.expected {
+				t.Errorf("Status is different from expected. Expected: %d, Actual: %d, body=%s", tt.expected, rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestAnalyzeUnsupportedType(t *testing.T) {
+	if rec := postFile(newTestServer(), "/api/analyze/memo", []byte("text")); rec.Code != http.StatusBadRequest {
+		t.Errorf("Unsupported type should be rejected, but got status %d", rec.Code)
+	}
+}
+
+//go:noinline
+func symbolizedTarget() {}
+
+func TestAnalyzeSymbolized(t *testing.T) {
+	// The test binary is the locally built binary the profile points into
+	binaryPath, err := os.Executable()
+	if err != nil {
+		t.Fatalf("Failed to get test binary path: %v", err)
+	}
+	f, err := elf.Open(binaryPath)
+	if err != nil {
+		t.Skipf("Test binary is not an ELF file: %v", err)
+	}
+	isPIE := f.Type == elf.ET_DYN
+	f.Close()
+	if isPIE {
+		t.Skip("Test binary is position independent")
+	}
+	binary, err := os.ReadFile(binaryPath)
+	if err != nil {
+		t.Fatalf("Failed to read test binary: %v", err)
+	}
+
+	// A profile collected without symbols has only the addresses of the locations
+	loc := &profile.Location{ID: 1, Address: uint64(reflect.ValueOf(symbolizedTarget).Pointer())}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Location:   []*profile.Location{loc},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{1000}}},
+	}
+	var profileBuf bytes.Buffer
+	if err := prof.Write(&profileBuf); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		files    map[string][]byte
+		query    string
+		expected int
+	}{
+		{name: "Text report", files: map[string][]byte{"profile": profileBuf.Bytes(), "binary": binary}, expected: http.StatusOK},
+		{name: "Detailed JSON", files: map[string][]byte{"profile": profileBuf.Bytes(), "binary": binary}, query: "?format=detailed_json", expected: http.StatusOK},
+		{name: "Missing binary", files: map[string][]byte{"profile": profileBuf.Bytes()}, expected: http.StatusBadRequest},
+		{name: "Not a binary", files: map[string][]byte{"profile": profileBuf.Bytes(), "binary": []byte("not a binary")}, expected: http.StatusBadRequest},
+	}
+
+	e := newTestServer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			for name, content := range tt.files {
+				w, err := mw.CreateFormFile(name, name)
+				if err != nil {
+					t.Fatalf("Failed to create form file: %v", err)
+				}
+				w.Write(content)
+			}
+			mw.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/api/analyze/pprof/symbolized"+tt.query, &body)
+			req.Header.Set(echo.HeaderContentType, mw.FormDataContentType())
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expected {
+				t.Fatalf("Status is different from expected. Expected: %d, Actual: %d, body=%s", tt.expected, rec.Code, rec.Body)
+			}
+			if rec.Code == http.StatusOK && !strings.Contains(rec.Body.String(), ".symbolizedTarget") {
+				t.Errorf("Result is not symbolized:\n%s", rec.Body)
+			}
+		})
+	}
+}
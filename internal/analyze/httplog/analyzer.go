@@ -1,14 +1,21 @@
 package httplog
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/kaz/pprotein/internal/analyze/meta"
+	"github.com/kaz/pprotein/internal/storage"
 	"gopkg.in/yaml.v3"
 )
 
@@ -28,34 +35,86 @@ type EndpointStats struct {
 	AvgTime     float64     // Average processing time
 	MaxTime     float64     // Maximum processing time
 	StatusCodes map[int]int // Status code counts
+
+	reqtimes []float64 // Processing times of the requests having one, for the percentiles
 }
 
+// HistogramBucket is the number of requests whose processing time is within [Min, Max)
+type HistogramBucket = meta.HistogramBucket
+
+// DefaultHistogramBuckets are the upper bounds of the histogram buckets used when none are given
+var DefaultHistogramBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1}
+
 // AlpConfig represents the ALP configuration file structure
 type AlpConfig struct {
 	MatchingGroups []string `yaml:"matching_groups"`
 }
 
-// Analyze parses raw HTTP logs and returns results in JSON format
-func Analyze(logContent []byte, slowThreshold float64) (string, error) {
-	lines := strings.Split(string(logContent), "\n")
+// Layouts tried for the time field when Options.TimeLayout is empty ($time_iso8601 and $time_local of nginx)
+var defaultTimeLayouts = []string{time.RFC3339, "02/Jan/2006:15:04:05 -0700"}
+
+// Options controls the HTTP log analysis
+type Options struct {
+	SlowThreshold float64      // Minimum processing time to be listed as a slow request (seconds)
+	From          time.Time    // Requests before this time are ignored (zero means no lower bound)
+	To            time.Time    // Requests after this time are ignored (zero means no upper bound)
+	TimeLayout    string       // Layout of the time field (defaults to RFC3339 or nginx $time_local)
+	Buckets       []float64    // Upper bounds of the latency histogram buckets in ascending order (DefaultHistogramBuckets if empty)
+	Source        *meta.Source // Where the log was collected from, echoed back in metadata.source if given
+	Config        *AlpConfig   // Matching groups used instead of the stored ALP config if given
+	Format        Format       // Layout of the log lines (tab-separated with the default labels if zero)
+}
 
-	// Get ALP config
-	config, err := loadAlpConfig()
+// Analyze parses raw HTTP logs and returns results in JSON format.
+// It stops and returns ctx.Err() once ctx is done.
+func Analyze(ctx context.Context, logContent []byte, slowThreshold float64) (string, error) {
+	return AnalyzeWithOptions(ctx, logContent, Options{SlowThreshold: slowThreshold})
+}
+
+// AnalyzeWithOptions is like Analyze but allows limiting the analysis to a time range.
+// Gzipped logs are decompressed transparently.
+func AnalyzeWithOptions(ctx context.Context, logContent []byte, opts Options) (string, error) {
+	logContent, err := meta.Decompress(logContent)
 	if err != nil {
-		log.Printf("Failed to load ALP config, using default URI patterns: %v", err)
+		return "", err
+	}
+
+	slowThreshold := opts.SlowThreshold
+	histogram, err := meta.NewHistogram(opts.Buckets, DefaultHistogramBuckets)
+	if err != nil {
+		return "", err
+	}
+	if err := opts.Format.Validate(); err != nil {
+		return "", fmt.Errorf("invalid format: %w", err)
+	}
+	lines := filterByTime(strings.Split(string(logContent), "\n"), opts)
+
+	// Get ALP config
+	config := opts.Config
+	if config == nil {
+		if config, err = loadAlpConfig(); err != nil {
+			log.Printf("Failed to load ALP config, using default URI patterns: %v", err)
+		}
 	}
 
 	// 1. Aggregate by endpoint
-	endpointStats := analyzeLog(lines, config)
+	endpointStats, err := analyzeLog(ctx, lines, opts.Format, config, histogram)
+	if err != nil {
+		return "", err
+	}
 
 	// 2. Extract slow requests (above threshold)
-	slowRequests := extractSlowRequests(lines, slowThreshold)
+	slowRequests := extractSlowRequests(lines, opts.Format, slowThreshold)
 
 	// Return results in JSON format
 	result := map[string]interface{}{
-		"endpoint_stats": endpointStats,
-		"slow_requests":  slowRequests[:min(10, len(slowRequests))], // 10 slowest requests
-		"config_used":    config != nil && len(config.MatchingGroups) > 0,
+		"endpoint_stats":    endpointStats,
+		"slow_requests":     slowRequests[:min(10, len(slowRequests))], // 10 slowest requests
+		"config_used":       config != nil && len(config.MatchingGroups) > 0,
+		"latency_histogram": histogram,
+	}
+	if opts.Source != nil {
+		result["metadata"] = &meta.Metadata{Source: opts.Source}
 	}
 
 	jsonResult, err := json.MarshalIndent(result, "", "  ")
@@ -66,11 +125,109 @@ func Analyze(logContent []byte, slowThreshold float64) (string, error) {
 	return string(jsonResult), nil
 }
 
+// AnalyzeEndpoints parses raw HTTP logs and returns statistics per endpoint.
+// Gzipped logs are decompressed transparently.
+func AnalyzeEndpoints(logContent []byte) (map[string]*EndpointStats, error) {
+	logContent, err := meta.Decompress(logContent)
+	if err != nil {
+		return nil, err
+	}
+	config, err := loadAlpConfig()
+	if err != nil {
+		log.Printf("Failed to load ALP config, using default URI patterns: %v", err)
+	}
+	return analyzeLog(context.Background(), strings.Split(string(logContent), "\n"), Format{}, config, nil)
+}
+
+// Request is a single request of raw HTTP logs with its URI patternized
+type Request struct {
+	Time     time.Time // Request time
+	Endpoint string    // Patternized URI as in the endpoint statistics
+	ReqTime  float64   // Processing time
+}
+
+// Requests parses raw HTTP logs laid out in the format into requests, dropping the lines without a parsable time
+// or processing time. timeLayout is the layout of the time field, which defaults to RFC3339 or nginx $time_local if empty.
+// Gzipped logs are decompressed transparently.
+func Requests(logContent []byte, format Format, timeLayout string) ([]Request, error) {
+	logContent, err := meta.Decompress(logContent)
+	if err != nil {
+		return nil, err
+	}
+	config, err := loadAlpConfig()
+	if err != nil {
+		log.Printf("Failed to load ALP config, using default URI patterns: %v", err)
+	}
+
+	layouts := defaultTimeLayouts
+	if timeLayout != "" {
+		layouts = []string{timeLayout}
+	}
+
+	var requests []Request
+	for _, line := range strings.Split(string(logContent), "\n") {
+		fields := format.split(line)
+		ts, ok := parseTime(format.extract(fields, FieldTime), layouts)
+		if !ok {
+			continue
+		}
+		reqtime, err := strconv.ParseFloat(format.extract(fields, FieldReqTime), 64)
+		if err != nil {
+			continue
+		}
+		requests = append(requests, Request{
+			Time:     ts,
+			Endpoint: patternizeURI(format.extract(fields, FieldURI), config),
+			ReqTime:  reqtime,
+		})
+	}
+	return requests, nil
+}
+
+// Percentile returns the p-th percentile (0-100) of the processing time of all requests in raw HTTP logs
+// laid out in the format. It returns 0 if there are no requests. Gzipped logs are decompressed transparently.
+func Percentile(logContent []byte, format Format, p float64) (float64, error) {
+	logContent, err := meta.Decompress(logContent)
+	if err != nil {
+		return 0, err
+	}
+
+	var reqtimes []float64
+	for _, line := range strings.Split(string(logContent), "\n") {
+		value := format.extract(format.split(line), FieldReqTime)
+		if value == "" {
+			continue
+		}
+		reqtime, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		reqtimes = append(reqtimes, reqtime)
+	}
+	if len(reqtimes) == 0 {
+		return 0, nil
+	}
+	sort.Float64s(reqtimes)
+	return nearestRank(reqtimes, p), nil
+}
+
+// nearestRank returns the p-th percentile (0-100) of the sorted values by the nearest-rank method
+func nearestRank(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
 // loadAlpConfig loads the ALP configuration file
 func loadAlpConfig() (*AlpConfig, error) {
 	// Try to find the ALP config file in different locations
 	configPaths := []string{
-		"data/alp.yml",
+		filepath.Join(storage.DataDir(), "alp.yml"),
 		"internal/extproc/alp/alp.yml",
 		"/home/purplehaze/Projects/pprotein/data/alp.yml",
 		"/home/purplehaze/Projects/pprotein/internal/extproc/alp/alp.yml",
@@ -100,21 +257,63 @@ func loadAlpConfig() (*AlpConfig, error) {
 	return &config, nil
 }
 
+// filterByTime returns the log lines whose time field is within the time range.
+// Lines without a parsable time are dropped only when a range is specified.
+func filterByTime(logLines []string, opts Options) []string {
+	if opts.From.IsZero() && opts.To.IsZero() {
+		return logLines
+	}
+
+	layouts := defaultTimeLayouts
+	if opts.TimeLayout != "" {
+		layouts = []string{opts.TimeLayout}
+	}
+
+	filtered := make([]string, 0, len(logLines))
+	for _, line := range logLines {
+		ts, ok := parseTime(opts.Format.extract(opts.Format.split(line), FieldTime), layouts)
+		if !ok {
+			continue
+		}
+		if !opts.From.IsZero() && ts.Before(opts.From) {
+			continue
+		}
+		if !opts.To.IsZero() && ts.After(opts.To) {
+			continue
+		}
+		filtered = append(filtered, line)
+	}
+	return filtered
+}
+
+// parseTime parses the value with the first matching layout
+func parseTime(value string, layouts []string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range layouts {
+		if ts, err := time.Parse(layout, value); err == nil {
+			return ts, true
+		}
+	}
+	return time.Time{}, false
+}
+
 // extractSlowRequests extracts requests from log lines where processing time exceeds the threshold
-func extractSlowRequests(logLines []string, thresholdSeconds float64) []SlowRequest {
+func extractSlowRequests(logLines []string, format Format, thresholdSeconds float64) []SlowRequest {
 	var slowRequests []SlowRequest
 
 	for _, line := range logLines {
-		fields := strings.Split(line, "\t")
-		reqtime, _ := strconv.ParseFloat(extractField(fields, "reqtime:"), 64)
+		fields := format.split(line)
+		reqtime, _ := strconv.ParseFloat(format.extract(fields, FieldReqTime), 64)
 
 		if reqtime >= thresholdSeconds {
 			slowRequests = append(slowRequests, SlowRequest{
-				Time:    extractField(fields, "time:"),
-				URI:     extractField(fields, "uri:"),
-				Method:  extractField(fields, "method:"),
+				Time:    format.extract(fields, FieldTime),
+				URI:     format.extract(fields, FieldURI),
+				Method:  format.extract(fields, FieldMethod),
 				ReqTime: reqtime,
-				Host:    extractField(fields, "vhost:"),
+				Host:    format.extract(fields, FieldVhost),
 			})
 		}
 	}
@@ -127,16 +326,28 @@ func extractSlowRequests(logLines []string, thresholdSeconds float64) []SlowRequ
 	return slowRequests
 }
 
-// analyzeLog extracts statistics per endpoint from log lines
-func analyzeLog(logLines []string, config *AlpConfig) map[string]*EndpointStats {
+// Number of lines between the checks for cancellation
+const cancelCheckInterval = 1024
+
+// analyzeLog extracts statistics per endpoint from log lines, counting the processing times in the histogram if given.
+// It returns ctx.Err() once ctx is done.
+func analyzeLog(ctx context.Context, logLines []string, format Format, config *AlpConfig, histogram meta.Histogram) (map[string]*EndpointStats, error) {
 	stats := make(map[string]*EndpointStats)
 
-	for _, line := range logLines {
-		fields := strings.Split(line, "\t")
+	for i, line := range logLines {
+		if i%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		fields := format.split(line)
 		// Extract necessary fields
-		uri := extractField(fields, "uri:")
-		reqtime, _ := strconv.ParseFloat(extractField(fields, "reqtime:"), 64)
-		status, _ := strconv.Atoi(extractField(fields, "status:"))
+		uri := format.extract(fields, FieldURI)
+		reqtime, reqtimeErr := strconv.ParseFloat(format.extract(fields, FieldReqTime), 64)
+		if reqtimeErr == nil {
+			histogram.Observe(reqtime)
+		}
+		status, _ := strconv.Atoi(format.extract(fields, FieldStatus))
 
 		// Patternize URI (replace ID with :id or use ALP config)
 		patternURI := patternizeURI(uri, config)
@@ -154,6 +365,9 @@ func analyzeLog(logLines []string, config *AlpConfig) map[string]*EndpointStats
 			s.MaxTime = reqtime
 		}
 		s.StatusCodes[status]++
+		if reqtimeErr == nil {
+			s.reqtimes = append(s.reqtimes, reqtime)
+		}
 	}
 
 	// Calculate average time
@@ -161,7 +375,7 @@ func analyzeLog(logLines []string, config *AlpConfig) map[string]*EndpointStats
 		s.AvgTime = s.TotalTime / float64(s.Count)
 	}
 
-	return stats
+	return stats, nil
 }
 
 // extractField extracts the value of a field that starts with fieldPrefix from log lines
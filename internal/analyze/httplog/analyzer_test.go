@@ -0,0 +1,326 @@
+package httplog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeWithTimeRange(t *testing.T) {
+	logContent := []byte("time:2023-04-01T11:59:00+09:00\tmethod:GET\turi:/api/health\tstatus:200\treqtime:0.001\n" +
+		"time:2023-04-01T12:00:10+09:00\tmethod:GET\turi:/api/users/1\tstatus:200\treqtime:0.300\n" +
+		"time:2023-04-01T12:00:20+09:00\tmethod:POST\turi:/api/users\tstatus:201\treqtime:0.500\n" +
+		"time:2023-04-01T12:05:00+09:00\tmethod:GET\turi:/api/health\tstatus:200\treqtime:0.001\n")
+
+	jst := time.FixedZone("JST", 9*60*60)
+	result, err := AnalyzeWithOptions(context.Background(), logContent, Options{
+		SlowThreshold: 0.1,
+		From:          time.Date(2023, 4, 1, 12, 0, 0, 0, jst),
+		To:            time.Date(2023, 4, 1, 12, 1, 0, 0, jst),
+	})
+	if err != nil {
+		t.Fatalf("Failed to analyze httplog: %v", err)
+	}
+
+	var analysisResult struct {
+		EndpointStats map[string]*EndpointStats `json:"endpoint_stats"`
+		SlowRequests  []SlowRequest             `json:"slow_requests"`
+	}
+	if err := json.Unmarshal([]byte(result), &analysisResult); err != nil {
+		t.Fatalf("Failed to decode JSON result: %v", err)
+	}
+
+	if _, ok := analysisResult.EndpointStats["/api/health"]; ok {
+		t.Errorf("Out-of-range requests were counted: %v", analysisResult.EndpointStats)
+	}
+	if stats, ok := analysisResult.EndpointStats["/api/users/:id"]; !ok || stats.Count != 1 {
+		t.Errorf("In-range request was not counted: %v", analysisResult.EndpointStats)
+	}
+	if len(analysisResult.SlowRequests) != 2 {
+		t.Errorf("Slow request count is different from expected. Expected: 2, Actual: %d", len(analysisResult.SlowRequests))
+	}
+}
+
+func TestAnalyzeWithTimeLayout(t *testing.T) {
+	logContent := []byte("time:01/Apr/2023:11:59:00 +0900\turi:/api/health\tstatus:200\treqtime:0.001\n" +
+		"time:01/Apr/2023:12:00:10 +0900\turi:/api/users/1\tstatus:200\treqtime:0.300\n")
+
+	jst := time.FixedZone("JST", 9*60*60)
+	result, err := AnalyzeWithOptions(context.Background(), logContent, Options{
+		SlowThreshold: 10,
+		From:          time.Date(2023, 4, 1, 12, 0, 0, 0, jst),
+		TimeLayout:    "02/Jan/2006:15:04:05 -0700",
+	})
+	if err != nil {
+		t.Fatalf("Failed to analyze httplog: %v", err)
+	}
+
+	var analysisResult struct {
+		EndpointStats map[string]*EndpointStats `json:"endpoint_stats"`
+	}
+	if err := json.Unmarshal([]byte(result), &analysisResult); err != nil {
+		t.Fatalf("Failed to decode JSON result: %v", err)
+	}
+
+	if len(analysisResult.EndpointStats) != 1 {
+		t.Errorf("Endpoint count is different from expected. Expected: 1, Actual: %d (%v)", len(analysisResult.EndpointStats), analysisResult.EndpointStats)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var logContent []byte
+	for i := 1; i <= 100; i++ {
+		logContent = append(logContent, []byte(fmt.Sprintf("method:GET\turi:/api/users/%d\tstatus:200\treqtime:%d.000\n", i, i))...)
+	}
+
+	tests := []struct {
+		name     string
+		p        float64
+		expected float64
+	}{
+		{name: "p50", p: 50, expected: 50},
+		{name: "p99", p: 99, expected: 99},
+		{name: "p100", p: 100, expected: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual, err := Percentile(logContent, Format{}, tt.p); err != nil || actual != tt.expected {
+				t.Errorf("Percentile is different from expected. Expected: %f, Actual: %f", tt.expected, actual)
+			}
+		})
+	}
+
+	if actual, err := Percentile(nil, Format{}, 99); err != nil || actual != 0 {
+		t.Errorf("Percentile of empty log is different from expected. Expected: 0, Actual: %f", actual)
+	}
+}
+
+func TestAnalyzeLatencyHistogram(t *testing.T) {
+	reqtimes := []string{"0.001", "0.005", "0.020", "0.080", "0.090", "0.300", "2.500"}
+	var logContent []byte
+	for i, reqtime := range reqtimes {
+		logContent = append(logContent, []byte(fmt.Sprintf("method:GET\turi:/api/users/%d\tstatus:200\treqtime:%s\n", i, reqtime))...)
+	}
+
+	tests := []struct {
+		name     string
+		buckets  []float64
+		expected map[string]int
+	}{
+		{
+			name:    "Default buckets",
+			buckets: nil,
+			expected: map[string]int{
+				"<0.01s": 2, "0.01s-0.05s": 1, "0.05s-0.1s": 2, "0.1s-0.5s": 1, "0.5s-1s": 0, "1s+": 1,
+			},
+		},
+		{
+			name:    "Custom buckets",
+			buckets: []float64{0.1, 1},
+			expected: map[string]int{
+				"<0.1s": 5, "0.1s-1s": 1, "1s+": 1,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := AnalyzeWithOptions(context.Background(), logContent, Options{SlowThreshold: 10, Buckets: tt.buckets})
+			if err != nil {
+				t.Fatalf("Failed to analyze httplog: %v", err)
+			}
+
+			var analysisResult struct {
+				LatencyHistogram []HistogramBucket `json:"latency_histogram"`
+			}
+			if err := json.Unmarshal([]byte(result), &analysisResult); err != nil {
+				t.Fatalf("Failed to decode JSON result: %v", err)
+			}
+
+			if len(analysisResult.LatencyHistogram) != len(tt.expected) {
+				t.Fatalf("Bucket count is different from expected. Expected: %d, Actual: %d", len(tt.expected), len(analysisResult.LatencyHistogram))
+			}
+			for _, bucket := range analysisResult.LatencyHistogram {
+				if expected, ok := tt.expected[bucket.Label]; !ok || bucket.Count != expected {
+					t.Errorf("Count of %s is different from expected. Expected: %d, Actual: %d", bucket.Label, expected, bucket.Count)
+				}
+			}
+		})
+	}
+
+	if _, err := AnalyzeWithOptions(context.Background(), logContent, Options{Buckets: []float64{1, 0.5}}); err == nil {
+		t.Errorf("Unordered buckets should be rejected")
+	}
+}
+
+func TestAnalyzeCancel(t *testing.T) {
+	var largeLog strings.Builder
+	for i := 0; i < 500000; i++ {
+		fmt.Fprintf(&largeLog, "method:GET\turi:/api/users/%d\tstatus:200\treqtime:0.100\n", i)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := AnalyzeWithOptions(ctx, []byte(largeLog.String()), Options{Config: &AlpConfig{}}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Analysis is not cancelled. Error: %v", err)
+	}
+}
+
+func TestAnalyzeGzip(t *testing.T) {
+	logContent := []byte("time:2023-04-01T12:00:10+09:00\tmethod:GET\turi:/api/users/1\tstatus:200\treqtime:0.300\n" +
+		"time:2023-04-01T12:00:20+09:00\tmethod:POST\turi:/api/users\tstatus:201\treqtime:0.500\n" +
+		"time:2023-04-01T12:05:00+09:00\tmethod:GET\turi:/api/health\tstatus:200\treqtime:0.001\n")
+
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	if _, err := gw.Write(logContent); err != nil {
+		t.Fatalf("Failed to compress log: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("Failed to compress log: %v", err)
+	}
+
+	opts := Options{SlowThreshold: 0.1, Config: &AlpConfig{MatchingGroups: []string{"^/api/users/[0-9]+$"}}}
+	expected, err := AnalyzeWithOptions(context.Background(), logContent, opts)
+	if err != nil {
+		t.Fatalf("Failed to analyze httplog: %v", err)
+	}
+	actual, err := AnalyzeWithOptions(context.Background(), compressed.Bytes(), opts)
+	if err != nil {
+		t.Fatalf("Failed to analyze gzipped httplog: %v", err)
+	}
+	if actual != expected {
+		t.Errorf("Result of gzipped log is different from expected. Expected: %s, Actual: %s", expected, actual)
+	}
+
+	if _, err := AnalyzeWithOptions(context.Background(), compressed.Bytes()[:10], opts); err == nil {
+		t.Errorf("Truncated gzip should be rejected")
+	}
+
+	// The other entry points read gzipped logs as well
+	expectedRequests, _ := Requests(logContent, Format{}, "")
+	if actualRequests, err := Requests(compressed.Bytes(), Format{}, ""); err != nil || !reflect.DeepEqual(actualRequests, expectedRequests) {
+		t.Errorf("Requests of gzipped log are different from expected. Expected: %v, Actual: %v (%v)", expectedRequests, actualRequests, err)
+	}
+	expectedEndpoints, _ := AnalyzeEndpoints(logContent)
+	if actualEndpoints, err := AnalyzeEndpoints(compressed.Bytes()); err != nil || !reflect.DeepEqual(actualEndpoints, expectedEndpoints) {
+		t.Errorf("Endpoints of gzipped log are different from expected. Expected: %v, Actual: %v (%v)", expectedEndpoints, actualEndpoints, err)
+	}
+	if p99, err := Percentile(compressed.Bytes(), Format{}, 99); err != nil || p99 != 0.5 {
+		t.Errorf("Percentile of gzipped log is different from expected. Expected: 0.5, Actual: %v (%v)", p99, err)
+	}
+}
+
+func TestAnalyzeWithFormat(t *testing.T) {
+	tests := []struct {
+		name       string
+		logContent string
+		format     Format
+	}{
+		{
+			name: "Default",
+			logContent: "method:GET\turi:/api/users/1\tstatus:200\treqtime:0.300\n" +
+				"method:GET\turi:/api/users/2\tstatus:500\treqtime:0.100\n",
+		},
+		{
+			name: "Relabeled",
+			logContent: "method:GET\tpath:/api/users/1\tstatus:200\tduration:0.300\n" +
+				"method:GET\tpath:/api/users/2\tstatus:500\tduration:0.100\n",
+			format: Format{Labels: map[string]string{FieldReqTime: "duration", FieldURI: "path"}},
+		},
+		{
+			name: "Delimiter",
+			logContent: "method:GET|uri:/api/users/1|status:200|duration:0.300\n" +
+				"method:GET|uri:/api/users/2|status:500|duration:0.100\n",
+			format: Format{Delimiter: "|", Labels: map[string]string{FieldReqTime: "duration"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := AnalyzeWithOptions(context.Background(), []byte(tt.logContent), Options{
+				SlowThreshold: 0.2,
+				Config:        &AlpConfig{},
+				Format:        tt.format,
+			})
+			if err != nil {
+				t.Fatalf("Failed to analyze httplog: %v", err)
+			}
+
+			var analysisResult struct {
+				EndpointStats map[string]*EndpointStats `json:"endpoint_stats"`
+				SlowRequests  []SlowRequest             `json:"slow_requests"`
+			}
+			if err := json.Unmarshal([]byte(result), &analysisResult); err != nil {
+				t.Fatalf("Failed to decode JSON result: %v", err)
+			}
+
+			stats, ok := analysisResult.EndpointStats["/api/users/:id"]
+			if !ok {
+				t.Fatalf("Endpoint is not found: %v", analysisResult.EndpointStats)
+			}
+			if stats.Count != 2 || math.Abs(stats.TotalTime-0.4) > 1e-9 || stats.StatusCodes[500] != 1 {
+				t.Errorf("Endpoint stats are different from expected: %+v", stats)
+			}
+			if len(analysisResult.SlowRequests) != 1 || analysisResult.SlowRequests[0].URI != "/api/users/1" {
+				t.Errorf("Slow requests are different from expected: %+v", analysisResult.SlowRequests)
+			}
+		})
+	}
+
+	if _, err := AnalyzeWithOptions(context.Background(), []byte("reqtime:0.1\n"), Options{Format: Format{Labels: map[string]string{"latency": "duration"}}}); err == nil {
+		t.Errorf("Unknown field should be rejected")
+	}
+}
+
+func TestRequestsAndPercentileWithFormat(t *testing.T) {
+	tests := []struct {
+		name       string
+		logContent string
+		format     Format
+	}{
+		{
+			name: "Default",
+			logContent: "time:2023-04-01T12:00:00+09:00\tmethod:GET\turi:/api/users/1\treqtime:0.300\n" +
+				"time:2023-04-01T12:00:01+09:00\tmethod:GET\turi:/api/users/2\treqtime:0.100\n",
+		},
+		{
+			name: "Relabeled",
+			logContent: "ts:2023-04-01T12:00:00+09:00\tmethod:GET\tpath:/api/users/1\tduration:0.300\n" +
+				"ts:2023-04-01T12:00:01+09:00\tmethod:GET\tpath:/api/users/2\tduration:0.100\n",
+			format: Format{Labels: map[string]string{FieldTime: "ts", FieldReqTime: "duration", FieldURI: "path"}},
+		},
+		{
+			name: "Delimiter",
+			logContent: "time:2023-04-01T12:00:00+09:00|method:GET|uri:/api/users/1|duration:0.300\n" +
+				"time:2023-04-01T12:00:01+09:00|method:GET|uri:/api/users/2|duration:0.100\n",
+			format: Format{Delimiter: "|", Labels: map[string]string{FieldReqTime: "duration"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests, err := Requests([]byte(tt.logContent), tt.format, "")
+			if err != nil {
+				t.Fatalf("Failed to parse requests: %v", err)
+			}
+			if len(requests) != 2 || requests[0].ReqTime != 0.3 || requests[0].Endpoint == "" {
+				t.Errorf("Requests are different from expected: %+v", requests)
+			}
+
+			if p100, err := Percentile([]byte(tt.logContent), tt.format, 100); err != nil || p100 != 0.3 {
+				t.Errorf("Percentile is different from expected. Expected: 0.3, Actual: %v (%v)", p100, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package httplog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/kaz/pprotein/internal/analyze/meta"
+)
+
+// Statuses of an endpoint between the compared logs
+const (
+	ComparisonRegressed = "regressed" // Slower on average
+	ComparisonImproved  = "improved"  // Faster on average
+	ComparisonUnchanged = "unchanged"
+	ComparisonAdded     = "added"   // Only in the logs after
+	ComparisonRemoved   = "removed" // Only in the logs before
+)
+
+type (
+	// EndpointLatency is the latency of an endpoint in one side of the comparison
+	EndpointLatency struct {
+		Count   int     `json:"count"`
+		AvgTime float64 `json:"avg_time"` // Average processing time (seconds)
+		P99Time float64 `json:"p99_time"` // 99th percentile of the processing time (seconds)
+	}
+
+	// EndpointComparison is the change of the latency of an endpoint.
+	// The deltas are after minus before, and zero unless the endpoint is in both sides.
+	EndpointComparison struct {
+		Endpoint     string           `json:"endpoint"`
+		Status       string           `json:"status"`
+		Before       *EndpointLatency `json:"before,omitempty"`
+		After        *EndpointLatency `json:"after,omitempty"`
+		CountDelta   int              `json:"count_delta"`
+		AvgTimeDelta float64          `json:"avg_time_delta"`
+		P99TimeDelta float64          `json:"p99_time_delta"`
+	}
+)
+
+// CompareEndpoints compares the latency per endpoint between two sets of raw HTTP logs in the format, e.g. of the hosts of two groups.
+// Endpoints in both are sorted from the one regressed most on average, followed by the ones only in either side.
+// Gzipped logs are decompressed transparently. It stops and returns ctx.Err() once ctx is done.
+func CompareEndpoints(ctx context.Context, before, after [][]byte, format Format) ([]*EndpointComparison, error) {
+	if err := format.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid format: %w", err)
+	}
+	config, err := loadAlpConfig()
+	if err != nil {
+		log.Printf("Failed to load ALP config, using default URI patterns: %v", err)
+	}
+
+	beforeLatencies, err := endpointLatencies(ctx, before, format, config)
+	if err != nil {
+		return nil, err
+	}
+	afterLatencies, err := endpointLatencies(ctx, after, format, config)
+	if err != nil {
+		return nil, err
+	}
+
+	comparisons := []*EndpointComparison{}
+	for endpoint, b := range beforeLatencies {
+		comparison := &EndpointComparison{Endpoint: endpoint, Status: ComparisonRemoved, Before: b}
+		if a, ok := afterLatencies[endpoint]; ok {
+			comparison.After = a
+			comparison.CountDelta = a.Count - b.Count
+			comparison.AvgTimeDelta = a.AvgTime - b.AvgTime
+			comparison.P99TimeDelta = a.P99Time - b.P99Time
+
+			switch {
+			case comparison.AvgTimeDelta > 0:
+				comparison.Status = ComparisonRegressed
+			case comparison.AvgTimeDelta < 0:
+				comparison.Status = ComparisonImproved
+			default:
+				comparison.Status = ComparisonUnchanged
+			}
+		}
+		comparisons = append(comparisons, comparison)
+	}
+	for endpoint, a := range afterLatencies {
+		if _, ok := beforeLatencies[endpoint]; !ok {
+			comparisons = append(comparisons, &EndpointComparison{Endpoint: endpoint, Status: ComparisonAdded, After: a})
+		}
+	}
+
+	sort.Slice(comparisons, func(i, j int) bool {
+		a, b := comparisons[i], comparisons[j]
+		if aBoth, bBoth := a.Before != nil && a.After != nil, b.Before != nil && b.After != nil; aBoth != bBoth {
+			return aBoth
+		}
+		if a.AvgTimeDelta != b.AvgTimeDelta {
+			return a.AvgTimeDelta > b.AvgTimeDelta
+		}
+		if a.P99TimeDelta != b.P99TimeDelta {
+			return a.P99TimeDelta > b.P99TimeDelta
+		}
+		return a.Endpoint < b.Endpoint
+	})
+	return comparisons, nil
+}
+
+// endpointLatencies returns the latency per endpoint of the logs, skipping the lines without a URI or a processing time
+func endpointLatencies(ctx context.Context, logs [][]byte, format Format, config *AlpConfig) (map[string]*EndpointLatency, error) {
+	var lines []string
+	for _, content := range logs {
+		content, err := meta.Decompress(content)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, strings.Split(string(content), "\n")...)
+	}
+
+	stats, err := analyzeLog(ctx, lines, format, config, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	latencies := make(map[string]*EndpointLatency, len(stats))
+	for endpoint, s := range stats {
+		if endpoint == "" || len(s.reqtimes) == 0 {
+			continue
+		}
+		sort.Float64s(s.reqtimes)
+		total := 0.0
+		for _, t := range s.reqtimes {
+			total += t
+		}
+		latencies[endpoint] = &EndpointLatency{
+			Count:   len(s.reqtimes),
+			AvgTime: total / float64(len(s.reqtimes)),
+			P99Time: nearestRank(s.reqtimes, 99),
+		}
+	}
+	return latencies, nil
+}
@@ -0,0 +1,89 @@
+package httplog
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// testLog returns a log with a request to the URI per processing time
+func testLog(uri string, reqtimes ...float64) []byte {
+	var b strings.Builder
+	for _, reqtime := range reqtimes {
+		fmt.Fprintf(&b, "method:GET\turi:%s\tstatus:200\treqtime:%0.3f\n", uri, reqtime)
+	}
+	return []byte(b.String())
+}
+
+func TestCompareEndpoints(t *testing.T) {
+	before := [][]byte{
+		testLog("/api/users/1", 0.1, 0.1, 0.2, 0.2),
+		append(testLog("/api/items", 1.0, 1.0, 3.0), testLog("/api/legacy", 0.5)...),
+	}
+	after := [][]byte{
+		testLog("/api/users/2", 0.3, 0.5, 0.6, 1.0),
+		append(testLog("/api/items", 0.2, 0.2, 0.2, 0.2), testLog("/api/new", 0.1)...),
+	}
+
+	comparisons, err := CompareEndpoints(context.Background(), before, after, Format{})
+	if err != nil {
+		t.Fatalf("Failed to compare endpoints: %v", err)
+	}
+
+	expected := []struct {
+		endpoint string
+		status   string
+		count    int
+		avg      float64
+		p99      float64
+	}{
+		{endpoint: "/api/users/:id", status: ComparisonRegressed, count: 0, avg: 0.45, p99: 0.8},
+		{endpoint: "/api/items", status: ComparisonImproved, count: 1, avg: -1.46666, p99: -2.8},
+		{endpoint: "/api/legacy", status: ComparisonRemoved},
+		{endpoint: "/api/new", status: ComparisonAdded},
+	}
+	if len(comparisons) != len(expected) {
+		t.Fatalf("Endpoints are different from expected. Expected: %d, Actual: %d", len(expected), len(comparisons))
+	}
+	for i, e := range expected {
+		c := comparisons[i]
+		if c.Endpoint != e.endpoint || c.Status != e.status {
+			t.Errorf("Endpoint %d is different from expected. Expected: %s (%s), Actual: %s (%s)", i, e.endpoint, e.status, c.Endpoint, c.Status)
+			continue
+		}
+		if c.CountDelta != e.count || math.Abs(c.AvgTimeDelta-e.avg) > 1e-4 || math.Abs(c.P99TimeDelta-e.p99) > 1e-9 {
+			t.Errorf("Deltas of %s are different from expected. Expected: %d/%v/%v, Actual: %d/%v/%v", e.endpoint, e.count, e.avg, e.p99, c.CountDelta, c.AvgTimeDelta, c.P99TimeDelta)
+		}
+	}
+
+	// Endpoints only in either side have the latency of that side only
+	if c := comparisons[2]; c.Before == nil || c.After != nil || c.Before.Count != 1 {
+		t.Errorf("Removed endpoint is different from expected: %+v", c)
+	}
+	if c := comparisons[3]; c.Before != nil || c.After == nil || c.After.P99Time != 0.1 {
+		t.Errorf("Added endpoint is different from expected: %+v", c)
+	}
+}
+
+func TestCompareEndpointsWithFormat(t *testing.T) {
+	format := Format{Delimiter: ",", Labels: map[string]string{FieldURI: "path", FieldReqTime: "duration"}}
+	before := [][]byte{[]byte("path:/api/items,duration:0.5\npath:/api/items,duration:0.7\n")}
+	after := [][]byte{[]byte("path:/api/items,duration:0.2\n")}
+
+	comparisons, err := CompareEndpoints(context.Background(), before, after, format)
+	if err != nil {
+		t.Fatalf("Failed to compare endpoints: %v", err)
+	}
+	if len(comparisons) != 1 || comparisons[0].Endpoint != "/api/items" || comparisons[0].Status != ComparisonImproved {
+		t.Fatalf("Endpoints are different from expected. Expected: /api/items (improved), Actual: %+v", comparisons)
+	}
+	if c := comparisons[0]; c.Before.Count != 2 || math.Abs(c.AvgTimeDelta+0.4) > 1e-9 {
+		t.Errorf("Comparison is different from expected. Expected: 2 requests before, avg delta -0.4, Actual: %+v", c)
+	}
+
+	if _, err := CompareEndpoints(context.Background(), before, after, Format{Labels: map[string]string{"latency": "duration"}}); err == nil {
+		t.Errorf("Unknown field in the format is accepted")
+	}
+}
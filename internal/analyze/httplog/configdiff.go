@@ -0,0 +1,86 @@
+package httplog
+
+// ConfigDiff is the difference of the matching groups between two ALP configs
+type ConfigDiff struct {
+	Added     []string `json:"added"`     // Patterns only in the new config
+	Removed   []string `json:"removed"`   // Patterns only in the old config
+	Reordered []string `json:"reordered"` // Patterns in both whose precedence relative to the others changed
+}
+
+// DiffConfigs compares the matching groups of two ALP configs.
+// Since the first matching group wins, a common pattern is reported as reordered
+// unless it belongs to the longest sequence of common patterns kept in the same order.
+func DiffConfigs(oldConfig, newConfig *AlpConfig) *ConfigDiff {
+	var oldGroups, newGroups []string
+	if oldConfig != nil {
+		oldGroups = oldConfig.MatchingGroups
+	}
+	if newConfig != nil {
+		newGroups = newConfig.MatchingGroups
+	}
+
+	inOld, inNew := map[string]bool{}, map[string]bool{}
+	for _, p := range oldGroups {
+		inOld[p] = true
+	}
+	for _, p := range newGroups {
+		inNew[p] = true
+	}
+
+	diff := &ConfigDiff{Added: []string{}, Removed: []string{}, Reordered: []string{}}
+	var oldCommon, newCommon []string
+	for _, p := range oldGroups {
+		if inNew[p] {
+			oldCommon = append(oldCommon, p)
+		} else {
+			diff.Removed = append(diff.Removed, p)
+		}
+	}
+	for _, p := range newGroups {
+		if inOld[p] {
+			newCommon = append(newCommon, p)
+		} else {
+			diff.Added = append(diff.Added, p)
+		}
+	}
+
+	kept := longestCommonSubsequence(oldCommon, newCommon)
+	for _, p := range newCommon {
+		if !kept[p] {
+			diff.Reordered = append(diff.Reordered, p)
+		}
+	}
+	return diff
+}
+
+// longestCommonSubsequence returns the elements of a longest common subsequence of a and b
+func longestCommonSubsequence(a, b []string) map[string]bool {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	kept := map[string]bool{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			kept[a[i]] = true
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return kept
+}
@@ -0,0 +1,80 @@
+package httplog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Names of the fields read from raw HTTP logs
+const (
+	FieldTime    = "time"
+	FieldMethod  = "method"
+	FieldURI     = "uri"
+	FieldStatus  = "status"
+	FieldReqTime = "reqtime"
+	FieldVhost   = "vhost"
+)
+
+var fieldNames = []string{FieldTime, FieldMethod, FieldURI, FieldStatus, FieldReqTime, FieldVhost}
+
+// Format tells how the fields are laid out in the lines of raw HTTP logs, which are LTSV as written by alp by default
+type Format struct {
+	Delimiter string            // Separator of the fields ("\t" if empty)
+	Labels    map[string]string // Label in the log for each field name, which is the field name itself if missing (e.g. reqtime: duration)
+}
+
+// Validate checks that only the known fields are relabeled
+func (f Format) Validate() error {
+	for name, label := range f.Labels {
+		if !containsField(name) {
+			return fmt.Errorf("unknown field: %s (expected one of %s)", name, strings.Join(fieldNames, ", "))
+		}
+		if label == "" {
+			return fmt.Errorf("label of %s is empty", name)
+		}
+	}
+	return nil
+}
+
+// split splits a log line into its fields
+func (f Format) split(line string) []string {
+	delimiter := f.Delimiter
+	if delimiter == "" {
+		delimiter = "\t"
+	}
+	return strings.Split(line, delimiter)
+}
+
+// extract returns the value of the named field from the fields of a log line
+func (f Format) extract(fields []string, name string) string {
+	label := name
+	if l, ok := f.Labels[name]; ok {
+		label = l
+	}
+	return extractField(fields, label+":")
+}
+
+// ParseLabels parses comma-separated relabelings of fields like "reqtime=duration,uri=path"
+func ParseLabels(v string) (map[string]string, error) {
+	if v == "" {
+		return nil, nil
+	}
+	labels := map[string]string{}
+	for _, pair := range strings.Split(v, ",") {
+		name, label, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected name=label: %s", pair)
+		}
+		labels[strings.TrimSpace(name)] = strings.TrimSpace(label)
+	}
+	return labels, nil
+}
+
+func containsField(name string) bool {
+	for _, n := range fieldNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
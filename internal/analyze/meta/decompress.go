@@ -0,0 +1,41 @@
+package meta
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/kaz/pprotein/internal/storage"
+)
+
+// maxDecompressedSize caps the decompressed content, as a small gzip can expand to far more than the body size limit.
+// It follows PPROTEIN_MAX_BODY_SIZE, where 0 means unlimited.
+var maxDecompressedSize = storage.MaxBodySizeFromEnv()
+
+// Decompress returns the content as is unless it starts with the gzip magic header, in which case it is decompressed.
+// Multistream gzip, as written by appending .gz files, is read as a whole.
+// Content decompressed to more than PPROTEIN_MAX_BODY_SIZE is rejected with storage.ErrSizeLimitExceeded.
+func Decompress(content []byte) ([]byte, error) {
+	if len(content) < 2 || content[0] != 0x1f || content[1] != 0x8b {
+		return content, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gzip: %w", err)
+	}
+	defer r.Close()
+
+	var src io.Reader = r
+	if maxDecompressedSize > 0 {
+		src = io.LimitReader(r, maxDecompressedSize+1)
+	}
+	decompressed, err := io.ReadAll(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress gzip: %w", err)
+	}
+	if maxDecompressedSize > 0 && int64(len(decompressed)) > maxDecompressedSize {
+		return nil, fmt.Errorf("%w: decompressed content exceeds the limit of %d bytes", storage.ErrSizeLimitExceeded, maxDecompressedSize)
+	}
+	return decompressed, nil
+}
@@ -0,0 +1,44 @@
+package meta
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"testing"
+
+	"github.com/kaz/pprotein/internal/storage"
+)
+
+func TestDecompressMaxSize(t *testing.T) {
+	defer func(orig int64) { maxDecompressedSize = orig }(maxDecompressedSize)
+	maxDecompressedSize = 1024
+
+	gzipped := func(size int) []byte {
+		buf := &bytes.Buffer{}
+		w := gzip.NewWriter(buf)
+		w.Write(bytes.Repeat([]byte("a"), size))
+		w.Close()
+		return buf.Bytes()
+	}
+
+	testCases := []struct {
+		name    string
+		content []byte
+		wantErr bool
+	}{
+		{name: "plain content larger than the limit is left to the body size limit", content: bytes.Repeat([]byte("a"), 2048)},
+		{name: "gzip within the limit", content: gzipped(1024)},
+		{name: "gzip expanding beyond the limit", content: gzipped(1025), wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Decompress(tc.content)
+			if tc.wantErr != errors.Is(err, storage.ErrSizeLimitExceeded) {
+				t.Errorf("Error is different from expected. Expected size limit error: %v, Actual: %v", tc.wantErr, err)
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
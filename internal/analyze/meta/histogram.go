@@ -0,0 +1,50 @@
+package meta
+
+import "fmt"
+
+// HistogramBucket is the number of observations whose duration is within [Min, Max)
+type HistogramBucket struct {
+	Label string  `json:"label"`         // Human-readable range (e.g. "0.5s-1s")
+	Min   float64 `json:"min"`           // Inclusive lower bound (seconds)
+	Max   float64 `json:"max,omitempty"` // Exclusive upper bound (seconds), omitted for the last bucket
+	Count int     `json:"count"`         // Number of observations
+}
+
+// Histogram counts durations in seconds into buckets
+type Histogram []HistogramBucket
+
+// NewHistogram creates the buckets from their upper bounds (defaults if empty), adding the last one without an upper bound
+func NewHistogram(bounds, defaults []float64) (Histogram, error) {
+	if len(bounds) == 0 {
+		bounds = defaults
+	}
+
+	h := make(Histogram, 0, len(bounds)+1)
+	lower := 0.0
+	for i, bound := range bounds {
+		if bound <= lower || (i > 0 && bound <= bounds[i-1]) {
+			return nil, fmt.Errorf("histogram buckets must be positive and in ascending order: %v", bounds)
+		}
+		label := fmt.Sprintf("<%gs", bound)
+		if i > 0 {
+			label = fmt.Sprintf("%gs-%gs", lower, bound)
+		}
+		h = append(h, HistogramBucket{Label: label, Min: lower, Max: bound})
+		lower = bound
+	}
+	return append(h, HistogramBucket{Label: fmt.Sprintf("%gs+", lower), Min: lower}), nil
+}
+
+// Observe counts the duration in its bucket, doing nothing on a nil histogram
+func (h Histogram) Observe(seconds float64) {
+	if len(h) == 0 {
+		return
+	}
+	for i := range h[:len(h)-1] {
+		if seconds < h[i].Max {
+			h[i].Count++
+			return
+		}
+	}
+	h[len(h)-1].Count++
+}
@@ -0,0 +1,47 @@
+package meta
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	tests := []struct {
+		name     string
+		bounds   []float64
+		observed []float64
+		labels   []string
+		counts   []int
+		wantErr  bool
+	}{
+		{name: "Defaults", observed: []float64{0.5, 3}, labels: []string{"<1s", "1s+"}, counts: []int{1, 1}},
+		{name: "Custom bounds", bounds: []float64{0.1, 0.5}, observed: []float64{0.05, 0.1, 0.3, 0.7}, labels: []string{"<0.1s", "0.1s-0.5s", "0.5s+"}, counts: []int{1, 2, 1}},
+		{name: "Not positive", bounds: []float64{0, 1}, wantErr: true},
+		{name: "Not ascending", bounds: []float64{1, 0.5}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewHistogram(tt.bounds, []float64{1})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Error is different from expected. Expected error: %v, Actual: %v", tt.wantErr, err)
+			}
+			for _, seconds := range tt.observed {
+				h.Observe(seconds)
+			}
+
+			var labels []string
+			var counts []int
+			for _, bucket := range h {
+				labels = append(labels, bucket.Label)
+				counts = append(counts, bucket.Count)
+			}
+			if !slices.Equal(labels, tt.labels) || !slices.Equal(counts, tt.counts) {
+				t.Errorf("Buckets are different from expected. Expected: %v %v, Actual: %v %v", tt.labels, tt.counts, labels, counts)
+			}
+		})
+	}
+
+	// Observing on a nil histogram is a no-op
+	var h Histogram
+	h.Observe(1)
+}
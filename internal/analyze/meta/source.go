@@ -0,0 +1,16 @@
+package meta
+
+import "time"
+
+// Source tells which collection the analyzed data came from, so that results can be attributed when compared
+type Source struct {
+	Label    string    `json:"label"`
+	GroupID  string    `json:"group_id"`
+	Duration int       `json:"duration"` // Collection duration in seconds
+	Datetime time.Time `json:"datetime"`
+}
+
+// Metadata is the metadata object of the analysis results, where the source is always found at metadata.source
+type Metadata struct {
+	Source *Source `json:"source,omitempty"`
+}
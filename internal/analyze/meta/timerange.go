@@ -0,0 +1,30 @@
+package meta
+
+import (
+	"fmt"
+	"time"
+)
+
+// ParseTimeRange parses the bounds of the time range of an analysis given as RFC 3339 timestamps.
+// An empty bound is left unbounded (zero time).
+func ParseTimeRange(from, to string) (time.Time, time.Time, error) {
+	var fromTime, toTime time.Time
+	if from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+		}
+		fromTime = t
+	}
+	if to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+		}
+		toTime = t
+	}
+	if !fromTime.IsZero() && !toTime.IsZero() && toTime.Before(fromTime) {
+		return time.Time{}, time.Time{}, fmt.Errorf("to (%s) is before from (%s)", to, from)
+	}
+	return fromTime, toTime, nil
+}
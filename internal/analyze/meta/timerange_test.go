@@ -0,0 +1,33 @@
+package meta
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		wantFrom time.Time
+		wantTo   time.Time
+		wantErr  bool
+	}{
+		{name: "Unbounded"},
+		{name: "Both bounds", from: "2023-04-01T12:00:00Z", to: "2023-04-01T12:01:00Z", wantFrom: time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC), wantTo: time.Date(2023, 4, 1, 12, 1, 0, 0, time.UTC)},
+		{name: "Only from", from: "2023-04-01T12:00:00Z", wantFrom: time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)},
+		{name: "Malformed", from: "2023-04-01 12:00:00", wantErr: true},
+		{name: "Reversed", from: "2023-04-01T12:01:00Z", to: "2023-04-01T12:00:00Z", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, err := ParseTimeRange(tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Error is different from expected. Expected error: %v, Actual: %v", tt.wantErr, err)
+			}
+			if !from.Equal(tt.wantFrom) || !to.Equal(tt.wantTo) {
+				t.Errorf("Time range is different from expected. Expected: %v-%v, Actual: %v-%v", tt.wantFrom, tt.wantTo, from, to)
+			}
+		})
+	}
+}
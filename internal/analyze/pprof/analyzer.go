@@ -1,13 +1,53 @@
 package pprof
 
 import (
+	"cmp"
 	"encoding/json"
 	"fmt"
-	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
 	"strings"
 
 	"github.com/google/pprof/profile"
+	"github.com/kaz/pprotein/internal/analyze/meta"
+)
+
+// Options controls how profiles are analyzed
+type Options struct {
+	// BinaryPath is the path of the profiled binary used to symbolize locations without symbol info
+	BinaryPath string
+	// SampleType is the only sample type kept in the detailed JSON (e.g. "alloc_space"), all types if empty
+	SampleType string
+	// Ranking is how hotspot functions are ranked in the text report, RankByValue if empty
+	Ranking string
+	// MaxSamples caps the samples in the detailed JSON, keeping the highest-value ones (0 means unlimited)
+	MaxSamples int
+	// MaxLocations caps the locations referenced by the samples kept in the detailed JSON (0 means unlimited)
+	MaxLocations int
+	// HideRuntime drops the frames of the Go runtime from the text report like "go tool pprof -hide=runtime\."
+	HideRuntime bool
+	// MinPercent omits hotspot functions and call paths contributing less than this percentage of the total
+	// from the text report, in addition to the cap of 50 entries each (0 means no cutoff)
+	MinPercent float64
+	// AllSampleTypes adds a compact hotspot table for every sample type to the text report,
+	// which otherwise ranks by the first one only
+	AllSampleTypes bool
+	// Source is where the profile was collected from, echoed back in metadata.source of the JSON outputs if given
+	Source *meta.Source
+}
+
+// Frames hidden from the text report with HideRuntime
+var runtimeFramePattern = regexp.MustCompile(`^runtime[./]`)
+
+// Rankings of hotspot functions in the text report
+const (
+	// RankByValue ranks functions by the sum of the first sample value
+	RankByValue = "by_value"
+	// RankByCount ranks functions by the number of samples they appear in,
+	// which is more meaningful for goroutine and block profiles
+	RankByCount = "by_count"
 )
 
 // Analyze parses pprof binary data and returns it in Speedscope JSON format
@@ -16,36 +56,60 @@ func Analyze(pprofData []byte, profileType string) (string, error) {
 	return convertPprofToStructuredJSON(pprofData, profileType)
 }
 
-// Function to convert pprof data into structured JSON for LLM analysis
-func convertPprofToStructuredJSON(pprofData []byte, profileType string) (string, error) {
-	// Create a temporary file and write pprof data
-	tempFile, err := os.CreateTemp("", "pprof-*.pb.gz")
+// AnalyzeWithOptions is like Analyze but symbolizes the profile with the given options first
+func AnalyzeWithOptions(pprofData []byte, profileType string, opts Options) (string, error) {
+	prof, err := parseProfile(pprofData, opts)
 	if err != nil {
-		return "", fmt.Errorf("temporary file creation error: %v", err)
+		return "", err
 	}
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()
 
-	if _, err := tempFile.Write(pprofData); err != nil {
-		return "", fmt.Errorf("temporary file write error: %v", err)
+	structuredJSON, err := generateStructuredJSON(prof, profileType, opts.Source)
+	if err != nil {
+		return "", fmt.Errorf("JSON generation error: %v", err)
 	}
-	tempFile.Close() // Close after writing
+	return structuredJSON, nil
+}
 
-	// Open profile file
-	f, err := os.Open(tempFile.Name())
+// parseProfile parses pprof binary data and symbolizes it if a binary is given.
+// The sample values of sampled heap profiles come out scaled by the sampling rate, so they estimate the whole heap
+// and can be summed as they are: the runtime scales the values of proto heap profiles when writing them,
+// and profile.Parse scales those of the legacy text format (debug=1) when reading them.
+// Profiles are parsed through the cache, so the same data is parsed once for all the outputs.
+// The returned profile is read-only unless symbolized; use parseWritableProfile to modify it.
+func parseProfile(pprofData []byte, opts Options) (*profile.Profile, error) {
+	prof, err := parseCache.parse(pprofData)
 	if err != nil {
-		return "", fmt.Errorf("profile file open error: %v", err)
+		return nil, fmt.Errorf("pprof parsing error: %v", err)
+	}
+
+	if opts.BinaryPath != "" {
+		prof = prof.Copy()
+		if err := symbolize(prof, opts.BinaryPath); err != nil {
+			return nil, fmt.Errorf("symbolization error: %v", err)
+		}
+	}
+	return prof, nil
+}
+
+// parseWritableProfile is like parseProfile but returns a profile the caller may modify
+func parseWritableProfile(pprofData []byte, opts Options) (*profile.Profile, error) {
+	prof, err := parseProfile(pprofData, opts)
+	if err != nil || opts.BinaryPath != "" {
+		// A symbolized profile is a copy already
+		return prof, err
 	}
-	defer f.Close()
+	return prof.Copy(), nil
+}
 
-	// Parse the profile
-	prof, err := profile.Parse(f)
+// Function to convert pprof data into structured JSON for LLM analysis
+func convertPprofToStructuredJSON(pprofData []byte, profileType string) (string, error) {
+	prof, err := parseProfile(pprofData, Options{})
 	if err != nil {
-		return "", fmt.Errorf("pprof parsing error: %v", err)
+		return "", err
 	}
 
 	// Generate structured JSON
-	structuredJSON, err := generateStructuredJSON(prof, profileType)
+	structuredJSON, err := generateStructuredJSON(prof, profileType, nil)
 	if err != nil {
 		return "", fmt.Errorf("JSON generation error: %v", err)
 	}
@@ -53,18 +117,53 @@ func convertPprofToStructuredJSON(pprofData []byte, profileType string) (string,
 	return structuredJSON, nil
 }
 
+// sampleTypeTotals returns the sum and the per-sample average of each sample type keyed by its name.
+// Heap values are already scaled by the sampling rate on parsing, so the sums are estimates of the whole heap.
+func sampleTypeTotals(prof *profile.Profile) (map[string]int64, map[string]float64) {
+	totals := map[string]int64{}
+	averages := map[string]float64{}
+	for i, st := range prof.SampleType {
+		total := int64(0)
+		for _, sample := range prof.Sample {
+			if i < len(sample.Value) {
+				total += sample.Value[i]
+			}
+		}
+		totals[st.Type] = total
+		averages[st.Type] = 0
+		if len(prof.Sample) > 0 {
+			averages[st.Type] = float64(total) / float64(len(prof.Sample))
+		}
+	}
+	return totals, averages
+}
+
 // Generate structured JSON from profile data for LLM analysis
-func generateStructuredJSON(prof *profile.Profile, profileType string) (string, error) {
+func generateStructuredJSON(prof *profile.Profile, profileType string, source *meta.Source) (string, error) {
 	// Prepare result data structure
+	metadata := map[string]interface{}{
+		"profileType": profileType,
+		"timeNanos":   prof.TimeNanos,
+		"duration":    prof.DurationNanos,
+		"period":      prof.Period,
+		"periodType":  "",
+		"periodUnit":  "",
+		// Counts to tell empty or partial profiles
+		"sampleCount":   len(prof.Sample),
+		"locationCount": len(prof.Location),
+		"functionCount": len(prof.Function),
+	}
+	if prof.PeriodType != nil {
+		metadata["periodType"] = prof.PeriodType.Type
+		metadata["periodUnit"] = prof.PeriodType.Unit
+	}
+	metadata["totals"], metadata["averages"] = sampleTypeTotals(prof)
+	// "duration" is taken by the profile, so the collection is nested
+	if source != nil {
+		metadata["source"] = source
+	}
 	result := map[string]interface{}{
-		"metadata": map[string]interface{}{
-			"profileType": profileType,
-			"timeNanos":   prof.TimeNanos,
-			"duration":    prof.DurationNanos,
-			"period":      prof.Period,
-			"periodType":  prof.PeriodType.Type,
-			"periodUnit":  prof.PeriodType.Unit,
-		},
+		"metadata": metadata,
 	}
 
 	// Create function mapping
@@ -79,12 +178,23 @@ func generateStructuredJSON(prof *profile.Profile, profileType string) (string,
 
 	// Structure location information
 	locationMap := make(map[uint64]map[string]interface{})
-	var stackTraces []interface{}
+	// Empty profiles yield empty arrays rather than null
+	stackTraces := []interface{}{}
 
-	for _, loc := range prof.Location {
+	// Locations and samples are sorted so that the same profile always yields the same bytes
+	for _, loc := range sortedLocations(prof.Location) {
 		var callStack []interface{}
 
 		for _, line := range loc.Line {
+			// Lines of stripped or merged profiles can lack the function
+			if line.Function == nil {
+				callStack = append(callStack, map[string]interface{}{
+					"function":     unsymbolizedName(loc),
+					"line":         line.Line,
+					"unsymbolized": true,
+				})
+				continue
+			}
 			if funcData, exists := functionMap[line.Function.ID]; exists {
 				callInfo := map[string]interface{}{
 					"function": funcData["name"],
@@ -95,6 +205,14 @@ func generateStructuredJSON(prof *profile.Profile, profileType string) (string,
 			}
 		}
 
+		// Keep unsymbolized locations identifiable by their address
+		if len(loc.Line) == 0 {
+			callStack = append(callStack, map[string]interface{}{
+				"function":     unsymbolizedName(loc),
+				"unsymbolized": true,
+			})
+		}
+
 		if len(callStack) > 0 {
 			structuredLoc := map[string]interface{}{
 				"id":        loc.ID,
@@ -109,8 +227,8 @@ func generateStructuredJSON(prof *profile.Profile, profileType string) (string,
 	result["stackTraces"] = stackTraces
 
 	// Structure sample information
-	var samples []interface{}
-	for _, sample := range prof.Sample {
+	samples := []interface{}{}
+	for _, sample := range sortedSamples(prof.Sample) {
 		// Collect location IDs corresponding to the sample
 		var locationIDs []uint64
 		for _, loc := range sample.Location {
@@ -142,66 +260,125 @@ func generateStructuredJSON(prof *profile.Profile, profileType string) (string,
 	return string(jsonBytes), nil
 }
 
+// sortedLocations returns a copy of the locations in ascending order of their ID
+func sortedLocations(locations []*profile.Location) []*profile.Location {
+	sorted := slices.Clone(locations)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+	return sorted
+}
+
+// sortedSamples returns a copy of the samples in descending order of their values,
+// breaking ties by the IDs of their locations
+func sortedSamples(samples []*profile.Sample) []*profile.Sample {
+	sorted := slices.Clone(samples)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if c := slices.Compare(sorted[i].Value, sorted[j].Value); c != 0 {
+			return c > 0
+		}
+		return slices.CompareFunc(sorted[i].Location, sorted[j].Location, func(a, b *profile.Location) int {
+			return cmp.Compare(a.ID, b.ID)
+		}) < 0
+	})
+	return sorted
+}
+
 // ConvertToDetailedJSON converts pprof data to a detailed JSON representation
 func ConvertToDetailedJSON(pprofData []byte) (string, error) {
-	// Create a temporary file and write pprof data
-	tempFile, err := os.CreateTemp("", "pprof-*.pb.gz")
+	prof, err := parseProfile(pprofData, Options{})
 	if err != nil {
-		return "", fmt.Errorf("temporary file creation error: %v", err)
+		return "", err
 	}
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()
 
-	if _, err := tempFile.Write(pprofData); err != nil {
-		return "", fmt.Errorf("temporary file write error: %v", err)
-	}
-	tempFile.Close() // Close after writing
+	// Convert to detailed Profile structure
+	detailedProfile := (*DetailedProfile)(prof)
 
-	// Open profile file
-	f, err := os.Open(tempFile.Name())
+	// Marshal to JSON
+	jsonBytes, err := json.MarshalIndent(detailedProfile, "", "  ")
 	if err != nil {
-		return "", fmt.Errorf("profile file open error: %v", err)
+		return "", fmt.Errorf("JSON marshaling error: %v", err)
 	}
-	defer f.Close()
 
-	// Parse the profile
-	prof, err := profile.Parse(f)
+	return string(jsonBytes), nil
+}
+
+// ConvertToDetailedJSONWithOptions is like ConvertToDetailedJSON but can restrict the samples to one sample type
+// and cap the output size. A capped output has a "truncation" field describing what was dropped.
+func ConvertToDetailedJSONWithOptions(pprofData []byte, opts Options) (string, error) {
+	// The profile is filtered and truncated in place
+	prof, err := parseWritableProfile(pprofData, opts)
 	if err != nil {
-		return "", fmt.Errorf("pprof parsing error: %v", err)
+		return "", err
 	}
 
-	// Convert to detailed Profile structure
-	detailedProfile := (*DetailedProfile)(prof)
+	if opts.SampleType != "" {
+		if err := filterSampleType(prof, opts.SampleType); err != nil {
+			return "", err
+		}
+	}
+	truncation := truncateProfile(prof, opts.MaxSamples, opts.MaxLocations)
 
-	// Marshal to JSON
-	jsonBytes, err := json.MarshalIndent(detailedProfile, "", "  ")
+	detailed := (*DetailedProfile)(prof).detailed(truncation)
+	if opts.Source != nil {
+		detailed.Metadata = &meta.Metadata{Source: opts.Source}
+	}
+	jsonBytes, err := json.MarshalIndent(detailed, "", "  ")
 	if err != nil {
 		return "", fmt.Errorf("JSON marshaling error: %v", err)
 	}
-
 	return string(jsonBytes), nil
 }
 
+// filterSampleType drops the values of all sample types but the given one from the profile
+func filterSampleType(prof *profile.Profile, sampleType string) error {
+	index, err := sampleIndex(prof, sampleType)
+	if err != nil {
+		return err
+	}
+
+	prof.SampleType = []*profile.ValueType{prof.SampleType[index]}
+	prof.DefaultSampleType = sampleType
+	for _, sample := range prof.Sample {
+		if index < len(sample.Value) {
+			sample.Value = []int64{sample.Value[index]}
+		} else {
+			sample.Value = []int64{0}
+		}
+	}
+	return nil
+}
+
 // DetailedProfile wraps profile.Profile for detailed JSON marshaling
 type DetailedProfile profile.Profile
 
+// detailedProfileJSON is the JSON representation of DetailedProfile
+type detailedProfileJSON struct {
+	SampleType        []*profile.ValueType `json:"sampleType"`
+	DefaultSampleType string               `json:"defaultSampleType"`
+	Sample            []*DetailedSample    `json:"sample"`
+	Mapping           []*profile.Mapping   `json:"mapping"`
+	Location          []*DetailedLocation  `json:"location"`
+	Function          []*profile.Function  `json:"function"`
+	Comments          []string             `json:"comments"`
+	DropFrames        string               `json:"dropFrames"`
+	KeepFrames        string               `json:"keepFrames"`
+	TimeNanos         int64                `json:"timeNanos"`
+	DurationNanos     int64                `json:"durationNanos"`
+	PeriodType        *profile.ValueType   `json:"periodType"`
+	Period            int64                `json:"period"`
+	Truncation        *Truncation          `json:"truncation,omitempty"`
+	Metadata          *meta.Metadata       `json:"metadata,omitempty"`
+}
+
 // MarshalJSON implements custom JSON marshaling for DetailedProfile
 func (p *DetailedProfile) MarshalJSON() ([]byte, error) {
-	q := struct {
-		SampleType        []*profile.ValueType `json:"sampleType"`
-		DefaultSampleType string               `json:"defaultSampleType"`
-		Sample            []*DetailedSample    `json:"sample"`
-		Mapping           []*profile.Mapping   `json:"mapping"`
-		Location          []*DetailedLocation  `json:"location"`
-		Function          []*profile.Function  `json:"function"`
-		Comments          []string             `json:"comments"`
-		DropFrames        string               `json:"dropFrames"`
-		KeepFrames        string               `json:"keepFrames"`
-		TimeNanos         int64                `json:"timeNanos"`
-		DurationNanos     int64                `json:"durationNanos"`
-		PeriodType        *profile.ValueType   `json:"periodType"`
-		Period            int64                `json:"period"`
-	}{
+	return json.Marshal(p.detailed(nil))
+}
+
+// detailed converts the profile to its JSON representation, noting the truncation if any
+func (p *DetailedProfile) detailed(truncation *Truncation) *detailedProfileJSON {
+	q := &detailedProfileJSON{
 		SampleType:        p.SampleType,
 		DefaultSampleType: p.DefaultSampleType,
 		Sample:            make([]*DetailedSample, len(p.Sample)),
@@ -215,6 +392,7 @@ func (p *DetailedProfile) MarshalJSON() ([]byte, error) {
 		DurationNanos:     p.DurationNanos,
 		PeriodType:        p.PeriodType,
 		Period:            p.Period,
+		Truncation:        truncation,
 	}
 
 	for i, s := range p.Sample {
@@ -225,7 +403,7 @@ func (p *DetailedProfile) MarshalJSON() ([]byte, error) {
 		q.Location[i] = (*DetailedLocation)(l)
 	}
 
-	return json.Marshal(q)
+	return q
 }
 
 // DetailedSample wraps profile.Sample for detailed JSON marshaling
@@ -248,7 +426,9 @@ func (p *DetailedSample) MarshalJSON() ([]byte, error) {
 	}
 
 	for i, l := range p.Location {
-		q.Location[i] = l.ID
+		if l != nil {
+			q.Location[i] = l.ID
+		}
 	}
 
 	return json.Marshal(q)
@@ -257,7 +437,8 @@ func (p *DetailedSample) MarshalJSON() ([]byte, error) {
 // DetailedLocation wraps profile.Location for detailed JSON marshaling
 type DetailedLocation profile.Location
 
-// MarshalJSON implements custom JSON marshaling for DetailedLocation
+// MarshalJSON implements custom JSON marshaling for DetailedLocation.
+// A location without a mapping, as in profiles of interrupted collections, has mapping 0.
 func (p *DetailedLocation) MarshalJSON() ([]byte, error) {
 	q := struct {
 		ID       uint64         `json:"id"`
@@ -267,11 +448,13 @@ func (p *DetailedLocation) MarshalJSON() ([]byte, error) {
 		IsFolded bool           `json:"isFolded"`
 	}{
 		ID:       p.ID,
-		Mapping:  p.Mapping.ID,
 		Address:  p.Address,
 		Line:     make([]DetailedLine, len(p.Line)),
 		IsFolded: p.IsFolded,
 	}
+	if p.Mapping != nil {
+		q.Mapping = p.Mapping.ID
+	}
 
 	for i, l := range p.Line {
 		q.Line[i] = DetailedLine(l)
@@ -283,16 +466,19 @@ func (p *DetailedLocation) MarshalJSON() ([]byte, error) {
 // DetailedLine wraps profile.Line for detailed JSON marshaling
 type DetailedLine profile.Line
 
-// MarshalJSON implements custom JSON marshaling for DetailedLine
+// MarshalJSON implements custom JSON marshaling for DetailedLine.
+// A line without a function has function 0.
 func (p *DetailedLine) MarshalJSON() ([]byte, error) {
 	q := struct {
 		Function uint64 `json:"function"`
 		Line     int64  `json:"line"`
 		Column   int64  `json:"column"`
 	}{
-		Function: p.Function.ID,
-		Line:     p.Line,
-		Column:   p.Column,
+		Line:   p.Line,
+		Column: p.Column,
+	}
+	if p.Function != nil {
+		q.Function = p.Function.ID
 	}
 
 	return json.Marshal(q)
@@ -301,239 +487,135 @@ func (p *DetailedLine) MarshalJSON() ([]byte, error) {
 // GenerateTextReport creates a human-readable text report from pprof data
 // highlighting performance bottlenecks
 func GenerateTextReport(pprofData []byte) (string, error) {
-	// Create a temporary file and write pprof data
-	tempFile, err := os.CreateTemp("", "pprof-*.pb.gz")
+	prof, err := parseProfile(pprofData, Options{})
 	if err != nil {
-		return "", fmt.Errorf("temporary file creation error: %v", err)
-	}
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()
-
-	if _, err := tempFile.Write(pprofData); err != nil {
-		return "", fmt.Errorf("temporary file write error: %v", err)
+		return "", err
 	}
-	tempFile.Close() // Close after writing
 
-	// Open profile file
-	f, err := os.Open(tempFile.Name())
-	if err != nil {
-		return "", fmt.Errorf("profile file open error: %v", err)
-	}
-	defer f.Close()
+	return generateTextReportFromProfile(prof, Options{})
+}
 
-	// Parse the profile
-	prof, err := profile.Parse(f)
+// GenerateTextReportWithOptions is like GenerateTextReport but symbolizes the profile
+// and ranks the hotspot functions with the given options
+func GenerateTextReportWithOptions(pprofData []byte, opts Options) (string, error) {
+	prof, err := parseProfile(pprofData, opts)
 	if err != nil {
-		return "", fmt.Errorf("pprof parsing error: %v", err)
+		return "", err
 	}
-
-	return generateTextReportFromProfile(prof)
+	return generateTextReportFromProfile(prof, opts)
 }
 
-// generateTextReportFromProfile creates a human-readable text report
-// from an already parsed profile
-func generateTextReportFromProfile(prof *profile.Profile) (string, error) {
-	var report strings.Builder
+// frame is a function entry of a call stack shown in the report
+type frame struct {
+	name      string
+	filename  string
+	startLine int64
+	inline    bool
+}
 
-	// 1. Profile Information Summary
-	report.WriteString("===== Profile Information Summary =====\n")
-	if prof.TimeNanos > 0 {
-		fmt.Fprintf(&report, "Measurement Time: %v nanoseconds\n", prof.DurationNanos)
-	}
-	if prof.PeriodType != nil {
-		fmt.Fprintf(&report, "Measurement Unit: %s (%s)\n", prof.PeriodType.Type, prof.PeriodType.Unit)
-	}
-	if len(prof.SampleType) > 0 {
-		report.WriteString("Sample Types: ")
-		for i, st := range prof.SampleType {
-			if i > 0 {
-				report.WriteString(", ")
-			}
-			fmt.Fprintf(&report, "%s (%s)", st.Type, st.Unit)
+// locationFrames returns the frames of a location in caller-to-callee order.
+// Locations without symbol info yield a single frame named by its address.
+func locationFrames(loc *profile.Location) []frame {
+	if len(loc.Line) == 0 {
+		return []frame{{name: unsymbolizedName(loc)}}
+	}
+
+	// Lines are ordered from the innermost inlined callee to the caller,
+	// so walk them backwards to keep the frames in caller-to-callee order
+	frames := make([]frame, 0, len(loc.Line))
+	for j := len(loc.Line) - 1; j >= 0; j-- {
+		line := loc.Line[j]
+
+		f := frame{inline: j < len(loc.Line)-1}
+		if line.Function != nil && line.Function.Name != "" {
+			f.name = line.Function.Name
+			f.filename = line.Function.Filename
+			f.startLine = line.Function.StartLine
+		} else {
+			f.name = unsymbolizedName(loc)
 		}
-		report.WriteString("\n")
+		frames = append(frames, f)
 	}
-	report.WriteString("\n")
-
-	// 2. Hotspot functions (functions consuming the most resources)
-	report.WriteString("===== Top 10 Hotspot Functions =====\n")
-
-	// Calculate cumulative values for each function
-	funcCumulative := make(map[uint64]int64)
-	for _, sample := range prof.Sample {
-		if len(sample.Value) == 0 || len(sample.Location) == 0 {
-			continue
-		}
-
-		// Use the first value (typically CPU time)
-		value := sample.Value[0]
+	return frames
+}
 
-		// Accumulate sample values by function
-		for _, loc := range sample.Location {
-			for _, line := range loc.Line {
-				funcCumulative[line.Function.ID] += value
-			}
-		}
+// unsymbolizedName names a location lacking symbol info by its address and mapped binary
+func unsymbolizedName(loc *profile.Location) string {
+	if loc.Mapping != nil && loc.Mapping.File != "" {
+		return fmt.Sprintf("0x%x (unsymbolized, %s)", loc.Address, filepath.Base(loc.Mapping.File))
 	}
+	return fmt.Sprintf("0x%x (unsymbolized)", loc.Address)
+}
 
-	// Convert function ID and value combinations to a slice
-	type funcValue struct {
-		funcID uint64
-		value  int64
-	}
-	funcValues := make([]funcValue, 0, len(funcCumulative))
-	for id, value := range funcCumulative {
-		funcValues = append(funcValues, funcValue{id, value})
+// generateTextReportFromProfile creates a human-readable text report
+// from an already parsed profile
+func generateTextReportFromProfile(prof *profile.Profile, opts Options) (string, error) {
+	report, err := buildReport(prof, opts)
+	if err != nil {
+		return "", err
 	}
+	return report.text(), nil
+}
 
-	// Sort in descending order by value
-	sort.Slice(funcValues, func(i, j int) bool {
-		return funcValues[i].value > funcValues[j].value
-	})
-
-	// Display top 50 functions
-	count := 0
-	for _, fv := range funcValues {
-		if count >= 50 {
-			break
-		}
-
-		// Get function information
-		var funcName, fileName string
-		var startLine int64
-		for _, fn := range prof.Function {
-			if fn.ID == fv.funcID {
-				funcName = fn.Name
-				fileName = fn.Filename
-				startLine = fn.StartLine
-				break
-			}
-		}
-
-		if funcName != "" {
-			percentOfTotal := 0.0
-			totalValue := int64(0)
-			if len(prof.Sample) > 0 && len(prof.Sample[0].Value) > 0 {
-				for _, sample := range prof.Sample {
-					if len(sample.Value) > 0 {
-						totalValue += sample.Value[0]
-					}
-				}
-				if totalValue > 0 {
-					percentOfTotal = float64(fv.value) / float64(totalValue) * 100
-				}
-			}
-
-			fmt.Fprintf(&report, "%d. %s (%s:%d)\n", count+1, funcName, fileName, startLine)
-			fmt.Fprintf(&report, "   Value: %d (%0.2f%%)\n", fv.value, percentOfTotal)
-			fmt.Fprintf(&report, "\n")
-			count++
-		}
+// formatValue scales a sample value to a human-friendly unit based on the sample unit
+func formatValue(value int64, unit string) string {
+	switch unit {
+	case "nanoseconds":
+		return formatDuration(float64(value))
+	case "microseconds":
+		return formatDuration(float64(value) * 1e3)
+	case "milliseconds":
+		return formatDuration(float64(value) * 1e6)
+	case "seconds":
+		return formatDuration(float64(value) * 1e9)
+	case "bytes":
+		return formatBytes(float64(value))
+	default:
+		return fmt.Sprintf("%d", value)
 	}
+}
 
-	// 3. Important call paths (call stacks)
-	report.WriteString("===== Important Call Paths =====\n")
-
-	// Get call stacks sorted by sample value
-	type sampleInfo struct {
-		value    int64
-		callPath []string
+// formatDuration formats nanoseconds in the largest unit up to seconds
+func formatDuration(ns float64) string {
+	abs := ns
+	if abs < 0 {
+		abs = -abs
 	}
 
-	var samplePaths []sampleInfo
-	for _, sample := range prof.Sample {
-		if len(sample.Value) == 0 || len(sample.Location) == 0 {
-			continue
-		}
-
-		// Use the first value (typically CPU time)
-		value := sample.Value[0]
-
-		// Build call path
-		var callPath []string
-		for i := len(sample.Location) - 1; i >= 0; i-- { // Build path in reverse order
-			loc := sample.Location[i]
-			if len(loc.Line) == 0 {
-				continue
-			}
-
-			// Use the last line (typically the caller)
-			line := loc.Line[len(loc.Line)-1]
-
-			for _, fn := range prof.Function {
-				if fn.ID == line.Function.ID {
-					callPath = append(callPath, fn.Name)
-					break
-				}
-			}
-		}
-
-		if len(callPath) > 0 {
-			samplePaths = append(samplePaths, sampleInfo{value, callPath})
-		}
+	switch {
+	case abs >= 1e9:
+		return trimFloat(ns/1e9) + "s"
+	case abs >= 1e6:
+		return trimFloat(ns/1e6) + "ms"
+	case abs >= 1e3:
+		return trimFloat(ns/1e3) + "us"
+	default:
+		return trimFloat(ns) + "ns"
 	}
+}
 
-	// Sort in descending order by value
-	sort.Slice(samplePaths, func(i, j int) bool {
-		return samplePaths[i].value > samplePaths[j].value
-	})
-
-	// Display top 50 call paths
-	for i, sp := range samplePaths {
-		if i >= 50 {
-			break
-		}
-
-		// Calculate ratio to total
-		totalValue := int64(0)
-		for _, sample := range prof.Sample {
-			if len(sample.Value) > 0 {
-				totalValue += sample.Value[0]
-			}
-		}
-		percentOfTotal := 0.0
-		if totalValue > 0 {
-			percentOfTotal = float64(sp.value) / float64(totalValue) * 100
-		}
-
-		fmt.Fprintf(&report, "Path %d - Value: %d (%0.2f%%)\n", i+1, sp.value, percentOfTotal)
-
-		// Display call path
-		for j, funcName := range sp.callPath {
-			indentation := strings.Repeat("  ", j)
-			fmt.Fprintf(&report, "%s-> %s\n", indentation, funcName)
-		}
-		fmt.Fprintf(&report, "\n")
+// formatBytes formats bytes in the largest binary unit up to GB
+func formatBytes(b float64) string {
+	abs := b
+	if abs < 0 {
+		abs = -abs
 	}
 
-	// 4. Resource usage distribution
-	if len(prof.SampleType) > 0 {
-		report.WriteString("===== Resource Usage Distribution =====\n")
-		for i, sampleType := range prof.SampleType {
-			if i >= len(prof.Sample[0].Value) {
-				continue
-			}
-
-			fmt.Fprintf(&report, "Measurement: %s (%s)\n", sampleType.Type, sampleType.Unit)
-
-			// Calculate total values
-			totalValue := int64(0)
-			for _, sample := range prof.Sample {
-				if i < len(sample.Value) {
-					totalValue += sample.Value[i]
-				}
-			}
-
-			fmt.Fprintf(&report, "Total: %d %s\n\n", totalValue, sampleType.Unit)
-		}
+	switch {
+	case abs >= 1<<30:
+		return trimFloat(b/(1<<30)) + "GB"
+	case abs >= 1<<20:
+		return trimFloat(b/(1<<20)) + "MB"
+	case abs >= 1<<10:
+		return trimFloat(b/(1<<10)) + "KB"
+	default:
+		return trimFloat(b) + "B"
 	}
+}
 
-	// 5. Profiling hints
-	report.WriteString("===== Bottleneck Analysis Hints =====\n")
-	report.WriteString("1. Focus on top functions (especially those consuming more than 10% of total resources)\n")
-	report.WriteString("2. Deep call paths may indicate excessive recursion or library calls\n")
-	report.WriteString("3. Consider optimizing functions that appear in multiple call paths\n")
-	report.WriteString("4. Consider algorithm improvements, caching, and parallel processing for optimization\n")
-
-	return report.String(), nil
+// trimFloat formats a float with up to 2 decimal places, dropping trailing zeros
+func trimFloat(f float64) string {
+	s := fmt.Sprintf("%.2f", f)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
 }
@@ -1,15 +1,23 @@
 package pprof
 
 import (
+	"bytes"
+	"debug/elf"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/pprof/profile"
+	"github.com/kaz/pprotein/internal/analyze/config"
+	"github.com/kaz/pprotein/internal/analyze/meta"
 )
 
 func TestAnalyze(t *testing.T) {
@@ -468,7 +476,7 @@ func TestGenerateTextReport(t *testing.T) {
 	prof := createSampleProfile()
 
 	// Generate text report directly
-	textReport, err := generateTextReportFromProfile(prof)
+	textReport, err := generateTextReportFromProfile(prof, Options{})
 	if err != nil {
 		t.Fatalf("Failed to generate text report: %v", err)
 	}
@@ -621,6 +629,93 @@ func TestDetailedJsonFromProfile(t *testing.T) {
 	}
 }
 
+func TestDetailedJSONWithoutMapping(t *testing.T) {
+	// Profiles of interrupted collections can lack mappings
+	prof := createSampleProfile()
+	prof.Mapping = nil
+	for _, loc := range prof.Location {
+		loc.Mapping = nil
+	}
+
+	jsonBytes, err := json.Marshal((*DetailedProfile)(prof))
+	if err != nil {
+		t.Fatalf("Failed to marshal to JSON: %v", err)
+	}
+
+	var detailed struct {
+		Location []struct {
+			ID      uint64 `json:"id"`
+			Mapping uint64 `json:"mapping"`
+		} `json:"location"`
+	}
+	if err := json.Unmarshal(jsonBytes, &detailed); err != nil {
+		t.Fatalf("Invalid JSON output: %v", err)
+	}
+
+	if len(detailed.Location) != len(prof.Location) {
+		t.Fatalf("Location count is different from expected. Expected: %d, Actual: %d", len(prof.Location), len(detailed.Location))
+	}
+	for _, loc := range detailed.Location {
+		if loc.Mapping != 0 {
+			t.Errorf("Mapping of location %d is different from expected. Expected: 0, Actual: %d", loc.ID, loc.Mapping)
+		}
+	}
+}
+
+func TestJSONWithoutLineFunction(t *testing.T) {
+	// Lines of stripped or merged profiles can lack the function
+	prof := createSampleProfile()
+	prof.Location[0].Line = []profile.Line{{Function: nil, Line: 42}}
+
+	t.Run("Detailed JSON", func(t *testing.T) {
+		jsonBytes, err := json.Marshal((*DetailedProfile)(prof))
+		if err != nil {
+			t.Fatalf("Failed to marshal to JSON: %v", err)
+		}
+
+		var detailed struct {
+			Location []struct {
+				Line []struct {
+					Function uint64 `json:"function"`
+					Line     int64  `json:"line"`
+				} `json:"line"`
+			} `json:"location"`
+		}
+		if err := json.Unmarshal(jsonBytes, &detailed); err != nil {
+			t.Fatalf("Invalid JSON output: %v", err)
+		}
+		if line := detailed.Location[0].Line[0]; line.Function != 0 || line.Line != 42 {
+			t.Errorf("Line is different from expected. Expected: function 0 at line 42, Actual: %+v", line)
+		}
+	})
+
+	t.Run("Structured JSON", func(t *testing.T) {
+		structured, err := generateStructuredJSON(prof, "cpu", nil)
+		if err != nil {
+			t.Fatalf("Failed to generate structured JSON: %v", err)
+		}
+
+		var result struct {
+			StackTraces []struct {
+				ID        uint64 `json:"id"`
+				CallStack []struct {
+					Function     string `json:"function"`
+					Unsymbolized bool   `json:"unsymbolized"`
+				} `json:"callStack"`
+			} `json:"stackTraces"`
+		}
+		if err := json.Unmarshal([]byte(structured), &result); err != nil {
+			t.Fatalf("Invalid JSON output: %v", err)
+		}
+		if len(result.StackTraces) != len(prof.Location) {
+			t.Fatalf("Stack trace count is different from expected. Expected: %d, Actual: %d", len(prof.Location), len(result.StackTraces))
+		}
+		if frame := result.StackTraces[0].CallStack[0]; !frame.Unsymbolized {
+			t.Errorf("Frame without a function is not marked as unsymbolized: %+v", frame)
+		}
+	})
+}
+
 // TestTextReportFromRealProfile tests generating a text report from a real CPU profile
 func TestTextReportFromRealProfile(t *testing.T) {
 	// Prepare test profile.pb.gz file
@@ -735,3 +830,879 @@ func TestMCPHandlerTextReport(t *testing.T) {
 	previewLength := min(500, len(textReport))
 	t.Logf("Text report preview:\n%s...", textReport[:previewLength])
 }
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value int64
+		unit  string
+		want  string
+	}{
+		{name: "Nanoseconds in seconds", value: 10000000000, unit: "nanoseconds", want: "10s"},
+		{name: "Nanoseconds in milliseconds", value: 1500000, unit: "nanoseconds", want: "1.5ms"},
+		{name: "Small nanoseconds", value: 500, unit: "nanoseconds", want: "500ns"},
+		{name: "Microseconds in seconds", value: 2500000, unit: "microseconds", want: "2.5s"},
+		{name: "Bytes in megabytes", value: 3 << 20, unit: "bytes", want: "3MB"},
+		{name: "Bytes in kilobytes", value: 1536, unit: "bytes", want: "1.5KB"},
+		{name: "Count is not scaled", value: 12345, unit: "count", want: "12345"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatValue(tt.value, tt.unit); got != tt.want {
+				t.Errorf("formatValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResourceUsageIsScaledByUnit(t *testing.T) {
+	prof := createSampleProfile()
+	prof.Sample[0].Value = []int64{6000000000}
+	prof.Sample[1].Value = []int64{3000000000}
+	prof.Sample[2].Value = []int64{1000000000}
+
+	textReport, err := generateTextReportFromProfile(prof, Options{})
+	if err != nil {
+		t.Fatalf("Failed to generate text report: %v", err)
+	}
+
+	expected := "Total: 10s (10000000000 nanoseconds)"
+	if !strings.Contains(textReport, expected) {
+		t.Errorf("Report does not contain %q:\n%s", expected, textReport)
+	}
+}
+
+func TestTextReportWithoutSamples(t *testing.T) {
+	prof := createSampleProfile()
+	prof.Sample = nil
+
+	textReport, err := generateTextReportFromProfile(prof, Options{})
+	if err != nil {
+		t.Fatalf("Failed to generate text report: %v", err)
+	}
+
+	if !strings.Contains(textReport, "Total: 0ns (0 nanoseconds)") {
+		t.Errorf("Report does not contain the zero total:\n%s", textReport)
+	}
+}
+
+func TestCallPathsIncludeInlinedFrames(t *testing.T) {
+	prof := createSampleProfile()
+
+	// main.smallHelper is inlined into main.processData at the leaf location
+	fnInlined := &profile.Function{ID: 4, Name: "main.smallHelper", Filename: "main.go", StartLine: 10}
+	prof.Function = append(prof.Function, fnInlined)
+
+	loc := &profile.Location{ID: 4, Mapping: prof.Mapping[0], Address: 0x1600}
+	loc.Line = []profile.Line{
+		{Function: fnInlined, Line: 12},
+		{Function: prof.Function[2], Line: 110},
+	}
+	prof.Location = append(prof.Location, loc)
+	prof.Sample = []*profile.Sample{{
+		Location: []*profile.Location{loc, prof.Location[1]},
+		Value:    []int64{9000000},
+	}}
+
+	textReport, err := generateTextReportFromProfile(prof, Options{})
+	if err != nil {
+		t.Fatalf("Failed to generate text report: %v", err)
+	}
+
+	expected := "-> runtime.schedule\n  -> main.processData\n    -> main.smallHelper (inline)\n"
+	if !strings.Contains(textReport, expected) {
+		t.Errorf("Call path does not contain the inlined frame %q:\n%s", expected, textReport)
+	}
+}
+
+func TestUnsymbolizedFramesAreMarkedByAddress(t *testing.T) {
+	prof := createSampleProfile()
+
+	// A location collected from a stripped binary has no line entries
+	loc := &profile.Location{ID: 4, Mapping: prof.Mapping[0], Address: 0x4a2f10}
+	prof.Location = append(prof.Location, loc)
+	prof.Sample = []*profile.Sample{{
+		Location: []*profile.Location{loc, prof.Location[1]},
+		Value:    []int64{9000000},
+	}}
+
+	textReport, err := generateTextReportFromProfile(prof, Options{})
+	if err != nil {
+		t.Fatalf("Failed to generate text report: %v", err)
+	}
+
+	expected := "-> runtime.schedule\n  -> 0x4a2f10 (unsymbolized, test_binary)\n"
+	if !strings.Contains(textReport, expected) {
+		t.Errorf("Call path does not contain the unsymbolized frame %q:\n%s", expected, textReport)
+	}
+	if !strings.Contains(textReport, ". 0x4a2f10 (unsymbolized, test_binary)\n") {
+		t.Errorf("Hotspots do not contain the unsymbolized frame:\n%s", textReport)
+	}
+}
+
+func symbolizeTarget() {}
+
+func TestSymbolize(t *testing.T) {
+	binaryPath, err := os.Executable()
+	if err != nil {
+		t.Fatalf("Failed to get test binary path: %v", err)
+	}
+	f, err := elf.Open(binaryPath)
+	if err != nil {
+		t.Skipf("Test binary is not an ELF file: %v", err)
+	}
+	isPIE := f.Type == elf.ET_DYN
+	f.Close()
+	if isPIE {
+		t.Skip("Test binary is position independent")
+	}
+
+	pc := reflect.ValueOf(symbolizeTarget).Pointer()
+	loc := &profile.Location{ID: 1, Address: uint64(pc)}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}},
+		Location:   []*profile.Location{loc},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{1}}},
+	}
+
+	if err := symbolize(prof, binaryPath); err != nil {
+		t.Fatalf("Failed to symbolize profile: %v", err)
+	}
+
+	if len(loc.Line) != 1 {
+		t.Fatalf("Location is not symbolized: %+v", loc)
+	}
+	if name := loc.Line[0].Function.Name; !strings.HasSuffix(name, ".symbolizeTarget") {
+		t.Errorf("Symbolized function is different from expected. Expected: *.symbolizeTarget, Actual: %s", name)
+	}
+}
+
+func TestDetailedJSONSampleTypeFilter(t *testing.T) {
+	prof := createSampleProfile()
+	prof.SampleType = []*profile.ValueType{
+		{Type: "alloc_objects", Unit: "count"},
+		{Type: "alloc_space", Unit: "bytes"},
+		{Type: "inuse_objects", Unit: "count"},
+		{Type: "inuse_space", Unit: "bytes"},
+	}
+	for i, sample := range prof.Sample {
+		sample.Value = []int64{int64(i + 1), int64(i+1) * 1024, 1, 512}
+	}
+	var buf strings.Builder
+	if err := prof.Write(&buf); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		sampleType string
+		wantLen    int
+	}{
+		{name: "Full dump by default", sampleType: "", wantLen: 4},
+		{name: "Filtered to alloc_space", sampleType: "alloc_space", wantLen: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ConvertToDetailedJSONWithOptions([]byte(buf.String()), Options{SampleType: tt.sampleType})
+			if err != nil {
+				t.Fatalf("Failed to convert profile: %v", err)
+			}
+
+			var detailed struct {
+				SampleType []*profile.ValueType `json:"sampleType"`
+				Sample     []struct {
+					Value []int64 `json:"value"`
+				} `json:"sample"`
+			}
+			if err := json.Unmarshal([]byte(result), &detailed); err != nil {
+				t.Fatalf("Failed to decode JSON: %v", err)
+			}
+
+			if len(detailed.SampleType) != tt.wantLen {
+				t.Errorf("Sample type count is different from expected. Expected: %d, Actual: %d", tt.wantLen, len(detailed.SampleType))
+			}
+			for i, sample := range detailed.Sample {
+				if len(sample.Value) != tt.wantLen {
+					t.Errorf("Value count of sample %d is different from expected. Expected: %d, Actual: %d", i, tt.wantLen, len(sample.Value))
+				}
+			}
+			if tt.sampleType == "alloc_space" && detailed.Sample[1].Value[0] != 2048 {
+				t.Errorf("Kept value is different from expected. Expected: 2048, Actual: %d", detailed.Sample[1].Value[0])
+			}
+		})
+	}
+
+	if _, err := ConvertToDetailedJSONWithOptions([]byte(buf.String()), Options{SampleType: "cpu"}); err == nil {
+		t.Errorf("Unknown sample type should be rejected")
+	}
+}
+
+func TestDetailedJSONTruncation(t *testing.T) {
+	fn := &profile.Function{ID: 1, Name: "main.work"}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Mapping:    []*profile.Mapping{{ID: 1, File: "main"}},
+		Function:   []*profile.Function{fn},
+	}
+	for i := 1; i <= 100; i++ {
+		loc := &profile.Location{ID: uint64(i), Mapping: prof.Mapping[0], Address: uint64(0x1000 + i), Line: []profile.Line{{Function: fn}}}
+		prof.Location = append(prof.Location, loc)
+		prof.Sample = append(prof.Sample, &profile.Sample{Location: []*profile.Location{loc}, Value: []int64{int64(i)}})
+	}
+	var buf strings.Builder
+	if err := prof.Write(&buf); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		opts          Options
+		wantSamples   int
+		wantTruncated bool
+	}{
+		{name: "Unlimited by default", opts: Options{}, wantSamples: 100, wantTruncated: false},
+		{name: "Capped by samples", opts: Options{MaxSamples: 10}, wantSamples: 10, wantTruncated: true},
+		{name: "Capped by locations", opts: Options{MaxLocations: 5}, wantSamples: 5, wantTruncated: true},
+		{name: "Within the caps", opts: Options{MaxSamples: 100, MaxLocations: 100}, wantSamples: 100, wantTruncated: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ConvertToDetailedJSONWithOptions([]byte(buf.String()), tt.opts)
+			if err != nil {
+				t.Fatalf("Failed to convert profile: %v", err)
+			}
+
+			var detailed struct {
+				Sample []struct {
+					Value []int64 `json:"value"`
+				} `json:"sample"`
+				Location   []json.RawMessage `json:"location"`
+				Truncation *Truncation       `json:"truncation"`
+			}
+			if err := json.Unmarshal([]byte(result), &detailed); err != nil {
+				t.Fatalf("Failed to decode JSON: %v", err)
+			}
+
+			if len(detailed.Sample) != tt.wantSamples {
+				t.Errorf("Sample count is different from expected. Expected: %d, Actual: %d", tt.wantSamples, len(detailed.Sample))
+			}
+			if len(detailed.Location) != tt.wantSamples {
+				t.Errorf("Location count is different from expected. Expected: %d, Actual: %d", tt.wantSamples, len(detailed.Location))
+			}
+			if (detailed.Truncation != nil) != tt.wantTruncated {
+				t.Fatalf("Truncation flag is different from expected. Expected: %v, Actual: %v", tt.wantTruncated, detailed.Truncation)
+			}
+			if !tt.wantTruncated {
+				return
+			}
+
+			if detailed.Truncation.TotalSamples != 100 || detailed.Truncation.Samples != tt.wantSamples || detailed.Truncation.Note == "" {
+				t.Errorf("Truncation is different from expected. Actual: %+v", detailed.Truncation)
+			}
+			// The highest-value samples are kept
+			for _, sample := range detailed.Sample {
+				if sample.Value[0] <= int64(100-tt.wantSamples) {
+					t.Errorf("Low-value sample is kept: %d", sample.Value[0])
+				}
+			}
+		})
+	}
+}
+
+func TestHotspotRankingByCount(t *testing.T) {
+	rare := &profile.Function{ID: 1, Name: "main.rareButExpensive"}
+	common := &profile.Function{ID: 2, Name: "main.commonButCheap"}
+	rareLoc := &profile.Location{ID: 1, Line: []profile.Line{{Function: rare}}}
+	commonLoc := &profile.Location{ID: 2, Line: []profile.Line{{Function: common}}}
+
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "delay", Unit: "nanoseconds"}},
+		Function:   []*profile.Function{rare, common},
+		Location:   []*profile.Location{rareLoc, commonLoc},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{rareLoc}, Value: []int64{1000}}},
+	}
+	for i := 0; i < 5; i++ {
+		prof.Sample = append(prof.Sample, &profile.Sample{Location: []*profile.Location{commonLoc}, Value: []int64{1}})
+	}
+
+	tests := []struct {
+		name     string
+		ranking  string
+		expected string
+	}{
+		{name: "By value", ranking: RankByValue, expected: "1. main.rareButExpensive\n"},
+		{name: "Default", ranking: "", expected: "1. main.rareButExpensive\n"},
+		{name: "By count", ranking: RankByCount, expected: "1. main.commonButCheap\n   Samples: 5 (83.33%)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			textReport, err := generateTextReportFromProfile(prof, Options{Ranking: tt.ranking})
+			if err != nil {
+				t.Fatalf("Failed to generate text report: %v", err)
+			}
+			if !strings.Contains(textReport, tt.expected) {
+				t.Errorf("Report does not contain %q:\n%s", tt.expected, textReport)
+			}
+		})
+	}
+
+	if _, err := generateTextReportFromProfile(prof, Options{Ranking: "by_magic"}); err == nil {
+		t.Errorf("Unknown ranking is accepted")
+	}
+}
+
+func TestBottleneckHints(t *testing.T) {
+	t.Cleanup(func() { config.Set(config.Default()) })
+
+	// main.handler has the largest cumulative value, but the time is spent in main.encode
+	handler := &profile.Function{ID: 1, Name: "main.handler"}
+	encode := &profile.Function{ID: 2, Name: "main.encode"}
+	logFn := &profile.Function{ID: 3, Name: "main.log"}
+	handlerLoc := &profile.Location{ID: 1, Line: []profile.Line{{Function: handler}}}
+	encodeLoc := &profile.Location{ID: 2, Line: []profile.Line{{Function: encode}}}
+	logLoc := &profile.Location{ID: 3, Line: []profile.Line{{Function: logFn}}}
+
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Function:   []*profile.Function{handler, encode, logFn},
+		Location:   []*profile.Location{handlerLoc, encodeLoc, logLoc},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{encodeLoc, handlerLoc}, Value: []int64{90}},
+			{Location: []*profile.Location{logLoc, handlerLoc}, Value: []int64{5}},
+			{Location: []*profile.Location{handlerLoc}, Value: []int64{5}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		thresholds config.Thresholds
+		expected   []string
+		unexpected []string
+	}{
+		{
+			name:       "Default",
+			thresholds: config.Default(),
+			expected:   []string{"1. main.encode spends 90.00% of the total by itself, over the 10% threshold"},
+			unexpected: []string{"main.handler spends", "main.log spends", "Call paths reach"},
+		},
+		{
+			name:       "Low thresholds",
+			thresholds: config.Thresholds{HotspotPercent: 4, CallPathDepth: 1},
+			expected: []string{
+				"1. main.encode spends 90.00%",
+				"2. main.handler spends 5.00%",
+				"3. main.log spends 5.00%",
+				"4. Call paths reach 2 frames (over the threshold of 1), e.g. down to main.encode",
+			},
+		},
+		{
+			name:       "No hotspot",
+			thresholds: config.Thresholds{HotspotPercent: 95, CallPathDepth: 40},
+			expected:   []string{"1. No function spends more than 95% of the total by itself"},
+			unexpected: []string{"main.encode spends"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := config.Set(tt.thresholds); err != nil {
+				t.Fatalf("Failed to set thresholds: %v", err)
+			}
+			textReport, err := generateTextReportFromProfile(prof, Options{})
+			if err != nil {
+				t.Fatalf("Failed to generate text report: %v", err)
+			}
+			_, hints, _ := strings.Cut(textReport, "===== Bottleneck Analysis Hints =====")
+			for _, expected := range tt.expected {
+				if !strings.Contains(hints, expected) {
+					t.Errorf("Hints do not contain %q:\n%s", expected, hints)
+				}
+			}
+			for _, unexpected := range tt.unexpected {
+				if strings.Contains(hints, unexpected) {
+					t.Errorf("Hints contain %q:\n%s", unexpected, hints)
+				}
+			}
+		})
+	}
+}
+
+func TestGCHeavyHint(t *testing.T) {
+	t.Cleanup(func() { config.Set(config.Default()) })
+
+	handler := &profile.Function{ID: 1, Name: "main.handler"}
+	mallocgc := &profile.Function{ID: 2, Name: "runtime.mallocgc"}
+	markWorker := &profile.Function{ID: 3, Name: "runtime.gcBgMarkWorker"}
+	scan := &profile.Function{ID: 4, Name: "runtime.scanobject"}
+	handlerLoc := &profile.Location{ID: 1, Line: []profile.Line{{Function: handler}}}
+	mallocgcLoc := &profile.Location{ID: 2, Line: []profile.Line{{Function: mallocgc}}}
+	markWorkerLoc := &profile.Location{ID: 3, Line: []profile.Line{{Function: markWorker}}}
+	scanLoc := &profile.Location{ID: 4, Line: []profile.Line{{Function: scan}}}
+
+	// newProfile returns a profile spending gc of the 100 samples in allocation and background marking
+	newProfile := func(sampleType string, gc int64) *profile.Profile {
+		return &profile.Profile{
+			SampleType: []*profile.ValueType{{Type: sampleType, Unit: "count"}},
+			Function:   []*profile.Function{handler, mallocgc, markWorker, scan},
+			Location:   []*profile.Location{handlerLoc, mallocgcLoc, markWorkerLoc, scanLoc},
+			Sample: []*profile.Sample{
+				{Location: []*profile.Location{mallocgcLoc, handlerLoc}, Value: []int64{gc / 2}},
+				{Location: []*profile.Location{scanLoc, markWorkerLoc}, Value: []int64{gc - gc/2}},
+				{Location: []*profile.Location{handlerLoc}, Value: []int64{100 - gc}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		prof     *profile.Profile
+		opts     Options
+		expected float64
+		hint     bool
+	}{
+		{name: "GC dominates", prof: newProfile("cpu", 70), expected: 70, hint: true},
+		{name: "GC dominates with runtime hidden", prof: newProfile("cpu", 70), opts: Options{HideRuntime: true}, expected: 70, hint: true},
+		{name: "GC under the threshold", prof: newProfile("cpu", 20), expected: 20},
+		{name: "Not a CPU profile", prof: newProfile("alloc_objects", 70), expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := buildReport(tt.prof, tt.opts)
+			if err != nil {
+				t.Fatalf("Failed to build report: %v", err)
+			}
+			if report.GCPercent != tt.expected {
+				t.Errorf("GC percent is different from expected. Expected: %v, Actual: %v", tt.expected, report.GCPercent)
+			}
+
+			hint := slices.ContainsFunc(report.Hints, func(h string) bool {
+				return strings.HasPrefix(h, "High GC overhead: ") && strings.Contains(h, "reduce allocations")
+			})
+			if hint != tt.hint {
+				t.Errorf("GC hint is different from expected. Expected: %v, Actual: %v, hints=%v", tt.hint, hint, report.Hints)
+			}
+		})
+	}
+}
+
+func TestHeapSampleScaling(t *testing.T) {
+	// Legacy text heap profile as served by /debug/pprof/heap?debug=1, sampled every 512KiB on average
+	const sampled = `heap profile: 3: 3072 [6: 12288] @ heap/1048576
+1: 1024 [2: 2048] @ 0x1001 0x2001
+2: 2048 [4: 10240] @ 0x1001 0x3001
+`
+	// scale estimates the number of allocations of avgSize bytes behind the sampled ones
+	scale := func(avgSize float64) float64 {
+		return 1 / (1 - math.Exp(-avgSize/524288))
+	}
+
+	tests := []struct {
+		name     string
+		data     string
+		expected map[string]int64
+	}{
+		{
+			name: "Sampled",
+			data: sampled,
+			expected: map[string]int64{
+				"inuse_objects": int64(1*scale(1024)) + int64(2*scale(1024)),
+				"inuse_space":   int64(1024*scale(1024)) + int64(2048*scale(1024)),
+				"alloc_objects": int64(2*scale(1024)) + int64(4*scale(2560)),
+				"alloc_space":   int64(2048*scale(1024)) + int64(10240*scale(2560)),
+			},
+		},
+		{
+			name: "Every allocation recorded",
+			data: strings.Replace(sampled, "heap/1048576", "heap_v2/1", 1),
+			expected: map[string]int64{
+				"inuse_objects": 3,
+				"inuse_space":   3072,
+				"alloc_objects": 6,
+				"alloc_space":   12288,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prof, err := parseProfile([]byte(tt.data), Options{})
+			if err != nil {
+				t.Fatalf("Failed to parse profile: %v", err)
+			}
+			totals, _ := sampleTypeTotals(prof)
+			if !reflect.DeepEqual(totals, tt.expected) {
+				t.Errorf("Totals are different from expected. Expected: %v, Actual: %v", tt.expected, totals)
+			}
+
+			report, err := GenerateReport([]byte(tt.data), Options{})
+			if err != nil {
+				t.Fatalf("Failed to generate report: %v", err)
+			}
+			for _, resource := range report.Resources {
+				if resource.Total != tt.expected[resource.Type] {
+					t.Errorf("Total of %s in the report is different from expected. Expected: %d, Actual: %d", resource.Type, tt.expected[resource.Type], resource.Total)
+				}
+			}
+		})
+	}
+}
+
+func TestTextReportHideRuntime(t *testing.T) {
+	prof := createSampleProfile()
+
+	textReport, err := generateTextReportFromProfile(prof, Options{})
+	if err != nil {
+		t.Fatalf("Failed to generate text report: %v", err)
+	}
+	if !strings.Contains(textReport, "runtime.schedule") {
+		t.Fatalf("Report does not contain runtime.schedule without HideRuntime:\n%s", textReport)
+	}
+
+	textReport, err = generateTextReportFromProfile(prof, Options{HideRuntime: true})
+	if err != nil {
+		t.Fatalf("Failed to generate text report: %v", err)
+	}
+	if strings.Contains(textReport, "runtime.schedule") {
+		t.Errorf("Report contains runtime.schedule with HideRuntime:\n%s", textReport)
+	}
+	if !strings.Contains(textReport, "1. main.heavyFunction") {
+		t.Errorf("Report does not contain the application hotspot:\n%s", textReport)
+	}
+}
+
+func TestTextReportAllSampleTypes(t *testing.T) {
+	prof := createSampleProfile()
+	prof.SampleType = []*profile.ValueType{
+		{Type: "alloc_objects", Unit: "count"},
+		{Type: "alloc_space", Unit: "bytes"},
+		{Type: "inuse_objects", Unit: "count"},
+		{Type: "inuse_space", Unit: "bytes"},
+	}
+	for i, sample := range prof.Sample {
+		sample.Value = []int64{int64(i + 1), int64(i+1) * 1024, 1, 512}
+	}
+
+	tests := []struct {
+		name         string
+		opts         Options
+		wantSections bool
+	}{
+		{name: "Single type by default", opts: Options{}, wantSections: false},
+		{name: "Section per type", opts: Options{AllSampleTypes: true}, wantSections: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			textReport, err := generateTextReportFromProfile(prof, tt.opts)
+			if err != nil {
+				t.Fatalf("Failed to generate text report: %v", err)
+			}
+
+			if strings.Contains(textReport, "===== Hotspot Functions per Sample Type =====") != tt.wantSections {
+				t.Fatalf("Presence of the per-type hotspots is different from expected. Expected: %v\n%s", tt.wantSections, textReport)
+			}
+			if !tt.wantSections {
+				return
+			}
+			for _, st := range prof.SampleType {
+				header := fmt.Sprintf("--- %s (%s), Total: ", st.Type, st.Unit)
+				if !strings.Contains(textReport, header) {
+					t.Errorf("Report does not contain the section of %s:\n%s", st.Type, textReport)
+				}
+			}
+			if !strings.Contains(textReport, "--- alloc_space (bytes), Total: 6KB ---") {
+				t.Errorf("Total of alloc_space is different from expected:\n%s", textReport)
+			}
+		})
+	}
+}
+
+func TestTextReportMinPercent(t *testing.T) {
+	// Hotspots are 80%, 70% and 30% (main.processData), and call paths are 50%, 30% and 20% of the total
+	prof := createSampleProfile()
+
+	tests := []struct {
+		name       string
+		minPercent float64
+		present    []string
+		absent     []string
+	}{
+		{
+			name:       "No cutoff by default",
+			minPercent: 0,
+			present:    []string{"main.processData", "Path 1 ", "Path 2 ", "Path 3 "},
+		},
+		{
+			name:       "Entries below the cutoff are omitted",
+			minPercent: 35,
+			present:    []string{"1. main.heavyFunction", "2. runtime.schedule", "Path 1 "},
+			absent:     []string{"main.processData", "Path 2 ", "Path 3 "},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			textReport, err := generateTextReportFromProfile(prof, Options{MinPercent: tt.minPercent})
+			if err != nil {
+				t.Fatalf("Failed to generate text report: %v", err)
+			}
+			for _, s := range tt.present {
+				if !strings.Contains(textReport, s) {
+					t.Errorf("Report does not contain %q:\n%s", s, textReport)
+				}
+			}
+			for _, s := range tt.absent {
+				if strings.Contains(textReport, s) {
+					t.Errorf("Report contains %q below the cutoff:\n%s", s, textReport)
+				}
+			}
+		})
+	}
+}
+
+func TestStructuredJSONCounts(t *testing.T) {
+	tests := []struct {
+		name string
+		prof *profile.Profile
+	}{
+		{name: "Sample profile", prof: createSampleProfile()},
+		{name: "Empty profile", prof: &profile.Profile{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			structured, err := generateStructuredJSON(tt.prof, "cpu", nil)
+			if err != nil {
+				t.Fatalf("Failed to generate structured JSON: %v", err)
+			}
+
+			var result struct {
+				Metadata struct {
+					SampleCount   int `json:"sampleCount"`
+					LocationCount int `json:"locationCount"`
+					FunctionCount int `json:"functionCount"`
+				} `json:"metadata"`
+				Samples []interface{} `json:"samples"`
+			}
+			if err := json.Unmarshal([]byte(structured), &result); err != nil {
+				t.Fatalf("Invalid JSON output: %v", err)
+			}
+
+			counts := map[string][2]int{
+				"sampleCount":   {len(tt.prof.Sample), result.Metadata.SampleCount},
+				"locationCount": {len(tt.prof.Location), result.Metadata.LocationCount},
+				"functionCount": {len(tt.prof.Function), result.Metadata.FunctionCount},
+			}
+			for key, c := range counts {
+				if c[0] != c[1] {
+					t.Errorf("%s is different from expected. Expected: %d, Actual: %d", key, c[0], c[1])
+				}
+			}
+			if result.Samples == nil {
+				t.Errorf("samples is not an array")
+			}
+		})
+	}
+}
+
+func TestStructuredJSONTotals(t *testing.T) {
+	// Heap profile with two sample types on top of the sample profile
+	heap := createSampleProfile()
+	heap.SampleType = []*profile.ValueType{{Type: "alloc_objects", Unit: "count"}, {Type: "alloc_space", Unit: "bytes"}}
+	for i, sample := range heap.Sample {
+		sample.Value = []int64{int64(i + 1), int64(1024 * (i + 1))}
+	}
+
+	tests := []struct {
+		name     string
+		prof     *profile.Profile
+		totals   map[string]int64
+		averages map[string]float64
+	}{
+		{
+			name:     "CPU profile",
+			prof:     createSampleProfile(),
+			totals:   map[string]int64{"cpu": 10000000},
+			averages: map[string]float64{"cpu": 10000000.0 / 3},
+		},
+		{
+			name:     "Heap profile",
+			prof:     heap,
+			totals:   map[string]int64{"alloc_objects": 6, "alloc_space": 6144},
+			averages: map[string]float64{"alloc_objects": 2, "alloc_space": 2048},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			structured, err := generateStructuredJSON(tt.prof, "heap", nil)
+			if err != nil {
+				t.Fatalf("Failed to generate structured JSON: %v", err)
+			}
+
+			var result struct {
+				Metadata struct {
+					Totals   map[string]int64   `json:"totals"`
+					Averages map[string]float64 `json:"averages"`
+				} `json:"metadata"`
+			}
+			if err := json.Unmarshal([]byte(structured), &result); err != nil {
+				t.Fatalf("Invalid JSON output: %v", err)
+			}
+
+			if !reflect.DeepEqual(result.Metadata.Totals, tt.totals) {
+				t.Errorf("Totals are different from expected. Expected: %v, Actual: %v", tt.totals, result.Metadata.Totals)
+			}
+			for typ, expected := range tt.averages {
+				if math.Abs(result.Metadata.Averages[typ]-expected) > 1e-6 {
+					t.Errorf("Average of %s is different from expected. Expected: %f, Actual: %f", typ, expected, result.Metadata.Averages[typ])
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyzeWithSource(t *testing.T) {
+	var buf strings.Builder
+	if err := createSampleProfile().Write(&buf); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+	opts := Options{Source: &meta.Source{
+		Label:    "app1",
+		GroupID:  "2023-04-01_12-00-00",
+		Duration: 30,
+		Datetime: time.Date(2023, 4, 1, 12, 0, 30, 0, time.UTC),
+	}}
+
+	structured, err := AnalyzeWithOptions([]byte(buf.String()), "cpu", opts)
+	if err != nil {
+		t.Fatalf("Failed to analyze profile: %v", err)
+	}
+	detailed, err := ConvertToDetailedJSONWithOptions([]byte(buf.String()), opts)
+	if err != nil {
+		t.Fatalf("Failed to convert profile: %v", err)
+	}
+
+	var structuredResult struct {
+		Metadata struct {
+			Source *meta.Source `json:"source"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal([]byte(structured), &structuredResult); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	var detailedResult struct {
+		Metadata struct {
+			Source *meta.Source `json:"source"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal([]byte(detailed), &detailedResult); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		source *meta.Source
+	}{
+		{name: "Structured JSON", source: structuredResult.Metadata.Source},
+		{name: "Detailed JSON", source: detailedResult.Metadata.Source},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.source == nil {
+				t.Fatalf("Source is missing from the metadata")
+			}
+			if !reflect.DeepEqual(tt.source, opts.Source) {
+				t.Errorf("Source is different from expected. Expected: %+v, Actual: %+v", opts.Source, tt.source)
+			}
+		})
+	}
+}
+
+func TestStructuredJSONDeterministic(t *testing.T) {
+	newProfile := func(reversed bool) *profile.Profile {
+		fns := []*profile.Function{{ID: 1, Name: "main.a"}, {ID: 2, Name: "main.b"}, {ID: 3, Name: "main.c"}}
+		locs := []*profile.Location{
+			{ID: 1, Line: []profile.Line{{Function: fns[0], Line: 10}}},
+			{ID: 2, Line: []profile.Line{{Function: fns[1], Line: 20}}},
+			{ID: 3, Line: []profile.Line{{Function: fns[2], Line: 30}}},
+		}
+		samples := []*profile.Sample{
+			{Location: []*profile.Location{locs[0]}, Value: []int64{10}, Label: map[string][]string{"handler": {"a"}}},
+			{Location: []*profile.Location{locs[1], locs[0]}, Value: []int64{30}},
+			{Location: []*profile.Location{locs[2], locs[0]}, Value: []int64{30}},
+			{Location: []*profile.Location{locs[2]}, Value: []int64{20}},
+		}
+		if reversed {
+			slices.Reverse(locs)
+			slices.Reverse(samples)
+		}
+		return &profile.Profile{
+			SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+			Function:   fns,
+			Location:   locs,
+			Sample:     samples,
+		}
+	}
+
+	first, err := generateStructuredJSON(newProfile(false), "cpu", nil)
+	if err != nil {
+		t.Fatalf("Failed to generate structured JSON: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		again, err := generateStructuredJSON(newProfile(i%2 == 1), "cpu", nil)
+		if err != nil {
+			t.Fatalf("Failed to generate structured JSON: %v", err)
+		}
+		if again != first {
+			t.Fatalf("Output differs between runs.\nFirst: %s\nAgain: %s", first, again)
+		}
+	}
+
+	var result struct {
+		StackTraces []struct {
+			ID uint64 `json:"id"`
+		} `json:"stackTraces"`
+		Samples []struct {
+			LocationIDs []uint64 `json:"locationIDs"`
+			Values      []int64  `json:"values"`
+		} `json:"samples"`
+	}
+	if err := json.Unmarshal([]byte(first), &result); err != nil {
+		t.Fatalf("Invalid JSON output: %v", err)
+	}
+	for i, st := range result.StackTraces {
+		if st.ID != uint64(i+1) {
+			t.Errorf("Stack trace %d is different from expected. Expected ID: %d, Actual: %d", i, i+1, st.ID)
+		}
+	}
+	expected := [][]uint64{{2, 1}, {3, 1}, {3}, {1}}
+	for i, sample := range result.Samples {
+		if !slices.Equal(sample.LocationIDs, expected[i]) {
+			t.Errorf("Sample %d is different from expected. Expected: %v, Actual: %v", i, expected[i], sample.LocationIDs)
+		}
+	}
+
+	// The whole analysis of the serialized profile is stable as well
+	var buf bytes.Buffer
+	if err := newProfile(true).Write(&buf); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+	a, err := Analyze(buf.Bytes(), "cpu")
+	if err != nil {
+		t.Fatalf("Failed to analyze profile: %v", err)
+	}
+	b, err := Analyze(buf.Bytes(), "cpu")
+	if err != nil {
+		t.Fatalf("Failed to analyze profile: %v", err)
+	}
+	if a != b {
+		t.Errorf("Analysis differs between runs")
+	}
+}
@@ -0,0 +1,225 @@
+package pprof
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+type (
+	// annotatedLine is the cost of a source line of an annotated function
+	annotatedLine struct {
+		flat int64
+		cum  int64
+	}
+
+	// annotatedFunction is a function matched by Annotate with the cost of its lines
+	annotatedFunction struct {
+		name      string
+		filename  string
+		startLine int64
+		flat      int64
+		cum       int64
+		lines     map[int64]*annotatedLine
+	}
+)
+
+// Annotate lists the source of the functions matching funcRegex with the sampled cost of each line,
+// like "go tool pprof -list". sourcePath is the source file, or a directory the file names in the profile are
+// resolved in. Only the sampled line numbers are listed when the source isn't available.
+func Annotate(pprofData []byte, funcRegex, sourcePath string) (string, error) {
+	re, err := regexp.Compile(funcRegex)
+	if err != nil {
+		return "", fmt.Errorf("invalid function regex: %v", err)
+	}
+
+	prof, err := parseProfile(pprofData, Options{})
+	if err != nil {
+		return "", err
+	}
+	if len(prof.SampleType) == 0 {
+		return "", fmt.Errorf("profile has no sample types")
+	}
+
+	functions := annotate(prof, re)
+	if len(functions) == 0 {
+		return "", fmt.Errorf("no function matches %s", funcRegex)
+	}
+
+	total := int64(0)
+	for _, sample := range prof.Sample {
+		if len(sample.Value) > 0 {
+			total += sample.Value[0]
+		}
+	}
+	unit := prof.SampleType[0].Unit
+
+	var report strings.Builder
+	for _, fn := range functions {
+		writeAnnotatedFunction(&report, fn, sourcePath, total, unit)
+	}
+	return report.String(), nil
+}
+
+// annotate sums the cost of the lines of the matched functions, in descending order of the cumulative cost.
+// Each line and function counts once per sample, even when it recurses.
+func annotate(prof *profile.Profile, re *regexp.Regexp) []*annotatedFunction {
+	functions := map[string]*annotatedFunction{}
+
+	for _, sample := range prof.Sample {
+		if len(sample.Value) == 0 {
+			continue
+		}
+		value := sample.Value[0]
+
+		seenFunctions := map[string]bool{}
+		seenLines := map[string]map[int64]bool{}
+		for i, loc := range sample.Location {
+			if loc == nil {
+				continue
+			}
+			// Lines are ordered from the innermost inlined callee, so the first line of the first location is the leaf
+			for j, line := range loc.Line {
+				if line.Function == nil || !re.MatchString(line.Function.Name) {
+					continue
+				}
+				name := line.Function.Name
+
+				fn, ok := functions[name]
+				if !ok {
+					fn = &annotatedFunction{
+						name:      name,
+						filename:  line.Function.Filename,
+						startLine: line.Function.StartLine,
+						lines:     map[int64]*annotatedLine{},
+					}
+					functions[name] = fn
+				}
+				l, ok := fn.lines[line.Line]
+				if !ok {
+					l = &annotatedLine{}
+					fn.lines[line.Line] = l
+				}
+
+				if i == 0 && j == 0 {
+					fn.flat += value
+					l.flat += value
+				}
+				if !seenFunctions[name] {
+					seenFunctions[name] = true
+					seenLines[name] = map[int64]bool{}
+					fn.cum += value
+				}
+				if !seenLines[name][line.Line] {
+					seenLines[name][line.Line] = true
+					l.cum += value
+				}
+			}
+		}
+	}
+
+	result := make([]*annotatedFunction, 0, len(functions))
+	for _, fn := range functions {
+		result = append(result, fn)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].cum != result[j].cum {
+			return result[i].cum > result[j].cum
+		}
+		return result[i].name < result[j].name
+	})
+	return result
+}
+
+// writeAnnotatedFunction writes the listing of a function, falling back to the sampled line numbers without the source
+func writeAnnotatedFunction(report *strings.Builder, fn *annotatedFunction, sourcePath string, total int64, unit string) {
+	percent := 0.0
+	if total != 0 {
+		percent = float64(fn.cum) / float64(total) * 100
+	}
+	fmt.Fprintf(report, "ROUTINE ======================== %s in %s\n", fn.name, fn.filename)
+	fmt.Fprintf(report, "%10s %10s (flat, cum) %.2f%% of Total\n", formatValue(fn.flat, unit), formatValue(fn.cum, unit), percent)
+
+	lineNumbers := make([]int64, 0, len(fn.lines))
+	for n := range fn.lines {
+		lineNumbers = append(lineNumbers, n)
+	}
+	sort.Slice(lineNumbers, func(i, j int) bool { return lineNumbers[i] < lineNumbers[j] })
+
+	cost := func(n int64) (string, string) {
+		l, ok := fn.lines[n]
+		if !ok {
+			return ".", "."
+		}
+		flat, cum := ".", formatValue(l.cum, unit)
+		if l.flat != 0 {
+			flat = formatValue(l.flat, unit)
+		}
+		return flat, cum
+	}
+
+	source, err := readSource(sourcePath, fn.filename)
+	if err != nil {
+		fmt.Fprintf(report, "  (source not available: %v)\n", err)
+		for _, n := range lineNumbers {
+			flat, cum := cost(n)
+			fmt.Fprintf(report, "%10s %10s %6d\n", flat, cum, n)
+		}
+		report.WriteString("\n")
+		return
+	}
+
+	// List from the start of the function to the last sampled line
+	first, last := fn.startLine, lineNumbers[len(lineNumbers)-1]
+	if first <= 0 || first > lineNumbers[0] {
+		first = lineNumbers[0]
+	}
+	for n := first; n <= last; n++ {
+		text := ""
+		if n >= 1 && int(n) <= len(source) {
+			text = source[n-1]
+		}
+		flat, cum := cost(n)
+		fmt.Fprintf(report, "%10s %10s %6d: %s\n", flat, cum, n, text)
+	}
+	report.WriteString("\n")
+}
+
+// readSource reads the lines of the source file of filename.
+// If sourcePath is a directory, filename and its trailing path components are looked up in it.
+func readSource(sourcePath, filename string) ([]string, error) {
+	if sourcePath == "" {
+		return nil, fmt.Errorf("no source path given")
+	}
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+
+	path := sourcePath
+	if info.IsDir() {
+		path = ""
+		parts := strings.Split(filepath.ToSlash(filename), "/")
+		for i := range parts {
+			candidate := filepath.Join(sourcePath, filepath.Join(parts[i:]...))
+			if fi, err := os.Stat(candidate); err == nil && !fi.IsDir() {
+				path = candidate
+				break
+			}
+		}
+		if path == "" {
+			return nil, fmt.Errorf("%s is not found in %s", filename, sourcePath)
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimRight(string(content), "\n"), "\n"), nil
+}
@@ -0,0 +1,100 @@
+package pprof
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+func TestAnnotate(t *testing.T) {
+	source := "package main\n\nfunc handler() {\n\ta := load()\n\tb := compute(a)\n\tsave(b)\n}\n"
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "app"), 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "app", "main.go"), []byte(source), 0644); err != nil {
+		t.Fatalf("Failed to write source: %v", err)
+	}
+
+	handler := &profile.Function{ID: 1, Name: "main.handler", Filename: "/build/app/main.go", StartLine: 3}
+	compute := &profile.Function{ID: 2, Name: "main.compute", Filename: "/build/app/compute.go", StartLine: 1}
+	line4 := &profile.Location{ID: 1, Line: []profile.Line{{Function: handler, Line: 4}}}
+	line5 := &profile.Location{ID: 2, Line: []profile.Line{{Function: handler, Line: 5}}}
+	inCompute := &profile.Location{ID: 3, Line: []profile.Line{{Function: compute, Line: 2}}}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Function:   []*profile.Function{handler, compute},
+		Location:   []*profile.Location{line4, line5, inCompute},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{line4}, Value: []int64{100000000}},
+			{Location: []*profile.Location{line5}, Value: []int64{300000000}},
+			{Location: []*profile.Location{inCompute, line5}, Value: []int64{200000000}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := prof.Write(&buf); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		sourcePath string
+		expected   []string
+		unexpected []string
+	}{
+		{
+			name:       "Source directory",
+			sourcePath: dir,
+			expected: []string{
+				"ROUTINE ======================== main.handler in /build/app/main.go",
+				"     400ms      600ms (flat, cum) 100.00% of Total",
+				"         .          .      3: func handler() {",
+				"     100ms      100ms      4: \ta := load()",
+				"     300ms      500ms      5: \tb := compute(a)",
+			},
+			unexpected: []string{"save(b)", "source not available"},
+		},
+		{
+			name:       "Source file",
+			sourcePath: filepath.Join(dir, "app", "main.go"),
+			expected:   []string{"     300ms      500ms      5: \tb := compute(a)"},
+		},
+		{
+			name:       "Source not available",
+			sourcePath: "",
+			expected: []string{
+				"source not available",
+				"     100ms      100ms      4\n",
+				"     300ms      500ms      5\n",
+			},
+			unexpected: []string{"compute(a)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := Annotate(buf.Bytes(), "^main\\.handler$", tt.sourcePath)
+			if err != nil {
+				t.Fatalf("Failed to annotate: %v", err)
+			}
+			for _, s := range tt.expected {
+				if !strings.Contains(report, s) {
+					t.Errorf("Report does not contain %q:\n%s", s, report)
+				}
+			}
+			for _, s := range tt.unexpected {
+				if strings.Contains(report, s) {
+					t.Errorf("Report contains %q:\n%s", s, report)
+				}
+			}
+		})
+	}
+
+	if _, err := Annotate(buf.Bytes(), "^main\\.missing$", dir); err == nil {
+		t.Errorf("Annotating a missing function succeeded")
+	}
+}
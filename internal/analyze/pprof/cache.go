@@ -0,0 +1,85 @@
+package pprof
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"sync"
+
+	"github.com/google/pprof/profile"
+)
+
+// Number of parsed profiles kept in the cache
+const parseCacheSize = 8
+
+type (
+	// profileCache keeps the recently parsed profiles keyed by the hash of their data,
+	// so that producing several outputs of the same profile parses it only once.
+	// It is safe for concurrent use.
+	profileCache struct {
+		mu      sync.Mutex
+		max     int
+		entries map[[sha256.Size]byte]*list.Element
+		order   *list.List // Of *profileCacheEntry, most recently used first
+
+		// Number of times the data was actually parsed
+		misses int
+	}
+
+	profileCacheEntry struct {
+		key  [sha256.Size]byte
+		prof *profile.Profile
+	}
+)
+
+// parseCache is shared by all the analyzers
+var parseCache = newProfileCache(parseCacheSize)
+
+// ParseCached returns the profile of the data through the cache shared with the analyzers,
+// so that the callers outside this package don't parse the profiles the reports have parsed already.
+// The returned profile is shared, so it must not be modified.
+func ParseCached(pprofData []byte) (*profile.Profile, error) {
+	return parseCache.parse(pprofData)
+}
+
+func newProfileCache(max int) *profileCache {
+	return &profileCache{
+		max:     max,
+		entries: map[[sha256.Size]byte]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// parse returns the profile of the data, parsing it only if it is not cached.
+// The returned profile is shared with the other callers, so it must be copied before being modified (e.g. symbolized or filtered).
+func (c *profileCache) parse(pprofData []byte) (*profile.Profile, error) {
+	key := sha256.Sum256(pprofData)
+
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		prof := elem.Value.(*profileCacheEntry).prof
+		c.mu.Unlock()
+		return prof, nil
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	// Parse outside the lock so that large profiles don't block the others
+	prof, err := profile.Parse(bytes.NewReader(pprofData))
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.order.PushFront(&profileCacheEntry{key: key, prof: prof})
+		for c.order.Len() > c.max {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*profileCacheEntry).key)
+		}
+	}
+	return prof, nil
+}
@@ -0,0 +1,127 @@
+package pprof
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+func TestParseCache(t *testing.T) {
+	original := parseCache
+	t.Cleanup(func() { parseCache = original })
+	parseCache = newProfileCache(2)
+
+	var buf bytes.Buffer
+	if err := createSampleProfile().Write(&buf); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+	pprofData := buf.Bytes()
+
+	// Text report, JSON and tree of the same profile
+	if _, err := GenerateTextReport(pprofData); err != nil {
+		t.Fatalf("Failed to generate text report: %v", err)
+	}
+	if _, err := ConvertToDetailedJSONWithOptions(pprofData, Options{SampleType: "cpu", MaxSamples: 1}); err != nil {
+		t.Fatalf("Failed to convert to JSON: %v", err)
+	}
+	if _, err := ToTreeJSON(pprofData, ""); err != nil {
+		t.Fatalf("Failed to convert to tree: %v", err)
+	}
+	if _, err := ParseCached(pprofData); err != nil {
+		t.Fatalf("Failed to parse profile: %v", err)
+	}
+	if parseCache.misses != 1 {
+		t.Errorf("Parses are different from expected. Expected: 1, Actual: %d", parseCache.misses)
+	}
+
+	// A hit returns the cached profile without decoding it again
+	first, err := parseCache.parse(pprofData)
+	if err != nil {
+		t.Fatalf("Failed to parse profile: %v", err)
+	}
+	second, err := parseCache.parse(pprofData)
+	if err != nil {
+		t.Fatalf("Failed to parse profile: %v", err)
+	}
+	if first != second {
+		t.Errorf("Cache hit returned another profile")
+	}
+
+	// Filtering and truncating the JSON must not leak into the cached profile
+	report, err := GenerateReport(pprofData, Options{})
+	if err != nil {
+		t.Fatalf("Failed to generate report: %v", err)
+	}
+	if len(report.CallPaths) != len(createSampleProfile().Sample) {
+		t.Errorf("Cached profile is modified. Call paths: %d", len(report.CallPaths))
+	}
+
+	// The least recently used profile is dropped over the limit
+	for _, duration := range []int64{1, 2} {
+		prof := createSampleProfile()
+		prof.DurationNanos = duration
+		var other bytes.Buffer
+		if err := prof.Write(&other); err != nil {
+			t.Fatalf("Failed to write profile: %v", err)
+		}
+		if _, err := GenerateTextReport(other.Bytes()); err != nil {
+			t.Fatalf("Failed to generate text report: %v", err)
+		}
+	}
+	if _, err := GenerateTextReport(pprofData); err != nil {
+		t.Fatalf("Failed to generate text report: %v", err)
+	}
+	if parseCache.misses != 4 || parseCache.order.Len() != 2 {
+		t.Errorf("Cache is different from expected. Misses: %d, Entries: %d", parseCache.misses, parseCache.order.Len())
+	}
+}
+
+// BenchmarkParseCacheHit measures a cache hit, which should allocate next to nothing compared to BenchmarkParse
+func BenchmarkParseCacheHit(b *testing.B) {
+	var buf bytes.Buffer
+	if err := createSampleProfile().Write(&buf); err != nil {
+		b.Fatalf("Failed to write profile: %v", err)
+	}
+	pprofData := buf.Bytes()
+	cache := newProfileCache(1)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := cache.parse(pprofData); err != nil {
+			b.Fatalf("Failed to parse profile: %v", err)
+		}
+	}
+}
+
+// BenchmarkParse measures decoding the profile, which a cache hit skips
+func BenchmarkParse(b *testing.B) {
+	var buf bytes.Buffer
+	if err := createSampleProfile().Write(&buf); err != nil {
+		b.Fatalf("Failed to write profile: %v", err)
+	}
+	pprofData := buf.Bytes()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := profile.Parse(bytes.NewReader(pprofData)); err != nil {
+			b.Fatalf("Failed to parse profile: %v", err)
+		}
+	}
+}
+
+func BenchmarkParseCache(b *testing.B) {
+	var buf bytes.Buffer
+	if err := createSampleProfile().Write(&buf); err != nil {
+		b.Fatalf("Failed to write profile: %v", err)
+	}
+	pprofData := buf.Bytes()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := GenerateTextReport(pprofData); err != nil {
+				b.Fatalf("Failed to generate text report: %v", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,225 @@
+package pprof
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+type (
+	// GoroutineReport is the goroutines of a goroutine profile grouped by where they are
+	GoroutineReport struct {
+		Total  int64            `json:"total"`
+		Groups []GoroutineGroup `json:"groups"`
+		// Hints call out the large pools of goroutines blocked on the same call
+		Hints []string `json:"hints"`
+	}
+
+	// GoroutineGroup is the goroutines in the same function and state
+	GoroutineGroup struct {
+		Function string  `json:"function"`
+		State    string  `json:"state"`
+		Count    int64   `json:"count"`
+		Percent  float64 `json:"percent"`
+		// Large is set for a blocked group of at least GoroutineOptions.MinPool goroutines
+		Large bool `json:"large,omitempty"`
+		// Stack is the most common call stack of the group in caller-to-callee order
+		Stack []string `json:"stack"`
+	}
+
+	// GoroutineOptions tune the goroutine analysis
+	GoroutineOptions struct {
+		// MinPool is the number of goroutines from which a blocked group is large, defaultMinPool if 0
+		MinPool int64
+	}
+)
+
+// Default number of goroutines from which a blocked group is large
+const defaultMinPool = 10
+
+// goroutineStates maps the functions goroutines block in to the state, like the ones in the goroutine dumps.
+// Functions not listed here are matched by goroutineStatePrefixes.
+var goroutineStates = map[string]string{
+	"runtime.chanrecv1":              "chan receive",
+	"runtime.chanrecv2":              "chan receive",
+	"runtime.chansend1":              "chan send",
+	"runtime.selectgo":               "select",
+	"runtime.block":                  "select (no cases)",
+	"time.Sleep":                     "sleep",
+	"sync.(*WaitGroup).Wait":         "wait group",
+	"sync.(*Cond).Wait":              "sync.Cond wait",
+	"internal/poll.runtime_pollWait": "IO wait",
+	"runtime.gcBgMarkWorker":         "GC worker (idle)",
+	"runtime.bgsweep":                "GC sweep wait",
+	"runtime.bgscavenge":             "GC scavenge wait",
+	"runtime.forcegchelper":          "force gc (idle)",
+	"runtime.runfinq":                "finalizer wait",
+}
+
+// goroutineStatePrefixes maps the prefixes of the functions goroutines block in to the state
+var goroutineStatePrefixes = []struct {
+	prefix string
+	state  string
+}{
+	{"sync.(*Mutex).", "mutex"},
+	{"sync.(*RWMutex).", "mutex"},
+	{"internal/sync.(*Mutex).", "mutex"},
+	{"sync.runtime_Semacquire", "semacquire"},
+	{"syscall.", "syscall"},
+	{"internal/runtime/syscall.", "syscall"},
+}
+
+// AnalyzeGoroutines groups the goroutines of a goroutine profile by the function they are in and their state.
+// The state is inferred from the call they block in, as the profile doesn't record it.
+func AnalyzeGoroutines(pprofData []byte, opts GoroutineOptions) (string, error) {
+	prof, err := parseProfile(pprofData, Options{})
+	if err != nil {
+		return "", err
+	}
+
+	report, err := analyzeGoroutines(prof, opts)
+	if err != nil {
+		return "", err
+	}
+
+	jsonBytes, err := json.Marshal(report)
+	if err != nil {
+		return "", fmt.Errorf("JSON marshaling error: %v", err)
+	}
+	return string(jsonBytes), nil
+}
+
+// analyzeGoroutines groups the goroutines of an already parsed profile
+func analyzeGoroutines(prof *profile.Profile, opts GoroutineOptions) (*GoroutineReport, error) {
+	if len(prof.SampleType) == 0 || prof.SampleType[0].Type != "goroutine" {
+		return nil, fmt.Errorf("not a goroutine profile")
+	}
+	minPool := opts.MinPool
+	if minPool <= 0 {
+		minPool = defaultMinPool
+	}
+
+	type groupKey struct {
+		function string
+		state    string
+	}
+	type group struct {
+		count     int64
+		stack     []string
+		stackSize int64 // Number of the goroutines with the stack
+	}
+	groups := map[groupKey]*group{}
+	report := &GoroutineReport{Groups: []GoroutineGroup{}, Hints: []string{}}
+
+	for _, sample := range prof.Sample {
+		if len(sample.Value) == 0 || len(sample.Location) == 0 {
+			continue
+		}
+		count := sample.Value[0]
+		report.Total += count
+
+		var stack []string
+		for i := len(sample.Location) - 1; i >= 0; i-- {
+			for _, f := range locationFrames(sample.Location[i]) {
+				stack = append(stack, f.name)
+			}
+		}
+
+		key := groupKey{function: goroutineFunction(stack), state: goroutineState(stack)}
+		g, ok := groups[key]
+		if !ok {
+			g = &group{}
+			groups[key] = g
+		}
+		g.count += count
+		if count > g.stackSize {
+			g.stack, g.stackSize = stack, count
+		}
+	}
+
+	for key, g := range groups {
+		report.Groups = append(report.Groups, GoroutineGroup{
+			Function: key.function,
+			State:    key.state,
+			Count:    g.count,
+			Percent:  percentOf(g.count, report.Total),
+			Large:    key.state != "running" && g.count >= minPool,
+			Stack:    g.stack,
+		})
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		a, b := report.Groups[i], report.Groups[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Function != b.Function {
+			return a.Function < b.Function
+		}
+		return a.State < b.State
+	})
+
+	for _, g := range report.Groups {
+		if g.Large {
+			report.Hints = append(report.Hints, fmt.Sprintf("%d goroutines (%0.2f%%) are blocked on %s in %s: check for lock contention, a missing receiver or an unbounded pool", g.Count, g.Percent, g.State, g.Function))
+		}
+	}
+	return report, nil
+}
+
+// goroutineState returns the state of the goroutine with the stack in caller-to-callee order,
+// which is the one of the outermost blocking call, e.g. mutex rather than semacquire for sync.Mutex.
+// Goroutines blocking in none of the known calls are running, or just waiting if parked.
+func goroutineState(stack []string) string {
+	for _, name := range stack {
+		if state, ok := goroutineStates[name]; ok {
+			return state
+		}
+		for _, p := range goroutineStatePrefixes {
+			if strings.HasPrefix(name, p.prefix) {
+				return p.state
+			}
+		}
+	}
+	if len(stack) > 0 && stack[len(stack)-1] == "runtime.gopark" {
+		return "waiting"
+	}
+	return "running"
+}
+
+// goroutineFunction returns the function the goroutine with the stack in caller-to-callee order is in,
+// which is the innermost one outside the standard library. Goroutines entirely in the standard library,
+// e.g. idle HTTP connections, are grouped by their outermost function.
+func goroutineFunction(stack []string) string {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if !isStdFunction(stack[i]) {
+			return stack[i]
+		}
+	}
+	for _, name := range stack {
+		if name != "runtime.goexit" {
+			return name
+		}
+	}
+	return "(unknown)"
+}
+
+// isStdFunction reports whether the function is in the standard library,
+// whose import paths don't have a dot in the first element unlike the modules
+func isStdFunction(name string) bool {
+	pkg := name
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		if j := strings.Index(pkg[i:], "."); j >= 0 {
+			pkg = pkg[:i+j]
+		}
+	} else if j := strings.Index(pkg, "."); j >= 0 {
+		pkg = pkg[:j]
+	}
+	if pkg == "main" || strings.HasPrefix(name, "0x") {
+		return false
+	}
+	first, _, _ := strings.Cut(pkg, "/")
+	return !strings.Contains(first, ".")
+}
@@ -0,0 +1,126 @@
+package pprof
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// createGoroutineProfile returns a goroutine profile with a pool of handlers contending on a mutex
+func createGoroutineProfile() *profile.Profile {
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "goroutine", Unit: "count"}},
+		PeriodType: &profile.ValueType{Type: "goroutine", Unit: "count"},
+		Period:     1,
+	}
+	locs := map[string]*profile.Location{}
+	loc := func(name string) *profile.Location {
+		if l, ok := locs[name]; ok {
+			return l
+		}
+		fn := &profile.Function{ID: uint64(len(prof.Function) + 1), Name: name}
+		l := &profile.Location{ID: uint64(len(prof.Location) + 1), Line: []profile.Line{{Function: fn}}}
+		prof.Function = append(prof.Function, fn)
+		prof.Location = append(prof.Location, l)
+		locs[name] = l
+		return l
+	}
+	// add adds count goroutines with the stack in callee-to-caller order
+	add := func(count int64, stack ...string) {
+		sample := &profile.Sample{Value: []int64{count}}
+		for _, name := range stack {
+			sample.Location = append(sample.Location, loc(name))
+		}
+		prof.Sample = append(prof.Sample, sample)
+	}
+
+	mutex := []string{"runtime.gopark", "runtime.goparkunlock", "runtime.semacquire1", "sync.runtime_SemacquireMutex", "sync.(*Mutex).lockSlow", "sync.(*Mutex).Lock", "main.(*cache).get"}
+	add(30, append(mutex, "main.handler", "net/http.HandlerFunc.ServeHTTP", "net/http.(*conn).serve", "runtime.goexit")...)
+	add(20, append(mutex, "main.refresh", "runtime.goexit")...)
+	add(12, "runtime.gopark", "runtime.chanrecv", "runtime.chanrecv1", "github.com/example/app/queue.(*Queue).consume", "runtime.goexit")
+	add(3, "runtime.gopark", "runtime.netpollblock", "internal/poll.runtime_pollWait", "internal/poll.(*pollDesc).wait", "net.(*conn).Read", "net/http.(*connReader).backgroundRead", "runtime.goexit")
+	add(1, "runtime/pprof.writeGoroutine", "main.main", "runtime.main", "runtime.goexit")
+	return prof
+}
+
+func TestAnalyzeGoroutines(t *testing.T) {
+	var buf bytes.Buffer
+	if err := createGoroutineProfile().Write(&buf); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     GoroutineOptions
+		expected []GoroutineGroup
+	}{
+		{
+			name: "Default",
+			expected: []GoroutineGroup{
+				{Function: "main.(*cache).get", State: "mutex", Count: 50, Large: true},
+				{Function: "github.com/example/app/queue.(*Queue).consume", State: "chan receive", Count: 12, Large: true},
+				{Function: "net/http.(*connReader).backgroundRead", State: "IO wait", Count: 3},
+				{Function: "main.main", State: "running", Count: 1},
+			},
+		},
+		{
+			name: "Larger pools",
+			opts: GoroutineOptions{MinPool: 13},
+			expected: []GoroutineGroup{
+				{Function: "main.(*cache).get", State: "mutex", Count: 50, Large: true},
+				{Function: "github.com/example/app/queue.(*Queue).consume", State: "chan receive", Count: 12},
+				{Function: "net/http.(*connReader).backgroundRead", State: "IO wait", Count: 3},
+				{Function: "main.main", State: "running", Count: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reportJSON, err := AnalyzeGoroutines(buf.Bytes(), tt.opts)
+			if err != nil {
+				t.Fatalf("Failed to analyze goroutines: %v", err)
+			}
+			var report GoroutineReport
+			if err := json.Unmarshal([]byte(reportJSON), &report); err != nil {
+				t.Fatalf("Failed to decode report: %v", err)
+			}
+
+			if report.Total != 66 {
+				t.Errorf("Total is different from expected. Expected: 66, Actual: %d", report.Total)
+			}
+			if len(report.Groups) != len(tt.expected) {
+				t.Fatalf("Groups are different from expected. Expected: %d, Actual: %s", len(tt.expected), reportJSON)
+			}
+			large := 0
+			for i, expected := range tt.expected {
+				g := report.Groups[i]
+				if g.Function != expected.Function || g.State != expected.State || g.Count != expected.Count || g.Large != expected.Large {
+					t.Errorf("Group %d is different from expected. Expected: %+v, Actual: %+v", i, expected, g)
+				}
+				if expected.Large {
+					large++
+				}
+			}
+			if len(report.Hints) != large {
+				t.Errorf("Hints are different from expected. Expected: %d, Actual: %v", large, report.Hints)
+			}
+
+			// The stack of the group is the one of the most goroutines
+			if stack := report.Groups[0].Stack; len(stack) == 0 || !slices.Contains(stack, "main.handler") {
+				t.Errorf("Stack of the largest group is different from expected: %v", stack)
+			}
+		})
+	}
+
+	var cpu bytes.Buffer
+	if err := createSampleProfile().Write(&cpu); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+	if _, err := AnalyzeGoroutines(cpu.Bytes(), GoroutineOptions{}); err == nil {
+		t.Errorf("CPU profile is analyzed as a goroutine profile")
+	}
+}
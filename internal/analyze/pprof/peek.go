@@ -0,0 +1,152 @@
+package pprof
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/google/pprof/profile"
+)
+
+type (
+	// PeekEdge is a direct caller or callee of a peeked function
+	PeekEdge struct {
+		Function string `json:"function"`
+		Value    int64  `json:"value"`
+	}
+
+	// PeekResult is a function matched by Peek with its direct callers and callees
+	PeekResult struct {
+		Function string      `json:"function"`
+		Flat     int64       `json:"flat"`
+		Cum      int64       `json:"cum"`
+		Callers  []*PeekEdge `json:"callers"`
+		Callees  []*PeekEdge `json:"callees"`
+	}
+)
+
+// Peek returns the direct callers and callees of the functions matching funcRegex with the edge weights,
+// like "go tool pprof -peek". sampleType selects the sample value, and the first one is used if empty.
+func Peek(pprofData []byte, funcRegex, sampleType string) (string, error) {
+	re, err := regexp.Compile(funcRegex)
+	if err != nil {
+		return "", fmt.Errorf("invalid function regex: %v", err)
+	}
+
+	prof, err := parseProfile(pprofData, Options{})
+	if err != nil {
+		return "", err
+	}
+
+	results, err := peek(prof, re, sampleType)
+	if err != nil {
+		return "", err
+	}
+
+	jsonBytes, err := json.Marshal(results)
+	if err != nil {
+		return "", fmt.Errorf("JSON marshaling error: %v", err)
+	}
+	return string(jsonBytes), nil
+}
+
+// peek collects the edges around the matched functions
+func peek(prof *profile.Profile, re *regexp.Regexp, sampleType string) ([]*PeekResult, error) {
+	index, err := sampleIndex(prof, sampleType)
+	if err != nil {
+		return nil, err
+	}
+
+	type node struct {
+		result  *PeekResult
+		callers map[string]int64
+		callees map[string]int64
+	}
+	nodes := map[string]*node{}
+
+	for _, sample := range prof.Sample {
+		if index >= len(sample.Value) || len(sample.Location) == 0 {
+			continue
+		}
+		value := sample.Value[index]
+
+		// Flatten the stack in caller-to-callee order
+		var stack []string
+		for i := len(sample.Location) - 1; i >= 0; i-- {
+			for _, f := range locationFrames(sample.Location[i]) {
+				stack = append(stack, f.name)
+			}
+		}
+
+		// Count each function and edge once per sample, even when it recurses
+		seen := map[string]bool{}
+		seenCallers := map[[2]string]bool{}
+		seenCallees := map[[2]string]bool{}
+		for i, name := range stack {
+			if !re.MatchString(name) {
+				continue
+			}
+
+			n, ok := nodes[name]
+			if !ok {
+				n = &node{
+					result:  &PeekResult{Function: name},
+					callers: map[string]int64{},
+					callees: map[string]int64{},
+				}
+				nodes[name] = n
+			}
+
+			if !seen[name] {
+				seen[name] = true
+				n.result.Cum += value
+			}
+			if i == len(stack)-1 {
+				n.result.Flat += value
+			}
+
+			if i > 0 {
+				if edge := [2]string{name, stack[i-1]}; !seenCallers[edge] {
+					seenCallers[edge] = true
+					n.callers[stack[i-1]] += value
+				}
+			}
+			if i < len(stack)-1 {
+				if edge := [2]string{name, stack[i+1]}; !seenCallees[edge] {
+					seenCallees[edge] = true
+					n.callees[stack[i+1]] += value
+				}
+			}
+		}
+	}
+
+	results := make([]*PeekResult, 0, len(nodes))
+	for _, n := range nodes {
+		n.result.Callers = sortedEdges(n.callers)
+		n.result.Callees = sortedEdges(n.callees)
+		results = append(results, n.result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Cum != results[j].Cum {
+			return results[i].Cum > results[j].Cum
+		}
+		return results[i].Function < results[j].Function
+	})
+	return results, nil
+}
+
+// sortedEdges converts the edge weights to a slice in descending order of the weight
+func sortedEdges(weights map[string]int64) []*PeekEdge {
+	edges := make([]*PeekEdge, 0, len(weights))
+	for name, value := range weights {
+		edges = append(edges, &PeekEdge{Function: name, Value: value})
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Value != edges[j].Value {
+			return edges[i].Value > edges[j].Value
+		}
+		return edges[i].Function < edges[j].Function
+	})
+	return edges
+}
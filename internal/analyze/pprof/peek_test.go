@@ -0,0 +1,81 @@
+package pprof
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestPeek(t *testing.T) {
+	prof := createSampleProfile()
+	var buf bytes.Buffer
+	if err := prof.Write(&buf); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		funcName string
+		flat     int64
+		cum      int64
+		callers  []PeekEdge
+		callees  []PeekEdge
+	}{
+		{
+			name:     "Leaf function",
+			funcName: "main.heavyFunction",
+			flat:     8000000,
+			cum:      8000000,
+			callers:  []PeekEdge{{"runtime.schedule", 5000000}, {"main.processData", 3000000}},
+			callees:  []PeekEdge{},
+		},
+		{
+			name:     "Caller of the leaf function",
+			funcName: "runtime.schedule",
+			flat:     2000000,
+			cum:      7000000,
+			callers:  []PeekEdge{},
+			callees:  []PeekEdge{{"main.heavyFunction", 5000000}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peekJSON, err := Peek(buf.Bytes(), "^"+tt.funcName+"$", "")
+			if err != nil {
+				t.Fatalf("Failed to peek: %v", err)
+			}
+
+			var results []*PeekResult
+			if err := json.Unmarshal([]byte(peekJSON), &results); err != nil {
+				t.Fatalf("Failed to decode peek result: %v", err)
+			}
+			if len(results) != 1 || results[0].Function != tt.funcName {
+				t.Fatalf("Peeked functions are different from expected: %s", peekJSON)
+			}
+
+			result := results[0]
+			if result.Flat != tt.flat || result.Cum != tt.cum {
+				t.Errorf("Flat/Cum is different from expected. Expected: %d/%d, Actual: %d/%d", tt.flat, tt.cum, result.Flat, result.Cum)
+			}
+			assertEdges(t, "Callers", tt.callers, result.Callers)
+			assertEdges(t, "Callees", tt.callees, result.Callees)
+		})
+	}
+
+	if _, err := Peek(buf.Bytes(), "main.(", ""); err == nil {
+		t.Errorf("Invalid regex is accepted")
+	}
+}
+
+func assertEdges(t *testing.T, name string, expected []PeekEdge, actual []*PeekEdge) {
+	t.Helper()
+	if len(actual) != len(expected) {
+		t.Fatalf("%s count is different from expected. Expected: %d, Actual: %d", name, len(expected), len(actual))
+	}
+	for i, edge := range actual {
+		if *edge != expected[i] {
+			t.Errorf("%s[%d] is different from expected. Expected: %+v, Actual: %+v", name, i, expected[i], *edge)
+		}
+	}
+}
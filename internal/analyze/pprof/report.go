@@ -0,0 +1,588 @@
+package pprof
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+	"github.com/kaz/pprotein/internal/analyze/config"
+)
+
+type (
+	// Report is the analysis behind the text report in a machine-readable form
+	Report struct {
+		Summary ReportSummary `json:"summary"`
+		// Ranking is how the hotspots are ranked, RankByValue or RankByCount
+		Ranking  string           `json:"ranking"`
+		Hotspots []ReportFunction `json:"hotspots"`
+		// SampleTypeHotspots is only filled with Options.AllSampleTypes
+		SampleTypeHotspots []SampleTypeHotspots `json:"sample_type_hotspots,omitempty"`
+		CallPaths          []ReportCallPath     `json:"call_paths"`
+		Resources          []ReportResource     `json:"resources"`
+		// GCPercent is the share of the total spent in garbage collection, only computed for CPU profiles
+		GCPercent float64  `json:"gc_percent,omitempty"`
+		Hints     []string `json:"hints"`
+	}
+
+	// ReportSummary describes the profile itself
+	ReportSummary struct {
+		TimeNanos     int64             `json:"time_nanos,omitempty"`
+		DurationNanos int64             `json:"duration_nanos,omitempty"`
+		PeriodType    *ReportValueType  `json:"period_type,omitempty"`
+		SampleTypes   []ReportValueType `json:"sample_types"`
+	}
+
+	// ReportValueType is a measurement of the profile, e.g. cpu in nanoseconds
+	ReportValueType struct {
+		Type string `json:"type"`
+		Unit string `json:"unit"`
+	}
+
+	// ReportFunction is a hotspot function. The values are of the first sample type,
+	// or numbers of samples when ranked by count.
+	ReportFunction struct {
+		Name      string `json:"name"`
+		Filename  string `json:"filename,omitempty"`
+		StartLine int64  `json:"start_line,omitempty"`
+		// Flat is the value of the function itself, excluding its callees
+		Flat int64 `json:"flat"`
+		// Cum is the value including the callees, by which the hotspots are ranked
+		Cum int64 `json:"cum"`
+		// Percent is the share of Cum in the total
+		Percent float64 `json:"percent"`
+	}
+
+	// SampleTypeHotspots are the top functions by cumulative value of a sample type
+	SampleTypeHotspots struct {
+		ReportValueType
+		Total     int64                `json:"total"`
+		Functions []SampleTypeFunction `json:"functions"`
+	}
+
+	// SampleTypeFunction is a function of SampleTypeHotspots
+	SampleTypeFunction struct {
+		Name    string  `json:"name"`
+		Value   int64   `json:"value"`
+		Percent float64 `json:"percent"`
+	}
+
+	// ReportCallPath is the call stack of a sample with the value of the first sample type
+	ReportCallPath struct {
+		Value   int64   `json:"value"`
+		Percent float64 `json:"percent"`
+		// Frames are in caller-to-callee order
+		Frames []ReportFrame `json:"frames"`
+	}
+
+	// ReportFrame is a function of a call path
+	ReportFrame struct {
+		Name   string `json:"name"`
+		Inline bool   `json:"inline,omitempty"`
+	}
+
+	// ReportResource is the total of a sample type
+	ReportResource struct {
+		ReportValueType
+		Total int64 `json:"total"`
+	}
+)
+
+// GenerateReport returns the analysis of the text report in a structured form, with the same options
+func GenerateReport(pprofData []byte, opts Options) (*Report, error) {
+	prof, err := parseProfile(pprofData, opts)
+	if err != nil {
+		return nil, err
+	}
+	return buildReport(prof, opts)
+}
+
+// GenerateReportJSON is like GenerateReport but returns the report as JSON
+func GenerateReportJSON(pprofData []byte, opts Options) (string, error) {
+	report, err := GenerateReport(pprofData, opts)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("JSON marshaling error: %v", err)
+	}
+	return string(data), nil
+}
+
+// Maximum number of hotspot functions and call paths in the report
+const maxReportEntries = 50
+
+// buildReport analyzes an already parsed profile
+func buildReport(prof *profile.Profile, opts Options) (*Report, error) {
+	byCount := false
+	switch opts.Ranking {
+	case "", RankByValue:
+	case RankByCount:
+		byCount = true
+	default:
+		return nil, fmt.Errorf("unknown ranking: %s", opts.Ranking)
+	}
+
+	hidden := func(f frame) bool {
+		return opts.HideRuntime && runtimeFramePattern.MatchString(f.name)
+	}
+
+	r := &Report{
+		Ranking:   RankByValue,
+		Hotspots:  []ReportFunction{},
+		CallPaths: []ReportCallPath{},
+		Resources: []ReportResource{},
+	}
+	if byCount {
+		r.Ranking = RankByCount
+	}
+
+	// 1. Profile Information Summary
+	r.Summary = ReportSummary{
+		TimeNanos:     prof.TimeNanos,
+		DurationNanos: prof.DurationNanos,
+		SampleTypes:   make([]ReportValueType, 0, len(prof.SampleType)),
+	}
+	if prof.PeriodType != nil {
+		r.Summary.PeriodType = &ReportValueType{Type: prof.PeriodType.Type, Unit: prof.PeriodType.Unit}
+	}
+	for _, st := range prof.SampleType {
+		r.Summary.SampleTypes = append(r.Summary.SampleTypes, ReportValueType{Type: st.Type, Unit: st.Unit})
+	}
+
+	// 2. Hotspot functions (functions consuming the most resources)
+	// Calculate cumulative values for each function
+	funcCumulative := make(map[frame]int64)
+	for _, sample := range prof.Sample {
+		if len(sample.Value) == 0 || len(sample.Location) == 0 {
+			continue
+		}
+
+		if byCount {
+			// Count each function once per sample, even when it recurses
+			seen := make(map[frame]bool)
+			for _, loc := range sample.Location {
+				for _, f := range locationFrames(loc) {
+					f.inline = false
+					if !seen[f] && !hidden(f) {
+						seen[f] = true
+						funcCumulative[f]++
+					}
+				}
+			}
+			continue
+		}
+
+		// Use the first value (typically CPU time)
+		value := sample.Value[0]
+
+		// Accumulate sample values by function
+		for _, loc := range sample.Location {
+			for _, f := range locationFrames(loc) {
+				if hidden(f) {
+					continue
+				}
+				f.inline = false
+				funcCumulative[f] += value
+			}
+		}
+	}
+	flat := flatValues(prof, hidden, byCount)
+
+	// Convert function and value combinations to a slice
+	type funcValue struct {
+		fn    frame
+		value int64
+	}
+	funcValues := make([]funcValue, 0, len(funcCumulative))
+	for fn, value := range funcCumulative {
+		funcValues = append(funcValues, funcValue{fn, value})
+	}
+
+	// Sort in descending order by value, breaking ties by name so that the order is stable
+	sort.Slice(funcValues, func(i, j int) bool {
+		if funcValues[i].value != funcValues[j].value {
+			return funcValues[i].value > funcValues[j].value
+		}
+		return funcValues[i].fn.name < funcValues[j].fn.name
+	})
+
+	totalValue := int64(0)
+	totalSamples := int64(0)
+	for _, sample := range prof.Sample {
+		if len(sample.Value) > 0 {
+			totalValue += sample.Value[0]
+			if len(sample.Location) > 0 {
+				totalSamples++
+			}
+		}
+	}
+	total := totalValue
+	if byCount {
+		total = totalSamples
+	}
+
+	for _, fv := range funcValues {
+		if len(r.Hotspots) >= maxReportEntries {
+			break
+		}
+		percentOfTotal := percentOf(fv.value, total)
+		// Entries are sorted, so the rest are below the cutoff too
+		if percentOfTotal < opts.MinPercent {
+			break
+		}
+		r.Hotspots = append(r.Hotspots, ReportFunction{
+			Name:      fv.fn.name,
+			Filename:  fv.fn.filename,
+			StartLine: fv.fn.startLine,
+			Flat:      flat[fv.fn],
+			Cum:       fv.value,
+			Percent:   percentOfTotal,
+		})
+	}
+
+	if opts.AllSampleTypes {
+		r.SampleTypeHotspots = sampleTypeHotspotsOf(prof, hidden)
+	}
+
+	// 3. Important call paths (call stacks)
+	var samplePaths []ReportCallPath
+	var deepest []ReportFrame
+	for _, sample := range prof.Sample {
+		if len(sample.Value) == 0 || len(sample.Location) == 0 {
+			continue
+		}
+
+		// Build call path
+		var callPath []ReportFrame
+		for i := len(sample.Location) - 1; i >= 0; i-- { // Build path in reverse order
+			for _, f := range locationFrames(sample.Location[i]) {
+				if !hidden(f) {
+					callPath = append(callPath, ReportFrame{Name: f.name, Inline: f.inline})
+				}
+			}
+		}
+
+		if len(callPath) > 0 {
+			// Use the first value (typically CPU time)
+			samplePaths = append(samplePaths, ReportCallPath{Value: sample.Value[0], Frames: callPath})
+		}
+		if len(callPath) > len(deepest) {
+			deepest = callPath
+		}
+	}
+
+	// Sort in descending order by value
+	sort.SliceStable(samplePaths, func(i, j int) bool {
+		return samplePaths[i].Value > samplePaths[j].Value
+	})
+
+	for _, sp := range samplePaths {
+		if len(r.CallPaths) >= maxReportEntries {
+			break
+		}
+		sp.Percent = percentOf(sp.Value, totalValue)
+		if sp.Percent < opts.MinPercent {
+			break
+		}
+		r.CallPaths = append(r.CallPaths, sp)
+	}
+
+	// 4. Resource usage distribution
+	for i, sampleType := range prof.SampleType {
+		resource := ReportResource{ReportValueType: ReportValueType{Type: sampleType.Type, Unit: sampleType.Unit}}
+		for _, sample := range prof.Sample {
+			if i < len(sample.Value) {
+				resource.Total += sample.Value[i]
+			}
+		}
+		r.Resources = append(r.Resources, resource)
+	}
+
+	// 5. Profiling hints
+	if isCPUProfile(prof) {
+		r.GCPercent = gcPercent(prof, totalValue)
+	}
+	r.Hints = bottleneckHints(flat, total, deepest, r.GCPercent)
+
+	return r, nil
+}
+
+// percentOf returns the share of the value in the total in percent, which is 0 without a total
+func percentOf(value, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(value) / float64(total) * 100
+}
+
+// flatValues returns the value of each function itself, excluding its callees.
+// The value of a hidden leaf is attributed to its nearest visible caller.
+func flatValues(prof *profile.Profile, hidden func(frame) bool, byCount bool) map[frame]int64 {
+	flat := make(map[frame]int64)
+	for _, sample := range prof.Sample {
+		if len(sample.Value) == 0 || len(sample.Location) == 0 {
+			continue
+		}
+		value := sample.Value[0]
+		if byCount {
+			value = 1
+		}
+
+	leaf:
+		for _, loc := range sample.Location {
+			frames := locationFrames(loc)
+			for i := len(frames) - 1; i >= 0; i-- {
+				if f := frames[i]; !hidden(f) {
+					f.inline = false
+					flat[f] += value
+					break leaf
+				}
+			}
+		}
+	}
+	return flat
+}
+
+// gcFunctions are the entry points of the garbage collector work, whose callees are all spent for GC.
+// Allocation is included, as it is where the allocating goroutines assist the marking.
+var gcFunctions = map[string]bool{
+	"runtime.gcBgMarkWorker": true,
+	"runtime.mallocgc":       true,
+	"runtime.gcAssistAlloc":  true,
+	"runtime.bgsweep":        true,
+	"runtime.bgscavenge":     true,
+	"runtime.GC":             true,
+}
+
+// isCPUProfile reports whether the profile is a CPU profile, whose first sample type is proportional to the CPU time
+func isCPUProfile(prof *profile.Profile) bool {
+	if prof.PeriodType != nil && prof.PeriodType.Type == "cpu" {
+		return true
+	}
+	return len(prof.SampleType) > 0 && prof.SampleType[0].Type == "cpu"
+}
+
+// gcPercent returns the share of the first sample type in the total spent under the GC functions.
+// Runtime frames are always looked at, even when they are hidden from the report.
+func gcPercent(prof *profile.Profile, total int64) float64 {
+	gc := int64(0)
+	for _, sample := range prof.Sample {
+		if len(sample.Value) == 0 {
+			continue
+		}
+	stack:
+		for _, loc := range sample.Location {
+			for _, f := range locationFrames(loc) {
+				if gcFunctions[f.name] {
+					gc += sample.Value[0]
+					break stack
+				}
+			}
+		}
+	}
+	return percentOf(gc, total)
+}
+
+// Maximum number of functions named in the hints
+const maxHotspotHints = 3
+
+// bottleneckHints points out the functions spending more than the threshold by themselves
+// and call paths deeper than the threshold, as well as CPU profiles spending more than the threshold in GC
+func bottleneckHints(flat map[frame]int64, total int64, deepest []ReportFrame, gcPercent float64) []string {
+	thresholds := config.Current()
+
+	type hotspot struct {
+		name    string
+		percent float64
+	}
+	var hotspots []hotspot
+	for f, value := range flat {
+		if p := percentOf(value, total); p > thresholds.HotspotPercent {
+			hotspots = append(hotspots, hotspot{f.name, p})
+		}
+	}
+	slices.SortFunc(hotspots, func(a, b hotspot) int {
+		if c := cmp.Compare(b.percent, a.percent); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.name, b.name)
+	})
+	if len(hotspots) > maxHotspotHints {
+		hotspots = hotspots[:maxHotspotHints]
+	}
+
+	hints := []string{}
+	for _, h := range hotspots {
+		hints = append(hints, fmt.Sprintf("%s spends %0.2f%% of the total by itself, over the %s%% threshold: optimize it first", h.name, h.percent, trimFloat(thresholds.HotspotPercent)))
+	}
+	if len(hotspots) == 0 {
+		hints = append(hints, fmt.Sprintf("No function spends more than %s%% of the total by itself, so the cost is spread out: look at the cumulative hotspots and the call paths instead", trimFloat(thresholds.HotspotPercent)))
+	}
+
+	if gcPercent > thresholds.GCPercent {
+		hints = append(hints, fmt.Sprintf("High GC overhead: %0.2f%% of the CPU time is spent in garbage collection and allocation, over the %s%% threshold: reduce allocations (e.g. reuse buffers with sync.Pool, preallocate slices) or raise GOGC", gcPercent, trimFloat(thresholds.GCPercent)))
+	}
+
+	if len(deepest) > thresholds.CallPathDepth {
+		hints = append(hints, fmt.Sprintf("Call paths reach %d frames (over the threshold of %d), e.g. down to %s: check for excessive recursion or library calls", len(deepest), thresholds.CallPathDepth, deepest[len(deepest)-1].Name))
+	}
+
+	return append(hints,
+		"Consider optimizing functions that appear in multiple call paths",
+		"Consider algorithm improvements, caching, and parallel processing for optimization",
+	)
+}
+
+// Number of functions in each table of the hotspots per sample type
+const sampleTypeHotspots = 10
+
+// sampleTypeHotspotsOf returns the top functions by cumulative value for each sample type
+func sampleTypeHotspotsOf(prof *profile.Profile, hidden func(frame) bool) []SampleTypeHotspots {
+	result := make([]SampleTypeHotspots, 0, len(prof.SampleType))
+	for i, sampleType := range prof.SampleType {
+		cumulative := make(map[string]int64)
+		total := int64(0)
+		for _, sample := range prof.Sample {
+			if i >= len(sample.Value) {
+				continue
+			}
+			value := sample.Value[i]
+			total += value
+
+			// Count each function once per sample, so that recursion does not inflate it
+			seen := make(map[string]bool)
+			for _, loc := range sample.Location {
+				for _, f := range locationFrames(loc) {
+					if !seen[f.name] && !hidden(f) {
+						seen[f.name] = true
+						cumulative[f.name] += value
+					}
+				}
+			}
+		}
+
+		names := make([]string, 0, len(cumulative))
+		for name := range cumulative {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(a, b int) bool {
+			if cumulative[names[a]] != cumulative[names[b]] {
+				return cumulative[names[a]] > cumulative[names[b]]
+			}
+			return names[a] < names[b]
+		})
+
+		hotspots := SampleTypeHotspots{
+			ReportValueType: ReportValueType{Type: sampleType.Type, Unit: sampleType.Unit},
+			Total:           total,
+			Functions:       []SampleTypeFunction{},
+		}
+		for rank, name := range names {
+			if rank >= sampleTypeHotspots || cumulative[name] == 0 {
+				break
+			}
+			hotspots.Functions = append(hotspots.Functions, SampleTypeFunction{
+				Name:    name,
+				Value:   cumulative[name],
+				Percent: percentOf(cumulative[name], total),
+			})
+		}
+		result = append(result, hotspots)
+	}
+	return result
+}
+
+// text renders the report in the human-readable format of GenerateTextReport
+func (r *Report) text() string {
+	var report strings.Builder
+
+	// 1. Profile Information Summary
+	report.WriteString("===== Profile Information Summary =====\n")
+	if r.Summary.TimeNanos > 0 {
+		fmt.Fprintf(&report, "Measurement Time: %v nanoseconds\n", r.Summary.DurationNanos)
+	}
+	if pt := r.Summary.PeriodType; pt != nil {
+		fmt.Fprintf(&report, "Measurement Unit: %s (%s)\n", pt.Type, pt.Unit)
+	}
+	if len(r.Summary.SampleTypes) > 0 {
+		report.WriteString("Sample Types: ")
+		for i, st := range r.Summary.SampleTypes {
+			if i > 0 {
+				report.WriteString(", ")
+			}
+			fmt.Fprintf(&report, "%s (%s)", st.Type, st.Unit)
+		}
+		report.WriteString("\n")
+	}
+	report.WriteString("\n")
+
+	// 2. Hotspot functions
+	byCount := r.Ranking == RankByCount
+	if byCount {
+		report.WriteString("===== Top 10 Hotspot Functions (by sample count) =====\n")
+	} else {
+		report.WriteString("===== Top 10 Hotspot Functions =====\n")
+	}
+	for i, fn := range r.Hotspots {
+		if fn.Filename != "" {
+			fmt.Fprintf(&report, "%d. %s (%s:%d)\n", i+1, fn.Name, fn.Filename, fn.StartLine)
+		} else {
+			fmt.Fprintf(&report, "%d. %s\n", i+1, fn.Name)
+		}
+		if byCount {
+			fmt.Fprintf(&report, "   Samples: %d (%0.2f%%)\n", fn.Cum, fn.Percent)
+		} else {
+			fmt.Fprintf(&report, "   Value: %d (%0.2f%%)\n", fn.Cum, fn.Percent)
+		}
+		fmt.Fprintf(&report, "\n")
+	}
+
+	if r.SampleTypeHotspots != nil {
+		report.WriteString("===== Hotspot Functions per Sample Type =====\n")
+		for _, hotspots := range r.SampleTypeHotspots {
+			fmt.Fprintf(&report, "--- %s (%s), Total: %s ---\n", hotspots.Type, hotspots.Unit, formatValue(hotspots.Total, hotspots.Unit))
+			for rank, fn := range hotspots.Functions {
+				fmt.Fprintf(&report, "%2d. %6.2f%% %10s  %s\n", rank+1, fn.Percent, formatValue(fn.Value, hotspots.Unit), fn.Name)
+			}
+			report.WriteString("\n")
+		}
+	}
+
+	// 3. Important call paths
+	report.WriteString("===== Important Call Paths =====\n")
+	for i, sp := range r.CallPaths {
+		fmt.Fprintf(&report, "Path %d - Value: %d (%0.2f%%)\n", i+1, sp.Value, sp.Percent)
+		for j, f := range sp.Frames {
+			indentation := strings.Repeat("  ", j)
+			if f.Inline {
+				fmt.Fprintf(&report, "%s-> %s (inline)\n", indentation, f.Name)
+			} else {
+				fmt.Fprintf(&report, "%s-> %s\n", indentation, f.Name)
+			}
+		}
+		fmt.Fprintf(&report, "\n")
+	}
+
+	// 4. Resource usage distribution
+	if len(r.Resources) > 0 {
+		report.WriteString("===== Resource Usage Distribution =====\n")
+		for _, resource := range r.Resources {
+			fmt.Fprintf(&report, "Measurement: %s (%s)\n", resource.Type, resource.Unit)
+			fmt.Fprintf(&report, "Total: %s (%d %s)\n\n", formatValue(resource.Total, resource.Unit), resource.Total, resource.Unit)
+		}
+	}
+
+	// 5. Profiling hints
+	report.WriteString("===== Bottleneck Analysis Hints =====\n")
+	for i, hint := range r.Hints {
+		fmt.Fprintf(&report, "%d. %s\n", i+1, hint)
+	}
+
+	return report.String()
+}
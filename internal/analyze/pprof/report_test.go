@@ -0,0 +1,70 @@
+package pprof
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGenerateReportJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := createSampleProfile().Write(&buf); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+	pprofData := buf.Bytes()
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "Default", opts: Options{}},
+		{name: "By count", opts: Options{Ranking: RankByCount, HideRuntime: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reportJSON, err := GenerateReportJSON(pprofData, tt.opts)
+			if err != nil {
+				t.Fatalf("Failed to generate report: %v", err)
+			}
+			var report Report
+			if err := json.Unmarshal([]byte(reportJSON), &report); err != nil {
+				t.Fatalf("Failed to decode report: %v", err)
+			}
+			textReport, err := GenerateTextReportWithOptions(pprofData, tt.opts)
+			if err != nil {
+				t.Fatalf("Failed to generate text report: %v", err)
+			}
+
+			if len(report.Hotspots) == 0 || len(report.CallPaths) == 0 {
+				t.Fatalf("Report is empty: %s", reportJSON)
+			}
+			_, hotspotsText, _ := strings.Cut(textReport, "Hotspot Functions")
+			hotspotsText, _, _ = strings.Cut(hotspotsText, "===== Important Call Paths =====")
+			if n := strings.Count(hotspotsText, "   Value: ") + strings.Count(hotspotsText, "   Samples: "); n != len(report.Hotspots) {
+				t.Errorf("Hotspots are different from the text. Expected: %d, Actual: %d", n, len(report.Hotspots))
+			}
+
+			for i, fn := range report.Hotspots {
+				if fn.Flat > fn.Cum {
+					t.Errorf("Flat value of %s exceeds the cumulative one: %+v", fn.Name, fn)
+				}
+
+				label := "Value"
+				if tt.opts.Ranking == RankByCount {
+					label = "Samples"
+				}
+				expected := fmt.Sprintf("%d. %s", i+1, fn.Name)
+				if fn.Filename != "" {
+					expected += fmt.Sprintf(" (%s:%d)", fn.Filename, fn.StartLine)
+				}
+				expected += fmt.Sprintf("\n   %s: %d (%0.2f%%)\n", label, fn.Cum, fn.Percent)
+				if !strings.Contains(hotspotsText, expected) {
+					t.Errorf("Hotspot %d is not in the text report: %q", i+1, expected)
+				}
+			}
+		})
+	}
+}
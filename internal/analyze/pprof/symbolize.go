@@ -0,0 +1,109 @@
+package pprof
+
+import (
+	"debug/elf"
+	"debug/gosym"
+	"fmt"
+
+	"github.com/google/pprof/profile"
+)
+
+// symbolize fills in function and line info of the locations lacking it
+// using the Go symbol table of the profiled binary
+func symbolize(prof *profile.Profile, binaryPath string) error {
+	f, err := elf.Open(binaryPath)
+	if err != nil {
+		return fmt.Errorf("failed to open binary: %w", err)
+	}
+	defer f.Close()
+
+	table, err := goSymbolTable(f)
+	if err != nil {
+		return err
+	}
+
+	// Reuse functions already present in the profile
+	functions := make(map[string]*profile.Function)
+	nextID := uint64(1)
+	for _, fn := range prof.Function {
+		functions[fn.Name] = fn
+		if fn.ID >= nextID {
+			nextID = fn.ID + 1
+		}
+	}
+
+	for _, loc := range prof.Location {
+		if len(loc.Line) > 0 {
+			continue
+		}
+
+		pc := binaryAddress(f, loc)
+		file, line, fn := table.PCToLine(pc)
+		if fn == nil {
+			continue
+		}
+
+		function, ok := functions[fn.Name]
+		if !ok {
+			_, startLine, _ := table.PCToLine(fn.Entry)
+			function = &profile.Function{
+				ID:         nextID,
+				Name:       fn.Name,
+				SystemName: fn.Name,
+				Filename:   file,
+				StartLine:  int64(startLine),
+			}
+			nextID++
+			functions[fn.Name] = function
+			prof.Function = append(prof.Function, function)
+		}
+
+		loc.Line = []profile.Line{{Function: function, Line: int64(line)}}
+	}
+
+	return nil
+}
+
+// goSymbolTable reads the Go symbol table embedded in the binary
+func goSymbolTable(f *elf.File) (*gosym.Table, error) {
+	pclntab := f.Section(".gopclntab")
+	text := f.Section(".text")
+	if pclntab == nil || text == nil {
+		return nil, fmt.Errorf("binary has no Go symbol table")
+	}
+
+	pclntabData, err := pclntab.Data()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .gopclntab: %w", err)
+	}
+
+	// .gosymtab is empty in modern Go binaries but may still be present
+	var symtabData []byte
+	if symtab := f.Section(".gosymtab"); symtab != nil {
+		if symtabData, err = symtab.Data(); err != nil {
+			return nil, fmt.Errorf("failed to read .gosymtab: %w", err)
+		}
+	}
+
+	table, err := gosym.NewTable(symtabData, gosym.NewLineTable(pclntabData, text.Addr))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Go symbol table: %w", err)
+	}
+	return table, nil
+}
+
+// binaryAddress translates a runtime address of the location into a virtual address of the binary.
+// Position independent executables are relocated at load time, so the mapping is used to undo it.
+func binaryAddress(f *elf.File, loc *profile.Location) uint64 {
+	if f.Type != elf.ET_DYN || loc.Mapping == nil || loc.Mapping.Start == 0 {
+		return loc.Address
+	}
+
+	offset := loc.Address - loc.Mapping.Start + loc.Mapping.Offset
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_LOAD && prog.Flags&elf.PF_X != 0 && prog.Off <= offset && offset < prog.Off+prog.Filesz {
+			return offset - prog.Off + prog.Vaddr
+		}
+	}
+	return loc.Address
+}
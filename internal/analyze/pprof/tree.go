@@ -0,0 +1,109 @@
+package pprof
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/google/pprof/profile"
+)
+
+// TreeNode is a node of the call tree for flame charts
+type TreeNode struct {
+	Name     string      `json:"name"`
+	Value    int64       `json:"value"`
+	Children []*TreeNode `json:"children,omitempty"`
+
+	index map[string]*TreeNode
+}
+
+// child returns the child with the name, creating it if it doesn't exist
+func (n *TreeNode) child(name string) *TreeNode {
+	if n.index == nil {
+		n.index = map[string]*TreeNode{}
+	}
+	if c, ok := n.index[name]; ok {
+		return c
+	}
+
+	c := &TreeNode{Name: name}
+	n.index[name] = c
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// sortChildren orders children by value in descending order so that the output is deterministic
+func (n *TreeNode) sortChildren() {
+	sort.Slice(n.Children, func(i, j int) bool {
+		if n.Children[i].Value != n.Children[j].Value {
+			return n.Children[i].Value > n.Children[j].Value
+		}
+		return n.Children[i].Name < n.Children[j].Name
+	})
+	for _, c := range n.Children {
+		c.sortChildren()
+	}
+}
+
+// ToTreeJSON builds a call tree from the root to the leaf functions, merging common prefixes across samples.
+// The value of each node is the sum of the samples passing through it.
+// sampleType selects the sample value (e.g. "alloc_space"), and the first one is used if empty.
+func ToTreeJSON(pprofData []byte, sampleType string) (string, error) {
+	prof, err := parseProfile(pprofData, Options{})
+	if err != nil {
+		return "", err
+	}
+
+	root, err := buildTree(prof, sampleType)
+	if err != nil {
+		return "", err
+	}
+
+	jsonBytes, err := json.Marshal(root)
+	if err != nil {
+		return "", fmt.Errorf("JSON marshaling error: %v", err)
+	}
+	return string(jsonBytes), nil
+}
+
+// buildTree builds the call tree of the profile
+func buildTree(prof *profile.Profile, sampleType string) (*TreeNode, error) {
+	index, err := sampleIndex(prof, sampleType)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &TreeNode{Name: "root"}
+	for _, sample := range prof.Sample {
+		if index >= len(sample.Value) {
+			continue
+		}
+		value := sample.Value[index]
+		root.Value += value
+
+		// Locations are ordered from the leaf to the root
+		node := root
+		for i := len(sample.Location) - 1; i >= 0; i-- {
+			for _, f := range locationFrames(sample.Location[i]) {
+				node = node.child(f.name)
+				node.Value += value
+			}
+		}
+	}
+
+	root.sortChildren()
+	return root, nil
+}
+
+// sampleIndex returns the index of the sample type in the sample values
+func sampleIndex(prof *profile.Profile, sampleType string) (int, error) {
+	if sampleType == "" {
+		return 0, nil
+	}
+	for i, st := range prof.SampleType {
+		if st.Type == sampleType {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("no such sample type: %s", sampleType)
+}
@@ -0,0 +1,63 @@
+package pprof
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestToTreeJSON(t *testing.T) {
+	prof := createSampleProfile()
+	var buf bytes.Buffer
+	if err := prof.Write(&buf); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+
+	treeJSON, err := ToTreeJSON(buf.Bytes(), "")
+	if err != nil {
+		t.Fatalf("Failed to build tree: %v", err)
+	}
+
+	root := &TreeNode{}
+	if err := json.Unmarshal([]byte(treeJSON), root); err != nil {
+		t.Fatalf("Failed to decode tree: %v", err)
+	}
+
+	total := int64(0)
+	for _, sample := range prof.Sample {
+		total += sample.Value[0]
+	}
+	if root.Value != total {
+		t.Errorf("Root value is different from expected. Expected: %d, Actual: %d", total, root.Value)
+	}
+
+	// runtime.schedule is the root frame of two samples, so they share one node
+	if len(root.Children) != 2 {
+		t.Fatalf("Root child count is different from expected. Expected: 2, Actual: %d", len(root.Children))
+	}
+	top := root.Children[0]
+	if top.Name != "runtime.schedule" || top.Value != 7000000 {
+		t.Errorf("Top node is different from expected. Expected: runtime.schedule=7000000, Actual: %s=%d", top.Name, top.Value)
+	}
+	if len(top.Children) != 1 || top.Children[0].Name != "main.heavyFunction" || top.Children[0].Value != 5000000 {
+		t.Errorf("Children of runtime.schedule are different from expected: %s", treeJSON)
+	}
+
+	// A node is never smaller than the sum of its children
+	var check func(n *TreeNode)
+	check = func(n *TreeNode) {
+		sum := int64(0)
+		for _, c := range n.Children {
+			sum += c.Value
+			check(c)
+		}
+		if sum > n.Value {
+			t.Errorf("Children of %s sum to %d exceeding its value %d", n.Name, sum, n.Value)
+		}
+	}
+	check(root)
+
+	if _, err := ToTreeJSON(buf.Bytes(), "alloc_space"); err == nil {
+		t.Errorf("Unknown sample type should be rejected")
+	}
+}
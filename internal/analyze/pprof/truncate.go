@@ -0,0 +1,112 @@
+package pprof
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/pprof/profile"
+)
+
+// Truncation describes what was dropped from a capped detailed JSON
+type Truncation struct {
+	Samples        int    `json:"samples"`
+	TotalSamples   int    `json:"totalSamples"`
+	Locations      int    `json:"locations"`
+	TotalLocations int    `json:"totalLocations"`
+	Note           string `json:"note"`
+}
+
+// truncateProfile keeps the highest-value samples within the caps, dropping the locations, functions and mappings
+// only the other samples refer to. Samples are kept or dropped as a whole so that the kept stacks stay complete.
+// It returns nil if the profile is within the caps.
+func truncateProfile(prof *profile.Profile, maxSamples, maxLocations int) *Truncation {
+	totalSamples, totalLocations := len(prof.Sample), len(prof.Location)
+	if (maxSamples <= 0 || totalSamples <= maxSamples) && (maxLocations <= 0 || totalLocations <= maxLocations) {
+		return nil
+	}
+
+	samples := make([]*profile.Sample, len(prof.Sample))
+	copy(samples, prof.Sample)
+	sort.SliceStable(samples, func(i, j int) bool {
+		return sampleWeight(samples[i]) > sampleWeight(samples[j])
+	})
+	if maxSamples > 0 && len(samples) > maxSamples {
+		samples = samples[:maxSamples]
+	}
+
+	// Take samples in the order of the value until the next one would exceed the location cap
+	kept := make([]*profile.Sample, 0, len(samples))
+	locations := map[uint64]bool{}
+	for _, sample := range samples {
+		added := 0
+		for _, loc := range sample.Location {
+			if !locations[loc.ID] {
+				added++
+			}
+		}
+		if maxLocations > 0 && len(locations)+added > maxLocations {
+			continue
+		}
+		for _, loc := range sample.Location {
+			locations[loc.ID] = true
+		}
+		kept = append(kept, sample)
+	}
+	prof.Sample = kept
+
+	functions := map[uint64]bool{}
+	mappings := map[uint64]bool{}
+	keptLocations := make([]*profile.Location, 0, len(locations))
+	for _, loc := range prof.Location {
+		if !locations[loc.ID] {
+			continue
+		}
+		keptLocations = append(keptLocations, loc)
+		if loc.Mapping != nil {
+			mappings[loc.Mapping.ID] = true
+		}
+		for _, line := range loc.Line {
+			if line.Function != nil {
+				functions[line.Function.ID] = true
+			}
+		}
+	}
+	prof.Location = keptLocations
+
+	keptFunctions := make([]*profile.Function, 0, len(functions))
+	for _, fn := range prof.Function {
+		if functions[fn.ID] {
+			keptFunctions = append(keptFunctions, fn)
+		}
+	}
+	prof.Function = keptFunctions
+
+	keptMappings := make([]*profile.Mapping, 0, len(mappings))
+	for _, m := range prof.Mapping {
+		if mappings[m.ID] {
+			keptMappings = append(keptMappings, m)
+		}
+	}
+	prof.Mapping = keptMappings
+
+	return &Truncation{
+		Samples:        len(prof.Sample),
+		TotalSamples:   totalSamples,
+		Locations:      len(prof.Location),
+		TotalLocations: totalLocations,
+		Note: fmt.Sprintf("Output is truncated to the %d highest-value samples out of %d. "+
+			"Values of the dropped samples are not included anywhere, so totals computed from this output are lower than the actual ones.",
+			len(prof.Sample), totalSamples),
+	}
+}
+
+// sampleWeight is the magnitude of the first value, by which samples are ranked for truncation
+func sampleWeight(sample *profile.Sample) int64 {
+	if len(sample.Value) == 0 {
+		return 0
+	}
+	if v := sample.Value[0]; v < 0 {
+		return -v
+	}
+	return sample.Value[0]
+}
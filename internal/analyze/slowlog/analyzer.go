@@ -1,12 +1,15 @@
 package slowlog
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
 	"sort"
 	"time"
 
+	"github.com/kaz/pprotein/internal/analyze/meta"
 	"github.com/percona/go-mysql/log"
 	parser "github.com/percona/go-mysql/log/slow"
 	"github.com/percona/go-mysql/query"
@@ -24,6 +27,11 @@ type QueryStats struct {
 	RowsExaminedAvg float64   `json:"rows_examined_avg"` // Average number of rows examined
 	RowsSent        int64     `json:"rows_sent"`         // Total number of rows sent
 	RowsSentAvg     float64   `json:"rows_sent_avg"`     // Average number of rows sent
+	ExaminedPerSent float64   `json:"examined_per_sent"` // Rows examined per row sent, counting no rows sent as one
+	TimeShare       float64   `json:"time_share"`        // Share of the total execution time (0-1)
+	TotalLockTime   float64   `json:"total_lock_time"`   // Total lock time
+	AvgLockTime     float64   `json:"avg_lock_time"`     // Average lock time
+	MaxLockTime     float64   `json:"max_lock_time"`     // Maximum lock time
 	Example         string    `json:"example"`           // Example of query
 	FirstSeen       time.Time `json:"first_seen"`        // Time first seen
 	LastSeen        time.Time `json:"last_seen"`         // Time last seen
@@ -42,36 +50,87 @@ type SlowQuery struct {
 	Query        string    `json:"query"`         // SQL query
 }
 
+// HistogramBucket is the number of queries whose query time is within [Min, Max)
+type HistogramBucket = meta.HistogramBucket
+
+// DefaultHistogramBuckets are the upper bounds of the histogram buckets used when none are given
+var DefaultHistogramBuckets = []float64{0.5, 1, 2, 5, 10}
+
 // Structure to store analysis results
 type AnalysisResult struct {
-	TopQueryPatterns []QueryStats `json:"top_query_patterns"` // Top query patterns
-	SlowestQueries   []SlowQuery  `json:"slowest_queries"`    // Slowest queries
-	TotalQueries     int          `json:"total_queries"`      // Total number of queries
-	TotalTime        float64      `json:"total_time"`         // Total execution time
+	TopQueryPatterns   []QueryStats      `json:"top_query_patterns"`  // Top query patterns
+	TopLockPatterns    []QueryStats      `json:"top_lock_patterns"`   // Top query patterns by total lock time
+	InefficientQueries []QueryStats      `json:"inefficient_queries"` // Top query patterns by rows examined per row sent
+	SlowestQueries     []SlowQuery       `json:"slowest_queries"`     // Slowest queries
+	TotalQueries       int               `json:"total_queries"`       // Total number of queries
+	TotalTime          float64           `json:"total_time"`          // Total execution time
+	TotalLockTime      float64           `json:"total_lock_time"`     // Total lock time
+	Histogram          []HistogramBucket `json:"histogram"`           // Distribution of query times
+	Metadata           *meta.Metadata    `json:"metadata,omitempty"`  // Where the slow log was collected from
 }
 
-// Analyze parses MySQL slow logs using the Percona go-mysql library and returns the results in JSON format
-func Analyze(logContent []byte, threshold float64) (string, error) {
-	// Convert logContent to io.Reader (using a temporary file)
-	tmpFile, err := os.CreateTemp("", "slowlog")
+// Options controls the slowlog analysis
+type Options struct {
+	Threshold   float64      // Minimum query time to be listed as a slow query (seconds)
+	From        time.Time    // Events before this time are ignored (zero means no lower bound)
+	To          time.Time    // Events after this time are ignored (zero means no upper bound)
+	Exclude     []string     // Regexes matched against query fingerprints to ignore (e.g. "^commit")
+	Buckets     []float64    // Upper bounds of the histogram buckets in ascending order (DefaultHistogramBuckets if empty)
+	Fingerprint string       // Name of the fingerprint strategy grouping queries into patterns (FingerprintPercona if empty)
+	Source      *meta.Source // Where the slow log was collected from, echoed back in metadata.source if given
+	Format      string       // Format of the slow log (FormatText if empty)
+}
+
+// inRange reports whether the event time is within the time range
+func (o Options) inRange(ts time.Time) bool {
+	if !o.From.IsZero() && ts.Before(o.From) {
+		return false
+	}
+	if !o.To.IsZero() && ts.After(o.To) {
+		return false
+	}
+	return true
+}
+
+// Analyze parses MySQL slow logs using the Percona go-mysql library and returns the results in JSON format.
+// It stops parsing and returns ctx.Err() once ctx is done.
+func Analyze(ctx context.Context, logContent []byte, threshold float64) (string, error) {
+	return AnalyzeWithOptions(ctx, logContent, Options{Threshold: threshold})
+}
+
+// AnalyzeWithOptions is like Analyze but allows limiting the analysis to a time range.
+// Gzipped logs are decompressed transparently.
+func AnalyzeWithOptions(ctx context.Context, logContent []byte, opts Options) (string, error) {
+	logContent, err := meta.Decompress(logContent)
 	if err != nil {
-		return "", fmt.Errorf("failed to create temporary file: %v", err)
+		return "", err
 	}
-	defer os.Remove(tmpFile.Name())
-	defer tmpFile.Close()
 
-	if _, err = tmpFile.Write(logContent); err != nil {
-		return "", fmt.Errorf("failed to write to temporary file: %v", err)
+	threshold := opts.Threshold
+
+	excludes := make([]*regexp.Regexp, 0, len(opts.Exclude))
+	for _, pattern := range opts.Exclude {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid exclude pattern %q: %v", pattern, err)
+		}
+		excludes = append(excludes, re)
 	}
 
-	if _, err = tmpFile.Seek(0, 0); err != nil {
-		return "", fmt.Errorf("failed to seek in temporary file: %v", err)
+	histogram, err := meta.NewHistogram(opts.Buckets, DefaultHistogramBuckets)
+	if err != nil {
+		return "", err
 	}
 
-	// Initialize Percona parser
-	parser := parser.NewSlowLogParser(tmpFile, log.Options{
-		DefaultLocation: time.UTC,
-	})
+	fingerprint, err := FingerprinterByName(opts.Fingerprint)
+	if err != nil {
+		return "", err
+	}
+
+	forEach, err := eventReaderByFormat(opts.Format)
+	if err != nil {
+		return "", err
+	}
 
 	// Map to store statistics by pattern
 	patternStats := make(map[string]*QueryStats)
@@ -82,92 +141,95 @@ func Analyze(logContent []byte, threshold float64) (string, error) {
 	// Total statistics
 	totalQueries := 0
 	totalTime := 0.0
+	totalLockTime := 0.0
 
-	// Start the parser
-	go parser.Start()
+	// Events without a "# Time:" line inherit the time of the preceding event
+	var lastTs time.Time
 
-	// Timeout channel
-	timeout := time.After(30 * time.Second)
+	err = forEach(ctx, logContent, func(event *log.Event) {
+		ts := event.Ts
+		if ts.IsZero() {
+			ts = lastTs
+		}
+		lastTs = ts
+		if !opts.inRange(ts) {
+			return
+		}
 
-	// Process events from the event channel
-	eventChan := parser.EventChan()
-	for {
-		select {
-		case event, ok := <-eventChan:
-			if !ok {
-				// If the channel is closed
-				goto LOOP_END
-			}
-			if event == nil {
-				continue
-			}
+		// Normalize the query to group the same patterns
+		fingerprintQuery := fingerprint(event.Query)
+		if isExcluded(fingerprintQuery, excludes) {
+			return
+		}
 
-			// Check if the query time exceeds the threshold
-			queryTime := event.TimeMetrics["Query_time"]
-			if queryTime >= threshold {
-				// Add to slow queries
-				slowQuery := SlowQuery{
-					Time:         event.Ts,
-					User:         event.User,
-					Host:         event.Host,
-					Db:           event.Db,
-					QueryTime:    queryTime,
-					LockTime:     event.TimeMetrics["Lock_time"],
-					RowsSent:     int(event.NumberMetrics["Rows_sent"]),
-					RowsExamined: int(event.NumberMetrics["Rows_examined"]),
-					Query:        event.Query,
-				}
-				slowQueries = append(slowQueries, slowQuery)
+		// Check if the query time exceeds the threshold
+		queryTime := event.TimeMetrics["Query_time"]
+		lockTime := event.TimeMetrics["Lock_time"]
+		if queryTime >= threshold {
+			// Add to slow queries
+			slowQuery := SlowQuery{
+				Time:         event.Ts,
+				User:         event.User,
+				Host:         event.Host,
+				Db:           event.Db,
+				QueryTime:    queryTime,
+				LockTime:     lockTime,
+				RowsSent:     int(event.NumberMetrics["Rows_sent"]),
+				RowsExamined: int(event.NumberMetrics["Rows_examined"]),
+				Query:        event.Query,
 			}
+			slowQueries = append(slowQueries, slowQuery)
+		}
 
-			// Normalize the query to group the same patterns
-			fingerprintQuery := query.Fingerprint(event.Query)
-
-			// Update statistics
-			stats, exists := patternStats[fingerprintQuery]
-			if !exists {
-				stats = &QueryStats{
-					Pattern:   fingerprintQuery,
-					Count:     0,
-					TotalTime: 0,
-					MaxTime:   0,
-					MinTime:   float64(^uint64(0) >> 1), // Initialize with maximum value
-					Example:   event.Query,
-					FirstSeen: event.Ts,
-					LastSeen:  event.Ts,
-				}
-				patternStats[fingerprintQuery] = stats
+		// Update statistics
+		stats, exists := patternStats[fingerprintQuery]
+		if !exists {
+			stats = &QueryStats{
+				Pattern:   fingerprintQuery,
+				Count:     0,
+				TotalTime: 0,
+				MaxTime:   0,
+				MinTime:   float64(^uint64(0) >> 1), // Initialize with maximum value
+				Example:   event.Query,
+				FirstSeen: event.Ts,
+				LastSeen:  event.Ts,
 			}
+			patternStats[fingerprintQuery] = stats
+		}
 
-			// Update statistics
-			stats.Count++
-			stats.TotalTime += queryTime
-			stats.LastSeen = event.Ts
+		// Update statistics
+		stats.Count++
+		stats.TotalTime += queryTime
+		stats.LastSeen = event.Ts
 
-			if queryTime > stats.MaxTime {
-				stats.MaxTime = queryTime
-			}
-			if queryTime < stats.MinTime {
-				stats.MinTime = queryTime
-			}
+		if queryTime > stats.MaxTime {
+			stats.MaxTime = queryTime
+		}
+		if queryTime < stats.MinTime {
+			stats.MinTime = queryTime
+		}
 
-			// Update row count statistics
-			rowsExamined := int64(event.NumberMetrics["Rows_examined"])
-			rowsSent := int64(event.NumberMetrics["Rows_sent"])
-			stats.RowsExamined += rowsExamined
-			stats.RowsSent += rowsSent
+		// Update lock time statistics
+		stats.TotalLockTime += lockTime
+		if lockTime > stats.MaxLockTime {
+			stats.MaxLockTime = lockTime
+		}
 
-			totalQueries++
-			totalTime += queryTime
+		// Update row count statistics
+		rowsExamined := int64(event.NumberMetrics["Rows_examined"])
+		rowsSent := int64(event.NumberMetrics["Rows_sent"])
+		stats.RowsExamined += rowsExamined
+		stats.RowsSent += rowsSent
 
-		case <-timeout:
-			// Timeout processing
-			fmt.Printf("Slow log analysis has timed out")
-			goto LOOP_END
-		}
+		totalQueries++
+		totalTime += queryTime
+		totalLockTime += lockTime
+		histogram.Observe(queryTime)
+	})
+	if err != nil {
+		return "", err
 	}
 
-LOOP_END:
 	// Convert statistics to a slice and calculate averages
 	var statsSlice []QueryStats
 	for _, stat := range patternStats {
@@ -175,6 +237,11 @@ LOOP_END:
 			stat.AvgTime = stat.TotalTime / float64(stat.Count)
 			stat.RowsExaminedAvg = float64(stat.RowsExamined) / float64(stat.Count)
 			stat.RowsSentAvg = float64(stat.RowsSent) / float64(stat.Count)
+			stat.ExaminedPerSent = float64(stat.RowsExamined) / float64(max(stat.RowsSent, 1))
+			stat.AvgLockTime = stat.TotalLockTime / float64(stat.Count)
+			if totalTime > 0 {
+				stat.TimeShare = stat.TotalTime / totalTime
+			}
 			statsSlice = append(statsSlice, *stat)
 		}
 	}
@@ -184,6 +251,31 @@ LOOP_END:
 		return statsSlice[i].TotalTime > statsSlice[j].TotalTime
 	})
 
+	// Rank patterns waiting on locks separately from ones slow because of their own work
+	var lockSlice []QueryStats
+	for _, stat := range statsSlice {
+		if stat.TotalLockTime > 0 {
+			lockSlice = append(lockSlice, stat)
+		}
+	}
+	sort.Slice(lockSlice, func(i, j int) bool {
+		return lockSlice[i].TotalLockTime > lockSlice[j].TotalLockTime
+	})
+
+	// Rank patterns scanning many rows to return few regardless of their time, which won't scale
+	inefficientSlice := []QueryStats{}
+	for _, stat := range statsSlice {
+		if stat.RowsExamined > 0 {
+			inefficientSlice = append(inefficientSlice, stat)
+		}
+	}
+	sort.SliceStable(inefficientSlice, func(i, j int) bool {
+		if inefficientSlice[i].ExaminedPerSent != inefficientSlice[j].ExaminedPerSent {
+			return inefficientSlice[i].ExaminedPerSent > inefficientSlice[j].ExaminedPerSent
+		}
+		return inefficientSlice[i].RowsExamined > inefficientSlice[j].RowsExamined
+	})
+
 	// Sort the slowest queries by execution time (descending)
 	sort.Slice(slowQueries, func(i, j int) bool {
 		return slowQueries[i].QueryTime > slowQueries[j].QueryTime
@@ -195,6 +287,16 @@ LOOP_END:
 		topPatterns = topPatterns[:20]
 	}
 
+	topLockPatterns := lockSlice
+	if len(topLockPatterns) > 20 {
+		topLockPatterns = topLockPatterns[:20]
+	}
+
+	topInefficient := inefficientSlice
+	if len(topInefficient) > 20 {
+		topInefficient = topInefficient[:20]
+	}
+
 	topSlowQueries := slowQueries
 	if len(topSlowQueries) > 10 {
 		topSlowQueries = topSlowQueries[:10]
@@ -202,10 +304,17 @@ LOOP_END:
 
 	// Return results in JSON
 	result := AnalysisResult{
-		TopQueryPatterns: topPatterns,
-		SlowestQueries:   topSlowQueries,
-		TotalQueries:     totalQueries,
-		TotalTime:        totalTime,
+		TopQueryPatterns:   topPatterns,
+		TopLockPatterns:    topLockPatterns,
+		InefficientQueries: topInefficient,
+		SlowestQueries:     topSlowQueries,
+		TotalQueries:       totalQueries,
+		TotalTime:          totalTime,
+		TotalLockTime:      totalLockTime,
+		Histogram:          histogram,
+	}
+	if opts.Source != nil {
+		result.Metadata = &meta.Metadata{Source: opts.Source}
 	}
 
 	jsonResult, err := json.MarshalIndent(result, "", "  ")
@@ -215,3 +324,106 @@ LOOP_END:
 
 	return string(jsonResult), nil
 }
+
+// Query is a single event of the slow log with its query fingerprinted
+type Query struct {
+	Time        time.Time // Query execution time
+	Fingerprint string    // Normalized query as in the query patterns
+	QueryTime   float64   // Query execution time (seconds)
+}
+
+// Queries parses the slow log into queries in the order of the log.
+// Events without a "# Time:" line inherit the time of the preceding event.
+// Gzipped logs are decompressed transparently.
+func Queries(logContent []byte) ([]Query, error) {
+	logContent, err := meta.Decompress(logContent)
+	if err != nil {
+		return nil, err
+	}
+
+	var queries []Query
+	var lastTs time.Time
+	err = forEachEvent(context.Background(), logContent, func(event *log.Event) {
+		ts := event.Ts
+		if ts.IsZero() {
+			ts = lastTs
+		}
+		lastTs = ts
+
+		queries = append(queries, Query{
+			Time:        ts,
+			Fingerprint: query.Fingerprint(event.Query),
+			QueryTime:   event.TimeMetrics["Query_time"],
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return queries, nil
+}
+
+// isExcluded reports whether the fingerprint matches any of the exclude patterns
+func isExcluded(fingerprint string, excludes []*regexp.Regexp) bool {
+	for _, re := range excludes {
+		if re.MatchString(fingerprint) {
+			return true
+		}
+	}
+	return false
+}
+
+// forEachEvent parses the slow log using the Percona go-mysql library and calls fn for each event in order.
+// It stops the parser and returns ctx.Err() once ctx is done.
+func forEachEvent(ctx context.Context, logContent []byte, fn func(event *log.Event)) error {
+	// Convert logContent to io.Reader (using a temporary file)
+	tmpFile, err := os.CreateTemp("", "slowlog")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	if _, err = tmpFile.Write(logContent); err != nil {
+		return fmt.Errorf("failed to write to temporary file: %v", err)
+	}
+
+	if _, err = tmpFile.Seek(0, 0); err != nil {
+		return fmt.Errorf("failed to seek in temporary file: %v", err)
+	}
+
+	// Initialize Percona parser
+	parser := parser.NewSlowLogParser(tmpFile, log.Options{
+		DefaultLocation: time.UTC,
+	})
+
+	// Start the parser
+	go parser.Start()
+
+	// Timeout channel
+	timeout := time.After(30 * time.Second)
+
+	// Process events from the event channel
+	eventChan := parser.EventChan()
+	for {
+		select {
+		case event, ok := <-eventChan:
+			if !ok {
+				// If the channel is closed
+				return nil
+			}
+			if event == nil {
+				continue
+			}
+			fn(event)
+
+		case <-ctx.Done():
+			parser.Stop()
+			return ctx.Err()
+
+		case <-timeout:
+			// Timeout processing
+			fmt.Printf("Slow log analysis has timed out")
+			return nil
+		}
+	}
+}
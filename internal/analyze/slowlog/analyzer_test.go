@@ -1,11 +1,20 @@
 package slowlog
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/kaz/pprotein/internal/analyze/meta"
 )
 
 func TestAnalyze(t *testing.T) {
@@ -44,7 +53,7 @@ SELECT * FROM orders WHERE created_at > '2023-01-01';
 	}
 
 	// Analyze slowlog (threshold 0.5 seconds)
-	result, err := Analyze(logContent, 0.5)
+	result, err := Analyze(context.Background(), logContent, 0.5)
 	if err != nil {
 		t.Fatalf("Failed to analyze slowlog: %v", err)
 	}
@@ -166,7 +175,7 @@ SET timestamp=` + fmt.Sprintf("%d", currentTime.Unix()) + `;
 	}
 
 	// Analyze slowlog (threshold 1.0 seconds)
-	result, err := Analyze(logContent, 1.0)
+	result, err := Analyze(context.Background(), logContent, 1.0)
 	if err != nil {
 		t.Fatalf("Failed to analyze slowlog: %v", err)
 	}
@@ -197,3 +206,442 @@ SET timestamp=` + fmt.Sprintf("%d", currentTime.Unix()) + `;
 	}
 
 }
+
+func TestAnalyzeWithTimeRange(t *testing.T) {
+	sampleLog := `# Time: 2023-04-01T11:55:00.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 5.000000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 10000
+SET timestamp=1680350100;
+SELECT * FROM warmup WHERE id = 1;
+
+# Time: 2023-04-01T12:00:30.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 1.000000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 100
+SET timestamp=1680350430;
+SELECT * FROM users WHERE id = 1;
+
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 0.500000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 100
+SET timestamp=1680350431;
+SELECT * FROM users WHERE id = 2;
+
+# Time: 2023-04-01T12:05:00.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 4.000000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 10000
+SET timestamp=1680350700;
+SELECT * FROM cooldown WHERE id = 1;
+`
+
+	result, err := AnalyzeWithOptions(context.Background(), []byte(sampleLog), Options{
+		Threshold: 0,
+		From:      time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC),
+		To:        time.Date(2023, 4, 1, 12, 2, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("Failed to analyze slowlog: %v", err)
+	}
+
+	var analysisResult AnalysisResult
+	if err := json.Unmarshal([]byte(result), &analysisResult); err != nil {
+		t.Fatalf("Failed to decode JSON result: %v", err)
+	}
+
+	if analysisResult.TotalQueries != 2 {
+		t.Errorf("Total query count is different from expected. Expected: 2, Actual: %d", analysisResult.TotalQueries)
+	}
+	if analysisResult.TotalTime != 1.5 {
+		t.Errorf("Total time is different from expected. Expected: 1.5, Actual: %f", analysisResult.TotalTime)
+	}
+	for _, pattern := range analysisResult.TopQueryPatterns {
+		if strings.Contains(pattern.Pattern, "warmup") || strings.Contains(pattern.Pattern, "cooldown") {
+			t.Errorf("Out-of-range query was counted: %s", pattern.Pattern)
+		}
+	}
+}
+
+func TestAnalyzeTimeShare(t *testing.T) {
+	sampleLog := `# Time: 2023-04-01T12:00:00.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 3.000000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 100
+SET timestamp=1680350400;
+SELECT * FROM users WHERE id = 1;
+
+# Time: 2023-04-01T12:00:01.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 1.000000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 100
+SET timestamp=1680350401;
+SELECT * FROM users WHERE id = 2;
+
+# Time: 2023-04-01T12:00:02.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 1.000000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 100
+SET timestamp=1680350402;
+SELECT * FROM orders WHERE id = 1;
+`
+
+	result, err := Analyze(context.Background(), []byte(sampleLog), 0)
+	if err != nil {
+		t.Fatalf("Failed to analyze slowlog: %v", err)
+	}
+
+	var analysisResult AnalysisResult
+	if err := json.Unmarshal([]byte(result), &analysisResult); err != nil {
+		t.Fatalf("Failed to decode JSON result: %v", err)
+	}
+
+	sum := 0.0
+	for _, pattern := range analysisResult.TopQueryPatterns {
+		expected := pattern.TotalTime / analysisResult.TotalTime
+		if math.Abs(pattern.TimeShare-expected) > 1e-9 {
+			t.Errorf("Time share of %q is different from expected. Expected: %f, Actual: %f", pattern.Pattern, expected, pattern.TimeShare)
+		}
+		sum += pattern.TimeShare
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("Sum of time shares is different from expected. Expected: 1, Actual: %f", sum)
+	}
+	if share := analysisResult.TopQueryPatterns[0].TimeShare; math.Abs(share-0.8) > 1e-9 {
+		t.Errorf("Time share of the top pattern is different from expected. Expected: 0.8, Actual: %f", share)
+	}
+}
+
+func TestAnalyzeWithExclude(t *testing.T) {
+	sampleLog := `# Time: 2023-04-01T12:00:00.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 1.000000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 100
+SET timestamp=1680350400;
+SELECT * FROM users WHERE id = 1;
+
+# Time: 2023-04-01T12:00:01.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 2.000000  Lock_time: 0.000010 Rows_sent: 0  Rows_examined: 0
+SET timestamp=1680350401;
+COMMIT;
+
+# Time: 2023-04-01T12:00:02.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 0.100000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 0
+SET timestamp=1680350402;
+SELECT 1;
+`
+
+	result, err := AnalyzeWithOptions(context.Background(), []byte(sampleLog), Options{
+		Exclude: []string{"^commit", `^select \?$`},
+	})
+	if err != nil {
+		t.Fatalf("Failed to analyze slowlog: %v", err)
+	}
+
+	var analysisResult AnalysisResult
+	if err := json.Unmarshal([]byte(result), &analysisResult); err != nil {
+		t.Fatalf("Failed to decode JSON result: %v", err)
+	}
+
+	if analysisResult.TotalQueries != 1 {
+		t.Errorf("Total query count is different from expected. Expected: 1, Actual: %d", analysisResult.TotalQueries)
+	}
+	if strings.Contains(strings.ToLower(result), "commit") {
+		t.Errorf("Excluded COMMIT is present in the output: %s", result)
+	}
+
+	if _, err := AnalyzeWithOptions(context.Background(), []byte(sampleLog), Options{Exclude: []string{"("}}); err == nil {
+		t.Errorf("Invalid exclude pattern should be rejected")
+	}
+}
+
+func TestAnalyzeTopLockPatterns(t *testing.T) {
+	sampleLog := `# Time: 2023-04-01T12:00:00.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 0.600000  Lock_time: 0.500000 Rows_sent: 0  Rows_examined: 1
+SET timestamp=1680350400;
+UPDATE livestreams SET title = 'b' WHERE id = 1;
+
+# Time: 2023-04-01T12:00:01.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 0.600000  Lock_time: 0.400000 Rows_sent: 0  Rows_examined: 1
+SET timestamp=1680350401;
+UPDATE livestreams SET title = 'c' WHERE id = 2;
+
+# Time: 2023-04-01T12:00:02.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 2.000000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 100000
+SET timestamp=1680350402;
+SELECT * FROM users WHERE name = 'a';
+`
+
+	result, err := Analyze(context.Background(), []byte(sampleLog), 0)
+	if err != nil {
+		t.Fatalf("Failed to analyze slowlog: %v", err)
+	}
+
+	var analysisResult AnalysisResult
+	if err := json.Unmarshal([]byte(result), &analysisResult); err != nil {
+		t.Fatalf("Failed to decode JSON result: %v", err)
+	}
+
+	if top := analysisResult.TopQueryPatterns[0].Pattern; !strings.HasPrefix(top, "select") {
+		t.Errorf("Top pattern by query time is different from expected. Expected: select ..., Actual: %s", top)
+	}
+
+	if len(analysisResult.TopLockPatterns) == 0 {
+		t.Fatalf("No patterns ranked by lock time")
+	}
+	top := analysisResult.TopLockPatterns[0]
+	if !strings.HasPrefix(top.Pattern, "update") {
+		t.Errorf("Top pattern by lock time is different from expected. Expected: update ..., Actual: %s", top.Pattern)
+	}
+	if math.Abs(top.TotalLockTime-0.9) > 1e-9 {
+		t.Errorf("Total lock time is different from expected. Expected: 0.9, Actual: %f", top.TotalLockTime)
+	}
+	if math.Abs(top.MaxLockTime-0.5) > 1e-9 {
+		t.Errorf("Max lock time is different from expected. Expected: 0.5, Actual: %f", top.MaxLockTime)
+	}
+	if math.Abs(analysisResult.TotalLockTime-0.90001) > 1e-9 {
+		t.Errorf("Overall lock time is different from expected. Expected: 0.90001, Actual: %f", analysisResult.TotalLockTime)
+	}
+}
+
+func TestAnalyzeHistogram(t *testing.T) {
+	queryTimes := []float64{0.1, 0.7, 0.9, 1.5, 3, 3.5, 4, 12}
+	var sampleLog strings.Builder
+	for i, queryTime := range queryTimes {
+		fmt.Fprintf(&sampleLog, `# Time: 2023-04-01T12:00:%02d.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: %f  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 100
+SET timestamp=%d;
+SELECT * FROM users WHERE id = %d;
+
+`, i, queryTime, 1680350400+i, i)
+	}
+
+	tests := []struct {
+		name     string
+		buckets  []float64
+		expected map[string]int
+	}{
+		{
+			name:    "Default buckets",
+			buckets: nil,
+			expected: map[string]int{
+				"<0.5s": 1, "0.5s-1s": 2, "1s-2s": 1, "2s-5s": 3, "5s-10s": 0, "10s+": 1,
+			},
+		},
+		{
+			name:    "Custom buckets",
+			buckets: []float64{1, 3},
+			expected: map[string]int{
+				"<1s": 3, "1s-3s": 1, "3s+": 4,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := AnalyzeWithOptions(context.Background(), []byte(sampleLog.String()), Options{Buckets: tt.buckets})
+			if err != nil {
+				t.Fatalf("Failed to analyze slowlog: %v", err)
+			}
+
+			var analysisResult AnalysisResult
+			if err := json.Unmarshal([]byte(result), &analysisResult); err != nil {
+				t.Fatalf("Failed to decode JSON result: %v", err)
+			}
+
+			if len(analysisResult.Histogram) != len(tt.expected) {
+				t.Fatalf("Bucket count is different from expected. Expected: %d, Actual: %d", len(tt.expected), len(analysisResult.Histogram))
+			}
+			total := 0
+			for _, bucket := range analysisResult.Histogram {
+				if expected, ok := tt.expected[bucket.Label]; !ok || bucket.Count != expected {
+					t.Errorf("Count of %s is different from expected. Expected: %d, Actual: %d", bucket.Label, expected, bucket.Count)
+				}
+				total += bucket.Count
+			}
+			if total != analysisResult.TotalQueries {
+				t.Errorf("Sum of bucket counts is different from total queries. Expected: %d, Actual: %d", analysisResult.TotalQueries, total)
+			}
+		})
+	}
+
+	if _, err := AnalyzeWithOptions(context.Background(), []byte(sampleLog.String()), Options{Buckets: []float64{2, 1}}); err == nil {
+		t.Errorf("Unordered buckets should be rejected")
+	}
+}
+
+func TestAnalyzeWithSource(t *testing.T) {
+	sampleLog := `# Time: 2023-04-01T12:00:00.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 1.000000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 100
+SET timestamp=1680350400;
+SELECT * FROM users WHERE id = 1;
+`
+	source := &meta.Source{
+		Label:    "db1",
+		GroupID:  "2023-04-01_12-00-00",
+		Duration: 60,
+		Datetime: time.Date(2023, 4, 1, 12, 1, 0, 0, time.UTC),
+	}
+
+	result, err := AnalyzeWithOptions(context.Background(), []byte(sampleLog), Options{Source: source})
+	if err != nil {
+		t.Fatalf("Failed to analyze slowlog: %v", err)
+	}
+
+	var analysisResult struct {
+		Metadata struct {
+			Source map[string]interface{} `json:"source"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal([]byte(result), &analysisResult); err != nil {
+		t.Fatalf("Failed to decode JSON result: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"label":    "db1",
+		"group_id": "2023-04-01_12-00-00",
+		"duration": float64(60),
+		"datetime": "2023-04-01T12:01:00Z",
+	}
+	for key, value := range expected {
+		if analysisResult.Metadata.Source[key] != value {
+			t.Errorf("Metadata %s is different from expected. Expected: %v, Actual: %v", key, value, analysisResult.Metadata.Source[key])
+		}
+	}
+}
+
+func TestAnalyzeCancel(t *testing.T) {
+	var largeLog strings.Builder
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(&largeLog, `# Time: 2023-04-01T12:00:00.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 0.100000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 100
+SET timestamp=1680350400;
+SELECT * FROM users WHERE id = %d;
+`, i)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := Analyze(ctx, []byte(largeLog.String()), 0.5); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Analysis is not cancelled. Error: %v", err)
+	}
+}
+
+func TestAnalyzeGzip(t *testing.T) {
+	logContent, err := os.ReadFile("testdata/large_slowlog.log")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	if _, err := gw.Write(logContent); err != nil {
+		t.Fatalf("Failed to compress log: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("Failed to compress log: %v", err)
+	}
+
+	expected, err := Analyze(context.Background(), logContent, 0.5)
+	if err != nil {
+		t.Fatalf("Failed to analyze slowlog: %v", err)
+	}
+	actual, err := Analyze(context.Background(), compressed.Bytes(), 0.5)
+	if err != nil {
+		t.Fatalf("Failed to analyze gzipped slowlog: %v", err)
+	}
+	if actual != expected {
+		t.Errorf("Result of gzipped log is different from expected")
+	}
+
+	if _, err := Analyze(context.Background(), compressed.Bytes()[:10], 0.5); err == nil {
+		t.Errorf("Truncated gzip should be rejected")
+	}
+	expectedQueries, err := Queries(logContent)
+	if err != nil {
+		t.Fatalf("Failed to parse queries: %v", err)
+	}
+	if actualQueries, err := Queries(compressed.Bytes()); err != nil || !reflect.DeepEqual(actualQueries, expectedQueries) {
+		t.Errorf("Queries of gzipped log are different from expected (%v)", err)
+	}
+}
+
+func TestAnalyzeInefficientQueries(t *testing.T) {
+	sampleLog := `# Time: 2023-04-01T12:00:00.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 3.000000  Lock_time: 0.000010 Rows_sent: 100  Rows_examined: 200
+SET timestamp=1680350400;
+SELECT * FROM livecomments WHERE livestream_id = 1;
+
+# Time: 2023-04-01T12:00:01.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 0.010000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 50000
+SET timestamp=1680350401;
+SELECT * FROM users WHERE name = 'a';
+
+# Time: 2023-04-01T12:00:02.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 0.010000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 30000
+SET timestamp=1680350402;
+SELECT * FROM users WHERE name = 'b';
+
+# Time: 2023-04-01T12:00:03.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 0.001000  Lock_time: 0.000010 Rows_sent: 0  Rows_examined: 0
+SET timestamp=1680350403;
+SELECT 1;
+`
+
+	result, err := Analyze(context.Background(), []byte(sampleLog), 0)
+	if err != nil {
+		t.Fatalf("Failed to analyze slowlog: %v", err)
+	}
+
+	var analysisResult AnalysisResult
+	if err := json.Unmarshal([]byte(result), &analysisResult); err != nil {
+		t.Fatalf("Failed to decode JSON result: %v", err)
+	}
+
+	if top := analysisResult.TopQueryPatterns[0].Pattern; !strings.Contains(top, "livecomments") {
+		t.Errorf("Top pattern by query time is different from expected. Expected: select * from livecomments ..., Actual: %s", top)
+	}
+
+	if len(analysisResult.InefficientQueries) != 2 {
+		t.Fatalf("Inefficient query count is different from expected. Expected: 2, Actual: %d", len(analysisResult.InefficientQueries))
+	}
+	top := analysisResult.InefficientQueries[0]
+	if !strings.Contains(top.Pattern, "users") {
+		t.Errorf("Top inefficient pattern is different from expected. Expected: select * from users ..., Actual: %s", top.Pattern)
+	}
+	if math.Abs(top.ExaminedPerSent-40000) > 1e-9 {
+		t.Errorf("Rows examined per row sent is different from expected. Expected: 40000, Actual: %f", top.ExaminedPerSent)
+	}
+	if math.Abs(analysisResult.InefficientQueries[1].ExaminedPerSent-2) > 1e-9 {
+		t.Errorf("Rows examined per row sent is different from expected. Expected: 2, Actual: %f", analysisResult.InefficientQueries[1].ExaminedPerSent)
+	}
+}
+
+func TestAnalyzeNoInefficientQueries(t *testing.T) {
+	sampleLog := `# Time: 2023-04-01T12:00:00.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 0.001000  Lock_time: 0.000010 Rows_sent: 0  Rows_examined: 0
+SET timestamp=1680350400;
+SELECT 1;
+`
+
+	result, err := Analyze(context.Background(), []byte(sampleLog), 0)
+	if err != nil {
+		t.Fatalf("Failed to analyze slowlog: %v", err)
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(result), &raw); err != nil {
+		t.Fatalf("Failed to decode JSON result: %v", err)
+	}
+
+	// An empty list rather than null, so that clients can iterate it as is
+	if string(raw["inefficient_queries"]) != "[]" {
+		t.Errorf("Inefficient queries are different from expected. Expected: [], Actual: %s", raw["inefficient_queries"])
+	}
+}
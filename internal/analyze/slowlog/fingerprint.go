@@ -0,0 +1,61 @@
+package slowlog
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/percona/go-mysql/query"
+)
+
+// Fingerprinter normalizes a query so that the queries of the same pattern have the same result
+type Fingerprinter func(q string) string
+
+// Names of the fingerprint strategies
+const (
+	// FingerprintPercona is the fingerprint of Percona Toolkit, which also lowercases the query
+	FingerprintPercona = "percona"
+	// FingerprintLiterals keeps the query as written but replaces the literals and collapses IN and VALUES lists
+	FingerprintLiterals = "literals"
+)
+
+var fingerprinters = map[string]Fingerprinter{
+	FingerprintPercona:  query.Fingerprint,
+	FingerprintLiterals: fingerprintLiterals,
+}
+
+// FingerprinterByName returns the fingerprint strategy of the name, which defaults to FingerprintPercona if empty
+func FingerprinterByName(name string) (Fingerprinter, error) {
+	if name == "" {
+		name = FingerprintPercona
+	}
+	if fp, ok := fingerprinters[name]; ok {
+		return fp, nil
+	}
+
+	names := make([]string, 0, len(fingerprinters))
+	for n := range fingerprinters {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown fingerprint %q, must be one of: %s", name, strings.Join(names, ", "))
+}
+
+var (
+	stringLiteralPattern = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.)*"`)
+	numberLiteralPattern = regexp.MustCompile(`\b(?:0x[0-9a-fA-F]+|\d+(?:\.\d+)?(?:[eE][-+]?\d+)?)\b`)
+	inListPattern        = regexp.MustCompile(`(?i)\b(IN)\s*\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	valuesListPattern    = regexp.MustCompile(`(\(\s*\?(?:\s*,\s*\?)*\s*\))(?:\s*,\s*\(\s*\?(?:\s*,\s*\?)*\s*\))+`)
+	whitespacePattern    = regexp.MustCompile(`\s+`)
+)
+
+// fingerprintLiterals replaces the string and number literals with "?" and collapses lists of them of any length
+func fingerprintLiterals(q string) string {
+	q = stringLiteralPattern.ReplaceAllString(q, "?")
+	q = numberLiteralPattern.ReplaceAllString(q, "?")
+	q = inListPattern.ReplaceAllString(q, "$1 (?+)")
+	q = valuesListPattern.ReplaceAllString(q, "$1")
+	q = whitespacePattern.ReplaceAllString(q, " ")
+	return strings.TrimSuffix(strings.TrimSpace(q), ";")
+}
@@ -0,0 +1,81 @@
+package slowlog
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestFingerprintLiterals(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{
+			name:     "IN lists of different lengths",
+			query:    "SELECT * FROM `Users` WHERE id IN (1, 2, 3) AND name = 'a''b'",
+			expected: "SELECT * FROM `Users` WHERE id IN (?+) AND name = ?",
+		},
+		{
+			name:     "Single element IN list",
+			query:    "SELECT * FROM `Users` WHERE id IN (42) AND name = \"x\"",
+			expected: "SELECT * FROM `Users` WHERE id IN (?+) AND name = ?",
+		},
+		{
+			name:     "Multi-row VALUES",
+			query:    "INSERT INTO t2 (a, b) VALUES (1, 'x'),\n  (2, 'y'), (3, 'z');",
+			expected: "INSERT INTO t2 (a, b) VALUES (?, ?)",
+		},
+		{
+			name:     "Identifiers with digits are kept",
+			query:    "SELECT c1 FROM t1 LIMIT 10",
+			expected: "SELECT c1 FROM t1 LIMIT ?",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := fingerprintLiterals(tt.query); actual != tt.expected {
+				t.Errorf("Fingerprint is different from expected. Expected: %s, Actual: %s", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestAnalyzeWithFingerprint(t *testing.T) {
+	sampleLog := `# Time: 2023-04-01T12:00:00.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 1.000000  Lock_time: 0.000010 Rows_sent: 3  Rows_examined: 3
+SET timestamp=1680350400;
+SELECT * FROM users WHERE id IN (1, 2, 3);
+
+# Time: 2023-04-01T12:00:01.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 1.000000  Lock_time: 0.000010 Rows_sent: 5  Rows_examined: 5
+SET timestamp=1680350401;
+SELECT * FROM users WHERE id IN (4, 5, 6, 7, 8);
+`
+
+	result, err := AnalyzeWithOptions(context.Background(), []byte(sampleLog), Options{Fingerprint: FingerprintLiterals})
+	if err != nil {
+		t.Fatalf("Failed to analyze slowlog: %v", err)
+	}
+
+	var analysisResult AnalysisResult
+	if err := json.Unmarshal([]byte(result), &analysisResult); err != nil {
+		t.Fatalf("Failed to decode JSON result: %v", err)
+	}
+
+	if len(analysisResult.TopQueryPatterns) != 1 {
+		t.Fatalf("Pattern count is different from expected. Expected: 1, Actual: %d", len(analysisResult.TopQueryPatterns))
+	}
+	pattern := analysisResult.TopQueryPatterns[0]
+	if pattern.Pattern != "SELECT * FROM users WHERE id IN (?+)" || pattern.Count != 2 {
+		t.Errorf("Pattern is different from expected. Actual: %s (count %d)", pattern.Pattern, pattern.Count)
+	}
+
+	if _, err := AnalyzeWithOptions(context.Background(), []byte(sampleLog), Options{Fingerprint: "unknown"}); err == nil {
+		t.Errorf("Unknown fingerprint should be rejected")
+	}
+}
@@ -0,0 +1,136 @@
+package slowlog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/percona/go-mysql/log"
+)
+
+// Formats of the slow log
+const (
+	FormatText = "text" // Slow query log file written with log_output=FILE
+	FormatJSON = "json" // JSON array of the rows of the mysql.slow_log table written with log_output=TABLE
+)
+
+// jsonEntry is a row of the mysql.slow_log table
+type jsonEntry struct {
+	StartTime    string          `json:"start_time"`
+	UserHost     string          `json:"user_host"`
+	QueryTime    json.RawMessage `json:"query_time"`
+	LockTime     json.RawMessage `json:"lock_time"`
+	RowsSent     int64           `json:"rows_sent"`
+	RowsExamined int64           `json:"rows_examined"`
+	Db           string          `json:"db"`
+	SQLText      string          `json:"sql_text"`
+}
+
+// Layouts tried for start_time, which is a DATETIME in the table
+var jsonTimeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999"}
+
+// AnalyzeJSON is like Analyze but reads the slow log in FormatJSON
+func AnalyzeJSON(ctx context.Context, logContent []byte, threshold float64) (string, error) {
+	return AnalyzeWithOptions(ctx, logContent, Options{Threshold: threshold, Format: FormatJSON})
+}
+
+// eventReaderByFormat returns the function calling fn for each event of the slow log in the format.
+// FormatText is used if the name is empty.
+func eventReaderByFormat(format string) (func(ctx context.Context, logContent []byte, fn func(event *log.Event)) error, error) {
+	switch format {
+	case "", FormatText:
+		return forEachEvent, nil
+	case FormatJSON:
+		return forEachJSONEvent, nil
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+// forEachJSONEvent parses the slow log in FormatJSON and calls fn for each event in order.
+// It returns ctx.Err() once ctx is done.
+func forEachJSONEvent(ctx context.Context, logContent []byte, fn func(event *log.Event)) error {
+	var entries []jsonEntry
+	if err := json.Unmarshal(logContent, &entries); err != nil {
+		return fmt.Errorf("failed to parse JSON slow log: %w", err)
+	}
+
+	for i, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		queryTime, err := parseJSONDuration(entry.QueryTime)
+		if err != nil {
+			return fmt.Errorf("invalid query_time of entry %d: %w", i, err)
+		}
+		lockTime, err := parseJSONDuration(entry.LockTime)
+		if err != nil {
+			return fmt.Errorf("invalid lock_time of entry %d: %w", i, err)
+		}
+
+		event := log.NewEvent()
+		event.Db = entry.Db
+		event.Query = strings.TrimSpace(entry.SQLText)
+		event.TimeMetrics["Query_time"] = queryTime
+		event.TimeMetrics["Lock_time"] = lockTime
+		event.NumberMetrics["Rows_sent"] = uint64(entry.RowsSent)
+		event.NumberMetrics["Rows_examined"] = uint64(entry.RowsExamined)
+
+		// user_host looks like "user[user] @ host [ip]"
+		user, host, _ := strings.Cut(entry.UserHost, " @ ")
+		user, _, _ = strings.Cut(user, "[")
+		host, _, _ = strings.Cut(host, " [")
+		event.User, event.Host = strings.TrimSpace(user), strings.TrimSpace(host)
+
+		for _, layout := range jsonTimeLayouts {
+			if ts, err := time.ParseInLocation(layout, entry.StartTime, time.UTC); err == nil {
+				event.Ts = ts
+				break
+			}
+		}
+
+		fn(event)
+	}
+	return nil
+}
+
+// parseJSONDuration parses seconds given as a number or as a TIME string like "00:00:01.500000"
+func parseJSONDuration(raw json.RawMessage) (float64, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, nil
+	}
+
+	var seconds float64
+	if err := json.Unmarshal(raw, &seconds); err == nil {
+		return seconds, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, err
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) == 1 {
+		return strconv.ParseFloat(s, 64)
+	}
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("unexpected time: %s", s)
+	}
+	hours, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	minutes, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	secs, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return 0, err
+	}
+	return hours*3600 + minutes*60 + secs, nil
+}
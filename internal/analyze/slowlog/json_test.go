@@ -0,0 +1,56 @@
+package slowlog
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestAnalyzeJSON(t *testing.T) {
+	logContent := `[
+		{"start_time": "2023-04-01 12:00:00.000000", "user_host": "isucon[isucon] @ localhost []", "query_time": "00:00:01.500000", "lock_time": "00:00:00.000100", "rows_sent": 1, "rows_examined": 10000, "db": "isuconp", "sql_text": "SELECT * FROM users WHERE id = 1"},
+		{"start_time": "2023-04-01 12:00:01.000000", "user_host": "isucon[isucon] @ localhost []", "query_time": "00:00:00.500000", "lock_time": "00:00:00.000100", "rows_sent": 1, "rows_examined": 10000, "db": "isuconp", "sql_text": "SELECT * FROM users WHERE id = 2"},
+		{"start_time": "2023-04-01T12:00:02Z", "user_host": "isucon[isucon] @ localhost []", "query_time": 0.2, "lock_time": 0, "rows_sent": 0, "rows_examined": 1, "db": "isuconp", "sql_text": "UPDATE posts SET title = 'a' WHERE id = 3"}
+	]`
+
+	raw, err := AnalyzeJSON(context.Background(), []byte(logContent), 1.0)
+	if err != nil {
+		t.Fatalf("Failed to analyze JSON slow log: %v", err)
+	}
+	result := &AnalysisResult{}
+	if err := json.Unmarshal([]byte(raw), result); err != nil {
+		t.Fatalf("Failed to parse analysis result: %v", err)
+	}
+
+	if result.TotalQueries != 3 {
+		t.Errorf("Total queries is different from expected. Expected: 3, Actual: %d", result.TotalQueries)
+	}
+	if math.Abs(result.TotalTime-2.2) > 1e-9 {
+		t.Errorf("Total time is different from expected. Expected: 2.2, Actual: %f", result.TotalTime)
+	}
+	if len(result.TopQueryPatterns) != 2 {
+		t.Fatalf("Pattern count is different from expected. Expected: 2, Actual: %d", len(result.TopQueryPatterns))
+	}
+	if top := result.TopQueryPatterns[0]; top.Count != 2 || top.RowsExamined != 20000 {
+		t.Errorf("Top pattern is different from expected. Actual: %+v", top)
+	}
+
+	if len(result.SlowestQueries) != 1 {
+		t.Fatalf("Slow query count is different from expected. Expected: 1, Actual: %d", len(result.SlowestQueries))
+	}
+	slowest := result.SlowestQueries[0]
+	if slowest.User != "isucon" || slowest.Host != "localhost" || slowest.Db != "isuconp" {
+		t.Errorf("Slowest query is different from expected. Actual: %+v", slowest)
+	}
+	if slowest.Time.Format("2006-01-02 15:04:05") != "2023-04-01 12:00:00" {
+		t.Errorf("Time of the slowest query is different from expected. Actual: %v", slowest.Time)
+	}
+
+	if _, err := AnalyzeJSON(context.Background(), []byte("# Time: 2023-04-01T12:00:00Z"), 1.0); err == nil {
+		t.Errorf("Text slow log is accepted as JSON")
+	}
+	if _, err := AnalyzeWithOptions(context.Background(), []byte(logContent), Options{Format: "xml"}); err == nil {
+		t.Errorf("Unknown format is accepted")
+	}
+}
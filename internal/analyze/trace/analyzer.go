@@ -0,0 +1,205 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/kaz/pprotein/internal/analyze/meta"
+	"golang.org/x/exp/trace"
+)
+
+type (
+	// PauseStats is the number and the duration of intervals like GC cycles and syscalls (seconds)
+	PauseStats struct {
+		Count int     `json:"count"`
+		Total float64 `json:"total"`
+		Max   float64 `json:"max"`
+	}
+
+	// GoroutineStats counts the goroutines of the trace
+	GoroutineStats struct {
+		Seen      int `json:"seen"`      // Goroutines existing at some point of the trace
+		Created   int `json:"created"`   // Goroutines created during the trace
+		Destroyed int `json:"destroyed"` // Goroutines exited during the trace
+	}
+
+	// SyscallStats summarizes the syscalls of the trace
+	SyscallStats struct {
+		PauseStats
+		Blocked int `json:"blocked"` // Syscalls long enough for the P to be handed off to another M
+	}
+
+	// Summary is the result of Analyze
+	Summary struct {
+		Version    string          `json:"version"`
+		Duration   float64         `json:"duration"`  // From the first to the last event (seconds)
+		GC         *PauseStats     `json:"gc"`        // GC cycles, from the start to the end of each cycle
+		STW        *PauseStats     `json:"stw"`       // Stop-the-world pauses of any kind
+		GCPauses   *PauseStats     `json:"gc_pauses"` // Stop-the-world pauses of the GC
+		Goroutines *GoroutineStats `json:"goroutines"`
+		Syscalls   *SyscallStats   `json:"syscalls"`
+		Metadata   *meta.Metadata  `json:"metadata,omitempty"` // Where the trace was collected from
+	}
+
+	// Options controls the trace analysis
+	Options struct {
+		Source *meta.Source // Where the trace was collected from, echoed back in metadata.source if given
+	}
+)
+
+// Names of the ranges of GC cycles and stop-the-world pauses, which are followed by the kind of the pause
+const (
+	gcRangeName    = "GC concurrent mark phase"
+	stwRangePrefix = "stop-the-world ("
+)
+
+// add records an interval
+func (s *PauseStats) add(d time.Duration) {
+	seconds := d.Seconds()
+	s.Count++
+	s.Total += seconds
+	s.Max = max(s.Max, seconds)
+}
+
+// Analyze summarizes GC pauses, goroutine counts and syscall blocking of a Go execution trace
+// captured by runtime/trace or /debug/pprof/trace. The trace is parsed with golang.org/x/exp/trace,
+// which supports the formats of Go 1.11 through the version of the trace package pinned in go.mod.
+func Analyze(content []byte) (string, error) {
+	return AnalyzeWithOptions(content, Options{})
+}
+
+// AnalyzeWithOptions is like Analyze but echoes back the source of the trace
+func AnalyzeWithOptions(content []byte, opts Options) (string, error) {
+	summary, err := Summarize(content)
+	if err != nil {
+		return "", err
+	}
+	if opts.Source != nil {
+		summary.Metadata = &meta.Metadata{Source: opts.Source}
+	}
+	jsonResult, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal result: %w", err)
+	}
+	return string(jsonResult), nil
+}
+
+// Summarize is like Analyze but returns the summary as is
+func Summarize(content []byte) (*Summary, error) {
+	content, err := meta.Decompress(content)
+	if err != nil {
+		return nil, err
+	}
+
+	// The reader doesn't tell the version, so it is taken from the header, which the reader validates
+	var version int
+	fmt.Sscanf(string(content[:min(len(content), 16)]), "go 1.%d trace", &version)
+
+	r, err := trace.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trace: %w", err)
+	}
+
+	var (
+		first, last trace.Time
+
+		gcBegin    trace.Time                          // Start of the pending GC cycle, 0 if none
+		stwBegins  = map[trace.ResourceID]trace.Time{} // Scope to the start of the pending pause
+		sysBegins  = map[trace.GoID]trace.Time{}       // Goroutine to the start of the pending syscall
+		goroutines = map[trace.GoID]bool{}
+	)
+
+	summary := &Summary{
+		GC:         &PauseStats{},
+		STW:        &PauseStats{},
+		GCPauses:   &PauseStats{},
+		Goroutines: &GoroutineStats{},
+		Syscalls:   &SyscallStats{},
+	}
+
+	for {
+		ev, err := r.ReadEvent()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read event: %w", err)
+		}
+
+		ts := ev.Time()
+		if first == 0 || ts < first {
+			first = ts
+		}
+		last = max(last, ts)
+
+		switch ev.Kind() {
+		case trace.EventRangeBegin:
+			rng := ev.Range()
+			switch {
+			case rng.Name == gcRangeName:
+				gcBegin = ts
+			case strings.HasPrefix(rng.Name, stwRangePrefix):
+				stwBegins[rng.Scope] = ts
+			}
+		case trace.EventRangeEnd:
+			rng := ev.Range()
+			switch {
+			case rng.Name == gcRangeName:
+				if gcBegin != 0 {
+					summary.GC.add(ts.Sub(gcBegin))
+					gcBegin = 0
+				}
+			case strings.HasPrefix(rng.Name, stwRangePrefix):
+				if begin, ok := stwBegins[rng.Scope]; ok {
+					delete(stwBegins, rng.Scope)
+					summary.STW.add(ts.Sub(begin))
+					// The kinds of the pauses of the GC are "GC sweep termination" and "GC mark termination"
+					if strings.HasPrefix(rng.Name, stwRangePrefix+"GC ") {
+						summary.GCPauses.add(ts.Sub(begin))
+					}
+				}
+			}
+
+		case trace.EventStateTransition:
+			st := ev.StateTransition()
+			if st.Resource.Kind != trace.ResourceGoroutine {
+				continue
+			}
+			id := st.Resource.Goroutine()
+			from, to := st.Goroutine()
+			if to != trace.GoNotExist {
+				goroutines[id] = true
+			}
+			if from == trace.GoNotExist {
+				summary.Goroutines.Created++
+			}
+			if to == trace.GoNotExist && from != trace.GoUndetermined {
+				summary.Goroutines.Destroyed++
+			}
+
+			if to == trace.GoSyscall {
+				sysBegins[id] = ts
+			} else if from == trace.GoSyscall {
+				if begin, ok := sysBegins[id]; ok {
+					delete(sysBegins, id)
+					summary.Syscalls.add(ts.Sub(begin))
+					// The P is handed off while blocked, so the goroutine has to wait for another one
+					if to == trace.GoRunnable {
+						summary.Syscalls.Blocked++
+					}
+				}
+			}
+		}
+	}
+
+	summary.Version = fmt.Sprintf("go 1.%d", version)
+	if last > first {
+		summary.Duration = last.Sub(first).Seconds()
+	}
+	summary.Goroutines.Seen = len(goroutines)
+	return summary, nil
+}
@@ -0,0 +1,95 @@
+package trace
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kaz/pprotein/internal/analyze/meta"
+)
+
+// testdata/trace.out is captured with runtime/trace while 8 goroutines sleep and read a file, followed by runtime.GC()
+func TestAnalyze(t *testing.T) {
+	content, err := os.ReadFile("testdata/trace.out")
+	if err != nil {
+		t.Fatalf("Failed to read trace: %v", err)
+	}
+
+	result, err := Analyze(content)
+	if err != nil {
+		t.Fatalf("Failed to analyze trace: %v", err)
+	}
+	summary := &Summary{}
+	if err := json.Unmarshal([]byte(result), summary); err != nil {
+		t.Fatalf("Failed to decode JSON result: %v", err)
+	}
+
+	if summary.Version != "go 1.26" {
+		t.Errorf("Version is different from expected. Expected: go 1.26, Actual: %s", summary.Version)
+	}
+	if summary.Duration <= 0 {
+		t.Errorf("Duration is not positive: %v", summary.Duration)
+	}
+	if summary.GC.Count != 1 || summary.GC.Total <= 0 {
+		t.Errorf("GC cycle is different from expected. Expected: 1, Actual: %+v", summary.GC)
+	}
+	if summary.GCPauses.Count != 2 || summary.STW.Count < summary.GCPauses.Count {
+		t.Errorf("Pauses are different from expected. Expected: 2 pauses of the GC, Actual: %+v of %+v", summary.GCPauses, summary.STW)
+	}
+	if summary.GCPauses.Max > summary.GCPauses.Total || summary.GCPauses.Max <= 0 {
+		t.Errorf("Max pause is inconsistent: %+v", summary.GCPauses)
+	}
+	if summary.Goroutines.Created < 8 || summary.Goroutines.Destroyed < 8 || summary.Goroutines.Seen < summary.Goroutines.Created {
+		t.Errorf("Goroutines are different from expected. Expected: at least 8 created and destroyed, Actual: %+v", summary.Goroutines)
+	}
+	if summary.Syscalls.Count == 0 || summary.Syscalls.Total <= 0 {
+		t.Errorf("Syscalls are not counted: %+v", summary.Syscalls)
+	}
+}
+
+func TestAnalyzeWithSource(t *testing.T) {
+	content, err := os.ReadFile("testdata/trace.out")
+	if err != nil {
+		t.Fatalf("Failed to read trace: %v", err)
+	}
+	source := &meta.Source{Label: "app1", GroupID: "2023-04-01_12-00-00", Duration: 5, Datetime: time.Date(2023, 4, 1, 12, 0, 5, 0, time.UTC)}
+
+	result, err := AnalyzeWithOptions(content, Options{Source: source})
+	if err != nil {
+		t.Fatalf("Failed to analyze trace: %v", err)
+	}
+	summary := &Summary{}
+	if err := json.Unmarshal([]byte(result), summary); err != nil {
+		t.Fatalf("Failed to decode JSON result: %v", err)
+	}
+	if summary.Metadata == nil || !reflect.DeepEqual(summary.Metadata.Source, source) {
+		t.Errorf("Source is different from expected. Expected: %+v, Actual: %+v", source, summary.Metadata)
+	}
+}
+
+func TestAnalyzeInvalid(t *testing.T) {
+	content, err := os.ReadFile("testdata/trace.out")
+	if err != nil {
+		t.Fatalf("Failed to read trace: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{name: "Empty", content: []byte{}},
+		{name: "Not a trace", content: []byte("time:2023-04-01T12:00:00+09:00\turi:/\n")},
+		{name: "Old version", content: []byte("go 1.21 trace\x00\x00\x00")},
+		{name: "Truncated", content: content[:len(content)/2]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Analyze(tt.content); err == nil {
+				t.Errorf("Invalid trace was analyzed")
+			}
+		})
+	}
+}
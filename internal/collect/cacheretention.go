@@ -0,0 +1,214 @@
+package collect
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/kaz/pprotein/internal/storage"
+)
+
+// Environment variables limiting the retention of the cached analysis results, independently of the raw files
+const (
+	CacheTTLEnv     = "PPROTEIN_CACHE_TTL"      // Duration after which cached results are dropped (e.g. 72h)
+	CacheMaxSizeEnv = "PPROTEIN_CACHE_MAX_SIZE" // Total size over which the oldest cached results are dropped (e.g. 512M)
+)
+
+// Bucket recording when and how large each result was cached, as the cache bucket holds only the results
+const cacheIndexTypeKey = "cache-index"
+
+// Interval of the eviction of cached results
+const cacheEvictionInterval = 5 * time.Minute
+
+type (
+	// CacheRetention bounds the cached analysis results. Zero values mean no limit.
+	// Dropped results are processed again from the raw files when requested.
+	CacheRetention struct {
+		TTL     time.Duration
+		MaxSize int64
+	}
+
+	cacheIndexEntry struct {
+		ID       string    `json:"id"`
+		CachedAt time.Time `json:"cached_at"`
+		Size     int64     `json:"size"`
+	}
+)
+
+// CacheRetentionFromEnv reads the retention of the cached results from the environment
+func CacheRetentionFromEnv() CacheRetention {
+	retention := CacheRetention{}
+	if v := os.Getenv(CacheTTLEnv); v != "" {
+		if ttl, err := time.ParseDuration(v); err == nil && ttl >= 0 {
+			retention.TTL = ttl
+		} else {
+			log.Printf("[!] invalid %s %q, keeping cached results", CacheTTLEnv, v)
+		}
+	}
+	if v := os.Getenv(CacheMaxSizeEnv); v != "" {
+		if size, err := storage.ParseSize(v); err == nil {
+			retention.MaxSize = size
+		} else {
+			log.Printf("[!] invalid %s %q, not limiting the size of cached results", CacheMaxSizeEnv, v)
+		}
+	}
+	return retention
+}
+
+// Enabled reports whether any limit is set
+func (r CacheRetention) Enabled() bool {
+	return r.TTL > 0 || r.MaxSize > 0
+}
+
+// StartCacheEviction drops the cached results over the retention periodically until stop is called.
+// Results cached before the index was kept are indexed as cached now, so they expire a TTL later.
+func StartCacheEviction(store storage.Storage, retention CacheRetention) (stop func()) {
+	if !retention.Enabled() {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		if err := indexUnindexedCaches(store, time.Now()); err != nil {
+			log.Printf("[!] failed to index cached results: %v", err)
+		}
+
+		ticker := time.NewTicker(cacheEvictionInterval)
+		defer ticker.Stop()
+
+		for {
+			if n, err := EvictCache(store, retention, time.Now()); err != nil {
+				log.Printf("[!] failed to evict cached results: %v", err)
+			} else if n > 0 {
+				log.Printf("evicted %d cached results", n)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// EvictCache drops the results cached longer than the TTL ago, and then the oldest ones while the total exceeds
+// the max size. It returns the number of the dropped results. The raw files and the metadata are left as they are.
+func EvictCache(store storage.Storage, retention CacheRetention, now time.Time) (int, error) {
+	entries, err := loadCacheIndex(store)
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CachedAt.Before(entries[j].CachedAt)
+	})
+
+	total := int64(0)
+	for _, entry := range entries {
+		total += entry.Size
+	}
+
+	evicted := 0
+	for _, entry := range entries {
+		expired := retention.TTL > 0 && now.Sub(entry.CachedAt) > retention.TTL
+		overflowed := retention.MaxSize > 0 && total > retention.MaxSize
+		if !expired && !overflowed {
+			// Entries are sorted, so the rest are newer and fit in the max size
+			break
+		}
+
+		if err := deleteCache(store, entry.ID); err != nil {
+			return evicted, err
+		}
+		total -= entry.Size
+		evicted++
+	}
+	return evicted, nil
+}
+
+// indexCache records that the result of the snapshot was cached
+func indexCache(store storage.Storage, id string, size int64, now time.Time) error {
+	raw, err := json.Marshal(&cacheIndexEntry{ID: id, CachedAt: now, Size: size})
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache index: %w", err)
+	}
+	if err := store.Put(cacheIndexTypeKey, id, raw); err != nil {
+		return fmt.Errorf("failed to put cache index: %w", err)
+	}
+	return nil
+}
+
+// deleteCache drops the cached result of the snapshot with its index
+func deleteCache(store storage.Storage, id string) error {
+	if err := store.Delete(cacheTypeKey, id); err != nil {
+		return fmt.Errorf("failed to delete cache of %s: %w", id, err)
+	}
+	if err := store.Delete(cacheIndexTypeKey, id); err != nil {
+		return fmt.Errorf("failed to delete cache index of %s: %w", id, err)
+	}
+	return nil
+}
+
+func loadCacheIndex(store storage.Storage) ([]*cacheIndexEntry, error) {
+	raws, err := store.GetAll(cacheIndexTypeKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cache index: %w", err)
+	}
+
+	entries := make([]*cacheIndexEntry, 0, len(raws))
+	for _, raw := range raws {
+		entry := &cacheIndexEntry{}
+		if err := json.Unmarshal(raw, entry); err != nil {
+			log.Printf("[!] unmarshalling cache index failed: %v", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// indexUnindexedCaches indexes the cached results of the stored snapshots lacking the index
+func indexUnindexedCaches(store storage.Storage, now time.Time) error {
+	entries, err := loadCacheIndex(store)
+	if err != nil {
+		return err
+	}
+	indexed := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		indexed[entry.ID] = true
+	}
+
+	for _, typ := range AllTypes {
+		snapshots, err := LoadSnapshots(store, typ)
+		if err != nil {
+			return err
+		}
+		for _, snapshot := range snapshots {
+			if indexed[snapshot.ID] {
+				continue
+			}
+			cache, err := CachedResult(store, snapshot.ID)
+			if err != nil {
+				return err
+			}
+			if cache == nil {
+				continue
+			}
+			if err := indexCache(store, snapshot.ID, int64(len(cache)), now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package collect
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaz/pprotein/internal/storage"
+)
+
+// countingProcessor returns a result of 10 bytes, counting how many times it is called
+type countingProcessor struct {
+	calls int
+}
+
+func (p *countingProcessor) Process(snapshot *Snapshot) (io.ReadCloser, error) {
+	p.calls++
+	return io.NopCloser(strings.NewReader(fmt.Sprintf("%-10s", snapshot.ID))), nil
+}
+
+func (p *countingProcessor) Cacheable() bool {
+	return true
+}
+
+func TestEvictCache(t *testing.T) {
+	now := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		retention CacheRetention
+		now       time.Time
+		evicted   []string
+	}{
+		{name: "Within the retention", retention: CacheRetention{TTL: 3 * time.Hour, MaxSize: 30}, now: now, evicted: []string{}},
+		{name: "Expired", retention: CacheRetention{TTL: 90 * time.Minute}, now: now, evicted: []string{"a", "b"}},
+		{name: "Over the max size", retention: CacheRetention{MaxSize: 25}, now: now, evicted: []string{"a"}},
+		{name: "All expired", retention: CacheRetention{TTL: time.Hour, MaxSize: 25}, now: now.Add(24 * time.Hour), evicted: []string{"a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := storage.New(t.TempDir(), storage.Limits{})
+			if err != nil {
+				t.Fatalf("Failed to create storage: %v", err)
+			}
+			internal := &countingProcessor{}
+			processor := newCachedProcessor(internal, store)
+
+			// a, b and c are cached 3, 2 and 1 hours ago
+			snapshots := map[string]*Snapshot{}
+			for i, id := range []string{"a", "b", "c"} {
+				snapshot := &Snapshot{store: store, SnapshotMeta: &SnapshotMeta{Type: "pprof", ID: id}}
+				snapshots[id] = snapshot
+				if err := store.PutFile(id, []byte("raw")); err != nil {
+					t.Fatalf("Failed to put raw file: %v", err)
+				}
+				if _, err := processor.Process(snapshot); err != nil {
+					t.Fatalf("Failed to process %s: %v", id, err)
+				}
+				if err := indexCache(store, id, 10, now.Add(time.Duration(i-3)*time.Hour)); err != nil {
+					t.Fatalf("Failed to index %s: %v", id, err)
+				}
+			}
+
+			n, err := EvictCache(store, tt.retention, tt.now)
+			if err != nil {
+				t.Fatalf("Failed to evict cache: %v", err)
+			}
+			if n != len(tt.evicted) {
+				t.Errorf("Evicted count is different from expected. Expected: %d, Actual: %d", len(tt.evicted), n)
+			}
+
+			for id, snapshot := range snapshots {
+				evicted := false
+				for _, e := range tt.evicted {
+					evicted = evicted || e == id
+				}
+
+				cache, err := CachedResult(store, id)
+				if err != nil {
+					t.Fatalf("Failed to get cache of %s: %v", id, err)
+				}
+				if (cache == nil) != evicted {
+					t.Errorf("Cache of %s is different from expected. Evicted: %v, Cache: %q", id, evicted, cache)
+				}
+				// Raw files have their own retention
+				if ok, _ := store.ExistsFile(id); !ok {
+					t.Errorf("Raw file of %s is deleted", id)
+				}
+
+				// Evicted results are processed again
+				calls := internal.calls
+				r, err := processor.Process(snapshot)
+				if err != nil {
+					t.Fatalf("Failed to process %s: %v", id, err)
+				}
+				if result, _ := io.ReadAll(r); strings.TrimSpace(string(result)) != id {
+					t.Errorf("Result of %s is different from expected: %q", id, result)
+				}
+				if reprocessed := internal.calls > calls; reprocessed != evicted {
+					t.Errorf("Processing of %s is different from expected. Expected: %v, Actual: %v", id, evicted, reprocessed)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheRetentionFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		ttl      string
+		maxSize  string
+		expected CacheRetention
+	}{
+		{name: "Unset", expected: CacheRetention{}},
+		{name: "Both", ttl: "72h", maxSize: "512M", expected: CacheRetention{TTL: 72 * time.Hour, MaxSize: 512 << 20}},
+		{name: "Invalid", ttl: "-1h", maxSize: "lots", expected: CacheRetention{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(CacheTTLEnv, tt.ttl)
+			t.Setenv(CacheMaxSizeEnv, tt.maxSize)
+			if retention := CacheRetentionFromEnv(); retention != tt.expected {
+				t.Errorf("Retention is different from expected. Expected: %+v, Actual: %+v", tt.expected, retention)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package collect
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -26,7 +27,7 @@ type (
 
 		store     storage.Storage
 		eventHub  *event.Hub
-		processor Processor
+		processor *cachedProcessor
 
 		mu   *sync.RWMutex
 		data map[string]*Entry
@@ -38,6 +39,21 @@ type (
 		Message  string
 	}
 	Status string
+
+	// EntryUpdate corrects the metadata of an entry after the collection. Nil fields are left unchanged.
+	EntryUpdate struct {
+		Label   *string `json:"label"`
+		Comment *string `json:"comment"`
+	}
+)
+
+var (
+	// ErrNoSuchEntry is returned for IDs of entries the collector doesn't have
+	ErrNoSuchEntry = errors.New("no such entry")
+	// ErrEntryPending is returned for entries still being collected or processed
+	ErrEntryPending = errors.New("entry is pending")
+	// ErrNotCacheable is returned when warming entries whose results are not cached (e.g. pprof)
+	ErrNotCacheable = errors.New("result is not cacheable")
 )
 
 const (
@@ -46,6 +62,12 @@ const (
 	StatusPending Status = "pending"
 )
 
+// Collectors by type, which pick up the imported snapshots
+var (
+	collectorsMu sync.RWMutex
+	collectors   = map[string]*Collector{}
+)
+
 func New(processor Processor, opts *Options) (*Collector, error) {
 	c := &Collector{
 		typ: opts.Type,
@@ -59,21 +81,111 @@ func New(processor Processor, opts *Options) (*Collector, error) {
 		data: map[string]*Entry{},
 	}
 
-	rawSnapshots, err := c.store.GetAll(c.typ)
+	snapshots, err := LoadSnapshots(c.store, c.typ)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, snapshot := range snapshots {
+		go c.runProcessor(snapshot)
+	}
+
+	collectorsMu.Lock()
+	collectors[c.typ] = c
+	collectorsMu.Unlock()
+
+	return c, nil
+}
+
+// Import stores a snapshot collected elsewhere together with its body,
+// and processes it with the collector of the type so that it is listed without restarting.
+func Import(store storage.Storage, snapshotMeta *SnapshotMeta, target *SnapshotTarget, content []byte) (*Snapshot, error) {
+	snapshot := &Snapshot{store: store, SnapshotMeta: snapshotMeta, SnapshotTarget: target}
+	if err := snapshot.Add(content); err != nil {
+		return nil, err
+	}
+
+	collectorsMu.RLock()
+	c, ok := collectors[snapshotMeta.Type]
+	collectorsMu.RUnlock()
+	if ok {
+		go c.runProcessor(snapshot)
+	}
+	return snapshot, nil
+}
+
+// Warm processes a stored snapshot with the collector of its type so that the result is cached.
+// Snapshots whose result is cached already are not processed again,
+// and those of collectors whose results are not cached are rejected with ErrNotCacheable.
+func Warm(snapshot *Snapshot) error {
+	collectorsMu.RLock()
+	c, ok := collectors[snapshot.Type]
+	collectorsMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("no collector for %s", snapshot.Type)
+	}
+	if !c.processor.internal.Cacheable() {
+		return ErrNotCacheable
+	}
+
+	r, err := c.processor.Process(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to process: %w", err)
+	}
+	if r != nil {
+		r.Close()
+	}
+	return nil
+}
+
+// Remove drops a deleted entry from the collector of its type, so that it is no longer listed, and its cached result.
+// The metadata and the body are deleted by the caller.
+func Remove(store storage.Storage, typ, id string) error {
+	collectorsMu.RLock()
+	c, ok := collectors[typ]
+	collectorsMu.RUnlock()
+	if ok {
+		c.remove(id)
+	}
+	return deleteCache(store, id)
+}
+
+func (c *Collector) remove(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.data, id)
+}
+
+// LoadSnapshot returns the stored snapshot of the type with the id
+func LoadSnapshot(store storage.Storage, typ, id string) (*Snapshot, error) {
+	raw, err := store.Get(typ, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot: %w", err)
+	}
+	snapshot := &Snapshot{store: store}
+	if err := snapshot.unmarshal(raw); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// LoadSnapshots returns all the stored snapshots of the type
+func LoadSnapshots(store storage.Storage, typ string) ([]*Snapshot, error) {
+	rawSnapshots, err := store.GetAll(typ)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get snapshots: %w", err)
 	}
 
+	snapshots := make([]*Snapshot, 0, len(rawSnapshots))
 	for _, raw := range rawSnapshots {
-		snapshot := &Snapshot{store: c.store}
+		snapshot := &Snapshot{store: store}
 		if err := snapshot.unmarshal(raw); err != nil {
 			log.Printf("[!] unmarshalling snapshot failed: %v", err)
 			continue
 		}
-		go c.runProcessor(snapshot)
+		snapshots = append(snapshots, snapshot)
 	}
-
-	return c, nil
+	return snapshots, nil
 }
 
 func (c *Collector) updateStatus(snapshot *Snapshot, status Status, msg string) {
@@ -127,6 +239,64 @@ func (c *Collector) Get(id string) (io.ReadCloser, error) {
 	return c.processor.Process(ent.Snapshot)
 }
 
+// Refresh is like Get but processes the entry again instead of serving the cached result, and caches the new one
+func (c *Collector) Refresh(id string) (io.ReadCloser, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ent, ok := c.data[id]
+	if !ok {
+		return nil, fmt.Errorf("no such entry: %v", id)
+	}
+
+	return c.processor.Refresh(ent.Snapshot)
+}
+
+// Update applies the update to the metadata of the entry and stores it.
+// The snapshot is replaced rather than modified, as the listed entries may be read concurrently.
+func (c *Collector) Update(id string, update *EntryUpdate) (*Entry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ent, ok := c.data[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoSuchEntry, id)
+	}
+	if ent.Status == StatusPending {
+		return nil, fmt.Errorf("%w: %s", ErrEntryPending, id)
+	}
+
+	meta := *ent.Snapshot.SnapshotMeta
+	target := SnapshotTarget{}
+	if ent.Snapshot.SnapshotTarget != nil {
+		target = *ent.Snapshot.SnapshotTarget
+	}
+	if update.Label != nil {
+		target.Label = *update.Label
+	}
+	if update.Comment != nil {
+		meta.Comment = *update.Comment
+	}
+	snapshot := &Snapshot{store: c.store, SnapshotMeta: &meta, SnapshotTarget: &target}
+
+	serialized, err := snapshot.marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize: %w", err)
+	}
+	if err := c.store.Put(c.typ, id, serialized); err != nil {
+		return nil, fmt.Errorf("failed to write meta: %w", err)
+	}
+
+	updated := &Entry{Snapshot: snapshot, Status: ent.Status, Message: ent.Message}
+	c.data[id] = updated
+	if eventData, err := json.Marshal(updated); err == nil {
+		c.eventHub.Publish(eventData)
+	} else {
+		log.Printf("failed to serialize event: %v", err)
+	}
+	return updated, nil
+}
+
 func (c *Collector) List() []*Entry {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
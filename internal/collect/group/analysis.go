@@ -0,0 +1,224 @@
+package group
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/kaz/pprotein/internal/analyze/httplog"
+	"github.com/kaz/pprotein/internal/analyze/pprof"
+	"github.com/kaz/pprotein/internal/analyze/slowlog"
+	"github.com/kaz/pprotein/internal/analyze/trace"
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/labstack/echo/v4"
+)
+
+// Number of entries per page of the type analysis when limit is not given
+const defaultAnalysisLimit = 50
+
+// Snapshot types with the type analysis, which covers traces besides the types summarized by the group delta
+var analysisTypes = append(append([]string{}, summaryTypes...), "trace")
+
+type (
+	// EntryAnalysis holds the headline numbers of a single entry, with the fields of its type filled
+	EntryAnalysis struct {
+		ID       string    `json:"id"`
+		GroupID  string    `json:"group_id"`
+		Label    string    `json:"label"`
+		Datetime time.Time `json:"datetime"`
+		Error    string    `json:"error,omitempty"`
+
+		PprofTotal  int64  `json:"pprof_total,omitempty"`
+		PprofUnit   string `json:"pprof_unit,omitempty"`
+		TopFunction string `json:"top_function,omitempty"` // Function with the largest flat value
+
+		Requests         int     `json:"requests,omitempty"`
+		TopEndpoint      string  `json:"top_endpoint,omitempty"` // Endpoint spending the most time in total
+		TopEndpointTotal float64 `json:"top_endpoint_total,omitempty"`
+
+		SlowlogTotalTime float64 `json:"slowlog_total_time,omitempty"`
+		SlowlogQueries   int     `json:"slowlog_queries,omitempty"`
+		TopQuery         string  `json:"top_query,omitempty"` // Query pattern spending the most time in total
+
+		TraceDuration    float64 `json:"trace_duration,omitempty"`     // Seconds
+		TraceGCPauses    float64 `json:"trace_gc_pauses,omitempty"`    // Seconds stopped by the GC in total
+		TraceSyscallTime float64 `json:"trace_syscall_time,omitempty"` // Seconds in syscalls in total
+	}
+
+	// TypeAnalysis is a page of the analyses of all the entries of a type, newest first
+	TypeAnalysis struct {
+		Type    string           `json:"type"`
+		Total   int              `json:"total"`
+		Offset  int              `json:"offset"`
+		Limit   int              `json:"limit"`
+		Entries []*EntryAnalysis `json:"entries"`
+	}
+)
+
+// RegisterAnalysisHandlers adds GET /:type/analysis for the enabled types with a summary.
+// The routes are static so that they take precedence over the entry routes of the collectors.
+func (cl *Collector) RegisterAnalysisHandlers(api *echo.Group) {
+	for _, typ := range analysisTypes {
+		if collect.TypeEnabled(typ) {
+			api.GET("/"+typ+"/analysis", cl.handleTypeAnalysis(typ))
+		}
+	}
+}
+
+// handleTypeAnalysis returns the analyses of the entries of the type in pages given with offset and limit.
+// Only the entries of the page are analyzed.
+func (cl *Collector) handleTypeAnalysis(typ string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		offset, err := parseNonNegative(c.QueryParam("offset"), 0)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid offset: %v", err))
+		}
+		limit, err := parseNonNegative(c.QueryParam("limit"), defaultAnalysisLimit)
+		if err != nil || limit == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid limit: %s", c.QueryParam("limit")))
+		}
+
+		snapshots, err := collect.LoadSnapshots(cl.store, typ)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to load entries: %v", err))
+		}
+		sort.Slice(snapshots, func(i, j int) bool {
+			if !snapshots[i].Datetime.Equal(snapshots[j].Datetime) {
+				return snapshots[i].Datetime.After(snapshots[j].Datetime)
+			}
+			return snapshots[i].ID > snapshots[j].ID
+		})
+
+		result := &TypeAnalysis{Type: typ, Total: len(snapshots), Offset: offset, Limit: limit}
+		// The limit is clamped before adding the offset, which overflows with a huge limit otherwise
+		start := min(offset, len(snapshots))
+		page := snapshots[start : start+min(limit, len(snapshots)-start)]
+		result.Entries = make([]*EntryAnalysis, len(page))
+		forEachConcurrently(len(page), cl.analysisWorkers, func(i int) {
+			result.Entries[i] = analyzeEntry(c.Request().Context(), page[i])
+		})
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+// analyzeEntry computes the headline numbers of a snapshot, reporting failures in the Error field
+func analyzeEntry(ctx context.Context, snapshot *collect.Snapshot) *EntryAnalysis {
+	entry := &EntryAnalysis{ID: snapshot.ID, Datetime: snapshot.Datetime}
+	if snapshot.SnapshotTarget != nil {
+		entry.GroupID, entry.Label = snapshot.GroupId, snapshot.Label
+	}
+
+	content, err := readSnapshotBody(snapshot)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+
+	switch snapshot.Type {
+	case "pprof":
+		err = analyzePprofEntry(entry, content)
+	case "httplog":
+		err = analyzeHttplogEntry(entry, content)
+	case "slowlog":
+		err = analyzeSlowlogEntry(ctx, entry, content)
+	case "trace":
+		err = analyzeTraceEntry(entry, content)
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	return entry
+}
+
+func analyzePprofEntry(entry *EntryAnalysis, content []byte) error {
+	prof, err := pprof.ParseCached(content)
+	if err != nil {
+		return fmt.Errorf("failed to parse profile: %w", err)
+	}
+	index := pprofSampleIndex(prof)
+	if index < 0 {
+		return nil
+	}
+	entry.PprofUnit = prof.SampleType[index].Unit
+
+	flat := map[string]int64{}
+	for _, sample := range prof.Sample {
+		if index >= len(sample.Value) {
+			continue
+		}
+		entry.PprofTotal += sample.Value[index]
+		if len(sample.Location) > 0 && len(sample.Location[0].Line) > 0 && sample.Location[0].Line[0].Function != nil {
+			flat[sample.Location[0].Line[0].Function.Name] += sample.Value[index]
+		}
+	}
+	for name, value := range flat {
+		if top, ok := flat[entry.TopFunction]; !ok || value > top || (value == top && name < entry.TopFunction) {
+			entry.TopFunction = name
+		}
+	}
+	return nil
+}
+
+func analyzeHttplogEntry(entry *EntryAnalysis, content []byte) error {
+	endpoints, err := httplog.AnalyzeEndpoints(content)
+	if err != nil {
+		return fmt.Errorf("failed to analyze httplog: %w", err)
+	}
+	for pattern, stats := range endpoints {
+		if pattern == "" {
+			continue
+		}
+		entry.Requests += stats.Count
+		if stats.TotalTime > entry.TopEndpointTotal || (stats.TotalTime == entry.TopEndpointTotal && (entry.TopEndpoint == "" || pattern < entry.TopEndpoint)) {
+			entry.TopEndpoint, entry.TopEndpointTotal = pattern, stats.TotalTime
+		}
+	}
+	return nil
+}
+
+func analyzeSlowlogEntry(ctx context.Context, entry *EntryAnalysis, content []byte) error {
+	raw, err := slowlog.Analyze(ctx, content, 0)
+	if err != nil {
+		return fmt.Errorf("failed to analyze slowlog: %w", err)
+	}
+	result := &slowlog.AnalysisResult{}
+	if err := json.Unmarshal([]byte(raw), result); err != nil {
+		return fmt.Errorf("failed to parse slowlog analysis: %w", err)
+	}
+	entry.SlowlogTotalTime = result.TotalTime
+	entry.SlowlogQueries = result.TotalQueries
+	if len(result.TopQueryPatterns) > 0 {
+		entry.TopQuery = result.TopQueryPatterns[0].Pattern
+	}
+	return nil
+}
+
+func analyzeTraceEntry(entry *EntryAnalysis, content []byte) error {
+	summary, err := trace.Summarize(content)
+	if err != nil {
+		return fmt.Errorf("failed to analyze trace: %w", err)
+	}
+	entry.TraceDuration = summary.Duration
+	entry.TraceGCPauses = summary.GCPauses.Total
+	entry.TraceSyscallTime = summary.Syscalls.Total
+	return nil
+}
+
+// parseNonNegative parses a non-negative integer, returning def if v is empty
+func parseNonNegative(v string, def int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("must not be negative: %d", n)
+	}
+	return n, nil
+}
@@ -0,0 +1,108 @@
+package group
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo/v4"
+)
+
+func TestTypeAnalysis(t *testing.T) {
+	cl, store := newTestCollector(t)
+
+	addTestSnapshot(t, store, "slowlog", "a-slowlog.log", "2025-04-01_12-00-00", "mysql", testSlowlog("2.000000"))
+	addTestSnapshot(t, store, "slowlog", "b-slowlog.log", "2025-04-01_12-10-00", "mysql", testSlowlog("0.500000"))
+	addTestSnapshot(t, store, "slowlog", "c-slowlog.log", "2025-04-01_12-20-00", "mysql", testSlowlog("1.250000"))
+	addTestSnapshot(t, store, "pprof", "a-pprof.pb.gz", "2025-04-01_12-00-00", "app", testProfile(t, 100))
+
+	e := echo.New()
+	api := e.Group("/api")
+	// Entry route of the collector, which must not shadow the analysis
+	api.GET("/slowlog/:id", func(c echo.Context) error { return c.NoContent(http.StatusTeapot) })
+	cl.RegisterAnalysisHandlers(api)
+
+	get := func(query string) *TypeAnalysis {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/slowlog/analysis"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+		}
+		result := &TypeAnalysis{}
+		if err := json.Unmarshal(rec.Body.Bytes(), result); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return result
+	}
+
+	result := get("")
+	if result.Total != 3 || len(result.Entries) != 3 {
+		t.Fatalf("Entry count is different from expected. Expected: 3, Actual: %d/%d", len(result.Entries), result.Total)
+	}
+	expected := map[string]float64{"a-slowlog.log": 2, "b-slowlog.log": 0.5, "c-slowlog.log": 1.25}
+	for _, entry := range result.Entries {
+		if entry.Error != "" {
+			t.Errorf("Failed to analyze %s: %s", entry.ID, entry.Error)
+		}
+		if math.Abs(entry.SlowlogTotalTime-expected[entry.ID]) > 1e-9 {
+			t.Errorf("Total time of %s is different from expected. Expected: %f, Actual: %f", entry.ID, expected[entry.ID], entry.SlowlogTotalTime)
+		}
+		if entry.SlowlogQueries != 1 || entry.TopQuery == "" || entry.Label != "mysql" {
+			t.Errorf("Summary of %s is different from expected: %+v", entry.ID, entry)
+		}
+	}
+
+	seen := map[string]bool{}
+	for offset := 0; offset < 3; offset++ {
+		page := get(fmt.Sprintf("?limit=1&offset=%d", offset))
+		if len(page.Entries) != 1 {
+			t.Fatalf("Page size is different from expected. Expected: 1, Actual: %d", len(page.Entries))
+		}
+		seen[page.Entries[0].ID] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("Pages overlap: %v", seen)
+	}
+	if page := get("?offset=10"); page.Total != 3 || len(page.Entries) != 0 {
+		t.Errorf("Page beyond the end is different from expected: %+v", page)
+	}
+	if page := get(fmt.Sprintf("?offset=1&limit=%d", math.MaxInt)); len(page.Entries) != 2 {
+		t.Errorf("Page with a huge limit is different from expected. Expected: 2 entries, Actual: %d", len(page.Entries))
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/pprof/analysis", nil))
+	pprofResult := &TypeAnalysis{}
+	if err := json.Unmarshal(rec.Body.Bytes(), pprofResult); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(pprofResult.Entries) != 1 || pprofResult.Entries[0].TopFunction != "main.handler" || pprofResult.Entries[0].PprofTotal != 100 {
+		t.Errorf("Pprof summary is different from expected: %+v", pprofResult.Entries)
+	}
+
+	traceContent, err := os.ReadFile("../../analyze/trace/testdata/trace.out")
+	if err != nil {
+		t.Fatalf("Failed to read trace: %v", err)
+	}
+	addTestSnapshot(t, store, "trace", "a-trace.out", "2025-04-01_12-00-00", "app", traceContent)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/trace/analysis", nil))
+	traceResult := &TypeAnalysis{}
+	if err := json.Unmarshal(rec.Body.Bytes(), traceResult); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(traceResult.Entries) != 1 || traceResult.Entries[0].Error != "" || traceResult.Entries[0].TraceDuration <= 0 || traceResult.Entries[0].TraceGCPauses <= 0 {
+		t.Errorf("Trace summary is different from expected: %+v", traceResult.Entries)
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/slowlog/analysis?limit=-1", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected status for an invalid limit: %d", rec.Code)
+	}
+}
@@ -0,0 +1,133 @@
+package group
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/labstack/echo/v4"
+)
+
+// Name of the manifest in the group archive
+const archiveManifestName = "manifest.json"
+
+type (
+	// ArchiveEntry describes a file of the group archive
+	ArchiveEntry struct {
+		Type     string    `json:"type"`
+		ID       string    `json:"id"`
+		Label    string    `json:"label"`
+		Datetime time.Time `json:"datetime"`
+		Path     string    `json:"path,omitempty"` // Path in the archive, empty if the file is missing
+		Missing  bool      `json:"missing,omitempty"`
+		Error    string    `json:"error,omitempty"`
+
+		// Collection settings restored on import
+		URL         string `json:"url,omitempty"`
+		Duration    int    `json:"duration,omitempty"`
+		ProfileType string `json:"profile_type,omitempty"`
+	}
+
+	// ArchiveManifest lists the entries of the group archive
+	ArchiveManifest struct {
+		GroupID string          `json:"group_id"`
+		Entries []*ArchiveEntry `json:"entries"`
+	}
+)
+
+// getArchive streams the raw files of all entries of the group as a zip archive with a manifest.
+// Entries whose file is missing are listed in the manifest as missing instead of failing the download.
+func (cl *Collector) getArchive(c echo.Context) error {
+	groupID := c.Param("id")
+
+	var snapshots []*collect.Snapshot
+	for _, typ := range collect.AllTypes {
+		all, err := collect.LoadSnapshots(cl.store, typ)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to load entries: %v", err))
+		}
+		for _, snapshot := range all {
+			if snapshot.SnapshotTarget != nil && snapshot.GroupId == groupID {
+				snapshots = append(snapshots, snapshot)
+			}
+		}
+	}
+	if len(snapshots) == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such group: %s", groupID))
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		if snapshots[i].Type != snapshots[j].Type {
+			return snapshots[i].Type < snapshots[j].Type
+		}
+		return snapshots[i].ID < snapshots[j].ID
+	})
+
+	c.Response().Header().Set(echo.HeaderContentType, "application/zip")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", groupID+".zip"))
+	c.Response().WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(c.Response())
+	manifest := &ArchiveManifest{GroupID: groupID, Entries: make([]*ArchiveEntry, 0, len(snapshots))}
+	for _, snapshot := range snapshots {
+		entry, err := addArchiveEntry(zw, snapshot)
+		if err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+
+	w, err := zw.Create(archiveManifestName)
+	if err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return zw.Close()
+}
+
+// addArchiveEntry copies the file of the snapshot into the archive.
+// The returned error is only for failures of the archive itself.
+func addArchiveEntry(zw *zip.Writer, snapshot *collect.Snapshot) (*ArchiveEntry, error) {
+	entry := &ArchiveEntry{
+		Type:     snapshot.Type,
+		ID:       snapshot.ID,
+		Label:    snapshot.Label,
+		Datetime: snapshot.Datetime,
+
+		URL:         snapshot.URL,
+		Duration:    snapshot.Duration,
+		ProfileType: snapshot.ProfileType,
+	}
+
+	bodyPath, err := snapshot.BodyPath()
+	if err != nil {
+		entry.Missing, entry.Error = true, err.Error()
+		return entry, nil
+	}
+	file, err := os.Open(bodyPath)
+	if err != nil {
+		entry.Missing, entry.Error = true, err.Error()
+		return entry, nil
+	}
+	defer file.Close()
+
+	entry.Path = path.Join(snapshot.Type, snapshot.ID)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: entry.Path, Method: zip.Deflate, Modified: snapshot.Datetime})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(w, file); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
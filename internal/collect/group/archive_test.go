@@ -0,0 +1,241 @@
+package group
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo/v4"
+)
+
+func TestArchive(t *testing.T) {
+	cl, store := newTestCollector(t)
+
+	addTestSnapshot(t, store, "pprof", "g1-pprof.pb.gz", "2025-04-01_12-00-00", "app", []byte("pprof"))
+	addTestSnapshot(t, store, "slowlog", "g1-slowlog.log", "2025-04-01_12-00-00", "db", []byte("slowlog"))
+	addTestSnapshot(t, store, "memo", "g1-memo.log", "2025-04-01_12-00-00", "memo", []byte("memo"))
+	addTestSnapshot(t, store, "pprof", "g2-pprof.pb.gz", "2025-04-01_12-10-00", "app", []byte("other"))
+	if err := store.DeleteFile("g1-memo.log"); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+
+	e := echo.New()
+	cl.RegisterHandlers(e.Group("/api/group"))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/group/2025-04-01_12-00-00/archive", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get(echo.HeaderContentDisposition); got != `attachment; filename="2025-04-01_12-00-00.zip"` {
+		t.Errorf("Content-Disposition is different from expected. Actual: %s", got)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", f.Name, err)
+		}
+		files[f.Name] = string(content)
+	}
+
+	expected := map[string]string{
+		"pprof/g1-pprof.pb.gz":   "pprof",
+		"slowlog/g1-slowlog.log": "slowlog",
+	}
+	for name, content := range expected {
+		if files[name] != content {
+			t.Errorf("Content of %s is different from expected. Expected: %s, Actual: %s", name, content, files[name])
+		}
+	}
+	if len(files) != len(expected)+1 {
+		t.Errorf("Archive entries are different from expected. Actual: %v", files)
+	}
+
+	manifest := &ArchiveManifest{}
+	if err := json.Unmarshal([]byte(files[archiveManifestName]), manifest); err != nil {
+		t.Fatalf("Failed to decode manifest: %v", err)
+	}
+	if len(manifest.Entries) != 3 {
+		t.Fatalf("Manifest entry count is different from expected. Expected: 3, Actual: %d", len(manifest.Entries))
+	}
+	for _, entry := range manifest.Entries {
+		if missing := entry.ID == "g1-memo.log"; entry.Missing != missing {
+			t.Errorf("Missing flag of %s is different from expected. Expected: %v, Actual: %v", entry.ID, missing, entry.Missing)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/group/2025-01-01_00-00-00/archive", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Unexpected status for a missing group: %d", rec.Code)
+	}
+}
+
+func TestImportArchive(t *testing.T) {
+	src, srcStore := newTestCollector(t)
+	addTestSnapshot(t, srcStore, "pprof", "g1-pprof.pb.gz", "2025-04-01_12-00-00", "app", []byte("pprof"))
+	addTestSnapshot(t, srcStore, "slowlog", "g1-slowlog.log", "2025-04-01_12-00-00", "db", []byte("slowlog"))
+
+	e := echo.New()
+	src.RegisterHandlers(e.Group("/api/group"))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/group/2025-04-01_12-00-00/archive", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status of export: %d, body=%s", rec.Code, rec.Body)
+	}
+	archive := rec.Body.Bytes()
+
+	dst, dstStore := newTestCollector(t)
+	e = echo.New()
+	dst.RegisterHandlers(e.Group("/api/group"))
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/group/import?preserve_id=true", bytes.NewReader(archive)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status of import: %d, body=%s", rec.Code, rec.Body)
+	}
+	result := &ImportResult{}
+	if err := json.Unmarshal(rec.Body.Bytes(), result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if result.GroupID != "2025-04-01_12-00-00" || len(result.Imported) != 2 {
+		t.Errorf("Import result is different from expected. Actual: %+v", result)
+	}
+
+	groups, err := dst.loadGroupSnapshots()
+	if err != nil {
+		t.Fatalf("Failed to load groups: %v", err)
+	}
+	snapshots := groups["2025-04-01_12-00-00"]
+	if len(snapshots) != 2 {
+		t.Fatalf("Imported entry count is different from expected. Expected: 2, Actual: %d", len(snapshots))
+	}
+	for _, snapshot := range snapshots {
+		content, err := readSnapshotBody(snapshot)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", snapshot.ID, err)
+		}
+		if string(content) != snapshot.Type {
+			t.Errorf("Content of %s is different from expected. Expected: %s, Actual: %s", snapshot.ID, snapshot.Type, content)
+		}
+	}
+	if ok, _ := dstStore.Exists("pprof", "g1-pprof.pb.gz"); !ok {
+		t.Errorf("Metadata of the imported entry is not stored")
+	}
+
+	tests := []struct {
+		name     string
+		body     []byte
+		expected int
+	}{
+		{name: "Importing twice", body: archive, expected: http.StatusConflict},
+		{name: "Not an archive", body: []byte("not a zip"), expected: http.StatusBadRequest},
+		{name: "Archive without manifest", body: zipWithoutManifest(t), expected: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/group/import", bytes.NewReader(tt.body)))
+			if rec.Code != tt.expected {
+				t.Errorf("Status is different from expected. Expected: %d, Actual: %d, body=%s", tt.expected, rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestImportArchiveMaxBodySize(t *testing.T) {
+	src, srcStore := newTestCollector(t)
+	addTestSnapshot(t, srcStore, "pprof", "g1-pprof.pb.gz", "2025-04-01_12-00-00", "app", []byte("pprof"))
+
+	e := echo.New()
+	src.RegisterHandlers(e.Group("/api/group"))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/group/2025-04-01_12-00-00/archive", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status of export: %d, body=%s", rec.Code, rec.Body)
+	}
+	archive := rec.Body.Bytes()
+
+	tests := []struct {
+		name     string
+		limit    int64
+		expected int
+	}{
+		{name: "Just under the limit", limit: int64(len(archive)), expected: http.StatusOK},
+		{name: "Just over the limit", limit: int64(len(archive) - 1), expected: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst, _ := newTestCollector(t)
+			dst.maxBodySize = tt.limit
+			e := echo.New()
+			dst.RegisterHandlers(e.Group("/api/group"))
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/group/import", bytes.NewReader(archive)))
+			if rec.Code != tt.expected {
+				t.Errorf("Status is different from expected. Expected: %d, Actual: %d, body=%s", tt.expected, rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestImportArchiveMaxEntrySize(t *testing.T) {
+	src, srcStore := newTestCollector(t)
+	addTestSnapshot(t, srcStore, "memo", "g1-memo.log", "2025-04-01_12-00-00", "memo", bytes.Repeat([]byte("a"), 64<<10))
+
+	e := echo.New()
+	src.RegisterHandlers(e.Group("/api/group"))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/group/2025-04-01_12-00-00/archive", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status of export: %d, body=%s", rec.Code, rec.Body)
+	}
+	archive := rec.Body.Bytes()
+
+	// The compressed archive fits in the limit, but the entry expands beyond it
+	dst, _ := newTestCollector(t)
+	dst.maxBodySize = 32 << 10
+	if int64(len(archive)) > dst.maxBodySize {
+		t.Fatalf("Archive is too large for the test: %d bytes", len(archive))
+	}
+	e = echo.New()
+	dst.RegisterHandlers(e.Group("/api/group"))
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/group/import", bytes.NewReader(archive)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Status is different from expected. Expected: %d, Actual: %d, body=%s", http.StatusRequestEntityTooLarge, rec.Code, rec.Body)
+	}
+}
+
+func zipWithoutManifest(t *testing.T) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	w, err := zw.Create("pprof/a-pprof.pb.gz")
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	w.Write([]byte("pprof"))
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close archive: %v", err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,60 @@
+package group
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Key of the baseline group ID in the storage
+const (
+	baselineType = "group"
+	baselineID   = "baseline"
+)
+
+// getBaseline returns the baseline group ID, or an empty string if it is not set
+func (cl *Collector) getBaseline() (string, error) {
+	ok, err := cl.store.Exists(baselineType, baselineID)
+	if err != nil || !ok {
+		return "", err
+	}
+	raw, err := cl.store.Get(baselineType, baselineID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get baseline: %w", err)
+	}
+	return string(raw), nil
+}
+
+func (cl *Collector) handleGetBaseline(c echo.Context) error {
+	baseline, err := cl.getBaseline()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"group_id": baseline})
+}
+
+// handleSetBaseline makes the group the one every delta is computed against by default
+func (cl *Collector) handleSetBaseline(c echo.Context) error {
+	groupID := c.Param("id")
+
+	groups, err := cl.loadGroupSnapshots()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to load groups: %v", err))
+	}
+	if _, ok := groups[groupID]; !ok {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such group: %s", groupID))
+	}
+
+	if err := cl.store.Put(baselineType, baselineID, []byte(groupID)); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to set baseline: %v", err))
+	}
+	return c.JSON(http.StatusOK, map[string]string{"group_id": groupID})
+}
+
+func (cl *Collector) handleDeleteBaseline(c echo.Context) error {
+	if err := cl.store.Delete(baselineType, baselineID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to clear baseline: %v", err))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
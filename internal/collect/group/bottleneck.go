@@ -0,0 +1,66 @@
+package group
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/kaz/pprotein/internal/analyze/bottleneck"
+	"github.com/labstack/echo/v4"
+)
+
+// getBottleneck ranks the likely root causes of slow endpoints by correlating the httplog and slowlog of the group.
+// The width of the time windows can be given as a duration with window (e.g. 5s).
+// Httplogs with another field separator or labels are read with delimiter and labels like the analysis.
+func (cl *Collector) getBottleneck(c echo.Context) error {
+	groupID := c.Param("id")
+
+	format, err := httplogFormatParam(c)
+	if err != nil {
+		return err
+	}
+	opts := bottleneck.Options{Format: format}
+	if v := c.QueryParam("window"); v != "" {
+		window, err := time.ParseDuration(v)
+		if err != nil || window <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid window: %s", v))
+		}
+		opts.Window = window
+	}
+
+	groups, err := cl.loadGroupSnapshots()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to load groups: %v", err))
+	}
+	snapshots, ok := groups[groupID]
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such group: %s", groupID))
+	}
+
+	// Logs collected from several hosts are analyzed together
+	contents := map[string]*bytes.Buffer{"httplog": {}, "slowlog": {}}
+	for _, snapshot := range snapshots {
+		buf, ok := contents[snapshot.Type]
+		if !ok {
+			continue
+		}
+		content, err := readSnapshotBody(snapshot)
+		if err != nil {
+			log.Printf("[!] failed to read snapshot %s: %v", snapshot.ID, err)
+			continue
+		}
+		buf.Write(content)
+		buf.WriteString("\n")
+	}
+	if contents["httplog"].Len() == 0 || contents["slowlog"].Len() == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("group %s needs both httplog and slowlog", groupID))
+	}
+
+	result, err := bottleneck.Analyze(contents["httplog"].Bytes(), contents["slowlog"].Bytes(), opts)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to analyze bottleneck: %v", err))
+	}
+	return c.JSON(http.StatusOK, result)
+}
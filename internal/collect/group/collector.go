@@ -4,7 +4,11 @@ import (
 	"bytes"
 	_ "embed"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-playground/validator/v10"
@@ -20,16 +24,42 @@ type (
 	Collector struct {
 		port string
 
+		// Number of the most recent groups to keep (0 means unlimited)
+		keepGroups int
+		// Number of snapshots analyzed at once when summarizing groups
+		analysisWorkers int
+		// Whether targets may point at the API of pprotein itself
+		allowSelfTargets bool
+		// Size limit of imported archives (0 means unlimited)
+		maxBodySize int64
+
 		store     storage.Storage
 		validator *validator.Validate
 		targets   *persistent.Handler
+		// Told when a collection completes (nil means no notification)
+		notifier Notifier
+
+		// Number of collections in progress, during which the analysis cache is not warmed
+		collecting atomic.Int32
 	}
 
 	CollectTarget struct {
 		Type     string `validate:"required"`
 		Label    string `validate:"required"`
-		URL      string `validate:"required,url"`
+		URL      string `validate:"required,target_url"`
 		Duration int    `validate:"required,gt=0"`
+
+		// ProfileType is passed through to the snapshot so that pprof analyzers don't have to guess it
+		ProfileType string `json:",omitempty"`
+
+		// Method and extra query parameters of the request to URL, passed through to the snapshot
+		Method string            `json:",omitempty" validate:"omitempty,oneof=GET POST"`
+		Query  map[string]string `json:",omitempty"`
+
+		// Basic auth credentials for targets behind an authenticating proxy, passed to the collection request only.
+		// The password is served as RedactedPassword, which keeps the stored one when posted back.
+		Username string `json:",omitempty" validate:"required_with=Password"`
+		Password string `json:",omitempty"`
 	}
 
 	GroupMeta struct {
@@ -40,20 +70,37 @@ type (
 	}
 )
 
+// RedactedPassword replaces the passwords of the targets served by the API
+const RedactedPassword = "********"
+
+// IDLayout is the layout of group IDs, which are the time the collection started
+const IDLayout = "2006-01-02_15-04-05.999999"
+
 //go:embed targets.json
 var defaultTargets []byte
 
 func NewCollector(store storage.Storage, port string) (*Collector, error) {
 	c := &Collector{
-		port:      port,
-		store:     store,
-		validator: validator.New(),
+		port:            port,
+		keepGroups:      keepGroupsFromEnv(),
+		analysisWorkers: analysisWorkersFromEnv(),
+		store:           store,
+		validator:       validator.New(),
+
+		allowSelfTargets: os.Getenv(AllowSelfTargetsEnv) == "true",
+		maxBodySize:      storage.MaxBodySizeFromEnv(),
+		notifier:         notifierFromEnv(),
+	}
+
+	if err := c.validator.RegisterValidation("target_url", isTargetURL); err != nil {
+		return nil, fmt.Errorf("failed to register validation: %w", err)
 	}
 
 	targets, err := persistent.New(store, "targets.json", defaultTargets, c.sanitize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create targets: %w", err)
 	}
+	targets.SetRedact(redactTargets)
 	c.targets = targets
 
 	return c, nil
@@ -63,6 +110,15 @@ func (cl *Collector) RegisterHandlers(g *echo.Group) {
 	cl.targets.RegisterHandlers(g.Group("/targets"))
 
 	g.GET("/collect", cl.collectAll)
+	g.GET("/:id/delta", cl.getDelta)
+	g.GET("/:id/httplog/compare", cl.getHttplogComparison)
+	g.GET("/baseline", cl.handleGetBaseline)
+	g.POST("/baseline/:id", cl.handleSetBaseline)
+	g.DELETE("/baseline", cl.handleDeleteBaseline)
+	g.GET("/:id/bottleneck", cl.getBottleneck)
+	g.GET("/:id/archive", cl.getArchive)
+	g.POST("/:id/warm", cl.warmGroup)
+	g.POST("/import", cl.importArchive)
 }
 
 func (cl *Collector) sanitize(raw []byte) ([]byte, error) {
@@ -74,6 +130,14 @@ func (cl *Collector) sanitize(raw []byte) ([]byte, error) {
 	if err := cl.validator.Var(targets, "dive"); err != nil {
 		return nil, fmt.Errorf("validation failed: %w", err)
 	}
+	if err := cl.restorePasswords(targets); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+	for _, target := range targets {
+		if err := cl.checkSelfTarget(target); err != nil {
+			return nil, fmt.Errorf("validation failed: %w", err)
+		}
+	}
 
 	res, err := json.MarshalIndent(targets, "", "  ")
 	if err != nil {
@@ -83,6 +147,65 @@ func (cl *Collector) sanitize(raw []byte) ([]byte, error) {
 	return res, nil
 }
 
+// restorePasswords replaces the redacted passwords with the stored ones of the targets of the same type and label
+func (cl *Collector) restorePasswords(targets []*CollectTarget) error {
+	stored := map[[2]string]string{}
+	// The targets aren't stored yet while the defaults are sanitized
+	if cl.targets != nil {
+		raw, err := cl.targets.GetContent()
+		if err != nil {
+			return err
+		}
+		current := []*CollectTarget{}
+		if err := json.Unmarshal(raw, &current); err != nil {
+			return fmt.Errorf("failed to unmarshal stored targets: %w", err)
+		}
+		for _, target := range current {
+			stored[[2]string{target.Type, target.Label}] = target.Password
+		}
+	}
+
+	for _, target := range targets {
+		if target.Password != RedactedPassword {
+			continue
+		}
+		password, ok := stored[[2]string{target.Type, target.Label}]
+		if !ok || password == "" {
+			return fmt.Errorf("no stored password of %s/%s to keep", target.Type, target.Label)
+		}
+		target.Password = password
+	}
+	return nil
+}
+
+// redactTargets replaces the passwords of the stored targets with RedactedPassword
+func redactTargets(raw []byte) ([]byte, error) {
+	targets := []*CollectTarget{}
+	if err := json.Unmarshal(raw, &targets); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	for _, target := range targets {
+		if target.Password != "" {
+			target.Password = RedactedPassword
+		}
+	}
+	return json.MarshalIndent(targets, "", "  ")
+}
+
+// isTargetURL validates the URL of a target, which is an absolute HTTP(S) URL
+// or a URL of a Unix domain socket like unix:///run/app.sock:/debug/pprof/profile
+func isTargetURL(fl validator.FieldLevel) bool {
+	u, err := url.Parse(fl.Field().String())
+	if err != nil {
+		return false
+	}
+	if u.Scheme == collect.UnixScheme {
+		_, _, err := collect.SplitUnixURL(u)
+		return err == nil
+	}
+	return u.Scheme != "" && u.Host != ""
+}
+
 func (cl *Collector) collectAll(c echo.Context) error {
 	raw, err := cl.targets.GetContent()
 	if err != nil {
@@ -94,22 +217,43 @@ func (cl *Collector) collectAll(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to unmarshal: %v", err))
 	}
 
-	grpId := time.Now().Format("2006-01-02_15-04-05.999999")
+	cl.collecting.Add(1)
+	defer cl.collecting.Add(-1)
+
+	start := time.Now()
+	grpId := start.Format(IDLayout)
 	eg := &errgroup.Group{}
 
 	ch := make(chan error, len(targets))
 	defer close(ch)
 
+	notification := &Notification{GroupID: grpId}
 	for _, target := range targets {
 		target := *target
+		if !collect.TypeEnabled(target.Type) {
+			log.Printf("[!] skipping target %s: type %s is disabled", target.Label, target.Type)
+			notification.Skipped++
+			continue
+		}
+		notification.Targets++
 		eg.Go(func() error {
 			return cl.makeInternalRequest(grpId, target)
 		})
 	}
 
-	if err := eg.Wait(); err != nil {
+	err = eg.Wait()
+	notification.Duration = time.Since(start).Seconds()
+	if err != nil {
+		notification.Error = err.Error()
+	}
+	go cl.notify(notification)
+	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to collect: %v", err))
 	}
+
+	if err := cl.pruneGroups(grpId); err != nil {
+		log.Printf("[!] failed to prune old groups: %v", err)
+	}
 	return c.NoContent(http.StatusOK)
 }
 func (cl *Collector) makeInternalRequest(grpId string, target CollectTarget) error {
@@ -118,6 +262,14 @@ func (cl *Collector) makeInternalRequest(grpId string, target CollectTarget) err
 		Label:    target.Label,
 		URL:      target.URL,
 		Duration: target.Duration,
+
+		ProfileType: target.ProfileType,
+
+		Method: target.Method,
+		Query:  target.Query,
+
+		Username: target.Username,
+		Password: target.Password,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to marshal: %w", err)
@@ -152,7 +304,7 @@ func (cl *Collector) getGroupData(c echo.Context) error {
 		"data":     map[string][]*collect.Entry{},
 	}
 
-	endpoints := []string{"pprof", "httplog", "slowlog", "memo"}
+	endpoints := collect.Types()
 
 	for _, endpoint := range endpoints {
 		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%s/api/%s", cl.port, endpoint), nil)
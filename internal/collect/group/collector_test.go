@@ -0,0 +1,98 @@
+package group
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSanitizeUnixTargets(t *testing.T) {
+	cl, _ := newTestCollector(t)
+
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{name: "HTTP", url: "http://192.0.2.1:6060/debug/pprof/profile"},
+		{name: "Unix domain socket", url: "unix:///run/app.sock:/debug/pprof/profile"},
+		{name: "Unix domain socket without path", url: "unix:///run/app.sock", wantErr: true},
+		{name: "Relative socket path", url: "unix://app.sock:/debug/pprof/profile", wantErr: true},
+		{name: "Not a URL", url: "app.sock", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := `[{"Type": "pprof", "Label": "app", "URL": "` + tt.url + `", "Duration": 10}]`
+			if _, err := cl.sanitize([]byte(raw)); (err != nil) != tt.wantErr {
+				t.Errorf("sanitize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTargetPasswordRedaction(t *testing.T) {
+	cl, _ := newTestCollector(t)
+	e := echo.New()
+	cl.RegisterHandlers(e.Group("/api/group"))
+
+	post := func(body string) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/group/targets", strings.NewReader(body))
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	stored := func() []*CollectTarget {
+		raw, err := cl.targets.GetContent()
+		if err != nil {
+			t.Fatalf("Failed to read targets: %v", err)
+		}
+		targets := []*CollectTarget{}
+		if err := json.Unmarshal(raw, &targets); err != nil {
+			t.Fatalf("Failed to decode targets: %v", err)
+		}
+		return targets
+	}
+
+	if code := post(`[{"Type": "pprof", "Label": "app", "URL": "http://192.0.2.1/", "Duration": 10, "Username": "u", "Password": "secret"}]`); code != http.StatusOK {
+		t.Fatalf("Unexpected status of post: %d", code)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/group/targets", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status of get: %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Errorf("Password is served: %s", rec.Body)
+	}
+	served := []*CollectTarget{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &served); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(served) != 1 || served[0].Password != RedactedPassword {
+		t.Fatalf("Served targets are different from expected: %s", rec.Body)
+	}
+
+	// Posting back the served targets keeps the stored password
+	served[0].Duration = 20
+	raw, _ := json.Marshal(served)
+	if code := post(string(raw)); code != http.StatusOK {
+		t.Fatalf("Unexpected status of post: %d", code)
+	}
+	if targets := stored(); targets[0].Password != "secret" || targets[0].Duration != 20 {
+		t.Errorf("Stored target is different from expected: %+v", targets[0])
+	}
+
+	// The placeholder can't be kept for a target without a stored password
+	if code := post(`[{"Type": "pprof", "Label": "other", "URL": "http://192.0.2.1/", "Duration": 10, "Username": "u", "Password": "` + RedactedPassword + `"}]`); code != http.StatusBadRequest {
+		t.Errorf("Unexpected status of post with an unknown redacted password: %d", code)
+	}
+	if targets := stored(); targets[0].Password != "secret" {
+		t.Errorf("Stored password is changed: %+v", targets[0])
+	}
+}
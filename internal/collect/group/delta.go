@@ -0,0 +1,351 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/google/pprof/profile"
+	"github.com/kaz/pprotein/internal/analyze/httplog"
+	"github.com/kaz/pprotein/internal/analyze/pprof"
+	"github.com/kaz/pprotein/internal/analyze/slowlog"
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/labstack/echo/v4"
+)
+
+// Snapshot types summarized by the group delta
+var summaryTypes = []string{"pprof", "httplog", "slowlog"}
+
+type (
+	// GroupSummary holds the headline numbers of a group
+	GroupSummary struct {
+		GroupID          string   `json:"group_id"`
+		Targets          []string `json:"targets"`
+		PprofTotal       int64    `json:"pprof_total"`
+		PprofUnit        string   `json:"pprof_unit"`
+		TopEndpoint      string   `json:"top_endpoint"`
+		TopEndpointAvg   float64  `json:"top_endpoint_avg"`
+		SlowlogTotalTime float64  `json:"slowlog_total_time"`
+	}
+
+	// GroupDelta is the difference of the headline numbers between a group and the previous one
+	GroupDelta struct {
+		GroupID          string        `json:"group_id"`
+		PreviousGroupID  string        `json:"previous_group_id,omitempty"`
+		Current          *GroupSummary `json:"current"`
+		Previous         *GroupSummary `json:"previous,omitempty"`
+		PprofTotal       int64         `json:"pprof_total_delta"`
+		TopEndpointAvg   float64       `json:"top_endpoint_avg_delta"`
+		SlowlogTotalTime float64       `json:"slowlog_total_time_delta"`
+		Message          string        `json:"message,omitempty"`
+		// How the compared group was chosen: "explicit", "baseline" or "previous"
+		ComparedWith string `json:"compared_with,omitempty"`
+	}
+)
+
+// getDelta compares the group with the one given by the "against" query parameter,
+// or with the baseline group if it is set, or with the previous group otherwise
+func (cl *Collector) getDelta(c echo.Context) error {
+	groupID := c.Param("id")
+
+	against, comparedWith := c.QueryParam("against"), "explicit"
+	if against == "" {
+		baseline, err := cl.getBaseline()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		against, comparedWith = baseline, "baseline"
+	}
+
+	delta, err := cl.computeDelta(groupID, against)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to compute delta: %v", err))
+	}
+	if delta == nil {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such group: %s", groupID))
+	}
+
+	if against != "" && against != groupID && delta.PreviousGroupID == against {
+		delta.ComparedWith = comparedWith
+	} else if comparedWith == "explicit" {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such group to compare with: %s", against))
+	}
+	return c.JSON(http.StatusOK, delta)
+}
+
+// computeDelta compares the group with the group against if it exists, or with the chronologically previous group
+// collected from the same targets otherwise. It returns nil if the group does not exist.
+func (cl *Collector) computeDelta(groupID, against string) (*GroupDelta, error) {
+	groups, err := cl.loadGroupSnapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	current, ok := groups[groupID]
+	if !ok {
+		return nil, nil
+	}
+
+	if _, ok := groups[against]; ok && against != groupID {
+		return cl.compareGroups(groupID, current, against, groups[against]), nil
+	}
+
+	// Group IDs are timestamps, so they sort chronologically
+	ids := make([]string, 0, len(groups))
+	for id := range groups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	targets := targetSet(current)
+	previousID := ""
+	for _, id := range ids {
+		if id >= groupID {
+			break
+		}
+		if targetSet(groups[id]) == targets {
+			previousID = id
+		}
+	}
+
+	if previousID == "" {
+		return &GroupDelta{
+			GroupID: groupID,
+			Current: cl.summarizeGroup(groupID, current),
+			Message: "no previous group with the same targets",
+		}, nil
+	}
+
+	delta := cl.compareGroups(groupID, current, previousID, groups[previousID])
+	delta.ComparedWith = "previous"
+	return delta, nil
+}
+
+// compareGroups computes the difference of the headline numbers of the groups
+func (cl *Collector) compareGroups(groupID string, current []*collect.Snapshot, previousID string, previous []*collect.Snapshot) *GroupDelta {
+	delta := &GroupDelta{
+		GroupID:         groupID,
+		PreviousGroupID: previousID,
+		Current:         cl.summarizeGroup(groupID, current),
+		Previous:        cl.summarizeGroup(previousID, previous),
+	}
+	delta.PprofTotal = delta.Current.PprofTotal - delta.Previous.PprofTotal
+	delta.TopEndpointAvg = delta.Current.TopEndpointAvg - delta.Previous.TopEndpointAvg
+	delta.SlowlogTotalTime = delta.Current.SlowlogTotalTime - delta.Previous.SlowlogTotalTime
+	return delta
+}
+
+// loadGroupSnapshots returns the stored snapshots grouped by group ID
+func (cl *Collector) loadGroupSnapshots() (map[string][]*collect.Snapshot, error) {
+	groups := map[string][]*collect.Snapshot{}
+	for _, typ := range summaryTypes {
+		snapshots, err := collect.LoadSnapshots(cl.store, typ)
+		if err != nil {
+			return nil, err
+		}
+		for _, snapshot := range snapshots {
+			if snapshot.SnapshotTarget == nil || snapshot.GroupId == "" {
+				continue
+			}
+			groups[snapshot.GroupId] = append(groups[snapshot.GroupId], snapshot)
+		}
+	}
+	return groups, nil
+}
+
+// targetSet returns a key identifying the set of targets the snapshots were collected from
+func targetSet(snapshots []*collect.Snapshot) string {
+	targets := make([]string, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		targets = append(targets, snapshot.Type+":"+snapshot.Label)
+	}
+	sort.Strings(targets)
+	return strings.Join(targets, ",")
+}
+
+// snapshotSummary holds the numbers of a single snapshot merged into the group summary
+type snapshotSummary struct {
+	ok               bool
+	pprofCPU         bool
+	pprofTotal       int64
+	pprofUnit        string
+	endpoints        map[string]*httplog.EndpointStats
+	slowlogTotalTime float64
+}
+
+// summarizeGroup computes the headline numbers of the group, analyzing the snapshots concurrently.
+// Snapshots which cannot be read are skipped.
+func (cl *Collector) summarizeGroup(groupID string, snapshots []*collect.Snapshot) *GroupSummary {
+	summary := &GroupSummary{
+		GroupID: groupID,
+		Targets: strings.Split(targetSet(snapshots), ","),
+	}
+
+	results := make([]*snapshotSummary, len(snapshots))
+	forEachConcurrently(len(snapshots), cl.analysisWorkers, func(i int) {
+		results[i] = summarizeSnapshot(snapshots[i])
+	})
+
+	// Requests from all httplog snapshots are merged before picking the top endpoint
+	endpoints := map[string]*httplog.EndpointStats{}
+
+	// Merge in the order of the snapshots so that the summary does not depend on the scheduling
+	for i, snapshot := range snapshots {
+		result := results[i]
+		if !result.ok {
+			continue
+		}
+
+		switch snapshot.Type {
+		case "pprof":
+			// Only CPU profiles are added up, so that the total is never mixed with the values of another unit
+			if !result.pprofCPU {
+				continue
+			}
+			summary.PprofUnit = result.pprofUnit
+			summary.PprofTotal += result.pprofTotal
+		case "httplog":
+			for pattern, stats := range result.endpoints {
+				if pattern == "" {
+					continue
+				}
+				merged, ok := endpoints[pattern]
+				if !ok {
+					merged = &httplog.EndpointStats{}
+					endpoints[pattern] = merged
+				}
+				merged.Count += stats.Count
+				merged.TotalTime += stats.TotalTime
+			}
+		case "slowlog":
+			summary.SlowlogTotalTime += result.slowlogTotalTime
+		}
+	}
+
+	// The top endpoint is the one spending the most time in total
+	for pattern, stats := range endpoints {
+		top, ok := endpoints[summary.TopEndpoint]
+		if !ok || stats.TotalTime > top.TotalTime || (stats.TotalTime == top.TotalTime && pattern < summary.TopEndpoint) {
+			summary.TopEndpoint = pattern
+		}
+	}
+	if top, ok := endpoints[summary.TopEndpoint]; ok && top.Count > 0 {
+		summary.TopEndpointAvg = top.TotalTime / float64(top.Count)
+	}
+
+	return summary
+}
+
+// summarizeSnapshot analyzes a single snapshot of the group
+func summarizeSnapshot(snapshot *collect.Snapshot) *snapshotSummary {
+	result := &snapshotSummary{}
+
+	content, err := readSnapshotBody(snapshot)
+	if err != nil {
+		log.Printf("[!] failed to read snapshot %s: %v", snapshot.ID, err)
+		return result
+	}
+
+	switch snapshot.Type {
+	case "pprof":
+		result.pprofTotal, result.pprofUnit, err = pprofCPUTotal(snapshot, content)
+		if errors.Is(err, errNotCPUProfile) {
+			break
+		}
+		result.pprofCPU = true
+		if err != nil {
+			log.Printf("[!] failed to parse profile %s: %v", snapshot.ID, err)
+			return result
+		}
+	case "httplog":
+		result.endpoints, err = httplog.AnalyzeEndpoints(content)
+		if err != nil {
+			log.Printf("[!] failed to analyze httplog %s: %v", snapshot.ID, err)
+			return result
+		}
+	case "slowlog":
+		result.slowlogTotalTime, err = slowlogTotalTime(content)
+		if err != nil {
+			log.Printf("[!] failed to analyze slowlog %s: %v", snapshot.ID, err)
+			return result
+		}
+	}
+
+	result.ok = true
+	return result
+}
+
+// errNotCPUProfile is returned for the profiles of another type than CPU (e.g. heap)
+var errNotCPUProfile = errors.New("not a CPU profile")
+
+// pprofCPUTotal returns the total CPU time of the profile and its unit.
+// The profile type of the snapshot is trusted if given, otherwise a profile is a CPU one if it has the "cpu" sample type.
+func pprofCPUTotal(snapshot *collect.Snapshot, content []byte) (int64, string, error) {
+	if snapshot.SnapshotTarget != nil && snapshot.ProfileType != "" && snapshot.ProfileType != "cpu" {
+		return 0, "", errNotCPUProfile
+	}
+
+	prof, err := pprof.ParseCached(content)
+	if err != nil {
+		return 0, "", err
+	}
+
+	index := -1
+	for i, sampleType := range prof.SampleType {
+		if sampleType.Type == "cpu" {
+			index = i
+		}
+	}
+	if index < 0 && snapshot.SnapshotTarget != nil && snapshot.ProfileType == "cpu" {
+		index = pprofSampleIndex(prof)
+	}
+	if index < 0 {
+		return 0, "", errNotCPUProfile
+	}
+
+	total := int64(0)
+	for _, sample := range prof.Sample {
+		if index < len(sample.Value) {
+			total += sample.Value[index]
+		}
+	}
+	return total, prof.SampleType[index].Unit, nil
+}
+
+// pprofSampleIndex returns the index of the sample type selected by default as go tool pprof does,
+// i.e. the default sample type of the profile or the last one, or -1 if the profile has no sample type
+func pprofSampleIndex(prof *profile.Profile) int {
+	for i, sampleType := range prof.SampleType {
+		if sampleType.Type == prof.DefaultSampleType {
+			return i
+		}
+	}
+	return len(prof.SampleType) - 1
+}
+
+// slowlogTotalTime returns the total query time of the slow log
+func slowlogTotalTime(content []byte) (float64, error) {
+	raw, err := slowlog.Analyze(context.Background(), content, 0)
+	if err != nil {
+		return 0, err
+	}
+	result := &slowlog.AnalysisResult{}
+	if err := json.Unmarshal([]byte(raw), result); err != nil {
+		return 0, fmt.Errorf("failed to parse slowlog analysis: %w", err)
+	}
+	return result.TotalTime, nil
+}
+
+func readSnapshotBody(snapshot *collect.Snapshot) ([]byte, error) {
+	path, err := snapshot.BodyPath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find body: %w", err)
+	}
+	return os.ReadFile(path)
+}
@@ -0,0 +1,340 @@
+package group
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/google/pprof/profile"
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/kaz/pprotein/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+func newTestCollector(t *testing.T) (*Collector, storage.Storage) {
+	t.Helper()
+
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	cl, err := NewCollector(store, "0")
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+	return cl, store
+}
+
+// addTestSnapshot stores a snapshot as the collectors do
+func addTestSnapshot(t *testing.T, store storage.Storage, typ, id, groupID, label string, content []byte) {
+	t.Helper()
+
+	snapshot := &collect.Snapshot{
+		SnapshotMeta:   &collect.SnapshotMeta{Type: typ, ID: id, Datetime: time.Now()},
+		SnapshotTarget: &collect.SnapshotTarget{GroupId: groupID, Label: label},
+	}
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatalf("Failed to marshal snapshot: %v", err)
+	}
+	if err := store.Put(typ, id, raw); err != nil {
+		t.Fatalf("Failed to put snapshot: %v", err)
+	}
+	if err := store.PutFile(id, content); err != nil {
+		t.Fatalf("Failed to put snapshot body: %v", err)
+	}
+}
+
+func testProfile(t *testing.T, total int64) []byte {
+	t.Helper()
+
+	fn := &profile.Function{ID: 1, Name: "main.handler"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Function:   []*profile.Function{fn},
+		Location:   []*profile.Location{loc},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{total}}},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := prof.Write(buf); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func testHeapProfile(t *testing.T, total int64) []byte {
+	t.Helper()
+
+	fn := &profile.Function{ID: 1, Name: "main.allocate"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "alloc_objects", Unit: "count"}, {Type: "alloc_space", Unit: "bytes"}},
+		Function:   []*profile.Function{fn},
+		Location:   []*profile.Location{loc},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{1, total}}},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := prof.Write(buf); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func testSlowlog(queryTime string) []byte {
+	return []byte(`# Time: 2023-04-01T12:00:00.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: ` + queryTime + `  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 10000
+SET timestamp=1680350400;
+SELECT * FROM users WHERE id = 1;
+`)
+}
+
+func testHttplog(reqtime string) []byte {
+	return []byte("time:2023-04-01T12:00:00+09:00\tmethod:GET\turi:/api/users/1\tstatus:200\treqtime:" + reqtime + "\n" +
+		"time:2023-04-01T12:00:01+09:00\tmethod:GET\turi:/api/users/2\tstatus:200\treqtime:" + reqtime + "\n")
+}
+
+func TestGroupDelta(t *testing.T) {
+	cl, store := newTestCollector(t)
+
+	addTestSnapshot(t, store, "pprof", "a-pprof.pb.gz", "2025-04-01_12-00-00", "app", testProfile(t, 3000000000))
+	addTestSnapshot(t, store, "httplog", "a-httplog.log", "2025-04-01_12-00-00", "nginx", testHttplog("0.500"))
+	addTestSnapshot(t, store, "slowlog", "a-slowlog.log", "2025-04-01_12-00-00", "mysql", testSlowlog("2.000000"))
+
+	addTestSnapshot(t, store, "pprof", "b-pprof.pb.gz", "2025-04-01_12-10-00", "app", testProfile(t, 2000000000))
+	addTestSnapshot(t, store, "httplog", "b-httplog.log", "2025-04-01_12-10-00", "nginx", testHttplog("0.200"))
+	addTestSnapshot(t, store, "slowlog", "b-slowlog.log", "2025-04-01_12-10-00", "mysql", testSlowlog("0.500000"))
+
+	e := echo.New()
+	cl.RegisterHandlers(e.Group("/api/group"))
+
+	t.Run("Second group is compared with the first", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/group/2025-04-01_12-10-00/delta", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Status code is different from expected. Expected: %d, Actual: %d, Body: %s", http.StatusOK, rec.Code, rec.Body)
+		}
+
+		delta := &GroupDelta{}
+		if err := json.Unmarshal(rec.Body.Bytes(), delta); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+
+		if delta.PreviousGroupID != "2025-04-01_12-00-00" {
+			t.Errorf("Previous group is different from expected. Expected: 2025-04-01_12-00-00, Actual: %s", delta.PreviousGroupID)
+		}
+		if delta.PprofTotal != -1000000000 {
+			t.Errorf("pprof total delta is different from expected. Expected: -1000000000, Actual: %d", delta.PprofTotal)
+		}
+		if delta.Current.TopEndpoint != "/api/users/:id" {
+			t.Errorf("Top endpoint is different from expected. Expected: /api/users/:id, Actual: %s", delta.Current.TopEndpoint)
+		}
+		if d := delta.TopEndpointAvg; d > -0.299 || d < -0.301 {
+			t.Errorf("Top endpoint avg delta is different from expected. Expected: -0.3, Actual: %f", d)
+		}
+		if d := delta.SlowlogTotalTime; d > -1.499 || d < -1.501 {
+			t.Errorf("Slowlog total time delta is different from expected. Expected: -1.5, Actual: %f", d)
+		}
+	})
+
+	t.Run("First group has no previous group", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/group/2025-04-01_12-00-00/delta", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Status code is different from expected. Expected: %d, Actual: %d", http.StatusOK, rec.Code)
+		}
+
+		delta := &GroupDelta{}
+		if err := json.Unmarshal(rec.Body.Bytes(), delta); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if delta.PreviousGroupID != "" || delta.Previous != nil {
+			t.Errorf("First group should not have a previous group: %+v", delta)
+		}
+		if delta.Message == "" {
+			t.Errorf("Message explaining the missing previous group is empty")
+		}
+	})
+
+	t.Run("Unknown group", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/group/unknown/delta", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Status code is different from expected. Expected: %d, Actual: %d", http.StatusNotFound, rec.Code)
+		}
+	})
+}
+
+func TestGroupDeltaAgainstBaseline(t *testing.T) {
+	cl, store := newTestCollector(t)
+
+	for i, groupID := range []string{"2025-04-01_12-00-00", "2025-04-01_12-10-00", "2025-04-01_12-20-00"} {
+		addTestSnapshot(t, store, "pprof", groupID+"-pprof.pb.gz", groupID, "app", testProfile(t, int64(3-i)*1000000000))
+	}
+
+	e := echo.New()
+	cl.RegisterHandlers(e.Group("/api/group"))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/group/baseline/2025-04-01_12-00-00", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Failed to set baseline: %d, body=%s", rec.Code, rec.Body)
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		previous     string
+		comparedWith string
+		pprofTotal   int64
+	}{
+		{
+			name:         "Baseline by default",
+			path:         "/api/group/2025-04-01_12-20-00/delta",
+			previous:     "2025-04-01_12-00-00",
+			comparedWith: "baseline",
+			pprofTotal:   -2000000000,
+		},
+		{
+			name:         "Explicit comparison target",
+			path:         "/api/group/2025-04-01_12-20-00/delta?against=2025-04-01_12-10-00",
+			previous:     "2025-04-01_12-10-00",
+			comparedWith: "explicit",
+			pprofTotal:   -1000000000,
+		},
+		{
+			name:         "Baseline itself is compared with the previous group",
+			path:         "/api/group/2025-04-01_12-00-00/delta",
+			previous:     "",
+			comparedWith: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Status code is different from expected. Expected: %d, Actual: %d, Body: %s", http.StatusOK, rec.Code, rec.Body)
+			}
+
+			delta := &GroupDelta{}
+			if err := json.Unmarshal(rec.Body.Bytes(), delta); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if delta.PreviousGroupID != tt.previous {
+				t.Errorf("Compared group is different from expected. Expected: %s, Actual: %s", tt.previous, delta.PreviousGroupID)
+			}
+			if delta.ComparedWith != tt.comparedWith {
+				t.Errorf("Comparison is different from expected. Expected: %s, Actual: %s", tt.comparedWith, delta.ComparedWith)
+			}
+			if delta.PprofTotal != tt.pprofTotal {
+				t.Errorf("pprof total delta is different from expected. Expected: %d, Actual: %d", tt.pprofTotal, delta.PprofTotal)
+			}
+		})
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/group/baseline/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Unknown group is accepted as the baseline: %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/group/baseline", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Failed to clear baseline: %d", rec.Code)
+	}
+	if baseline, err := cl.getBaseline(); err != nil || baseline != "" {
+		t.Errorf("Baseline is not cleared: %q, %v", baseline, err)
+	}
+}
+
+func TestPprofCPUTotal(t *testing.T) {
+	fn := &profile.Function{ID: 1, Name: "main.handler"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	newProfile := func(sampleTypes ...*profile.ValueType) []byte {
+		values := make([]int64, len(sampleTypes))
+		for i := range values {
+			values[i] = int64(i+1) * 10
+		}
+		prof := &profile.Profile{
+			SampleType: sampleTypes,
+			Function:   []*profile.Function{fn},
+			Location:   []*profile.Location{loc},
+			Sample: []*profile.Sample{
+				{Location: []*profile.Location{loc}, Value: values},
+				{Location: []*profile.Location{loc}, Value: values},
+			},
+		}
+		buf := &bytes.Buffer{}
+		if err := prof.Write(buf); err != nil {
+			t.Fatalf("Failed to write profile: %v", err)
+		}
+		return buf.Bytes()
+	}
+	samples := &profile.ValueType{Type: "samples", Unit: "count"}
+	cpu := &profile.ValueType{Type: "cpu", Unit: "nanoseconds"}
+	space := &profile.ValueType{Type: "alloc_space", Unit: "bytes"}
+
+	tests := []struct {
+		name        string
+		profileType string
+		content     []byte
+		total       int64
+		unit        string
+		notCPU      bool
+	}{
+		{name: "CPU sample type", content: newProfile(cpu, samples), total: 20, unit: "nanoseconds"},
+		{name: "Heap profile", content: newProfile(samples, space), notCPU: true},
+		{name: "Profile type other than CPU", profileType: "heap", content: newProfile(samples, cpu), notCPU: true},
+		{name: "CPU profile type without the CPU sample type", profileType: "cpu", content: newProfile(samples), total: 20, unit: "count"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot := &collect.Snapshot{SnapshotTarget: &collect.SnapshotTarget{ProfileType: tt.profileType}}
+			total, unit, err := pprofCPUTotal(snapshot, tt.content)
+			if tt.notCPU {
+				if !errors.Is(err, errNotCPUProfile) {
+					t.Errorf("Profile is not rejected as a non-CPU profile: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to compute pprof total: %v", err)
+			}
+			if total != tt.total {
+				t.Errorf("pprof total is different from expected. Expected: %d, Actual: %d", tt.total, total)
+			}
+			if unit != tt.unit {
+				t.Errorf("pprof unit is different from expected. Expected: %s, Actual: %s", tt.unit, unit)
+			}
+		})
+	}
+}
+
+func TestSummarizeGroupOnlyAddsCPUProfiles(t *testing.T) {
+	cl, store := newTestCollector(t)
+
+	const groupID = "2025-04-01_12-00-00"
+	addTestSnapshot(t, store, "pprof", "cpu-pprof.pb.gz", groupID, "app", testProfile(t, 3000000000))
+	addTestSnapshot(t, store, "pprof", "heap-pprof.pb.gz", groupID, "app", testHeapProfile(t, 1024))
+
+	snapshots, err := collect.LoadSnapshots(store, "pprof")
+	if err != nil {
+		t.Fatalf("Failed to load snapshots: %v", err)
+	}
+
+	summary := cl.summarizeGroup(groupID, snapshots)
+	if summary.PprofTotal != 3000000000 || summary.PprofUnit != "nanoseconds" {
+		t.Errorf("pprof total is different from expected. Expected: 3000000000 nanoseconds, Actual: %d %s", summary.PprofTotal, summary.PprofUnit)
+	}
+}
@@ -0,0 +1,78 @@
+package group
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/kaz/pprotein/internal/analyze/httplog"
+	"github.com/labstack/echo/v4"
+)
+
+// HttplogComparison is the change of the latency per endpoint between the httplogs of two groups
+type HttplogComparison struct {
+	GroupID   string                        `json:"group_id"`
+	Against   string                        `json:"against"`
+	Endpoints []*httplog.EndpointComparison `json:"endpoints"`
+}
+
+// getHttplogComparison compares the httplogs of the group with the ones of the group given by the "against"
+// query parameter, or of the baseline group if it is set. The httplogs of all targets of a group are merged.
+// Httplogs with another field separator or labels are read with delimiter and labels like the analysis.
+func (cl *Collector) getHttplogComparison(c echo.Context) error {
+	groupID, against := c.Param("id"), c.QueryParam("against")
+	format, err := httplogFormatParam(c)
+	if err != nil {
+		return err
+	}
+	if against == "" {
+		baseline, err := cl.getBaseline()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if baseline == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "against is required unless a baseline is set")
+		}
+		against = baseline
+	}
+
+	groups, err := cl.loadGroupSnapshots()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to load groups: %v", err))
+	}
+
+	logs := map[string][][]byte{}
+	for _, id := range []string{against, groupID} {
+		for _, snapshot := range groups[id] {
+			if snapshot.Type != "httplog" {
+				continue
+			}
+			content, err := readSnapshotBody(snapshot)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to read %s: %v", snapshot.ID, err))
+			}
+			logs[id] = append(logs[id], content)
+		}
+		if len(logs[id]) == 0 {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no httplog in group: %s", id))
+		}
+	}
+
+	endpoints, err := httplog.CompareEndpoints(c.Request().Context(), logs[against], logs[groupID], format)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to compare httplogs: %v", err))
+	}
+	return c.JSON(http.StatusOK, &HttplogComparison{GroupID: groupID, Against: against, Endpoints: endpoints})
+}
+
+// httplogFormatParam reads the layout of the httplogs from the delimiter and labels query parameters
+func httplogFormatParam(c echo.Context) (httplog.Format, error) {
+	labels, err := httplog.ParseLabels(c.QueryParam("labels"))
+	if err != nil {
+		return httplog.Format{}, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid labels: %v", err))
+	}
+	format := httplog.Format{Delimiter: c.QueryParam("delimiter"), Labels: labels}
+	if err := format.Validate(); err != nil {
+		return httplog.Format{}, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid labels: %v", err))
+	}
+	return format, nil
+}
@@ -0,0 +1,60 @@
+package group
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo/v4"
+)
+
+func TestHttplogComparison(t *testing.T) {
+	cl, store := newTestCollector(t)
+	addTestSnapshot(t, store, "httplog", "g1-app1-httplog.log", "2025-04-01_12-00-00", "app1", []byte("uri:/api/items\treqtime:0.100\n"))
+	addTestSnapshot(t, store, "httplog", "g1-app2-httplog.log", "2025-04-01_12-00-00", "app2", []byte("uri:/api/items\treqtime:0.300\n"))
+	addTestSnapshot(t, store, "httplog", "g2-app1-httplog.log", "2025-04-01_13-00-00", "app1", []byte("uri:/api/items\treqtime:0.500\n"))
+	addTestSnapshot(t, store, "pprof", "g3-pprof.pb.gz", "2025-04-01_14-00-00", "app1", testProfile(t, 100))
+
+	e := echo.New()
+	cl.RegisterHandlers(e.Group("/api/group"))
+
+	tests := []struct {
+		name     string
+		path     string
+		expected int
+	}{
+		{name: "Against a group", path: "/api/group/2025-04-01_13-00-00/httplog/compare?against=2025-04-01_12-00-00", expected: http.StatusOK},
+		{name: "Without against nor baseline", path: "/api/group/2025-04-01_13-00-00/httplog/compare", expected: http.StatusBadRequest},
+		{name: "Relabeled fields", path: "/api/group/2025-04-01_13-00-00/httplog/compare?against=2025-04-01_12-00-00&labels=uri=uri", expected: http.StatusOK},
+		{name: "Malformed labels", path: "/api/group/2025-04-01_13-00-00/httplog/compare?against=2025-04-01_12-00-00&labels=duration", expected: http.StatusBadRequest},
+		{name: "Unknown field", path: "/api/group/2025-04-01_13-00-00/httplog/compare?against=2025-04-01_12-00-00&labels=latency=duration", expected: http.StatusBadRequest},
+		{name: "Group without httplog", path: "/api/group/2025-04-01_14-00-00/httplog/compare?against=2025-04-01_12-00-00", expected: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.expected {
+				t.Fatalf("Status is different from expected. Expected: %d, Actual: %d, body=%s", tt.expected, rec.Code, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			// The httplogs of both targets of the first group are merged
+			comparison := &HttplogComparison{}
+			if err := json.Unmarshal(rec.Body.Bytes(), comparison); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(comparison.Endpoints) != 1 {
+				t.Fatalf("Endpoints are different from expected: %s", rec.Body)
+			}
+			endpoint := comparison.Endpoints[0]
+			if endpoint.Before.Count != 2 || endpoint.CountDelta != -1 || endpoint.Status != "regressed" {
+				t.Errorf("Comparison is different from expected: %s", rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package group
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/kaz/pprotein/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+// ImportResult is the outcome of importing a group archive
+type ImportResult struct {
+	GroupID  string   `json:"group_id"`
+	Imported []string `json:"imported"`
+	Skipped  []string `json:"skipped"` // Entries listed as missing in the manifest
+}
+
+// importArchive restores a group from the zip archive of getArchive in the request body.
+// The entries go to a new group unless preserve_id=true, in which case the group ID of the archive is kept.
+// Entry IDs are kept as they are, so an archive can't be imported while its entries exist.
+// The archive and each of its files are read into memory, so they are rejected with 413 when larger than PPROTEIN_MAX_BODY_SIZE.
+func (cl *Collector) importArchive(c echo.Context) error {
+	body := c.Request().Body
+	if cl.maxBodySize > 0 {
+		body = http.MaxBytesReader(c.Response(), body, cl.maxBodySize)
+	}
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("archive exceeds the limit of %d bytes", maxBytesErr.Limit))
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to read body: %v", err))
+	}
+	zr, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to open archive: %v", err))
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	manifest, err := readManifest(files, cl.maxBodySize)
+	if err != nil {
+		if errors.Is(err, storage.ErrSizeLimitExceeded) {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid archive: %v", err))
+	}
+
+	for _, entry := range manifest.Entries {
+		if entry.Missing {
+			continue
+		}
+		if ok, err := cl.store.Exists(entry.Type, entry.ID); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to check entry: %v", err))
+		} else if ok {
+			return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("entry already exists: %s/%s", entry.Type, entry.ID))
+		}
+	}
+
+	groupID := time.Now().Format(IDLayout)
+	if c.QueryParam("preserve_id") == "true" {
+		groupID = manifest.GroupID
+	}
+
+	result := &ImportResult{GroupID: groupID, Imported: []string{}, Skipped: []string{}}
+	for _, entry := range manifest.Entries {
+		if entry.Missing {
+			result.Skipped = append(result.Skipped, entry.ID)
+			continue
+		}
+
+		content, err := readArchiveFile(files[entry.Path], cl.maxBodySize)
+		if err != nil {
+			if errors.Is(err, storage.ErrSizeLimitExceeded) {
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to read %s: %v", entry.Path, err))
+		}
+		_, err = collect.Import(cl.store, &collect.SnapshotMeta{
+			Type:     entry.Type,
+			ID:       entry.ID,
+			Datetime: entry.Datetime,
+		}, &collect.SnapshotTarget{
+			GroupId:  groupID,
+			Label:    entry.Label,
+			URL:      entry.URL,
+			Duration: entry.Duration,
+
+			ProfileType: entry.ProfileType,
+		}, content)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to import %s: %v", entry.ID, err))
+		}
+		result.Imported = append(result.Imported, entry.ID)
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// readManifest parses and validates the manifest of the archive, checking that every entry not missing has its file
+func readManifest(files map[string]*zip.File, maxSize int64) (*ArchiveManifest, error) {
+	f, ok := files[archiveManifestName]
+	if !ok {
+		return nil, fmt.Errorf("%s is missing", archiveManifestName)
+	}
+	raw, err := readArchiveFile(f, maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", archiveManifestName, err)
+	}
+	manifest := &ArchiveManifest{}
+	if err := json.Unmarshal(raw, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", archiveManifestName, err)
+	}
+
+	if manifest.GroupID == "" {
+		return nil, fmt.Errorf("group_id is missing")
+	}
+	if len(manifest.Entries) == 0 {
+		return nil, fmt.Errorf("no entries")
+	}
+
+	ids := map[string]bool{}
+	for i, entry := range manifest.Entries {
+		if entry == nil {
+			return nil, fmt.Errorf("entry %d is null", i)
+		}
+		if !slices.Contains(collect.AllTypes, entry.Type) {
+			return nil, fmt.Errorf("unknown type of entry %d: %s", i, entry.Type)
+		}
+		if entry.ID == "" || entry.ID == "." || entry.ID == ".." || strings.ContainsAny(entry.ID, `/\`) {
+			return nil, fmt.Errorf("invalid id of entry %d: %q", i, entry.ID)
+		}
+		if ids[entry.ID] {
+			return nil, fmt.Errorf("duplicated id: %s", entry.ID)
+		}
+		ids[entry.ID] = true
+
+		if entry.Missing {
+			continue
+		}
+		if entry.Path != path.Join(entry.Type, entry.ID) {
+			return nil, fmt.Errorf("unexpected path of %s: %s", entry.ID, entry.Path)
+		}
+		if _, ok := files[entry.Path]; !ok {
+			return nil, fmt.Errorf("file of %s is missing", entry.ID)
+		}
+	}
+	return manifest, nil
+}
+
+// The file is rejected with storage.ErrSizeLimitExceeded if it expands to more than maxSize bytes, unless maxSize is 0.
+func readArchiveFile(f *zip.File, maxSize int64) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var src io.Reader = r
+	if maxSize > 0 {
+		src = io.LimitReader(r, maxSize+1)
+	}
+	content, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && int64(len(content)) > maxSize {
+		return nil, fmt.Errorf("%w: %s exceeds the limit of %d bytes", storage.ErrSizeLimitExceeded, f.Name, maxSize)
+	}
+	return content, nil
+}
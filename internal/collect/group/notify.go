@@ -0,0 +1,93 @@
+package group
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+// Environment variable specifying the URL of the webhook notified when a collection completes
+const WebhookURLEnv = "PPROTEIN_WEBHOOK_URL"
+
+type (
+	// Notification tells the outcome of a collection
+	Notification struct {
+		GroupID  string  `json:"group_id"`
+		Targets  int     `json:"targets"`
+		Skipped  int     `json:"skipped"`  // Targets of disabled types
+		Duration float64 `json:"duration"` // Seconds the collection took
+		Error    string  `json:"error,omitempty"`
+	}
+
+	// Notifier is told when a collection completes
+	Notifier interface {
+		Notify(n *Notification) error
+	}
+
+	// webhookNotifier posts a Slack-compatible payload to a webhook
+	webhookNotifier struct {
+		url    string
+		client *http.Client
+	}
+
+	// webhookPayload is the body posted to the webhook, with "text" for Slack and the notification for other receivers
+	webhookPayload struct {
+		Text string `json:"text"`
+		*Notification
+	}
+)
+
+// notifierFromEnv returns the webhook notifier if WebhookURLEnv is set, or nil otherwise
+func notifierFromEnv() Notifier {
+	url := os.Getenv(WebhookURLEnv)
+	if url == "" {
+		return nil
+	}
+	return &webhookNotifier{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (w *webhookNotifier) Notify(n *Notification) error {
+	body, err := json.Marshal(&webhookPayload{Text: n.summary(), Notification: n})
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// summary is the one-line message of the notification
+func (n *Notification) summary() string {
+	status := "completed"
+	if n.Error != "" {
+		status = "failed: " + n.Error
+	}
+	msg := fmt.Sprintf("pprotein: collection %s %s (%d targets in %.0fs)", n.GroupID, status, n.Targets, n.Duration)
+	if n.Skipped > 0 {
+		msg += fmt.Sprintf(", %d skipped", n.Skipped)
+	}
+	return msg
+}
+
+// notify tells the notifier about the collection if there is one, only logging failures
+func (cl *Collector) notify(n *Notification) {
+	if cl.notifier == nil {
+		return
+	}
+	if err := cl.notifier.Notify(n); err != nil {
+		log.Printf("[!] failed to notify collection %s: %v", n.GroupID, err)
+	}
+}
@@ -0,0 +1,75 @@
+package group
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/kaz/pprotein/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+func TestNotifyOnCollection(t *testing.T) {
+	payloads := make(chan map[string]interface{}, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		payloads <- payload
+	}))
+	defer webhook.Close()
+	t.Setenv(WebhookURLEnv, webhook.URL)
+
+	// API of pprotein accepting the collection requests
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer api.Close()
+	apiURL, _ := url.Parse(api.URL)
+
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	cl, err := NewCollector(store, apiURL.Port())
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+
+	e := echo.New()
+	cl.RegisterHandlers(e.Group("/api/group"))
+
+	targets := `[{"Type":"pprof","Label":"app","URL":"http://app.example/debug/pprof/profile","Duration":1},` +
+		`{"Type":"httplog","Label":"nginx","URL":"http://app.example/debug/log/httplog","Duration":1}]`
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/group/targets", bytes.NewBufferString(targets)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Failed to set targets: %d, body=%s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/group/collect", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Failed to collect: %d, body=%s", rec.Code, rec.Body)
+	}
+
+	select {
+	case payload := <-payloads:
+		groupID, _ := payload["group_id"].(string)
+		if _, err := time.ParseInLocation(IDLayout, groupID, time.Local); err != nil {
+			t.Errorf("Group ID is different from expected. Actual: %q", groupID)
+		}
+		if text, _ := payload["text"].(string); !strings.Contains(text, groupID) || !strings.Contains(text, "completed") {
+			t.Errorf("Text is different from expected. Actual: %q", text)
+		}
+		if targets, _ := payload["targets"].(float64); targets != 2 {
+			t.Errorf("Target count is different from expected. Expected: 2, Actual: %v", payload["targets"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Webhook was not called")
+	}
+}
@@ -0,0 +1,86 @@
+package group
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/kaz/pprotein/internal/data"
+)
+
+// Environment variable specifying how many of the most recent groups to keep
+const KeepGroupsEnv = "PPROTEIN_KEEP_GROUPS"
+
+// keepGroupsFromEnv returns the number of groups to keep, where 0 means unlimited
+func keepGroupsFromEnv() int {
+	v := os.Getenv(KeepGroupsEnv)
+	if v == "" {
+		return 0
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Printf("[!] invalid %s %q, keeping all groups", KeepGroupsEnv, v)
+		return 0
+	}
+	return n
+}
+
+// pruneGroups deletes all entries of the oldest groups so that at most keepGroups groups remain.
+// The group being collected counts as one of them even if none of its entries are stored yet.
+// The baseline group is never pruned and doesn't count toward keepGroups.
+// Pruned entries are dropped from the live collectors along with their cached results.
+func (cl *Collector) pruneGroups(currentGroupID string) error {
+	if cl.keepGroups <= 0 {
+		return nil
+	}
+
+	groups := map[string][]*collect.Snapshot{currentGroupID: nil}
+	// Entries of disabled types are pruned as well
+	for _, typ := range collect.AllTypes {
+		snapshots, err := collect.LoadSnapshots(cl.store, typ)
+		if err != nil {
+			return err
+		}
+		for _, snapshot := range snapshots {
+			if snapshot.SnapshotTarget == nil || snapshot.GroupId == "" {
+				continue
+			}
+			groups[snapshot.GroupId] = append(groups[snapshot.GroupId], snapshot)
+		}
+	}
+
+	baseline, err := cl.getBaseline()
+	if err != nil {
+		return err
+	}
+	if baseline != currentGroupID {
+		delete(groups, baseline)
+	}
+	if len(groups) <= cl.keepGroups {
+		return nil
+	}
+
+	// Group IDs are timestamps, so they sort chronologically
+	ids := make([]string, 0, len(groups))
+	for id := range groups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids[:len(ids)-cl.keepGroups] {
+		if id == currentGroupID {
+			continue
+		}
+		for _, snapshot := range groups[id] {
+			if err := data.Delete(cl.store, snapshot.Type, snapshot.ID); err != nil {
+				return fmt.Errorf("failed to delete %s of group %s: %w", snapshot.ID, id, err)
+			}
+		}
+		log.Printf("pruned group %s (%d entries)", id, len(groups[id]))
+	}
+	return nil
+}
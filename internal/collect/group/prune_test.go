@@ -0,0 +1,123 @@
+package group
+
+import (
+	"testing"
+
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/kaz/pprotein/internal/event"
+)
+
+func TestPruneGroups(t *testing.T) {
+	cl, store := newTestCollector(t)
+	cl.keepGroups = 2
+
+	addTestSnapshot(t, store, "pprof", "g1-pprof.pb.gz", "2025-04-01_12-00-00", "app", []byte("p"))
+	addTestSnapshot(t, store, "slowlog", "g1-slowlog.log", "2025-04-01_12-00-00", "db", []byte("s"))
+	addTestSnapshot(t, store, "memo", "g1-memo.log", "2025-04-01_12-00-00", "memo", []byte("m"))
+	addTestSnapshot(t, store, "pprof", "g2-pprof.pb.gz", "2025-04-01_12-10-00", "app", []byte("p"))
+
+	// Collecting the third group pushes out the first one
+	if err := cl.pruneGroups("2025-04-01_12-20-00"); err != nil {
+		t.Fatalf("Failed to prune groups: %v", err)
+	}
+
+	for _, entry := range []struct{ typ, id string }{
+		{"pprof", "g1-pprof.pb.gz"},
+		{"slowlog", "g1-slowlog.log"},
+		{"memo", "g1-memo.log"},
+	} {
+		if ok, _ := store.Exists(entry.typ, entry.id); ok {
+			t.Errorf("Metadata of %s in the oldest group is not deleted", entry.id)
+		}
+		if ok, _ := store.ExistsFile(entry.id); ok {
+			t.Errorf("File of %s in the oldest group is not deleted", entry.id)
+		}
+	}
+	if ok, _ := store.Exists("pprof", "g2-pprof.pb.gz"); !ok {
+		t.Errorf("Entry of a recent group is deleted")
+	}
+
+	// Unlimited by default
+	cl.keepGroups = 0
+	addTestSnapshot(t, store, "pprof", "g3-pprof.pb.gz", "2025-04-01_12-20-00", "app", []byte("p"))
+	if err := cl.pruneGroups("2025-04-01_12-30-00"); err != nil {
+		t.Fatalf("Failed to prune groups: %v", err)
+	}
+	if ok, _ := store.Exists("pprof", "g2-pprof.pb.gz"); !ok {
+		t.Errorf("Entry is deleted even though the number of groups is unlimited")
+	}
+}
+
+func TestPruneGroupsRemovesCollectedEntries(t *testing.T) {
+	cl, store := newTestCollector(t)
+	cl.keepGroups = 2
+
+	collector, err := collect.New(&countingProcessor{}, &collect.Options{Type: "memo", Ext: "-memo.txt", Store: store, EventHub: event.NewHub()})
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+	old, err := collector.Add(&collect.SnapshotTarget{GroupId: "2025-04-01_12-00-00", Label: "memo"}, []byte("a"))
+	if err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+	recent, err := collector.Add(&collect.SnapshotTarget{GroupId: "2025-04-01_12-10-00", Label: "memo"}, []byte("b"))
+	if err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+
+	if err := cl.pruneGroups("2025-04-01_12-20-00"); err != nil {
+		t.Fatalf("Failed to prune groups: %v", err)
+	}
+
+	entries := collector.List()
+	if len(entries) != 1 || entries[0].Snapshot.ID != recent.ID {
+		t.Errorf("Listed entries are different from expected. Expected: [%s], Actual: %d entries", recent.ID, len(entries))
+	}
+	if cached, err := collect.CachedResult(store, old.ID); err != nil || cached != nil {
+		t.Errorf("Cache of a pruned entry is not deleted: %q, %v", cached, err)
+	}
+	if ok, _ := store.Exists("cache-index", old.ID); ok {
+		t.Errorf("Cache index of a pruned entry is not deleted")
+	}
+	if cached, err := collect.CachedResult(store, recent.ID); err != nil || cached == nil {
+		t.Errorf("Cache of a recent entry is deleted: %v", err)
+	}
+}
+
+func TestPruneGroupsKeepsBaseline(t *testing.T) {
+	cl, store := newTestCollector(t)
+	cl.keepGroups = 2
+
+	addTestSnapshot(t, store, "pprof", "g1-pprof.pb.gz", "2025-04-01_12-00-00", "app", []byte("p"))
+	addTestSnapshot(t, store, "pprof", "g2-pprof.pb.gz", "2025-04-01_12-10-00", "app", []byte("p"))
+	addTestSnapshot(t, store, "pprof", "g3-pprof.pb.gz", "2025-04-01_12-20-00", "app", []byte("p"))
+	if err := store.Put(baselineType, baselineID, []byte("2025-04-01_12-00-00")); err != nil {
+		t.Fatalf("Failed to set baseline: %v", err)
+	}
+
+	// The oldest group is the baseline, so the next oldest one is pruned instead
+	if err := cl.pruneGroups("2025-04-01_12-30-00"); err != nil {
+		t.Fatalf("Failed to prune groups: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		id     string
+		exists bool
+	}{
+		{name: "Baseline", id: "g1-pprof.pb.gz", exists: true},
+		{name: "Oldest group besides the baseline", id: "g2-pprof.pb.gz", exists: false},
+		{name: "Recent group", id: "g3-pprof.pb.gz", exists: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ok, _ := store.Exists("pprof", tt.id); ok != tt.exists {
+				t.Errorf("Existence of %s is different from expected. Expected: %v, Actual: %v", tt.id, tt.exists, ok)
+			}
+		})
+	}
+	if baseline, err := cl.getBaseline(); err != nil || baseline != "2025-04-01_12-00-00" {
+		t.Errorf("Baseline is different from expected. Expected: 2025-04-01_12-00-00, Actual: %q, %v", baseline, err)
+	}
+}
@@ -0,0 +1,65 @@
+package group
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Environment variable allowing targets pointing at the API of pprotein itself
+const AllowSelfTargetsEnv = "PPROTEIN_ALLOW_SELF_TARGETS"
+
+// checkSelfTarget rejects a target pointing at the API of this pprotein, which would make collection recurse.
+// Targets on the same address and port outside /api (e.g. the self-profiling /debug/pprof) are fine.
+func (cl *Collector) checkSelfTarget(target *CollectTarget) error {
+	if cl.allowSelfTargets {
+		return nil
+	}
+
+	u, err := url.Parse(target.URL)
+	if err != nil {
+		return fmt.Errorf("invalid URL of %s: %w", target.Label, err)
+	}
+	if u.Path != "/api" && !strings.HasPrefix(u.Path, "/api/") {
+		return nil
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	if port != cl.port || !isSelfHost(u.Hostname()) {
+		return nil
+	}
+	return fmt.Errorf("URL of %s points at the API of pprotein itself: %s (set %s=true to allow)", target.Label, target.URL, AllowSelfTargetsEnv)
+}
+
+// isSelfHost reports whether the host is an address of this machine, without resolving other names
+func isSelfHost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	if hostname, err := os.Hostname(); err == nil && strings.EqualFold(host, hostname) {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() || ip.IsUnspecified() {
+		return true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package group
+
+import (
+	"testing"
+)
+
+func TestSanitizeRejectsSelfTargets(t *testing.T) {
+	cl, _ := newTestCollector(t)
+	cl.port = "9000"
+
+	tests := []struct {
+		name    string
+		url     string
+		allow   bool
+		wantErr bool
+	}{
+		{name: "Own API", url: "http://localhost:9000/api/group/collect", wantErr: true},
+		{name: "Own API via loopback address", url: "http://127.0.0.1:9000/api/pprof", wantErr: true},
+		{name: "Own API allowed explicitly", url: "http://localhost:9000/api/pprof", allow: true},
+		{name: "Self-profiling", url: "http://localhost:9000/debug/pprof/profile"},
+		{name: "Another port", url: "http://localhost:8080/api/pprof"},
+		{name: "Another host", url: "http://192.0.2.1:9000/api/pprof"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl.allowSelfTargets = tt.allow
+			raw := `[{"Type": "pprof", "Label": "app", "URL": "` + tt.url + `", "Duration": 10}]`
+			if _, err := cl.sanitize([]byte(raw)); (err != nil) != tt.wantErr {
+				t.Errorf("sanitize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
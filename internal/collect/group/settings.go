@@ -0,0 +1,20 @@
+package group
+
+// Settings is the effective configuration of the group collector
+type Settings struct {
+	KeepGroups       int  `json:"keep_groups"`
+	AnalysisWorkers  int  `json:"analysis_workers"`
+	AllowSelfTargets bool `json:"allow_self_targets"`
+	// Whether a webhook is notified, whose URL is left out as it usually embeds a token
+	Webhook bool `json:"webhook"`
+}
+
+// Settings returns the settings the collector is running with
+func (cl *Collector) Settings() Settings {
+	return Settings{
+		KeepGroups:       cl.keepGroups,
+		AnalysisWorkers:  cl.analysisWorkers,
+		AllowSelfTargets: cl.allowSelfTargets,
+		Webhook:          cl.notifier != nil,
+	}
+}
@@ -0,0 +1,78 @@
+package group
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/labstack/echo/v4"
+)
+
+// Stats is an at-a-glance summary of the whole instance
+type Stats struct {
+	Groups       int            `json:"groups"`
+	Entries      map[string]int `json:"entries"`
+	StorageBytes int64          `json:"storage_bytes"`
+	OldestGroup  *time.Time     `json:"oldest_group,omitempty"`
+	NewestGroup  *time.Time     `json:"newest_group,omitempty"`
+	MCPRunning   bool           `json:"mcp_running"`
+}
+
+// HandleStats returns the handler serving the instance summary, where mcpRunning reports whether the MCP server is up
+func (cl *Collector) HandleStats(mcpRunning func() bool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		stats, err := cl.computeStats()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to compute stats: %v", err))
+		}
+		stats.MCPRunning = mcpRunning()
+		return c.JSON(http.StatusOK, stats)
+	}
+}
+
+// computeStats aggregates the storage listings of the enabled types
+func (cl *Collector) computeStats() (*Stats, error) {
+	stats := &Stats{Entries: map[string]int{}}
+
+	groups := map[string]time.Time{}
+	for _, typ := range collect.Types() {
+		snapshots, err := collect.LoadSnapshots(cl.store, typ)
+		if err != nil {
+			return nil, err
+		}
+		stats.Entries[typ] = len(snapshots)
+
+		for _, snapshot := range snapshots {
+			if snapshot.SnapshotTarget == nil || snapshot.GroupId == "" {
+				continue
+			}
+			if _, ok := groups[snapshot.GroupId]; ok {
+				continue
+			}
+			timestamp, err := time.ParseInLocation(IDLayout, snapshot.GroupId, time.Local)
+			if err != nil {
+				timestamp = snapshot.Datetime
+			}
+			groups[snapshot.GroupId] = timestamp
+		}
+	}
+	stats.Groups = len(groups)
+
+	timestamps := make([]time.Time, 0, len(groups))
+	for _, timestamp := range groups {
+		timestamps = append(timestamps, timestamp)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i].Before(timestamps[j]) })
+	if len(timestamps) > 0 {
+		stats.OldestGroup, stats.NewestGroup = &timestamps[0], &timestamps[len(timestamps)-1]
+	}
+
+	usage, err := cl.store.Usage()
+	if err != nil {
+		return nil, err
+	}
+	stats.StorageBytes = usage
+	return stats, nil
+}
@@ -0,0 +1,54 @@
+package group
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo/v4"
+)
+
+func TestStats(t *testing.T) {
+	cl, store := newTestCollector(t)
+
+	addTestSnapshot(t, store, "pprof", "g1-pprof.pb.gz", "2025-04-01_12-00-00", "app", []byte("pprof"))
+	addTestSnapshot(t, store, "slowlog", "g1-slowlog.log", "2025-04-01_12-00-00", "db", []byte("slowlog"))
+	addTestSnapshot(t, store, "pprof", "g2-pprof.pb.gz", "2025-04-01_12-10-00", "app", []byte("pprof"))
+	addTestSnapshot(t, store, "httplog", "g3-httplog.log", "2025-04-01_12-20-00", "nginx", []byte("httplog"))
+
+	e := echo.New()
+	e.GET("/api/stats", cl.HandleStats(func() bool { return true }))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+	}
+
+	stats := &Stats{}
+	if err := json.Unmarshal(rec.Body.Bytes(), stats); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if stats.Groups != 3 {
+		t.Errorf("Group count is different from expected. Expected: 3, Actual: %d", stats.Groups)
+	}
+	for typ, expected := range map[string]int{"pprof": 2, "slowlog": 1, "httplog": 1, "memo": 0} {
+		if stats.Entries[typ] != expected {
+			t.Errorf("Entry count of %s is different from expected. Expected: %d, Actual: %d", typ, expected, stats.Entries[typ])
+		}
+	}
+	if bodies := int64(len("pprof")*2 + len("slowlog") + len("httplog")); stats.StorageBytes < bodies {
+		t.Errorf("Storage bytes is smaller than the stored bodies. Expected at least: %d, Actual: %d", bodies, stats.StorageBytes)
+	}
+	if stats.OldestGroup == nil || stats.OldestGroup.Format(IDLayout) != "2025-04-01_12-00-00" {
+		t.Errorf("Oldest group is different from expected. Actual: %v", stats.OldestGroup)
+	}
+	if stats.NewestGroup == nil || stats.NewestGroup.Format(IDLayout) != "2025-04-01_12-20-00" {
+		t.Errorf("Newest group is different from expected. Actual: %v", stats.NewestGroup)
+	}
+	if !stats.MCPRunning {
+		t.Errorf("MCP status is different from expected")
+	}
+}
@@ -0,0 +1,152 @@
+package group
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kaz/pprotein/internal/analyze/httplog"
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/labstack/echo/v4"
+)
+
+// Metrics available in the trend and the snapshot type each one is computed from
+var trendMetrics = map[string]string{
+	"pprof_total":        "pprof",
+	"slowlog_total_time": "slowlog",
+	"httplog_p99":        "httplog",
+}
+
+type (
+	// TrendPoint is the value of a metric in a group
+	TrendPoint struct {
+		GroupID   string    `json:"group_id"`
+		Timestamp time.Time `json:"timestamp"`
+		Value     float64   `json:"value"`
+	}
+
+	// Trend is a time series of a metric across groups
+	Trend struct {
+		Metric string        `json:"metric"`
+		Points []*TrendPoint `json:"points"`
+	}
+)
+
+// HandleTrend serves the time series of the metric given by the "metric" query parameter.
+// Httplogs with another field separator or labels are read with delimiter and labels like the analysis.
+func (cl *Collector) HandleTrend(c echo.Context) error {
+	metric := c.QueryParam("metric")
+	if _, ok := trendMetrics[metric]; !ok {
+		metrics := make([]string, 0, len(trendMetrics))
+		for m := range trendMetrics {
+			metrics = append(metrics, m)
+		}
+		sort.Strings(metrics)
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("metric must be one of: %s", strings.Join(metrics, ", ")))
+	}
+
+	format, err := httplogFormatParam(c)
+	if err != nil {
+		return err
+	}
+
+	trend, err := cl.computeTrend(metric, format)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to compute trend: %v", err))
+	}
+	return c.JSON(http.StatusOK, trend)
+}
+
+// computeTrend computes the metric from the latest entry of the relevant type in each group.
+// For pprof_total, only CPU profiles are considered, so the latest CPU profile of the group is used.
+// Groups without such an entry are skipped.
+func (cl *Collector) computeTrend(metric string, format httplog.Format) (*Trend, error) {
+	typ := trendMetrics[metric]
+
+	snapshots, err := collect.LoadSnapshots(cl.store, typ)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := map[string][]*collect.Snapshot{}
+	for _, snapshot := range snapshots {
+		if snapshot.SnapshotTarget == nil || snapshot.GroupId == "" {
+			continue
+		}
+		candidates[snapshot.GroupId] = append(candidates[snapshot.GroupId], snapshot)
+	}
+
+	groupIDs := make([]string, 0, len(candidates))
+	for groupID, group := range candidates {
+		groupIDs = append(groupIDs, groupID)
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].Datetime.After(group[j].Datetime)
+		})
+	}
+
+	latest := make([]*collect.Snapshot, len(groupIDs))
+	values := make([]float64, len(groupIDs))
+	errs := make([]error, len(groupIDs))
+	forEachConcurrently(len(groupIDs), cl.analysisWorkers, func(i int) {
+		// Entries the metric doesn't apply to (e.g. heap profiles) are passed over for older ones
+		for _, snapshot := range candidates[groupIDs[i]] {
+			latest[i] = snapshot
+			values[i], errs[i] = trendValue(metric, format, snapshot)
+			if !errors.Is(errs[i], errNotCPUProfile) {
+				return
+			}
+		}
+	})
+
+	trend := &Trend{Metric: metric, Points: []*TrendPoint{}}
+	for i, groupID := range groupIDs {
+		snapshot, value := latest[i], values[i]
+		if errors.Is(errs[i], errNotCPUProfile) {
+			continue
+		}
+		if err := errs[i]; err != nil {
+			log.Printf("[!] failed to compute %s of %s: %v", metric, snapshot.ID, err)
+			continue
+		}
+
+		timestamp, err := time.ParseInLocation(IDLayout, groupID, time.Local)
+		if err != nil {
+			timestamp = snapshot.Datetime
+		}
+
+		trend.Points = append(trend.Points, &TrendPoint{
+			GroupID:   groupID,
+			Timestamp: timestamp,
+			Value:     value,
+		})
+	}
+
+	sort.Slice(trend.Points, func(i, j int) bool {
+		return trend.Points[i].Timestamp.Before(trend.Points[j].Timestamp)
+	})
+	return trend, nil
+}
+
+// trendValue computes the metric of a snapshot, reading httplogs in the format
+func trendValue(metric string, format httplog.Format, snapshot *collect.Snapshot) (float64, error) {
+	content, err := readSnapshotBody(snapshot)
+	if err != nil {
+		return 0, err
+	}
+
+	switch metric {
+	case "pprof_total":
+		total, _, err := pprofCPUTotal(snapshot, content)
+		return float64(total), err
+	case "slowlog_total_time":
+		return slowlogTotalTime(content)
+	case "httplog_p99":
+		return httplog.Percentile(content, format, 99)
+	default:
+		return 0, fmt.Errorf("unknown metric: %s", metric)
+	}
+}
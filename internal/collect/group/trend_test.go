@@ -0,0 +1,62 @@
+package group
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/labstack/echo/v4"
+)
+
+func TestTrend(t *testing.T) {
+	cl, store := newTestCollector(t)
+
+	addTestSnapshot(t, store, "pprof", "g1-pprof.pb.gz", "2025-04-01_12-00-00", "app", testProfile(t, 3000))
+	addTestSnapshot(t, store, "pprof", "g2-pprof.pb.gz", "2025-04-01_12-10-00", "app", testProfile(t, 2000))
+	addTestSnapshot(t, store, "pprof", "g3-pprof.pb.gz", "2025-04-01_12-20-00", "app", testProfile(t, 1000))
+	addTestSnapshot(t, store, "slowlog", "g3-slowlog.log", "2025-04-01_12-20-00", "db", testSlowlog("1.000000"))
+	// A heap profile newer than the CPU one doesn't put bytes into the series
+	addTestSnapshot(t, store, "pprof", "g2-heap-pprof.pb.gz", "2025-04-01_12-10-00", "app", testHeapProfile(t, 1<<30))
+	// A group with only a heap profile has no point
+	addTestSnapshot(t, store, "pprof", "g4-heap-pprof.pb.gz", "2025-04-01_12-30-00", "app", testHeapProfile(t, 1<<30))
+
+	e := echo.New()
+	e.GET("/api/trend", cl.HandleTrend)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/trend?metric=pprof_total", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+	}
+
+	trend := &Trend{}
+	if err := json.Unmarshal(rec.Body.Bytes(), trend); err != nil {
+		t.Fatalf("Failed to decode trend: %v", err)
+	}
+
+	expected := []struct {
+		groupID string
+		value   float64
+	}{
+		{"2025-04-01_12-00-00", 3000},
+		{"2025-04-01_12-10-00", 2000},
+		{"2025-04-01_12-20-00", 1000},
+	}
+	if len(trend.Points) != len(expected) {
+		t.Fatalf("Point count is different from expected. Expected: %d, Actual: %d", len(expected), len(trend.Points))
+	}
+	for i, point := range trend.Points {
+		if point.GroupID != expected[i].groupID || point.Value != expected[i].value {
+			t.Errorf("Point %d is different from expected. Expected: %s=%f, Actual: %s=%f", i, expected[i].groupID, expected[i].value, point.GroupID, point.Value)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/trend?metric=unknown", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Unknown metric should be rejected, but got status %d", rec.Code)
+	}
+}
@@ -0,0 +1,94 @@
+package group
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/labstack/echo/v4"
+)
+
+// WarmResult is the outcome of warming the analysis cache of a group
+type WarmResult struct {
+	GroupID string            `json:"group_id"`
+	Warmed  []string          `json:"warmed"`
+	Failed  map[string]string `json:"failed"` // Error by entry ID
+	// Skipped are the entries whose results are not cached (e.g. pprof),
+	// and those left unprocessed because a collection started while warming
+	Skipped []string `json:"skipped"`
+}
+
+// errCollecting is returned for the entries skipped because a collection is in progress
+var errCollecting = errors.New("a collection is in progress")
+
+// Only one group is warmed at once, in addition to the limit of analysis workers
+var warming sync.Mutex
+
+// warmGroup processes every entry of the group with the collector of its type, so that the first request of the UI
+// or the MCP tools is served from the cache. Entries of disabled types are left out,
+// and those of types whose results are not cached (e.g. pprof) are skipped.
+// Collected entries are processed right away, so this mainly helps imported entries and results whose cache was lost.
+// Warming is refused while a collection is in progress so that it doesn't compete with the benchmark.
+func (cl *Collector) warmGroup(c echo.Context) error {
+	groupID := c.Param("id")
+
+	var snapshots []*collect.Snapshot
+	for _, typ := range collect.Types() {
+		all, err := collect.LoadSnapshots(cl.store, typ)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to load entries: %v", err))
+		}
+		for _, snapshot := range all {
+			if snapshot.SnapshotTarget != nil && snapshot.GroupId == groupID {
+				snapshots = append(snapshots, snapshot)
+			}
+		}
+	}
+	if len(snapshots) == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such group: %s", groupID))
+	}
+
+	if cl.collecting.Load() > 0 {
+		return echo.NewHTTPError(http.StatusConflict, errCollecting.Error())
+	}
+	if !warming.TryLock() {
+		return echo.NewHTTPError(http.StatusConflict, "another group is being warmed")
+	}
+	defer warming.Unlock()
+
+	return c.JSON(http.StatusOK, cl.warm(groupID, snapshots))
+}
+
+// warm processes the snapshots with at most analysisWorkers at once.
+// Snapshots not started yet are skipped once a collection begins.
+func (cl *Collector) warm(groupID string, snapshots []*collect.Snapshot) *WarmResult {
+	errs := make([]error, len(snapshots))
+	forEachConcurrently(len(snapshots), cl.analysisWorkers, func(i int) {
+		if cl.collecting.Load() > 0 {
+			errs[i] = errCollecting
+			return
+		}
+		errs[i] = collect.Warm(snapshots[i])
+	})
+
+	result := &WarmResult{GroupID: groupID, Warmed: []string{}, Failed: map[string]string{}, Skipped: []string{}}
+	for i, snapshot := range snapshots {
+		if errors.Is(errs[i], errCollecting) || errors.Is(errs[i], collect.ErrNotCacheable) {
+			result.Skipped = append(result.Skipped, snapshot.ID)
+			continue
+		}
+		if errs[i] != nil {
+			log.Printf("[!] failed to warm %s: %v", snapshot.ID, errs[i])
+			result.Failed[snapshot.ID] = errs[i].Error()
+			continue
+		}
+		result.Warmed = append(result.Warmed, snapshot.ID)
+	}
+	sort.Strings(result.Warmed)
+	sort.Strings(result.Skipped)
+	return result
+}
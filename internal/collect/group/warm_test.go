@@ -0,0 +1,142 @@
+package group
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/kaz/pprotein/internal/event"
+	"github.com/labstack/echo/v4"
+)
+
+// countingProcessor returns a fixed result, counting how many times it processed
+type countingProcessor struct {
+	count atomic.Int32
+}
+
+func (p *countingProcessor) Process(snapshot *collect.Snapshot) (io.ReadCloser, error) {
+	p.count.Add(1)
+	return io.NopCloser(bytes.NewBufferString("processed " + snapshot.ID)), nil
+}
+func (p *countingProcessor) Cacheable() bool {
+	return true
+}
+
+func TestWarmGroup(t *testing.T) {
+	cl, store := newTestCollector(t)
+
+	processor := &countingProcessor{}
+	if _, err := collect.New(processor, &collect.Options{Type: "memo", Ext: "-memo.txt", Store: store, EventHub: event.NewHub()}); err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+	addTestSnapshot(t, store, "memo", "g1-memo-a.txt", "2025-04-01_12-00-00", "a", []byte("a"))
+	addTestSnapshot(t, store, "memo", "g1-memo-b.txt", "2025-04-01_12-00-00", "b", []byte("b"))
+	addTestSnapshot(t, store, "memo", "g2-memo.txt", "2025-04-01_12-10-00", "a", []byte("c"))
+
+	e := echo.New()
+	cl.RegisterHandlers(e.Group("/api/group"))
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/group/2025-04-01_12-00-00/warm", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+		}
+
+		result := &WarmResult{}
+		if err := json.Unmarshal(rec.Body.Bytes(), result); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(result.Warmed) != 2 || len(result.Failed) != 0 {
+			t.Errorf("Warm result is different from expected: %+v", result)
+		}
+	}
+
+	for _, id := range []string{"g1-memo-a.txt", "g1-memo-b.txt"} {
+		cached, err := collect.CachedResult(store, id)
+		if err != nil {
+			t.Fatalf("Failed to get cache: %v", err)
+		}
+		if string(cached) != "processed "+id {
+			t.Errorf("Cache of %s is different from expected. Actual: %q", id, cached)
+		}
+	}
+	if cached, err := collect.CachedResult(store, "g2-memo.txt"); err != nil || cached != nil {
+		t.Errorf("Entry of another group was warmed: %q, %v", cached, err)
+	}
+	if count := processor.count.Load(); count != 2 {
+		t.Errorf("Cached entries were processed again. Expected: 2, Actual: %d", count)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/group/2025-04-01_12-20-00/warm", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Unexpected status for a missing group: %d", rec.Code)
+	}
+
+	// Warming is refused while a collection is in progress
+	cl.collecting.Add(1)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/group/2025-04-01_12-10-00/warm", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Unexpected status while collecting: %d", rec.Code)
+	}
+
+	// Entries not started yet are skipped once a collection begins
+	snapshots, err := collect.LoadSnapshots(store, "memo")
+	if err != nil {
+		t.Fatalf("Failed to load snapshots: %v", err)
+	}
+	result := cl.warm("2025-04-01_12-10-00", snapshots)
+	if len(result.Warmed) != 0 || len(result.Skipped) != len(snapshots) {
+		t.Errorf("Warm result is different from expected: %+v", result)
+	}
+	if count := processor.count.Load(); count != 2 {
+		t.Errorf("Entries were processed while collecting. Expected: 2, Actual: %d", count)
+	}
+	cl.collecting.Add(-1)
+}
+
+// uncacheableProcessor is a countingProcessor whose results are not cached, like the pprof one
+type uncacheableProcessor struct {
+	countingProcessor
+}
+
+func (p *uncacheableProcessor) Cacheable() bool {
+	return false
+}
+
+func TestWarmGroupSkipsUncacheable(t *testing.T) {
+	cl, store := newTestCollector(t)
+
+	processor := &uncacheableProcessor{}
+	if _, err := collect.New(processor, &collect.Options{Type: "pprof", Ext: "-pprof.pb.gz", Store: store, EventHub: event.NewHub()}); err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+	addTestSnapshot(t, store, "pprof", "g1-pprof.pb.gz", "2025-04-01_12-00-00", "app", []byte("p"))
+
+	e := echo.New()
+	cl.RegisterHandlers(e.Group("/api/group"))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/group/2025-04-01_12-00-00/warm", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+	}
+
+	result := &WarmResult{}
+	if err := json.Unmarshal(rec.Body.Bytes(), result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(result.Warmed) != 0 || len(result.Failed) != 0 || len(result.Skipped) != 1 || result.Skipped[0] != "g1-pprof.pb.gz" {
+		t.Errorf("Warm result is different from expected: %+v", result)
+	}
+	if count := processor.count.Load(); count != 0 {
+		t.Errorf("Uncacheable entry was processed. Expected: 0, Actual: %d", count)
+	}
+}
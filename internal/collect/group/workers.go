@@ -0,0 +1,44 @@
+package group
+
+import (
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Environment variable specifying how many snapshots are analyzed at once
+const AnalysisWorkersEnv = "PPROTEIN_ANALYSIS_WORKERS"
+
+// analysisWorkersFromEnv returns the number of analysis workers.
+// It defaults to half of the CPUs so that benchmarks running alongside keep the rest.
+func analysisWorkersFromEnv() int {
+	defaultWorkers := max(1, runtime.NumCPU()/2)
+
+	v := os.Getenv(AnalysisWorkersEnv)
+	if v == "" {
+		return defaultWorkers
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		log.Printf("[!] invalid %s %q, using %d workers", AnalysisWorkersEnv, v, defaultWorkers)
+		return defaultWorkers
+	}
+	return n
+}
+
+// forEachConcurrently calls fn with each index below n, running at most workers calls at once
+func forEachConcurrently(n, workers int, fn func(i int)) {
+	eg := &errgroup.Group{}
+	eg.SetLimit(max(1, workers))
+	for i := 0; i < n; i++ {
+		eg.Go(func() error {
+			fn(i)
+			return nil
+		})
+	}
+	eg.Wait()
+}
@@ -0,0 +1,79 @@
+package group
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kaz/pprotein/internal/collect"
+)
+
+func TestForEachConcurrentlyBoundsWorkers(t *testing.T) {
+	const n, workers = 20, 3
+
+	var running, peak atomic.Int32
+	called := make([]atomic.Bool, n)
+	forEachConcurrently(n, workers, func(i int) {
+		cur := running.Add(1)
+		for {
+			prev := peak.Load()
+			if cur <= prev || peak.CompareAndSwap(prev, cur) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		called[i].Store(true)
+	})
+
+	if p := peak.Load(); p > workers {
+		t.Errorf("Concurrency exceeded the limit. Limit: %d, Actual: %d", workers, p)
+	}
+	for i := range called {
+		if !called[i].Load() {
+			t.Errorf("Index %d is not processed", i)
+		}
+	}
+}
+
+func TestSummarizeGroupConcurrently(t *testing.T) {
+	cl, store := newTestCollector(t)
+
+	const groupID = "2025-04-01_12-00-00"
+	expectedPprofTotal := int64(0)
+	for i := 1; i <= 10; i++ {
+		expectedPprofTotal += int64(i) * 1000000
+		addTestSnapshot(t, store, "pprof", fmt.Sprintf("%d-pprof.pb.gz", i), groupID, fmt.Sprintf("app%d", i), testProfile(t, int64(i)*1000000))
+		addTestSnapshot(t, store, "slowlog", fmt.Sprintf("%d-slowlog.log", i), groupID, fmt.Sprintf("mysql%d", i), testSlowlog("0.500000"))
+		addTestSnapshot(t, store, "httplog", fmt.Sprintf("%d-httplog.log", i), groupID, fmt.Sprintf("nginx%d", i), testHttplog("0.200"))
+	}
+
+	snapshots := []*collect.Snapshot{}
+	for _, typ := range summaryTypes {
+		loaded, err := collect.LoadSnapshots(store, typ)
+		if err != nil {
+			t.Fatalf("Failed to load snapshots: %v", err)
+		}
+		snapshots = append(snapshots, loaded...)
+	}
+
+	cl.analysisWorkers = 1
+	sequential := cl.summarizeGroup(groupID, snapshots)
+
+	cl.analysisWorkers = 4
+	concurrent := cl.summarizeGroup(groupID, snapshots)
+
+	if concurrent.PprofTotal != expectedPprofTotal {
+		t.Errorf("pprof total is different from expected. Expected: %d, Actual: %d", expectedPprofTotal, concurrent.PprofTotal)
+	}
+	if d := concurrent.SlowlogTotalTime; d < 4.999 || d > 5.001 {
+		t.Errorf("Slowlog total time is different from expected. Expected: 5, Actual: %f", d)
+	}
+	if concurrent.TopEndpoint != "/api/users/:id" {
+		t.Errorf("Top endpoint is different from expected. Expected: /api/users/:id, Actual: %s", concurrent.TopEndpoint)
+	}
+	if fmt.Sprintf("%+v", *concurrent) != fmt.Sprintf("%+v", *sequential) {
+		t.Errorf("Concurrent summary is different from the sequential one.\nSequential: %+v\nConcurrent: %+v", *sequential, *concurrent)
+	}
+}
@@ -0,0 +1,90 @@
+package collect
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Keys the entries can be sorted by
+const (
+	SortByDatetime = "datetime"
+	SortByLabel    = "label"
+)
+
+// ListOptions sorts and filters the entries of a list
+type ListOptions struct {
+	Sort       string // SortByDatetime, SortByLabel or empty to keep the order
+	Descending bool
+	GroupID    string // Only the entries of the group if not empty
+	Label      string // Only the entries whose label contains it if not empty
+}
+
+// ParseListOptions reads ListOptions from the query params sort, order (asc or desc), group and label
+func ParseListOptions(query url.Values) (ListOptions, error) {
+	opts := ListOptions{
+		Sort:    query.Get("sort"),
+		GroupID: query.Get("group"),
+		Label:   query.Get("label"),
+	}
+	switch opts.Sort {
+	case "", SortByDatetime, SortByLabel:
+	default:
+		return opts, fmt.Errorf("unknown sort key: %s, must be %s or %s", opts.Sort, SortByDatetime, SortByLabel)
+	}
+	switch order := query.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		return opts, fmt.Errorf("unknown order: %s, must be asc or desc", order)
+	}
+	return opts, nil
+}
+
+// FilterEntries returns the entries matching opts in the order of opts.
+// Ties are broken by ID so that the order is stable across requests.
+func FilterEntries(entries []*Entry, opts ListOptions) []*Entry {
+	result := make([]*Entry, 0, len(entries))
+	for _, ent := range entries {
+		target := entryTarget(ent)
+		if opts.GroupID != "" && target.GroupId != opts.GroupID {
+			continue
+		}
+		if opts.Label != "" && !strings.Contains(target.Label, opts.Label) {
+			continue
+		}
+		result = append(result, ent)
+	}
+	if opts.Sort == "" {
+		return result
+	}
+
+	slices.SortFunc(result, func(a, b *Entry) int {
+		var c int
+		switch opts.Sort {
+		case SortByDatetime:
+			c = a.Snapshot.Datetime.Compare(b.Snapshot.Datetime)
+		case SortByLabel:
+			c = cmp.Compare(entryTarget(a).Label, entryTarget(b).Label)
+		}
+		if c == 0 {
+			c = cmp.Compare(a.Snapshot.ID, b.Snapshot.ID)
+		}
+		if opts.Descending {
+			return -c
+		}
+		return c
+	})
+	return result
+}
+
+// entryTarget returns the target of the entry, which is empty for snapshots stored without one
+func entryTarget(ent *Entry) *SnapshotTarget {
+	if ent.Snapshot.SnapshotTarget == nil {
+		return &SnapshotTarget{}
+	}
+	return ent.Snapshot.SnapshotTarget
+}
@@ -0,0 +1,66 @@
+package collect
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFilterEntries(t *testing.T) {
+	base := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+	entry := func(id, groupID, label string, minutes int) *Entry {
+		return &Entry{Snapshot: &Snapshot{
+			SnapshotMeta:   &SnapshotMeta{Type: "slowlog", ID: id, Datetime: base.Add(time.Duration(minutes) * time.Minute)},
+			SnapshotTarget: &SnapshotTarget{GroupId: groupID, Label: label},
+		}}
+	}
+	entries := []*Entry{
+		entry("b", "g1", "db1", 10),
+		entry("a", "g1", "web1", 0),
+		entry("d", "g2", "db2", 30),
+		entry("c", "g2", "web2", 20),
+		{Snapshot: &Snapshot{SnapshotMeta: &SnapshotMeta{Type: "slowlog", ID: "e", Datetime: base.Add(-time.Minute)}}},
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{name: "No options", query: "", expected: []string{"b", "a", "d", "c", "e"}},
+		{name: "Datetime descending", query: "sort=datetime&order=desc", expected: []string{"d", "c", "b", "a", "e"}},
+		{name: "Label ascending", query: "sort=label", expected: []string{"e", "b", "d", "a", "c"}},
+		{name: "Label filter", query: "label=db&sort=datetime&order=desc", expected: []string{"d", "b"}},
+		{name: "Group filter", query: "group=g1&sort=datetime", expected: []string{"a", "b"}},
+		{name: "No match", query: "group=g1&label=web2", expected: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("Failed to parse query: %v", err)
+			}
+			opts, err := ParseListOptions(query)
+			if err != nil {
+				t.Fatalf("Failed to parse options: %v", err)
+			}
+
+			ids := []string{}
+			for _, ent := range FilterEntries(entries, opts) {
+				ids = append(ids, ent.Snapshot.ID)
+			}
+			if !slices.Equal(ids, tt.expected) {
+				t.Errorf("Entries are different from expected. Expected: %v, Actual: %v", tt.expected, ids)
+			}
+		})
+	}
+
+	for _, query := range []string{"sort=size", "sort=datetime&order=random"} {
+		values, _ := url.ParseQuery(query)
+		if _, err := ParseListOptions(values); err == nil {
+			t.Errorf("Invalid options are accepted: %s", query)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package collect
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandlePatch returns the handler correcting the label or the comment of an entry of the collector
+func HandlePatch(collector *Collector) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		update := &EntryUpdate{}
+		if err := c.Bind(update); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to parse request body: %v", err))
+		}
+		if update.Label != nil && *update.Label == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "label must not be empty")
+		}
+
+		entry, err := collector.Update(c.Param("id"), update)
+		switch {
+		case errors.Is(err, ErrNoSuchEntry):
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		case errors.Is(err, ErrEntryPending):
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		case err != nil:
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to update entry: %v", err))
+		}
+		return c.JSON(http.StatusOK, entry)
+	}
+}
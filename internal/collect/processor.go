@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"log"
+	"time"
 
 	"github.com/kaz/pprotein/internal/storage"
 )
@@ -22,24 +24,25 @@ type (
 	}
 )
 
-func newCachedProcessor(internal Processor, store storage.Storage) Processor {
+func newCachedProcessor(internal Processor, store storage.Storage) *cachedProcessor {
 	return &cachedProcessor{internal, store}
 }
 
+// Process serves the cached result of the snapshot, processing it if it isn't cached or has been evicted
 func (p *cachedProcessor) Process(snapshot *Snapshot) (io.ReadCloser, error) {
-	if ok, err := p.store.Exists(cacheTypeKey, snapshot.ID); err != nil {
-		return nil, fmt.Errorf("failed to check cache status: %w", err)
-	} else if ok {
-		return p.serveCached(snapshot)
-	}
-	return p.serveGenerated(snapshot)
-}
-func (p *cachedProcessor) serveCached(snapshot *Snapshot) (io.ReadCloser, error) {
 	cache, err := p.store.Get(cacheTypeKey, snapshot.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read cache: %w", err)
 	}
-	return io.NopCloser(bytes.NewBuffer(cache)), nil
+	if cache != nil {
+		return io.NopCloser(bytes.NewBuffer(cache)), nil
+	}
+	return p.serveGenerated(snapshot)
+}
+
+// Refresh processes the snapshot again even if it is cached, replacing the cache
+func (p *cachedProcessor) Refresh(snapshot *Snapshot) (io.ReadCloser, error) {
+	return p.serveGenerated(snapshot)
 }
 func (p *cachedProcessor) serveGenerated(snapshot *Snapshot) (io.ReadCloser, error) {
 	r, err := p.internal.Process(snapshot)
@@ -59,9 +62,26 @@ func (p *cachedProcessor) serveGenerated(snapshot *Snapshot) (io.ReadCloser, err
 	if err := p.store.Put(cacheTypeKey, snapshot.ID, cacheContent); err != nil {
 		return nil, fmt.Errorf("failed to create cache: %w", err)
 	}
-	return p.serveCached(snapshot)
+	// The index is only for the eviction, so the result is served even if it isn't indexed
+	if err := indexCache(p.store, snapshot.ID, int64(len(cacheContent)), time.Now()); err != nil {
+		log.Printf("[!] failed to index cache of %s: %v", snapshot.ID, err)
+	}
+	// Served from memory, as the cache may be evicted at any time
+	return io.NopCloser(bytes.NewReader(cacheContent)), nil
 }
 
 func (p *cachedProcessor) Cacheable() bool {
 	return false
 }
+
+// CachedResult returns the processed result of a snapshot cached in the store, or nil if there is none
+func CachedResult(store storage.Storage, id string) ([]byte, error) {
+	ok, err := store.Exists(cacheTypeKey, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check cache status: %w", err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return store.Get(cacheTypeKey, id)
+}
@@ -6,11 +6,13 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/goccy/go-json"
+	"github.com/kaz/pprotein/internal/analyze/meta"
 	"github.com/kaz/pprotein/internal/git"
 	"github.com/kaz/pprotein/internal/storage"
 )
@@ -18,6 +20,8 @@ import (
 type (
 	Snapshot struct {
 		store storage.Storage
+		// Basic auth credentials of the collection request, kept out of the stored and listed target
+		username, password string
 
 		*SnapshotMeta
 		*SnapshotTarget
@@ -27,12 +31,25 @@ type (
 		ID         string
 		Datetime   time.Time
 		Repository *git.RepositoryInfo
+		// Comment is a free note added after the collection
+		Comment string `json:",omitempty"`
 	}
 	SnapshotTarget struct {
 		GroupId  string
 		Label    string
 		URL      string
 		Duration int
+
+		// ProfileType tells the analyzers what kind of profile is collected (e.g. "cpu", "heap", "mutex")
+		ProfileType string `json:",omitempty"`
+
+		// Method of the collection request (GET if empty)
+		Method string `json:",omitempty"`
+		// Query parameters added to the collection request, which override seconds derived from Duration
+		Query map[string]string `json:",omitempty"`
+		// Basic auth credentials of the collection request, for targets behind an authenticating proxy
+		Username string `json:",omitempty"`
+		Password string `json:",omitempty"`
 	}
 )
 
@@ -40,8 +57,18 @@ func newSnapshot(store storage.Storage, typ string, ext string, target *Snapshot
 	ts := time.Now()
 	id := strconv.FormatInt(ts.UnixNano(), 36) + ext
 
+	var username, password string
+	if target != nil && (target.Username != "" || target.Password != "") {
+		username, password = target.Username, target.Password
+		stripped := *target
+		stripped.Username, stripped.Password = "", ""
+		target = &stripped
+	}
+
 	return &Snapshot{
-		store: store,
+		store:    store,
+		username: username,
+		password: password,
 
 		SnapshotMeta: &SnapshotMeta{
 			Type:       typ,
@@ -60,14 +87,45 @@ func (s *Snapshot) marshal() ([]byte, error) {
 	return json.Marshal(s)
 }
 
+// Collect requests the target and stores the response as the snapshot body.
+// Duration is sent as the seconds parameter, which sets the length of CPU profiles and traces and of log tails,
+// replacing any seconds in the URL. Only an explicit seconds in Query takes precedence.
+// Targets with a unix:// URL are requested over the Unix domain socket.
 func (s *Snapshot) Collect() error {
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s?seconds=%d", s.URL, s.Duration), nil)
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return fmt.Errorf("failed to parse URL: %w", err)
+	}
+	client := http.DefaultClient
+	if u.Scheme == UnixScheme {
+		var socket string
+		if socket, u, err = SplitUnixURL(u); err != nil {
+			return fmt.Errorf("failed to parse URL: %w", err)
+		}
+		client = unixClient(socket)
+	}
+	query := u.Query()
+	query.Set("seconds", strconv.Itoa(s.Duration))
+	for k, v := range s.Query {
+		query.Set(k, v)
+	}
+	u.RawQuery = query.Encode()
+
+	method := s.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequest(method, u.String(), nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Accept-Encoding", "gzip")
+	if s.username != "" || s.password != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("http error: %w", err)
 	}
@@ -84,10 +142,19 @@ func (s *Snapshot) Collect() error {
 		r = cr
 	}
 
+	// Stop reading as soon as the body turns out to be too large to store
+	maxSize := s.store.Limits().MaxFileSize
+	if maxSize > 0 {
+		r = io.LimitReader(r, maxSize+1)
+	}
+
 	bodyContent, err := io.ReadAll(r)
 	if err != nil {
 		return fmt.Errorf("failed to read body: %w", err)
 	}
+	if maxSize > 0 && int64(len(bodyContent)) > maxSize {
+		return fmt.Errorf("%w: response body exceeds the limit of %d bytes", storage.ErrSizeLimitExceeded, maxSize)
+	}
 
 	s.Repository = &git.RepositoryInfo{}
 	if err := json.Unmarshal([]byte(resp.Header.Get("X-Git-Repository")), s.Repository); err != nil {
@@ -108,7 +175,7 @@ func (s *Snapshot) Collect() error {
 	if err := s.store.Put(s.Type, s.ID, serialized); err != nil {
 		return fmt.Errorf("failed to write meta: %w", err)
 	}
-	if err := s.store.PutFile(s.ID, bodyContent); err != nil {
+	if err := s.store.PutGroupFile(s.GroupId, s.ID, bodyContent); err != nil {
 		return fmt.Errorf("failed to write body: %w", err)
 	}
 	return nil
@@ -119,10 +186,10 @@ func (s *Snapshot) Add(content []byte) error {
 	if err != nil {
 		return fmt.Errorf("failed to serialize: %w", err)
 	}
-	if err := s.store.Put(s.ID, s.Type, serialized); err != nil {
+	if err := s.store.Put(s.Type, s.ID, serialized); err != nil {
 		return fmt.Errorf("failed to write meta: %w", err)
 	}
-	if err := s.store.PutFile(s.ID, content); err != nil {
+	if err := s.store.PutGroupFile(s.GroupId, s.ID, content); err != nil {
 		return fmt.Errorf("failed to write body: %w", err)
 	}
 	return nil
@@ -132,6 +199,20 @@ func (s *Snapshot) BodyPath() (string, error) {
 	return s.store.GetFilePath(s.ID)
 }
 
+// Source returns where the snapshot was collected from, to be echoed back in analysis results
+func (s *Snapshot) Source() *meta.Source {
+	source := &meta.Source{}
+	if s.SnapshotMeta != nil {
+		source.Datetime = s.Datetime
+	}
+	if s.SnapshotTarget != nil {
+		source.Label = s.Label
+		source.GroupID = s.GroupId
+		source.Duration = s.Duration
+	}
+	return source
+}
+
 func (s *Snapshot) Prune() error {
 	return s.store.Delete(s.Type, s.ID)
 }
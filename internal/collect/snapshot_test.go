@@ -0,0 +1,176 @@
+package collect
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/kaz/pprotein/internal/storage"
+)
+
+func TestCollectForwardsMethodAndQuery(t *testing.T) {
+	var method string
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, query = r.Method, r.URL.Query()
+		w.Write([]byte("profile"))
+	}))
+	defer server.Close()
+
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		target   *SnapshotTarget
+		method   string
+		expected map[string]string
+	}{
+		{
+			name:     "Defaults",
+			target:   &SnapshotTarget{URL: server.URL + "/debug/pprof/profile", Duration: 30},
+			method:   http.MethodGet,
+			expected: map[string]string{"seconds": "30"},
+		},
+		{
+			name:     "Seconds in URL",
+			target:   &SnapshotTarget{URL: server.URL + "/debug/pprof/profile?seconds=5", Duration: 15},
+			method:   http.MethodGet,
+			expected: map[string]string{"seconds": "15"},
+		},
+		{
+			name: "Method and extra query",
+			target: &SnapshotTarget{
+				URL:      server.URL + "/debug/pprof/profile?debug=0",
+				Duration: 30,
+				Method:   http.MethodPost,
+				Query:    map[string]string{"gc": "1", "seconds": "10"},
+			},
+			method:   http.MethodPost,
+			expected: map[string]string{"debug": "0", "gc": "1", "seconds": "10"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot := newSnapshot(store, "pprof", "-pprof.pb.gz", tt.target)
+			if err := snapshot.Collect(); err != nil {
+				t.Fatalf("Failed to collect: %v", err)
+			}
+
+			if method != tt.method {
+				t.Errorf("Method is different from expected. Expected: %s, Actual: %s", tt.method, method)
+			}
+			if len(query) != len(tt.expected) {
+				t.Errorf("Query is different from expected. Expected: %v, Actual: %v", tt.expected, query)
+			}
+			for k, v := range tt.expected {
+				if query.Get(k) != v {
+					t.Errorf("Query parameter %s is different from expected. Expected: %s, Actual: %s", k, v, query.Get(k))
+				}
+			}
+		})
+	}
+}
+
+func TestCollectWithBasicAuth(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Write([]byte("profile"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		expected string
+	}{
+		{name: "Without credentials", expected: ""},
+		{name: "With credentials", username: "isucon", password: "secret", expected: "Basic aXN1Y29uOnNlY3JldA=="},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := storage.New(t.TempDir(), storage.Limits{})
+			if err != nil {
+				t.Fatalf("Failed to create storage: %v", err)
+			}
+
+			target := &SnapshotTarget{URL: server.URL, Duration: 1, Username: tt.username, Password: tt.password}
+			if err := newSnapshot(store, "pprof", "-pprof.pb.gz", target).Collect(); err != nil {
+				t.Fatalf("Failed to collect: %v", err)
+			}
+			if authorization != tt.expected {
+				t.Errorf("Authorization is different from expected. Expected: %q, Actual: %q", tt.expected, authorization)
+			}
+
+			// The credentials must not be stored with the snapshot
+			snapshots, err := LoadSnapshots(store, "pprof")
+			if err != nil || len(snapshots) != 1 {
+				t.Fatalf("Failed to load snapshots: %v", err)
+			}
+			if snapshots[0].Username != "" || snapshots[0].Password != "" {
+				t.Errorf("Credentials are stored: %+v", snapshots[0].SnapshotTarget)
+			}
+		})
+	}
+}
+
+func TestCollectFromUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "app.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("Unix domain sockets are not available: %v", err)
+	}
+	var path string
+	var query url.Values
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, query = r.URL.Path, r.URL.Query()
+		w.Write([]byte("profile"))
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{name: "Socket and path", url: "unix://" + socket + ":/debug/pprof/profile?debug=0"},
+		{name: "Without path", url: "unix://" + socket, wantErr: true},
+		{name: "Missing socket", url: "unix://" + socket + ".missing:/debug/pprof/profile", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := storage.New(t.TempDir(), storage.Limits{})
+			if err != nil {
+				t.Fatalf("Failed to create storage: %v", err)
+			}
+
+			snapshot := newSnapshot(store, "pprof", "-pprof.pb.gz", &SnapshotTarget{URL: tt.url, Duration: 5})
+			err = snapshot.Collect()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Collect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if path != "/debug/pprof/profile" || query.Get("seconds") != "5" || query.Get("debug") != "0" {
+				t.Errorf("Request is different from expected. Path: %s, Query: %v", path, query)
+			}
+			if ok, _ := store.ExistsFile(snapshot.ID); !ok {
+				t.Errorf("Body collected from the socket is not stored")
+			}
+		})
+	}
+}
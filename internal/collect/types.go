@@ -0,0 +1,74 @@
+package collect
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TypesEnv is the environment variable listing the enabled types, comma-separated (all types if empty)
+const TypesEnv = "PPROTEIN_TYPES"
+
+// AllTypes are the types pprotein can collect
+var AllTypes = []string{"pprof", "httplog", "slowlog", "memo", "trace"}
+
+var (
+	typesMu      sync.RWMutex
+	enabledTypes = AllTypes
+)
+
+// Types returns the enabled types in the order of AllTypes
+func Types() []string {
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+	return append([]string{}, enabledTypes...)
+}
+
+// TypeEnabled reports whether the type is enabled
+func TypeEnabled(typ string) bool {
+	for _, t := range Types() {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// SetTypes replaces the enabled types. All types are enabled if types is empty.
+func SetTypes(types []string) error {
+	requested := map[string]bool{}
+	for _, typ := range types {
+		requested[typ] = true
+	}
+
+	enabled := []string{}
+	for _, typ := range AllTypes {
+		if len(types) == 0 || requested[typ] {
+			enabled = append(enabled, typ)
+			delete(requested, typ)
+		}
+	}
+	for typ := range requested {
+		return fmt.Errorf("unknown type: %s, must be one of %s", typ, strings.Join(AllTypes, ", "))
+	}
+
+	typesMu.Lock()
+	defer typesMu.Unlock()
+	enabledTypes = enabled
+	return nil
+}
+
+// LoadTypesFromEnv enables the types given in the environment
+func LoadTypesFromEnv() error {
+	var types []string
+	for _, typ := range strings.Split(os.Getenv(TypesEnv), ",") {
+		if typ = strings.TrimSpace(typ); typ != "" {
+			types = append(types, typ)
+		}
+	}
+	if err := SetTypes(types); err != nil {
+		return fmt.Errorf("invalid %s: %w", TypesEnv, err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package collect
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// UnixScheme is the URL scheme of targets served on a Unix domain socket.
+// The socket path and the HTTP path are separated by a colon, e.g. unix:///run/app.sock:/debug/pprof/profile.
+const UnixScheme = "unix"
+
+// SplitUnixURL returns the socket path of a unix:// URL and the URL to request over it
+func SplitUnixURL(u *url.URL) (string, *url.URL, error) {
+	if u.Scheme != UnixScheme {
+		return "", nil, fmt.Errorf("not a %s URL: %s", UnixScheme, u)
+	}
+	if u.Host != "" {
+		return "", nil, fmt.Errorf("socket path must be absolute, like %s:///run/app.sock:/path", UnixScheme)
+	}
+
+	socket, path, ok := strings.Cut(u.Path, ":")
+	if !ok || socket == "" || !strings.HasPrefix(path, "/") {
+		return "", nil, fmt.Errorf("socket path and HTTP path must be separated by a colon, like %s:///run/app.sock:/path", UnixScheme)
+	}
+
+	// The host is only sent in the Host header, as the connections go to the socket
+	target := *u
+	target.Scheme, target.Host, target.Path, target.RawPath = "http", "localhost", path, ""
+	return socket, &target, nil
+}
+
+// unixClient returns a client sending all requests to the socket.
+// Connections aren't kept alive, as the client is made for each collection.
+func unixClient(socket string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+			DisableKeepAlives: true,
+		},
+	}
+}
@@ -0,0 +1,167 @@
+package data
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/kaz/pprotein/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	Handler struct {
+		store storage.Storage
+	}
+
+	deleteTarget struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	}
+	deleteResult struct {
+		Type   string `json:"type"`
+		ID     string `json:"id"`
+		Status string `json:"status"`
+		Error  string `json:"error,omitempty"`
+	}
+)
+
+const (
+	statusDeleted  = "deleted"
+	statusNotFound = "not_found"
+	statusError    = "error"
+)
+
+func NewHandler(store storage.Storage) *Handler {
+	return &Handler{store: store}
+}
+
+func (h *Handler) RegisterHandlers(g *echo.Group) {
+	g.DELETE("/:type/:id", h.deleteOne)
+	g.POST("/delete", h.deleteBatch)
+}
+
+// RegisterRawHandlers registers the endpoint downloading the stored files
+func (h *Handler) RegisterRawHandlers(g *echo.Group) {
+	g.GET("/:type/:id", h.getRaw)
+}
+
+// Content types of the stored files by type. Logs and memos are served as plain text.
+var rawContentTypes = map[string]string{
+	"pprof": "application/gzip",
+}
+
+// getRaw streams the stored file of an entry as an attachment
+func (h *Handler) getRaw(c echo.Context) error {
+	dataType := c.Param("type")
+	id := c.Param("id")
+
+	ok, err := h.store.Exists(dataType, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to check entry: %v", err))
+	}
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such entry: %s/%s", dataType, id))
+	}
+
+	path, err := h.store.GetFilePath(id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to get file path: %v", err))
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no file for entry: %s/%s", dataType, id))
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to open file: %v", err))
+	}
+	defer file.Close()
+
+	contentType, ok := rawContentTypes[dataType]
+	if !ok {
+		contentType = echo.MIMETextPlainCharsetUTF8
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", id))
+	return c.Stream(http.StatusOK, contentType, file)
+}
+
+// Delete removes the metadata, the body file and the cached result of an entry,
+// and drops it from the listed entries of its collector
+func Delete(store storage.Storage, typ, id string) error {
+	if err := store.Delete(typ, id); err != nil {
+		return fmt.Errorf("failed to delete metadata: %w", err)
+	}
+
+	// The file may already be gone, so failing to delete it is not fatal
+	if err := store.DeleteFile(id); err != nil {
+		log.Printf("failed to delete file %s: %v", id, err)
+	}
+	if err := collect.Remove(store, typ, id); err != nil {
+		return fmt.Errorf("failed to remove entry: %w", err)
+	}
+	return nil
+}
+
+func (h *Handler) deleteOne(c echo.Context) error {
+	dataType := c.Param("type")
+	id := c.Param("id")
+
+	if err := Delete(h.store, dataType, id); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"status": statusDeleted,
+		"type":   dataType,
+		"id":     id,
+	})
+}
+
+func (h *Handler) deleteBatch(c echo.Context) error {
+	targets := []*deleteTarget{}
+	if err := c.Bind(&targets); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to parse request body: %v", err))
+	}
+
+	results := make([]*deleteResult, 0, len(targets))
+	for _, target := range targets {
+		results = append(results, h.deleteTarget(target))
+	}
+	return c.JSON(http.StatusOK, results)
+}
+
+// deleteTarget deletes a single entry of a batch, reporting failures in the result instead of aborting the batch
+func (h *Handler) deleteTarget(target *deleteTarget) *deleteResult {
+	result := &deleteResult{Type: target.Type, ID: target.ID}
+
+	if target.Type == "" || target.ID == "" {
+		result.Status = statusError
+		result.Error = "type and id are required"
+		return result
+	}
+
+	ok, err := h.store.Exists(target.Type, target.ID)
+	if err != nil {
+		result.Status = statusError
+		result.Error = fmt.Sprintf("failed to check entry: %v", err)
+		return result
+	}
+	if !ok {
+		result.Status = statusNotFound
+		return result
+	}
+
+	if err := Delete(h.store, target.Type, target.ID); err != nil {
+		result.Status = statusError
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Status = statusDeleted
+	return result
+}
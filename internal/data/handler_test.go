@@ -0,0 +1,178 @@
+package data
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/kaz/pprotein/internal/event"
+	"github.com/kaz/pprotein/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+func TestDeleteBatch(t *testing.T) {
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	entries := []struct {
+		typ string
+		id  string
+	}{
+		{"pprof", "a-pprof.pb.gz"},
+		{"slowlog", "b-slowlog.log"},
+	}
+	for _, entry := range entries {
+		if err := store.Put(entry.typ, entry.id, []byte("{}")); err != nil {
+			t.Fatalf("Failed to put metadata: %v", err)
+		}
+		if err := store.PutFile(entry.id, []byte("body")); err != nil {
+			t.Fatalf("Failed to put file: %v", err)
+		}
+	}
+
+	e := echo.New()
+	NewHandler(store).RegisterHandlers(e.Group("/api/data"))
+
+	body := `[
+		{"type": "pprof", "id": "a-pprof.pb.gz"},
+		{"type": "httplog", "id": "missing-httplog.log"},
+		{"type": "slowlog", "id": "b-slowlog.log"}
+	]`
+	req := httptest.NewRequest(http.MethodPost, "/api/data/delete", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+	}
+
+	var results []*deleteResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	expected := []string{statusDeleted, statusNotFound, statusDeleted}
+	if len(results) != len(expected) {
+		t.Fatalf("Result count is different from expected. Expected: %d, Actual: %d", len(expected), len(results))
+	}
+	for i, result := range results {
+		if result.Status != expected[i] {
+			t.Errorf("Status of %s is different from expected. Expected: %s, Actual: %s", result.ID, expected[i], result.Status)
+		}
+	}
+
+	for _, entry := range entries {
+		if ok, _ := store.Exists(entry.typ, entry.id); ok {
+			t.Errorf("Metadata of %s is not deleted", entry.id)
+		}
+		if ok, _ := store.ExistsFile(entry.id); ok {
+			t.Errorf("File of %s is not deleted", entry.id)
+		}
+	}
+}
+
+// echoProcessor returns the body of the snapshot as the cached result
+type echoProcessor struct{}
+
+func (echoProcessor) Process(snapshot *collect.Snapshot) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(snapshot.ID)), nil
+}
+
+func (echoProcessor) Cacheable() bool {
+	return true
+}
+
+func TestDeleteRemovesListedEntries(t *testing.T) {
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	collector, err := collect.New(echoProcessor{}, &collect.Options{Type: "memo", Ext: "-memo.log", Store: store, EventHub: event.NewHub()})
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		snapshot, err := collector.Add(&collect.SnapshotTarget{Label: "memo"}, []byte("memo"))
+		if err != nil {
+			t.Fatalf("Failed to add entry: %v", err)
+		}
+		ids = append(ids, snapshot.ID)
+	}
+
+	e := echo.New()
+	NewHandler(store).RegisterHandlers(e.Group("/api/data"))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/data/memo/"+ids[0], nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status of delete: %d, body=%s", rec.Code, rec.Body)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/data/delete", strings.NewReader(`[{"type": "memo", "id": "`+ids[1]+`"}]`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status of batch delete: %d, body=%s", rec.Code, rec.Body)
+	}
+
+	entries := collector.List()
+	if len(entries) != 1 || entries[0].Snapshot.ID != ids[2] {
+		t.Errorf("Listed entries are different from expected. Expected: [%s], Actual: %d entries", ids[2], len(entries))
+	}
+	for i, id := range ids {
+		cache, err := collect.CachedResult(store, id)
+		if err != nil {
+			t.Fatalf("Failed to get cache of %s: %v", id, err)
+		}
+		if deleted := i < 2; deleted != (cache == nil) {
+			t.Errorf("Cache of %s is different from expected. Deleted: %v, Cache: %q", id, deleted, cache)
+		}
+	}
+}
+
+func TestGetRaw(t *testing.T) {
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	if err := store.Put("pprof", "a-pprof.pb.gz", []byte("{}")); err != nil {
+		t.Fatalf("Failed to put metadata: %v", err)
+	}
+	if err := store.PutFile("a-pprof.pb.gz", []byte("profile")); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+
+	e := echo.New()
+	NewHandler(store).RegisterRawHandlers(e.Group("/api/raw"))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/raw/pprof/a-pprof.pb.gz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get(echo.HeaderContentType); got != "application/gzip" {
+		t.Errorf("Content-Type is different from expected. Expected: application/gzip, Actual: %s", got)
+	}
+	if got := rec.Header().Get(echo.HeaderContentDisposition); got != `attachment; filename="a-pprof.pb.gz"` {
+		t.Errorf("Content-Disposition is different from expected. Actual: %s", got)
+	}
+	if rec.Body.String() != "profile" {
+		t.Errorf("Body is different from expected. Actual: %s", rec.Body)
+	}
+
+	// The entry must be of the requested type
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/raw/slowlog/a-pprof.pb.gz", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Unexpected status for a mismatched type: %d", rec.Code)
+	}
+}
@@ -1,25 +1,206 @@
 package event
 
 import (
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
 	"github.com/alexandrevicenzi/go-sse"
 	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
 )
 
+// Number of messages buffered per WebSocket client before further messages are dropped
+const subscriberBufferSize = 64
+
+// Environment variable specifying the interval of SSE heartbeats (e.g. "30s", "0" disables them)
+const HeartbeatIntervalEnv = "PPROTEIN_SSE_HEARTBEAT_INTERVAL"
+
+// Default interval of SSE heartbeats, short enough for common proxy idle timeouts
+const defaultHeartbeatInterval = 15 * time.Second
+
 type (
 	Hub struct {
 		server *sse.Server
+
+		// Interval of comment lines sent to keep idle SSE connections open (0 disables them)
+		heartbeatInterval time.Duration
+
+		mu          *sync.RWMutex
+		subscribers map[chan []byte]struct{}
 	}
 )
 
 func NewHub() *Hub {
 	return &Hub{
 		server: sse.NewServer(&sse.Options{}),
+
+		heartbeatInterval: heartbeatIntervalFromEnv(),
+
+		mu:          &sync.RWMutex{},
+		subscribers: map[chan []byte]struct{}{},
 	}
 }
 
 func (h *Hub) RegisterHandlers(g *echo.Group) {
-	g.GET("", echo.WrapHandler(h.server))
+	g.GET("", echo.WrapHandler(http.HandlerFunc(h.serveSSE)))
+	g.GET("/ws", echo.WrapHandler(websocket.Server{Handler: h.serveWebSocket}))
 }
 func (h *Hub) Publish(message []byte) {
 	h.server.SendMessage("", sse.SimpleMessage(string(message)))
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for ch := range h.subscribers {
+		// Never block publishers on a slow client
+		select {
+		case ch <- message:
+		default:
+		}
+	}
+}
+
+// heartbeatIntervalFromEnv returns the SSE heartbeat interval configured by the environment variable
+func heartbeatIntervalFromEnv() time.Duration {
+	v := os.Getenv(HeartbeatIntervalEnv)
+	if v == "" {
+		return defaultHeartbeatInterval
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Printf("[!] invalid %s %q, using default %v", HeartbeatIntervalEnv, v, defaultHeartbeatInterval)
+		return defaultHeartbeatInterval
+	}
+	return d
+}
+
+// serveSSE serves the SSE stream, sending heartbeats while the client is connected
+func (h *Hub) serveSSE(w http.ResponseWriter, r *http.Request) {
+	if h.heartbeatInterval <= 0 {
+		h.server.ServeHTTP(w, r)
+		return
+	}
+
+	hw := &heartbeatWriter{ResponseWriter: w}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(h.heartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				hw.heartbeat()
+			case <-r.Context().Done():
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	h.server.ServeHTTP(hw, r)
+
+	// The response must not be written after the handler returns
+	close(done)
+	<-stopped
+}
+
+// heartbeatWriter serializes writes of the SSE server and heartbeats to the response
+type heartbeatWriter struct {
+	http.ResponseWriter
+
+	mu          sync.Mutex
+	wroteHeader bool
+}
+
+func (w *heartbeatWriter) WriteHeader(statusCode int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *heartbeatWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *heartbeatWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// heartbeat writes a comment line, which EventSource clients ignore
+func (w *heartbeatWriter) heartbeat() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Writing before the SSE server sets the headers would send the wrong Content-Type
+	if !w.wroteHeader {
+		return
+	}
+
+	w.ResponseWriter.Write([]byte(": keepalive\n\n"))
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// subscribe registers a channel receiving published messages until the returned function is called
+func (h *Hub) subscribe() (<-chan []byte, func()) {
+	ch := make(chan []byte, subscriberBufferSize)
+
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subscribers, ch)
+		h.mu.Unlock()
+	}
+}
+
+// serveWebSocket relays published messages to a WebSocket client until it disconnects
+func (h *Hub) serveWebSocket(ws *websocket.Conn) {
+	defer ws.Close()
+
+	messages, unsubscribe := h.subscribe()
+	defer unsubscribe()
+
+	// Clients don't send anything, so reading only returns once the connection is closed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		io.Copy(io.Discard, ws)
+	}()
+
+	for {
+		select {
+		case message := <-messages:
+			if err := websocket.Message.Send(ws, string(message)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
 }
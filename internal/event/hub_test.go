@@ -0,0 +1,105 @@
+package event
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+)
+
+func subscriberCount(h *Hub) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subscribers)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	hub := NewHub()
+
+	e := echo.New()
+	hub.RegisterHandlers(e.Group("/api/event"))
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/event/ws"
+	ws, err := websocket.Dial(url, "", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	// The handler subscribes asynchronously after the handshake
+	waitFor(t, func() bool { return subscriberCount(hub) == 1 })
+
+	hub.Publish([]byte(`{"Status":"ok"}`))
+
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var message string
+	if err := websocket.Message.Receive(ws, &message); err != nil {
+		t.Fatalf("Failed to receive message: %v", err)
+	}
+	if message != `{"Status":"ok"}` {
+		t.Errorf("Message is different from expected. Expected: %s, Actual: %s", `{"Status":"ok"}`, message)
+	}
+
+	// Disconnecting must release the subscription
+	ws.Close()
+	waitFor(t, func() bool { return subscriberCount(hub) == 0 })
+}
+
+func TestSSEHeartbeat(t *testing.T) {
+	hub := NewHub()
+	hub.heartbeatInterval = 50 * time.Millisecond
+
+	e := echo.New()
+	hub.RegisterHandlers(e.Group("/api/event"))
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/event", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type is different from expected. Expected: text/event-stream, Actual: %s", ct)
+	}
+
+	// No events are published, so the first line must be a heartbeat
+	start := time.Now()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read heartbeat: %v", err)
+	}
+	if line != ": keepalive\n" {
+		t.Errorf("Line is different from expected. Expected: %q, Actual: %q", ": keepalive\n", line)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Heartbeat took too long: %v", elapsed)
+	}
+}
@@ -2,8 +2,15 @@ package alp
 
 import (
 	_ "embed"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
 
+	"github.com/kaz/pprotein/internal/analyze/config"
+	"github.com/kaz/pprotein/internal/analyze/httplog"
+	"github.com/kaz/pprotein/internal/analyze/meta"
 	"github.com/kaz/pprotein/internal/collect"
 	"github.com/kaz/pprotein/internal/extproc"
 	"github.com/kaz/pprotein/internal/persistent"
@@ -15,7 +22,10 @@ import (
 type (
 	handler struct {
 		opts   *collect.Options
+		store  storage.Storage
 		config *persistent.Handler
+
+		maxBodySize int64 // Config bodies larger than this are rejected with 413, unlimited if 0
 	}
 )
 
@@ -24,7 +34,10 @@ var defaultConfig []byte
 
 func NewHandler(opts *collect.Options, store storage.Storage) (*handler, error) {
 	h := &handler{
-		opts: opts,
+		opts:  opts,
+		store: store,
+
+		maxBodySize: storage.MaxBodySizeFromEnv(),
 	}
 
 	config, err := persistent.New(store, "alp.yml", defaultConfig, h.sanitize)
@@ -38,6 +51,8 @@ func NewHandler(opts *collect.Options, store storage.Storage) (*handler, error)
 
 func (h *handler) Register(g *echo.Group) error {
 	h.config.RegisterHandlers(g.Group("/config"))
+	g.POST("/config/diff", h.diffConfig)
+	g.POST("/:id/analyze", h.analyze)
 
 	if err := extproc.NewHandler(&processor{confPath: h.config.GetPath()}, h.opts).Register(g); err != nil {
 		return fmt.Errorf("failed to register extproc handlers: %w", err)
@@ -45,6 +60,113 @@ func (h *handler) Register(g *echo.Group) error {
 	return nil
 }
 
+// readBody reads the request body, returning 413 if it is larger than PPROTEIN_MAX_BODY_SIZE
+func (h *handler) readBody(c echo.Context) ([]byte, error) {
+	body := c.Request().Body
+	if h.maxBodySize > 0 {
+		body = http.MaxBytesReader(c.Response(), body, h.maxBodySize)
+	}
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("body exceeds the limit of %d bytes", maxBytesErr.Limit))
+		}
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to read body: %v", err))
+	}
+	return raw, nil
+}
+
+// analyze analyzes a stored httplog with the alp config in the request body, leaving the stored config untouched.
+// The requests can be limited to the time range between the RFC 3339 timestamps from and to,
+// where the time field is parsed with time_layout if given. The entry is echoed back in metadata.source.
+func (h *handler) analyze(c echo.Context) error {
+	id := c.Param("id")
+	if ok, err := h.store.Exists(h.opts.Type, id); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to check entry: %v", err))
+	} else if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("no such entry: %s", id))
+	}
+	snapshot, err := collect.LoadSnapshot(h.store, h.opts.Type, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to load entry: %v", err))
+	}
+
+	raw, err := h.readBody(c)
+	if err != nil {
+		return err
+	}
+	alpConfig := &httplog.AlpConfig{}
+	if err := yaml.Unmarshal(raw, alpConfig); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to parse config: %v", err))
+	}
+
+	from, to, err := meta.ParseTimeRange(c.QueryParam("from"), c.QueryParam("to"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	path, err := h.store.GetFilePath(id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to get file path: %v", err))
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to read file: %v", err))
+	}
+
+	result, err := httplog.AnalyzeWithOptions(c.Request().Context(), content, httplog.Options{
+		SlowThreshold: config.Current().HttplogSeconds,
+		From:          from,
+		To:            to,
+		TimeLayout:    c.QueryParam("time_layout"),
+		Source:        snapshot.Source(),
+		Config:        alpConfig,
+	})
+	if errors.Is(err, storage.ErrSizeLimitExceeded) {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to analyze httplog: %v", err))
+	}
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, []byte(result))
+}
+
+// configDiffRequest is either a pair of configs to compare, or a single config compared to the stored one
+type configDiffRequest struct {
+	Base              *httplog.AlpConfig `yaml:"base"`
+	Target            *httplog.AlpConfig `yaml:"target"`
+	httplog.AlpConfig `yaml:",inline"`
+}
+
+// diffConfig returns the matching groups added, removed and reordered between two alp configs.
+// The body holds the configs to compare in base and target, or a plain config compared to the stored one.
+func (h *handler) diffConfig(c echo.Context) error {
+	raw, err := h.readBody(c)
+	if err != nil {
+		return err
+	}
+	req := &configDiffRequest{}
+	if err := yaml.Unmarshal(raw, req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("failed to parse config: %v", err))
+	}
+
+	base, target := req.Base, req.Target
+	if target == nil {
+		target = &req.AlpConfig
+	}
+	if base == nil {
+		current, err := h.config.GetContent()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to get config: %v", err))
+		}
+		base = &httplog.AlpConfig{}
+		if err := yaml.Unmarshal(current, base); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to parse stored config: %v", err))
+		}
+	}
+	return c.JSON(http.StatusOK, httplog.DiffConfigs(base, target))
+}
+
 func (h *handler) sanitize(raw []byte) ([]byte, error) {
 	var config interface{}
 	if err := yaml.Unmarshal(raw, &config); err != nil {
@@ -0,0 +1,283 @@
+package alp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/kaz/pprotein/internal/analyze/httplog"
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/kaz/pprotein/internal/event"
+	"github.com/kaz/pprotein/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+func newTestHandler(t *testing.T) (*echo.Echo, storage.Storage) {
+	t.Helper()
+
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	h, err := NewHandler(&collect.Options{
+		Type:     "httplog",
+		Ext:      "-httplog.log",
+		Store:    store,
+		EventHub: event.NewHub(),
+	}, store)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	e := echo.New()
+	if err := h.Register(e.Group("/api/httplog")); err != nil {
+		t.Fatalf("Failed to register handler: %v", err)
+	}
+	return e, store
+}
+
+func TestAnalyzeWithConfig(t *testing.T) {
+	e, store := newTestHandler(t)
+	if err := store.Put("httplog", "a-httplog.log", []byte("{}")); err != nil {
+		t.Fatalf("Failed to put metadata: %v", err)
+	}
+	content := "method:GET\turi:/api/users/1\tstatus:200\treqtime:0.100\n" +
+		"method:GET\turi:/api/users/alice\tstatus:200\treqtime:0.200\n"
+	if err := store.PutFile("a-httplog.log", []byte(content)); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		config    string
+		endpoints []string
+	}{
+		{
+			name:      "Matching group covering all users",
+			config:    "matching_groups:\n  - ^/api/users/[^/]+$\n",
+			endpoints: []string{"group_1: ^/api/users/[^/]+$"},
+		},
+		{
+			name:      "No matching groups",
+			config:    "matching_groups: []\n",
+			endpoints: []string{"/api/users/:id", "/api/users/alice"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/httplog/a-httplog.log/analyze", strings.NewReader(tt.config)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+			}
+
+			var result struct {
+				EndpointStats map[string]json.RawMessage `json:"endpoint_stats"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			// The trailing empty line is counted as an empty URI
+			delete(result.EndpointStats, "")
+
+			if len(result.EndpointStats) != len(tt.endpoints) {
+				t.Errorf("Endpoint count is different from expected. Expected: %v, Actual: %v", tt.endpoints, result.EndpointStats)
+			}
+			for _, endpoint := range tt.endpoints {
+				if _, ok := result.EndpointStats[endpoint]; !ok {
+					t.Errorf("Endpoint %s is missing: %v", endpoint, result.EndpointStats)
+				}
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/httplog/missing-httplog.log/analyze", strings.NewReader("")))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Unexpected status for a missing entry: %d", rec.Code)
+	}
+}
+
+func TestAnalyzeTimeRange(t *testing.T) {
+	e, store := newTestHandler(t)
+	if err := store.Put("httplog", "a-httplog.log", []byte("{}")); err != nil {
+		t.Fatalf("Failed to put metadata: %v", err)
+	}
+	content := "time:2023-04-01T12:00:00Z\tmethod:GET\turi:/early\tstatus:200\treqtime:0.100\n" +
+		"time:2023-04-01T12:10:00Z\tmethod:GET\turi:/late\tstatus:200\treqtime:0.200\n"
+	if err := store.PutFile("a-httplog.log", []byte(content)); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		status    int
+		endpoints []string
+	}{
+		{name: "No range", query: "", status: http.StatusOK, endpoints: []string{"/early", "/late"}},
+		{name: "From", query: "?from=2023-04-01T12:05:00Z", status: http.StatusOK, endpoints: []string{"/late"}},
+		{name: "To", query: "?to=2023-04-01T12:05:00Z", status: http.StatusOK, endpoints: []string{"/early"}},
+		{name: "Malformed from", query: "?from=noon", status: http.StatusBadRequest},
+		{name: "Reversed range", query: "?from=2023-04-01T12:10:00Z&to=2023-04-01T12:00:00Z", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/httplog/a-httplog.log/analyze"+tt.query, strings.NewReader("")))
+			if rec.Code != tt.status {
+				t.Fatalf("Status is different from expected. Expected: %d, Actual: %d, body=%s", tt.status, rec.Code, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var result struct {
+				EndpointStats map[string]json.RawMessage `json:"endpoint_stats"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			delete(result.EndpointStats, "")
+
+			if len(result.EndpointStats) != len(tt.endpoints) {
+				t.Errorf("Endpoints are different from expected. Expected: %v, Actual: %v", tt.endpoints, result.EndpointStats)
+			}
+			for _, endpoint := range tt.endpoints {
+				if _, ok := result.EndpointStats[endpoint]; !ok {
+					t.Errorf("Endpoint %s is missing: %v", endpoint, result.EndpointStats)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyzeSource(t *testing.T) {
+	e, store := newTestHandler(t)
+	if err := store.Put("httplog", "a-httplog.log", []byte(`{"ID":"a-httplog.log","GroupId":"2023-04-01_12-00-00","Label":"nginx1","Duration":30}`)); err != nil {
+		t.Fatalf("Failed to put metadata: %v", err)
+	}
+	if err := store.PutFile("a-httplog.log", []byte("method:GET\turi:/api/users/1\tstatus:200\treqtime:0.100\n")); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/httplog/a-httplog.log/analyze", strings.NewReader("")))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+	}
+
+	var result struct {
+		Metadata struct {
+			Source struct {
+				Label    string `json:"label"`
+				GroupID  string `json:"group_id"`
+				Duration int    `json:"duration"`
+			} `json:"source"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if source := result.Metadata.Source; source.Label != "nginx1" || source.GroupID != "2023-04-01_12-00-00" || source.Duration != 30 {
+		t.Errorf("Source is different from expected: %+v", source)
+	}
+}
+
+func TestDiffConfig(t *testing.T) {
+	e, _ := newTestHandler(t)
+
+	tests := []struct {
+		name     string
+		body     string
+		expected *httplog.ConfigDiff
+	}{
+		{
+			name: "One pattern added and one removed",
+			body: "base:\n  matching_groups:\n    - ^/api/users/[0-9]+$\n    - ^/api/items/[0-9]+$\n" +
+				"target:\n  matching_groups:\n    - ^/api/users/[0-9]+$\n    - ^/api/orders/[0-9]+$\n",
+			expected: &httplog.ConfigDiff{
+				Added:     []string{"^/api/orders/[0-9]+$"},
+				Removed:   []string{"^/api/items/[0-9]+$"},
+				Reordered: []string{},
+			},
+		},
+		{
+			name: "Patterns swapped",
+			body: "base:\n  matching_groups:\n    - ^/a$\n    - ^/b$\n    - ^/c$\n" +
+				"target:\n  matching_groups:\n    - ^/b$\n    - ^/c$\n    - ^/a$\n",
+			expected: &httplog.ConfigDiff{
+				Added:     []string{},
+				Removed:   []string{},
+				Reordered: []string{"^/a$"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/httplog/config/diff", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+			}
+
+			diff := &httplog.ConfigDiff{}
+			if err := json.Unmarshal(rec.Body.Bytes(), diff); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if !reflect.DeepEqual(diff, tt.expected) {
+				t.Errorf("Diff is different from expected. Expected: %+v, Actual: %+v", tt.expected, diff)
+			}
+		})
+	}
+
+	// A plain config is compared to the stored one
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/httplog/config/diff", strings.NewReader("matching_groups: []\n")))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+	}
+	diff := &httplog.ConfigDiff{}
+	if err := json.Unmarshal(rec.Body.Bytes(), diff); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(diff.Removed) != 2 || len(diff.Added) != 0 || len(diff.Reordered) != 0 {
+		t.Errorf("Emptying the config must only remove patterns. Actual: %+v", diff)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	t.Setenv(storage.MaxBodySizeEnv, "32")
+	e, store := newTestHandler(t)
+	if err := store.Put("httplog", "a-httplog.log", []byte("{}")); err != nil {
+		t.Fatalf("Failed to put metadata: %v", err)
+	}
+	if err := store.PutFile("a-httplog.log", []byte("method:GET\turi:/\tstatus:200\treqtime:0.100\n")); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		expected int
+	}{
+		{name: "Analyze within the limit", path: "/api/httplog/a-httplog.log/analyze", body: "matching_groups: [^/api/.*$]\n", expected: http.StatusOK},
+		{name: "Analyze over the limit", path: "/api/httplog/a-httplog.log/analyze", body: "matching_groups: [^/api/users/.*$]\n", expected: http.StatusRequestEntityTooLarge},
+		{name: "Diff over the limit", path: "/api/httplog/config/diff", body: "matching_groups: [^/api/users/.*$]\n", expected: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.expected {
+				t.Errorf("Status is different from expected. Expected: %d, Actual: %d, body=%s", tt.expected, rec.Code, rec.Body)
+			}
+		})
+	}
+}
@@ -35,14 +35,20 @@ func (h *handler) Register(g *echo.Group) error {
 	g.GET("", h.getIndex)
 	g.POST("", h.postIndex)
 	g.GET("/:id", h.getId)
+	g.PATCH("/:id", collect.HandlePatch(h.collector))
 	g.GET("/data/:id", h.getData)
 	g.GET("/data/latest", h.getLatestData)
 
 	return nil
 }
 
+// getIndex lists the entries, sorted and filtered by the query params of collect.ParseListOptions
 func (h *handler) getIndex(c echo.Context) error {
-	return c.JSON(http.StatusOK, h.collector.List())
+	opts, err := collect.ParseListOptions(c.QueryParams())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, collect.FilterEntries(h.collector.List(), opts))
 }
 
 func (h *handler) postIndex(c echo.Context) error {
@@ -60,8 +66,14 @@ func (h *handler) postIndex(c echo.Context) error {
 	return c.NoContent(http.StatusOK)
 }
 
+// getId serves the analysis result, which is computed again instead of served from the cache with refresh=1
 func (h *handler) getId(c echo.Context) error {
-	r, err := h.collector.Get(c.Param("id"))
+	get := h.collector.Get
+	if refresh := c.QueryParam("refresh"); refresh == "1" || refresh == "true" {
+		get = h.collector.Refresh
+	}
+
+	r, err := get(c.Param("id"))
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Errorf("failed to get entry: %w", err))
 	}
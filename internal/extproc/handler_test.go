@@ -0,0 +1,157 @@
+package extproc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/kaz/pprotein/internal/event"
+	"github.com/kaz/pprotein/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+// fakeProcessor returns a fixed analysis result for every snapshot
+type fakeProcessor struct {
+	result string
+}
+
+func (p *fakeProcessor) Process(snapshot *collect.Snapshot) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(p.result)), nil
+}
+
+func (p *fakeProcessor) Cacheable() bool {
+	return false
+}
+
+// countingProcessor returns the number of times it has processed as the result
+type countingProcessor struct {
+	count int
+}
+
+func (p *countingProcessor) Process(snapshot *collect.Snapshot) (io.ReadCloser, error) {
+	p.count++
+	return io.NopCloser(strings.NewReader(strconv.Itoa(p.count))), nil
+}
+
+func (p *countingProcessor) Cacheable() bool {
+	return true
+}
+
+func TestGetIdRefresh(t *testing.T) {
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	processor := &countingProcessor{}
+	h := NewHandler(processor, &collect.Options{
+		Type:     "httplog",
+		Ext:      "-httplog.log",
+		Store:    store,
+		EventHub: event.NewHub(),
+	})
+
+	e := echo.New()
+	if err := h.Register(e.Group("/api/httplog")); err != nil {
+		t.Fatalf("Failed to register handler: %v", err)
+	}
+
+	// Adding a snapshot processes it once and caches the result
+	snapshot, err := h.collector.Add(&collect.SnapshotTarget{GroupId: "1", Label: "nginx"}, []byte("log"))
+	if err != nil {
+		t.Fatalf("Failed to add snapshot: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		wantBody  string
+		wantCount int
+	}{
+		{name: "Cached result is served", query: "", wantBody: "1", wantCount: 1},
+		{name: "Refresh processes again", query: "?refresh=1", wantBody: "2", wantCount: 2},
+		{name: "Refreshed result is cached", query: "", wantBody: "2", wantCount: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/httplog/"+snapshot.ID+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Unexpected status: %d, body=%s", rec.Code, rec.Body)
+			}
+			if rec.Body.String() != tt.wantBody {
+				t.Errorf("Body is different from expected. Expected: %s, Actual: %s", tt.wantBody, rec.Body)
+			}
+			if processor.count != tt.wantCount {
+				t.Errorf("Process count is different from expected. Expected: %d, Actual: %d", tt.wantCount, processor.count)
+			}
+		})
+	}
+}
+
+func TestPatchId(t *testing.T) {
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	h := NewHandler(&fakeProcessor{result: "{}"}, &collect.Options{
+		Type:     "slowlog",
+		Ext:      "-slowlog.log",
+		Store:    store,
+		EventHub: event.NewHub(),
+	})
+
+	e := echo.New()
+	if err := h.Register(e.Group("/api/slowlog")); err != nil {
+		t.Fatalf("Failed to register handler: %v", err)
+	}
+
+	snapshot, err := h.collector.Add(&collect.SnapshotTarget{GroupId: "1", Label: "web1"}, []byte("log"))
+	if err != nil {
+		t.Fatalf("Failed to add snapshot: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		id       string
+		body     string
+		expected int
+	}{
+		{name: "Relabel", id: snapshot.ID, body: `{"label":"db1","comment":"mislabeled"}`, expected: http.StatusOK},
+		{name: "Empty label", id: snapshot.ID, body: `{"label":""}`, expected: http.StatusBadRequest},
+		{name: "Unknown entry", id: "unknown", body: `{"label":"db1"}`, expected: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/api/slowlog/"+tt.id, strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.expected {
+				t.Errorf("Status is different from expected. Expected: %d, Actual: %d, body=%s", tt.expected, rec.Code, rec.Body)
+			}
+		})
+	}
+
+	// The update must be listed and survive reloading the snapshots
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/slowlog?label=db1", nil))
+	if !strings.Contains(rec.Body.String(), snapshot.ID) {
+		t.Errorf("Relabeled entry is not listed: %s", rec.Body)
+	}
+
+	snapshots, err := collect.LoadSnapshots(store, "slowlog")
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("Failed to load snapshots: %v", err)
+	}
+	if snapshots[0].Label != "db1" || snapshots[0].Comment != "mislabeled" || snapshots[0].GroupId != "1" {
+		t.Errorf("Stored snapshot is different from expected: %+v, %+v", snapshots[0].SnapshotMeta, snapshots[0].SnapshotTarget)
+	}
+}
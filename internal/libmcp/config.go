@@ -0,0 +1,84 @@
+package libmcp
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variable specifying the path of the connections config file
+const ConnectionsConfigEnv = "PPROTEIN_CONNECTIONS_CONFIG"
+
+// ConnectionsConfig is the structure of the connections config file (YAML or JSON)
+type ConnectionsConfig struct {
+	SSH   []SSHConnectionConfig   `yaml:"ssh"`
+	MySQL []MySQLConnectionConfig `yaml:"mysql"`
+}
+
+// SSHConnectionConfig is a named SSH connection defined in the config file
+type SSHConnectionConfig struct {
+	Name     string `yaml:"name"`
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	KeyPath  string `yaml:"key_path"`
+}
+
+// MySQLConnectionConfig is a named MySQL connection defined in the config file
+type MySQLConnectionConfig struct {
+	Name     string `yaml:"name"`
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Database string `yaml:"database"`
+	TLS      string `yaml:"tls"`    // TLS mode as given to mysql_connect (e.g. required)
+	TLSCA    string `yaml:"tls_ca"` // Path of the CA certificate to verify the server with
+}
+
+// LoadConnectionsConfig reads the connections config file, registers the SSH connections defined in it as pinned ones,
+// and returns the validated config so that callers can register the remaining connection types
+func LoadConnectionsConfig(path string) (*ConnectionsConfig, error) {
+	log.Printf("Loading connection settings from %s", path)
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read connections config: %w", err)
+	}
+
+	// YAML is a superset of JSON, so both formats are accepted
+	config := &ConnectionsConfig{}
+	if err := yaml.Unmarshal(raw, config); err != nil {
+		return nil, fmt.Errorf("failed to parse connections config: %w", err)
+	}
+
+	sshCount := 0
+	for _, conn := range config.SSH {
+		if err := registerSSHConnection(conn.Name, conn.Host, conn.Port, conn.Username, conn.Password, conn.KeyPath, true); err != nil {
+			log.Printf("Warning: Skipping SSH connection '%s' from config: %v", conn.Name, err)
+			continue
+		}
+		sshCount++
+	}
+
+	mysqlConnections := make([]MySQLConnectionConfig, 0, len(config.MySQL))
+	for _, conn := range config.MySQL {
+		if conn.Name == "" || conn.Host == "" || conn.Username == "" {
+			log.Printf("Warning: Skipping MySQL connection '%s' from config: name, host, and username are required", conn.Name)
+			continue
+		}
+		if conn.Port == "" {
+			conn.Port = "3306"
+		}
+
+		mysqlConnections = append(mysqlConnections, conn)
+		log.Printf("MySQL connection setting '%s' loaded with host '%s', user '%s', port '%s'", conn.Name, conn.Host, conn.Username, conn.Port)
+	}
+	config.MySQL = mysqlConnections
+
+	log.Printf("Completed loading connection settings from %s: %d SSH, %d MySQL", path, sshCount, len(config.MySQL))
+	return config, nil
+}
@@ -0,0 +1,63 @@
+package libmcp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConnectionsConfig(t *testing.T) {
+	configContent := `ssh:
+  - name: isu1
+    host: 192.168.0.11
+    username: isucon
+    key_path: /home/isucon/.ssh/id_ed25519
+  - name: isu2
+    host: 192.168.0.12
+    port: "2222"
+    username: isucon
+    password: secret
+  - name: broken
+    username: isucon
+mysql:
+  - name: isu1-db
+    host: 192.168.0.11
+    username: isucon
+    password: isucon
+    database: isupipe
+`
+
+	configPath := filepath.Join(t.TempDir(), "connections.yml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+
+	config, err := LoadConnectionsConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load connections config: %v", err)
+	}
+
+	// Verify SSH connections are registered
+	for _, name := range []string{"isu1", "isu2"} {
+		if _, ok := getSSHConnection(name); !ok {
+			t.Errorf("SSH connection %s is not registered", name)
+		}
+	}
+	if _, ok := getSSHConnection("broken"); ok {
+		t.Errorf("Invalid SSH connection should not be registered")
+	}
+	if conn, _ := getSSHConnection("isu1"); conn != nil && conn.Port != "22" {
+		t.Errorf("Default SSH port is not applied. Expected: 22, Actual: %s", conn.Port)
+	}
+	if conn, _ := getSSHConnection("isu2"); conn != nil && conn.Port != "2222" {
+		t.Errorf("SSH port does not match. Expected: 2222, Actual: %s", conn.Port)
+	}
+
+	// Verify MySQL connections are returned with defaults applied
+	if len(config.MySQL) != 1 {
+		t.Fatalf("MySQL connection count is different from expected. Expected: 1, Actual: %d", len(config.MySQL))
+	}
+	if config.MySQL[0].Name != "isu1-db" || config.MySQL[0].Port != "3306" {
+		t.Errorf("Unexpected MySQL connection: %+v", config.MySQL[0])
+	}
+}
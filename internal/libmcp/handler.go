@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 )
@@ -60,8 +61,14 @@ func handleSSHCommand(ctx context.Context, request mcp.CallToolRequest) (*mcp.Ca
 	password, _ := request.Params.Arguments["password"].(string)
 	keyPath, _ := request.Params.Arguments["key_path"].(string)
 	command, _ := request.Params.Arguments["command"].(string)
+	timeoutSeconds, _ := request.Params.Arguments["timeout"].(float64)
 
-	result, err := ExecuteSSHCommand(connectionName, host, port, username, password, keyPath, command)
+	timeout := SSHCommandTimeout()
+	if timeoutSeconds > 0 {
+		timeout = time.Duration(timeoutSeconds * float64(time.Second))
+	}
+
+	result, err := ExecuteSSHCommand(ctx, connectionName, host, port, username, password, keyPath, command, timeout)
 	if err != nil {
 		return nil, err
 	}
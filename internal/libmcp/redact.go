@@ -0,0 +1,58 @@
+package libmcp
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Placeholder shown instead of secret values
+const redactedValue = "********"
+
+// Connection attributes whose values must never be logged.
+// KEY is only the path to the private key, which is shown like the other settings.
+var sensitiveAttributes = map[string]bool{
+	"PASS": true,
+}
+
+// redactingLogger writes log messages with all registered secret values masked
+type redactingLogger struct {
+	secrets []string
+}
+
+// newRedactingLogger creates a logger masking the given secret values (empty values are ignored)
+func newRedactingLogger(secrets ...string) *redactingLogger {
+	l := &redactingLogger{}
+	l.AddSecret(secrets...)
+	return l
+}
+
+// AddSecret registers additional secret values to be masked
+func (l *redactingLogger) AddSecret(secrets ...string) {
+	for _, secret := range secrets {
+		if secret != "" {
+			l.secrets = append(l.secrets, secret)
+		}
+	}
+}
+
+// Redact returns s with all registered secret values masked
+func (l *redactingLogger) Redact(s string) string {
+	for _, secret := range l.secrets {
+		s = strings.ReplaceAll(s, secret, redactedValue)
+	}
+	return s
+}
+
+// Printf formats the message like log.Printf and writes it with secret values masked
+func (l *redactingLogger) Printf(format string, v ...interface{}) {
+	log.Print(l.Redact(fmt.Sprintf(format, v...)))
+}
+
+// redactAttribute returns the value to log for a connection attribute
+func redactAttribute(attr, value string) string {
+	if sensitiveAttributes[attr] && value != "" {
+		return redactedValue
+	}
+	return value
+}
@@ -0,0 +1,190 @@
+package libmcp
+
+import (
+	"container/list"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Environment variables limiting the connection registries, which are unlimited if not set
+const (
+	MaxConnectionsEnv = "PPROTEIN_MCP_MAX_CONNECTIONS" // Maximum number of connections per registry
+	ConnectionTTLEnv  = "PPROTEIN_MCP_CONNECTION_TTL"  // Duration after which unused connections are dropped (e.g. 1h)
+)
+
+// RegistryLimits bounds the connections of a Registry. Zero values mean no limit.
+type RegistryLimits struct {
+	MaxEntries int           // The least recently used connection is dropped when exceeded
+	IdleTTL    time.Duration // Connections unused for this long are dropped
+}
+
+// RegistryLimitsFromEnv reads the limits of the connection registries from the environment
+func RegistryLimitsFromEnv() RegistryLimits {
+	limits := RegistryLimits{}
+	if v := os.Getenv(MaxConnectionsEnv); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			limits.MaxEntries = n
+		} else {
+			log.Printf("[!] invalid %s %q, not limiting the number of connections", MaxConnectionsEnv, v)
+		}
+	}
+	if v := os.Getenv(ConnectionTTLEnv); v != "" {
+		if ttl, err := time.ParseDuration(v); err == nil && ttl >= 0 {
+			limits.IdleTTL = ttl
+		} else {
+			log.Printf("[!] invalid %s %q, keeping idle connections", ConnectionTTLEnv, v)
+		}
+	}
+	return limits
+}
+
+type (
+	// Registry holds named connections, dropping the least recently used ones over the limits.
+	// Pinned connections (e.g. the ones from the config file) are never dropped and don't count toward the cap.
+	// It is safe for concurrent use.
+	Registry[V any] struct {
+		mu      sync.Mutex
+		limits  RegistryLimits
+		onEvict func(name string, v V) // Called for each dropped connection, e.g. to close it
+		now     func() time.Time
+
+		entries map[string]*list.Element
+		order   *list.List // Of *registryEntry, most recently used first
+		pinned  int        // Number of pinned entries in order
+	}
+
+	registryEntry[V any] struct {
+		name     string
+		value    V
+		lastUsed time.Time
+		pinned   bool
+	}
+)
+
+// NewRegistry returns an empty registry. onEvict may be nil.
+func NewRegistry[V any](limits RegistryLimits, onEvict func(name string, v V)) *Registry[V] {
+	return &Registry[V]{
+		limits:  limits,
+		onEvict: onEvict,
+		now:     time.Now,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// Store saves the connection, replacing any with the same name, and drops the ones over the limits
+func (r *Registry[V]) Store(name string, v V) {
+	r.store(name, v, false)
+}
+
+// StorePinned saves the connection like Store, but the connection is never dropped by the limits
+func (r *Registry[V]) StorePinned(name string, v V) {
+	r.store(name, v, true)
+}
+
+func (r *Registry[V]) store(name string, v V, pinned bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if elem, ok := r.entries[name]; ok {
+		entry := elem.Value.(*registryEntry[V])
+		if entry.pinned {
+			r.pinned--
+		}
+		entry.value, entry.lastUsed, entry.pinned = v, now, pinned
+		r.order.MoveToFront(elem)
+	} else {
+		r.entries[name] = r.order.PushFront(&registryEntry[V]{name: name, value: v, lastUsed: now, pinned: pinned})
+	}
+	if pinned {
+		r.pinned++
+	}
+	r.evict(now)
+}
+
+// Delete drops the named connection without calling onEvict
+func (r *Registry[V]) Delete(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	elem, ok := r.entries[name]
+	if !ok {
+		return
+	}
+	if elem.Value.(*registryEntry[V]).pinned {
+		r.pinned--
+	}
+	r.order.Remove(elem)
+	delete(r.entries, name)
+}
+
+// Get returns the named connection, marking it as used
+func (r *Registry[V]) Get(name string) (V, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	r.evict(now)
+	elem, ok := r.entries[name]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	entry := elem.Value.(*registryEntry[V])
+	entry.lastUsed = now
+	r.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+// Len returns the number of connections
+func (r *Registry[V]) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.evict(r.now())
+	return len(r.entries)
+}
+
+// Range calls fn for each connection from the most recently used one without marking them as used.
+// fn must not call the other methods of the registry.
+func (r *Registry[V]) Range(fn func(name string, v V)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.evict(r.now())
+	for elem := r.order.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*registryEntry[V])
+		fn(entry.name, entry.value)
+	}
+}
+
+// evict drops the connections idle for longer than the TTL and then the least recently used ones over the cap,
+// skipping the pinned ones
+func (r *Registry[V]) evict(now time.Time) {
+	for elem := r.order.Back(); elem != nil; {
+		entry := elem.Value.(*registryEntry[V])
+		prev := elem.Prev()
+		if entry.pinned {
+			elem = prev
+			continue
+		}
+
+		expired := r.limits.IdleTTL > 0 && now.Sub(entry.lastUsed) > r.limits.IdleTTL
+		overflowed := r.limits.MaxEntries > 0 && r.order.Len()-r.pinned > r.limits.MaxEntries
+		if !expired && !overflowed {
+			return
+		}
+
+		r.order.Remove(elem)
+		delete(r.entries, entry.name)
+		log.Printf("Connection setting '%s' has been dropped", entry.name)
+		if r.onEvict != nil {
+			r.onEvict(entry.name, entry.value)
+		}
+		elem = prev
+	}
+}
@@ -0,0 +1,131 @@
+package libmcp
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// registryNames returns the names in the registry from the most recently used one
+func registryNames[V any](r *Registry[V]) []string {
+	names := []string{}
+	r.Range(func(name string, _ V) {
+		names = append(names, name)
+	})
+	return names
+}
+
+func TestRegistryEvictsOnOverflow(t *testing.T) {
+	var evicted []string
+	r := NewRegistry(RegistryLimits{MaxEntries: 2}, func(name string, _ int) {
+		evicted = append(evicted, name)
+	})
+
+	r.Store("isu1", 1)
+	r.Store("isu2", 2)
+	if _, ok := r.Get("isu1"); !ok {
+		t.Fatalf("Connection isu1 is missing")
+	}
+	r.Store("isu3", 3) // isu2 is the least recently used one
+
+	if names := registryNames(r); !slices.Equal(names, []string{"isu3", "isu1"}) {
+		t.Errorf("Connections are different from expected. Expected: [isu3 isu1], Actual: %v", names)
+	}
+	if !slices.Equal(evicted, []string{"isu2"}) {
+		t.Errorf("Evicted connections are different from expected. Expected: [isu2], Actual: %v", evicted)
+	}
+
+	// Replacing a connection doesn't evict anything
+	r.Store("isu1", 10)
+	if v, _ := r.Get("isu1"); v != 10 || r.Len() != 2 || len(evicted) != 1 {
+		t.Errorf("Replaced connection is different from expected. Value: %d, Len: %d, Evicted: %v", v, r.Len(), evicted)
+	}
+}
+
+func TestRegistryExpiresAfterIdle(t *testing.T) {
+	now := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+	var evicted []string
+	r := NewRegistry(RegistryLimits{IdleTTL: time.Hour}, func(name string, _ string) {
+		evicted = append(evicted, name)
+	})
+	r.now = func() time.Time { return now }
+
+	r.Store("isu1", "a")
+	r.Store("isu2", "b")
+
+	now = now.Add(40 * time.Minute)
+	if _, ok := r.Get("isu1"); !ok {
+		t.Fatalf("Connection isu1 expired before the TTL")
+	}
+
+	// isu2 has been idle for 80 minutes, while isu1 was used 40 minutes ago
+	now = now.Add(40 * time.Minute)
+	if _, ok := r.Get("isu2"); ok {
+		t.Errorf("Idle connection isu2 is not dropped")
+	}
+	if _, ok := r.Get("isu1"); !ok {
+		t.Errorf("Recently used connection isu1 is dropped")
+	}
+	if !slices.Equal(evicted, []string{"isu2"}) {
+		t.Errorf("Evicted connections are different from expected. Expected: [isu2], Actual: %v", evicted)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if r.Len() != 0 {
+		t.Errorf("Idle connections are left: %v", registryNames(r))
+	}
+}
+
+func TestRegistryKeepsPinned(t *testing.T) {
+	now := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+	var evicted []string
+	r := NewRegistry(RegistryLimits{MaxEntries: 1, IdleTTL: time.Hour}, func(name string, _ int) {
+		evicted = append(evicted, name)
+	})
+	r.now = func() time.Time { return now }
+
+	r.StorePinned("config", 0)
+	r.Store("isu1", 1)
+	r.Store("isu2", 2) // The pinned connection doesn't count toward the cap
+
+	if names := registryNames(r); !slices.Equal(names, []string{"isu2", "config"}) {
+		t.Errorf("Connections are different from expected. Expected: [isu2 config], Actual: %v", names)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if names := registryNames(r); !slices.Equal(names, []string{"config"}) {
+		t.Errorf("Connections are different from expected after the TTL. Expected: [config], Actual: %v", names)
+	}
+	if !slices.Equal(evicted, []string{"isu1", "isu2"}) {
+		t.Errorf("Evicted connections are different from expected. Expected: [isu1 isu2], Actual: %v", evicted)
+	}
+
+	// Deleting doesn't call onEvict
+	r.Delete("config")
+	if r.Len() != 0 || len(evicted) != 2 {
+		t.Errorf("Deleted connection is different from expected. Len: %d, Evicted: %v", r.Len(), evicted)
+	}
+}
+
+func TestRegistryLimitsFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		max      string
+		ttl      string
+		expected RegistryLimits
+	}{
+		{name: "Unset", expected: RegistryLimits{}},
+		{name: "Both", max: "10", ttl: "30m", expected: RegistryLimits{MaxEntries: 10, IdleTTL: 30 * time.Minute}},
+		{name: "Invalid", max: "many", ttl: "-1h", expected: RegistryLimits{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(MaxConnectionsEnv, tt.max)
+			t.Setenv(ConnectionTTLEnv, tt.ttl)
+			if limits := RegistryLimitsFromEnv(); limits != tt.expected {
+				t.Errorf("Limits are different from expected. Expected: %+v, Actual: %+v", tt.expected, limits)
+			}
+		})
+	}
+}
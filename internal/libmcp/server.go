@@ -99,6 +99,9 @@ func (s *mcpServerImpl) RegisterSSHTools() error {
 			mcp.Required(),
 			mcp.Description("Command to execute"),
 		),
+		mcp.WithNumber("timeout",
+			mcp.Description("Timeout in seconds, after which the command is killed (default: 60, or SSH_COMMAND_TIMEOUT)"),
+		),
 	)
 
 	// SSH connection settings list retrieval tool
@@ -2,12 +2,15 @@ package libmcp
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
@@ -23,11 +26,36 @@ type SSHConnection struct {
 	KeyPath  string `json:"key_path"` // Private key path (optional)
 }
 
-// Map of saved SSH connections
-var sshConnections = make(map[string]*SSHConnection)
+// Saved SSH connections, where the ones registered at runtime are bounded by the limits in the environment
+var sshConnections = NewRegistry[*SSHConnection](RegistryLimitsFromEnv(), nil)
 
-// RegisterSSHConnection registers new SSH connection settings
+// storeSSHConnection saves SSH connection settings, replacing any with the same name.
+// Pinned settings (e.g. from the config file) are kept regardless of the limits.
+func storeSSHConnection(conn *SSHConnection, pinned bool) {
+	if pinned {
+		sshConnections.StorePinned(conn.Name, conn)
+		return
+	}
+	sshConnections.Store(conn.Name, conn)
+}
+
+// getSSHConnection returns the named SSH connection settings
+func getSSHConnection(name string) (*SSHConnection, bool) {
+	return sshConnections.Get(name)
+}
+
+// SSHConnectionCount returns the number of saved SSH connections
+func SSHConnectionCount() int {
+	return sshConnections.Len()
+}
+
+// RegisterSSHConnection registers new SSH connection settings, which are dropped over the limits
 func RegisterSSHConnection(name, host, port, username, password, keyPath string) error {
+	return registerSSHConnection(name, host, port, username, password, keyPath, false)
+}
+
+// registerSSHConnection validates and saves SSH connection settings
+func registerSSHConnection(name, host, port, username, password, keyPath string, pinned bool) error {
 	// Check required parameters
 	if name == "" || host == "" || username == "" {
 		return fmt.Errorf("Name, host, and username are required")
@@ -44,14 +72,14 @@ func RegisterSSHConnection(name, host, port, username, password, keyPath string)
 	}
 
 	// Save connection settings
-	sshConnections[name] = &SSHConnection{
+	storeSSHConnection(&SSHConnection{
 		Name:     name,
 		Host:     host,
 		Port:     port,
 		Username: username,
 		Password: password,
 		KeyPath:  keyPath,
-	}
+	}, pinned)
 
 	log.Printf("SSH connection setting '%s' has been registered", name)
 	return nil
@@ -60,13 +88,13 @@ func RegisterSSHConnection(name, host, port, username, password, keyPath string)
 // ListSSHConnections returns a list of registered SSH connection settings
 func ListSSHConnections() ([]map[string]interface{}, error) {
 	// Register default settings if no connections are registered
-	if len(sshConnections) == 0 {
+	if SSHConnectionCount() == 0 {
 		registerDefaultSSHConnection()
 	}
 
 	// Convert connection settings list to slice
-	connections := make([]map[string]interface{}, 0, len(sshConnections))
-	for _, conn := range sshConnections {
+	connections := make([]map[string]interface{}, 0, SSHConnectionCount())
+	sshConnections.Range(func(_ string, conn *SSHConnection) {
 		// Mask sensitive information
 		connMap := map[string]interface{}{
 			"name":     conn.Name,
@@ -76,7 +104,7 @@ func ListSSHConnections() ([]map[string]interface{}, error) {
 		}
 
 		if conn.Password != "" {
-			connMap["password"] = "********"
+			connMap["password"] = redactedValue
 		}
 
 		if conn.KeyPath != "" {
@@ -84,39 +112,56 @@ func ListSSHConnections() ([]map[string]interface{}, error) {
 		}
 
 		connections = append(connections, connMap)
-	}
+	})
 
 	return connections, nil
 }
 
-// ExecuteSSHCommand executes an SSH command on a remote host
-func ExecuteSSHCommand(connectionName, host, port, username, password, keyPath, command string) (map[string]interface{}, error) {
-	log.Println("Starting SSH command execution process")
+// Default timeout of SSH command execution
+const defaultSSHCommandTimeout = 60 * time.Second
+
+// SSHCommandTimeout returns the timeout of SSH command execution,
+// which can be overridden with the SSH_COMMAND_TIMEOUT environment variable (e.g. "30s")
+func SSHCommandTimeout() time.Duration {
+	if v := os.Getenv("SSH_COMMAND_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+		log.Printf("Warning: Invalid SSH_COMMAND_TIMEOUT %q, using default %v", v, defaultSSHCommandTimeout)
+	}
+	return defaultSSHCommandTimeout
+}
+
+// ExecuteSSHCommand executes an SSH command on a remote host.
+// The command is killed when ctx is cancelled or the timeout expires.
+func ExecuteSSHCommand(ctx context.Context, connectionName, host, port, username, password, keyPath, command string, timeout time.Duration) (map[string]interface{}, error) {
+	// Mask passwords in every log line, including ones echoed through the command or its output
+	rlog := newRedactingLogger(password)
+	rlog.Printf("Starting SSH command execution process")
 
 	// Command is required
 	if command == "" {
-		log.Println("Error: No command specified for SSH execution")
+		rlog.Printf("Error: No command specified for SSH execution")
 		return nil, fmt.Errorf("Command is required")
 	}
-	log.Printf("Preparing to execute command: %s", command)
 
 	// If connection name is specified, use that
 	if connectionName != "" {
-		log.Printf("Using named connection: '%s'", connectionName)
+		rlog.Printf("Using named connection: '%s'", connectionName)
 
 		// Register default settings if no connections are registered
-		if len(sshConnections) == 0 {
-			log.Println("No SSH connections registered, loading default settings")
+		if SSHConnectionCount() == 0 {
+			rlog.Printf("No SSH connections registered, loading default settings")
 			registerDefaultSSHConnection()
 		}
 
-		conn, exists := sshConnections[connectionName]
+		conn, exists := getSSHConnection(connectionName)
 		if !exists {
-			log.Printf("Error: Connection '%s' not found in registered connections", connectionName)
+			rlog.Printf("Error: Connection '%s' not found in registered connections", connectionName)
 			return nil, fmt.Errorf("The specified connection setting '%s' does not exist", connectionName)
 		}
 
-		log.Printf("Found connection settings for '%s': host=%s, port=%s, user=%s",
+		rlog.Printf("Found connection settings for '%s': host=%s, port=%s, user=%s",
 			connectionName, conn.Host, conn.Port, conn.Username)
 
 		host = conn.Host
@@ -126,114 +171,117 @@ func ExecuteSSHCommand(connectionName, host, port, username, password, keyPath,
 		// Don't overwrite existing settings
 		if password == "" {
 			if conn.Password != "" {
-				log.Printf("Using password from connection settings for '%s'", connectionName)
+				rlog.Printf("Using password from connection settings for '%s'", connectionName)
 				password = conn.Password
+				rlog.AddSecret(password)
 			} else {
-				log.Printf("No password specified in connection '%s'", connectionName)
+				rlog.Printf("No password specified in connection '%s'", connectionName)
 			}
 		} else {
-			log.Printf("Using provided password instead of connection settings")
+			rlog.Printf("Using provided password instead of connection settings")
 		}
 
 		if keyPath == "" {
 			if conn.KeyPath != "" {
-				log.Printf("Using key path from connection settings: %s", conn.KeyPath)
+				rlog.Printf("Using key path from connection settings: %s", conn.KeyPath)
 				keyPath = conn.KeyPath
 			} else {
-				log.Printf("No key path specified in connection '%s'", connectionName)
+				rlog.Printf("No key path specified in connection '%s'", connectionName)
 			}
 		} else {
-			log.Printf("Using provided key path instead of connection settings")
+			rlog.Printf("Using provided key path instead of connection settings")
 		}
 	} else {
-		log.Printf("Using direct connection parameters: host=%s, port=%s, user=%s", host, port, username)
+		rlog.Printf("Using direct connection parameters: host=%s, port=%s, user=%s", host, port, username)
 	}
 
+	rlog.Printf("Preparing to execute command: %s", command)
+
 	// Check required parameters
 	if host == "" || username == "" {
-		log.Println("Error: Host and username are required for SSH execution")
+		rlog.Printf("Error: Host and username are required for SSH execution")
 		return nil, fmt.Errorf("Host and username are required")
 	}
 
 	// Default port setting
 	if port == "" {
 		port = "22"
-		log.Printf("No port specified, using default SSH port 22")
+		rlog.Printf("No port specified, using default SSH port 22")
 	} else {
-		log.Printf("Using SSH port: %s", port)
+		rlog.Printf("Using SSH port: %s", port)
 	}
 
-	// Execute SSH command
-	var cmd *exec.Cmd
+	// Build SSH command
+	var name string
+	var args []string
 	if keyPath != "" {
 		// If using private key authentication
-		log.Printf("Using private key authentication with key: %s", keyPath)
+		rlog.Printf("Using private key authentication with key: %s", keyPath)
 
 		// Check if the key file exists
 		if _, err := os.Stat(keyPath); os.IsNotExist(err) {
-			log.Printf("Warning: Private key file does not exist: %s", keyPath)
+			rlog.Printf("Warning: Private key file does not exist: %s", keyPath)
 		}
 
-		cmd = exec.Command("ssh",
+		name = "ssh"
+		args = []string{
 			"-o", "StrictHostKeyChecking=no",
 			"-i", keyPath,
 			"-p", port,
 			fmt.Sprintf("%s@%s", username, host),
-			command)
-		log.Printf("Created SSH command with key authentication: ssh -i %s -p %s %s@%s '%s'",
+			command,
+		}
+		rlog.Printf("Created SSH command with key authentication: ssh -i %s -p %s %s@%s '%s'",
 			keyPath, port, username, host, command)
 	} else if password != "" {
 		// If using password authentication (using sshpass)
-		log.Printf("Using password authentication with sshpass")
+		rlog.Printf("Using password authentication with sshpass")
 
 		// Check if sshpass is installed
 		if _, err := exec.LookPath("sshpass"); err != nil {
-			log.Println("Warning: sshpass may not be installed, this could cause command execution to fail")
+			rlog.Printf("Warning: sshpass may not be installed, this could cause command execution to fail")
 		}
 
-		cmd = exec.Command("sshpass",
+		name = "sshpass"
+		args = []string{
 			"-p", password,
 			"ssh",
 			"-o", "StrictHostKeyChecking=no",
 			"-p", port,
 			fmt.Sprintf("%s@%s", username, host),
-			command)
-		log.Printf("Created SSH command with password authentication: sshpass -p *** ssh -p %s %s@%s '%s'",
+			command,
+		}
+		rlog.Printf("Created SSH command with password authentication: sshpass -p *** ssh -p %s %s@%s '%s'",
 			port, username, host, command)
 	} else {
-		log.Println("Error: No authentication method specified (neither password nor key)")
+		rlog.Printf("Error: No authentication method specified (neither password nor key)")
 		return nil, fmt.Errorf("Please specify an authentication method (password or private key)")
 	}
 
-	// Get command output
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
 	// Execute command
-	log.Printf("Executing SSH command to %s@%s...", username, host)
-	err := cmd.Run()
+	rlog.Printf("Executing SSH command to %s@%s (timeout: %v)...", username, host, timeout)
+	stdoutStr, stderrStr, timedOut, err := runCommand(ctx, timeout, name, args...)
 
-	if err != nil {
-		log.Printf("SSH command execution failed: %v", err)
+	if timedOut {
+		rlog.Printf("SSH command execution timed out: %v", err)
+	} else if err != nil {
+		rlog.Printf("SSH command execution failed: %v", err)
 	} else {
-		log.Printf("SSH command execution completed successfully")
+		rlog.Printf("SSH command execution completed successfully")
 	}
 
 	// Log output
-	stdoutStr := stdout.String()
-	stderrStr := stderr.String()
 
 	if stdoutStr != "" {
-		log.Printf("Command stdout (%d bytes): %s", len(stdoutStr), truncateIfTooLong(stdoutStr, 500))
+		rlog.Printf("Command stdout (%d bytes): %s", len(stdoutStr), truncateIfTooLong(stdoutStr, 500))
 	} else {
-		log.Printf("Command stdout: <empty>")
+		rlog.Printf("Command stdout: <empty>")
 	}
 
 	if stderrStr != "" {
-		log.Printf("Command stderr (%d bytes): %s", len(stderrStr), truncateIfTooLong(stderrStr, 500))
+		rlog.Printf("Command stderr (%d bytes): %s", len(stderrStr), truncateIfTooLong(stderrStr, 500))
 	} else {
-		log.Printf("Command stderr: <empty>")
+		rlog.Printf("Command stderr: <empty>")
 	}
 
 	// Return results as a map
@@ -243,16 +291,41 @@ func ExecuteSSHCommand(connectionName, host, port, username, password, keyPath,
 		"stdout":     stdoutStr,
 		"stderr":     stderrStr,
 		"successful": err == nil,
+		"timed_out":  timedOut,
 	}
 
 	if err != nil {
 		result["error"] = err.Error()
 	}
 
-	log.Printf("SSH command execution process completed with status: %v", err == nil)
+	rlog.Printf("SSH command execution process completed with status: %v", err == nil)
 	return result, nil
 }
 
+// runCommand runs a command, killing it when ctx is cancelled or the timeout expires,
+// and returns the output captured until then
+func runCommand(ctx context.Context, timeout time.Duration, name string, args ...string) (string, string, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	// Don't wait forever for children (e.g. ssh spawned by sshpass) still holding the output pipes
+	cmd.WaitDelay = time.Second
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return stdout.String(), stderr.String(), true, fmt.Errorf("command timed out after %v", timeout)
+	}
+	if ctx.Err() != nil {
+		return stdout.String(), stderr.String(), false, fmt.Errorf("command cancelled: %w", ctx.Err())
+	}
+	return stdout.String(), stderr.String(), false, err
+}
+
 // truncateIfTooLong truncates a string if it's too long and adds "..."
 func truncateIfTooLong(s string, maxLen int) string {
 	if len(s) <= maxLen {
@@ -267,7 +340,7 @@ func registerDefaultSSHConnection() {
 	loadSSHConnectionsFromEnv()
 
 	// Add default settings if there are no settings in environment variables
-	if len(sshConnections) == 0 {
+	if SSHConnectionCount() == 0 {
 		// Get default private key path
 		homeDir, err := os.UserHomeDir()
 		keyPath := "/root/.ssh/id_ed25519" // Default value
@@ -294,7 +367,7 @@ func registerDefaultSSHConnection() {
 			KeyPath:  keyPath,
 		}
 
-		sshConnections[defaultConn.Name] = defaultConn
+		storeSSHConnection(defaultConn, false)
 		log.Printf("Default SSH connection setting '%s' registered with user '%s'", defaultConn.Name, defaultConn.Username)
 	}
 }
@@ -353,7 +426,7 @@ func loadSSHConnectionsFromEnv() {
 
 		// Save attribute value
 		connectionMap[name][attr] = value
-		log.Printf("Set %s=%s for connection '%s'", attr, value, name)
+		log.Printf("Set %s=%s for connection '%s'", attr, redactAttribute(attr, value), name)
 	}
 
 	log.Printf("Found %d SSH environment variables for %d connection settings", sshEnvCount, len(connectionMap))
@@ -456,11 +529,11 @@ func loadSSHConnectionsFromEnv() {
 			KeyPath:  keyPath,
 		}
 
-		sshConnections[name] = conn
+		storeSSHConnection(conn, true)
 		log.Printf("SSH connection setting '%s' registered with host '%s', user '%s', port '%s'", name, host, username, port)
 	}
 
-	log.Printf("Completed loading SSH connection settings, registered %d connections", len(sshConnections))
+	log.Printf("Completed loading SSH connection settings, registered %d connections", SSHConnectionCount())
 }
 
 // Register SSH tools to the MCP server
@@ -492,6 +565,9 @@ func RegisterSSHTools(s *server.MCPServer) {
 			mcp.Description("Command to execute"),
 			mcp.Required(),
 		),
+		mcp.WithNumber("timeout",
+			mcp.Description("Timeout in seconds, after which the command is killed (default: 60, or SSH_COMMAND_TIMEOUT)"),
+		),
 	)
 
 	// Tool to get the list of SSH connection settings
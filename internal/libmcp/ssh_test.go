@@ -0,0 +1,160 @@
+package libmcp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// captureLog redirects the standard logger into a buffer for the duration of the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() {
+		log.SetOutput(prev)
+	})
+	return &buf
+}
+
+func TestExecuteSSHCommandRedactsPassword(t *testing.T) {
+	const password = "s3cr3t-passw0rd"
+
+	if err := RegisterSSHConnection("redact-test", "127.0.0.1", "1", "isucon", password, ""); err != nil {
+		t.Fatalf("Failed to register SSH connection: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		connectionName string
+		password       string
+	}{
+		{
+			name:           "Password given directly",
+			connectionName: "",
+			password:       password,
+		},
+		{
+			name:           "Password from registered connection",
+			connectionName: "redact-test",
+			password:       "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureLog(t)
+
+			// The command echoes the password to make sure it is masked even when it appears in the command line
+			if _, err := ExecuteSSHCommand(context.Background(), tt.connectionName, "127.0.0.1", "1", "isucon", tt.password, "", "echo "+password, 10*time.Second); err != nil {
+				t.Fatalf("ExecuteSSHCommand() error = %v", err)
+			}
+
+			output := buf.String()
+			if strings.Contains(output, password) {
+				t.Errorf("Password found in log output:\n%s", output)
+			}
+			if !strings.Contains(output, redactedValue) {
+				t.Errorf("Redacted placeholder not found in log output:\n%s", output)
+			}
+		})
+	}
+
+	connections, err := ListSSHConnections()
+	if err != nil {
+		t.Fatalf("ListSSHConnections() error = %v", err)
+	}
+	for _, conn := range connections {
+		if conn["password"] == password {
+			t.Errorf("Password found in connection list: %v", conn)
+		}
+	}
+}
+
+func TestLoadSSHConnectionsFromEnvRedactsPassword(t *testing.T) {
+	const password = "pr0d-s3cr3t"
+	const keyPath = "/secret/keys/prod_ed25519"
+
+	t.Setenv("SSH_CONN_PROD_HOST", "192.168.0.100")
+	t.Setenv("SSH_CONN_PROD_PASS", password)
+	t.Setenv("SSH_CONN_PROD_KEY", keyPath)
+
+	buf := captureLog(t)
+	loadSSHConnectionsFromEnv()
+
+	output := buf.String()
+	if strings.Contains(output, password) {
+		t.Errorf("Password found in log output:\n%s", output)
+	}
+	// The key path is not a secret and is logged like the other settings
+	if !strings.Contains(output, keyPath) {
+		t.Errorf("Key path not found in log output:\n%s", output)
+	}
+
+	conn, ok := getSSHConnection("PROD")
+	if !ok {
+		t.Fatalf("SSH connection PROD is not registered")
+	}
+	if conn.Password != password || conn.KeyPath != keyPath {
+		t.Errorf("Secret values were not registered as given: %+v", conn)
+	}
+}
+
+func TestRunCommandTimeout(t *testing.T) {
+	start := time.Now()
+	stdout, _, timedOut, err := runCommand(context.Background(), time.Second, "sh", "-c", "echo partial; sleep 100")
+	elapsed := time.Since(start)
+
+	if !timedOut {
+		t.Errorf("Command should have timed out")
+	}
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Timeout error expected, got: %v", err)
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("Command did not return promptly after timeout: %v", elapsed)
+	}
+	if !strings.Contains(stdout, "partial") {
+		t.Errorf("Partial output was not captured: %q", stdout)
+	}
+}
+
+func TestSSHConnectionsConcurrentAccess(t *testing.T) {
+	captureLog(t)
+
+	// Nothing listens on port 1, so every execution fails fast after looking up the connection
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("race-%d", i)
+
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			if err := RegisterSSHConnection(name, "127.0.0.1", "1", "isucon", "isucon", ""); err != nil {
+				t.Errorf("Failed to register SSH connection: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			ExecuteSSHCommand(context.Background(), name, "", "", "", "", "", "true", 10*time.Second)
+		}()
+		go func() {
+			defer wg.Done()
+			ListSSHConnections()
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < 10; i++ {
+		if _, ok := getSSHConnection(fmt.Sprintf("race-%d", i)); !ok {
+			t.Errorf("SSH connection race-%d is not registered", i)
+		}
+	}
+}
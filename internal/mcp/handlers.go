@@ -2,21 +2,35 @@ package mcp
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"regexp"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/kaz/pprotein/internal/analyze/config"
+	"github.com/kaz/pprotein/internal/analyze/meta"
 	"github.com/kaz/pprotein/internal/analyze/pprof"
 	"github.com/kaz/pprotein/internal/analyze/slowlog"
+	"github.com/kaz/pprotein/internal/analyze/trace"
 	"github.com/kaz/pprotein/internal/collect"
+	"github.com/kaz/pprotein/internal/collect/group"
 )
 
-// Get group list handler
-func handleGroupList(port string) (interface{}, error) {
+// rawDataURL returns the URL downloading the stored file of an entry
+func rawDataURL(port, fileType, id string) string {
+	return fmt.Sprintf("http://localhost:%s/api/raw/%s/%s", port, fileType, id)
+}
+
+// Get group list handler.
+// Once ctx is done, the groups found so far are returned with a note.
+func handleGroupList(ctx context.Context, port string) (interface{}, error) {
 	log.Println("Executing group_list function")
 
 	// Map to store results
@@ -25,23 +39,30 @@ func handleGroupList(port string) (interface{}, error) {
 	}
 
 	// Collect entries from all endpoints
-	endpoints := []string{"pprof", "httplog", "slowlog", "memo"}
+	endpoints := collect.Types()
 	uniqueGroups := make(map[string]struct{})
 
-	for _, endpoint := range endpoints {
+	for i, endpoint := range endpoints {
+		if ctx.Err() != nil {
+			markTimedOut(result, endpoints[i:])
+			break
+		}
 		log.Printf("Fetching entries from endpoint: %s", endpoint)
 
 		// Get data from each endpoint
-		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%s/api/%s", port, endpoint), nil)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://localhost:%s/api/%s", port, endpoint), nil)
 		if err != nil {
 			log.Printf("Error creating request for %s: %v", endpoint, err)
 			continue
 		}
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		resp, err := doWithRetry(req)
 		if err != nil {
 			log.Printf("Error fetching from %s: %v", endpoint, err)
+			if ctx.Err() != nil {
+				markTimedOut(result, endpoints[i:])
+				break
+			}
 			continue
 		}
 
@@ -55,6 +76,10 @@ func handleGroupList(port string) (interface{}, error) {
 		if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
 			log.Printf("Error decoding response from %s: %v", endpoint, err)
 			resp.Body.Close()
+			if ctx.Err() != nil {
+				markTimedOut(result, endpoints[i:])
+				break
+			}
 			continue
 		}
 		resp.Body.Close()
@@ -84,8 +109,9 @@ func handleGroupList(port string) (interface{}, error) {
 	return result, nil
 }
 
-// Get group data handler
-func handleGroupData(port string, groupID string) (interface{}, error) {
+// Get group data handler.
+// Once ctx is done, the entries found so far are returned with a note.
+func handleGroupData(ctx context.Context, port string, groupID string) (interface{}, error) {
 	log.Printf("Executing group_data function with group_id: %s", groupID)
 
 	result := map[string]interface{}{
@@ -94,21 +120,28 @@ func handleGroupData(port string, groupID string) (interface{}, error) {
 	}
 
 	// Get data from each collector
-	endpoints := []string{"pprof", "httplog", "slowlog", "memo"}
+	endpoints := collect.Types()
 
-	for _, endpoint := range endpoints {
+	for i, endpoint := range endpoints {
+		if ctx.Err() != nil {
+			markTimedOut(result, endpoints[i:])
+			break
+		}
 		log.Printf("Fetching group data from endpoint: %s", endpoint)
 
-		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%s/api/%s", port, endpoint), nil)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://localhost:%s/api/%s", port, endpoint), nil)
 		if err != nil {
 			log.Printf("Error creating request for %s: %v", endpoint, err)
 			continue
 		}
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		resp, err := doWithRetry(req)
 		if err != nil {
 			log.Printf("Error fetching from %s: %v", endpoint, err)
+			if ctx.Err() != nil {
+				markTimedOut(result, endpoints[i:])
+				break
+			}
 			continue
 		}
 
@@ -122,6 +155,10 @@ func handleGroupData(port string, groupID string) (interface{}, error) {
 		if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
 			log.Printf("Error decoding response from %s: %v", endpoint, err)
 			resp.Body.Close()
+			if ctx.Err() != nil {
+				markTimedOut(result, endpoints[i:])
+				break
+			}
 			continue
 		}
 		resp.Body.Close()
@@ -140,197 +177,359 @@ func handleGroupData(port string, groupID string) (interface{}, error) {
 		}
 	}
 
+	// A group only exists through its entries, so nothing found is reported as no data rather than an error
+	if _, timedOut := result["timed_out"]; len(result["data"].(map[string][]interface{})) == 0 && !timedOut {
+		result["status"] = statusNoData
+		result["message"] = fmt.Sprintf("Group %s has no entries", groupID)
+	} else {
+		result["status"] = statusOK
+	}
+
 	log.Printf("group_data completed for group_id: %s", groupID)
 	return result, nil
 }
 
-// Get group file handler
-func handleGroupFile(port string, groupID string, fileType string, entryID string) ([]byte, string, error) {
-	log.Printf("Executing group_file function with group_id: %s, type: %s, entry_id: %s", groupID, fileType, entryID)
-
-	// If httplog, return analysis result
-	if fileType == "httplog" {
-		result, contentType, err := handleHttpLogAnalysis(port, groupID, fileType, entryID)
+// Get latest group handler.
+// Once ctx is done, the newest group among the entries found so far is returned with a note.
+func handleGroupLatest(ctx context.Context, src source) (interface{}, error) {
+	log.Println("Executing group_latest function")
+
+	counts := map[string]map[string]int{}
+	latest := map[string]time.Time{}
+	types := collect.Types()
+	var skipped []string
+	for i, typ := range types {
+		if ctx.Err() != nil {
+			skipped = types[i:]
+			break
+		}
+		entries, err := src.entries(ctx, typ)
 		if err != nil {
-			return nil, "", err
+			log.Printf("Error fetching entries of %s: %v", typ, err)
+			continue
 		}
-		return []byte(result), contentType, nil
-	}
 
-	// If slowlog, return analysis result
-	if fileType == "slowlog" {
-		result, contentType, err := handleSlowLogAnalysis(port, groupID, fileType, entryID)
-		if err != nil {
-			return nil, "", err
-		}
-		return []byte(result), contentType, nil
-	}
-
-	// If pprof, return analysis result
-	if fileType == "pprof" {
-		// If there is a special format specification
-		format := strings.ToLower(strings.TrimSpace(entryID))
-		if format == "speedscope" {
-			// Return Speedscope JSON format
-			result, contentType, err := handlePprofAnalysis(port, groupID, fileType, "")
-			if err != nil {
-				return nil, "", err
+		for _, entry := range entries {
+			if entry.Snapshot == nil || entry.Snapshot.SnapshotTarget == nil || entry.Snapshot.GroupId == "" {
+				continue
 			}
-			return []byte(result), contentType, nil
-		}
+			groupID := entry.Snapshot.GroupId
 
-		if format == "detailed_json" {
-			// Return detailed JSON format
-			result, contentType, err := handlePprofDetailedJSON(port, groupID)
-			if err != nil {
-				return nil, "", err
+			if counts[groupID] == nil {
+				counts[groupID] = map[string]int{}
 			}
-			return []byte(result), contentType, nil
-		}
+			counts[groupID][typ]++
 
-		if entryID != "" && !strings.HasPrefix(entryID, "format=") {
-			// Get text report for specific entry ID (default format)
-			result, contentType, err := handlePprofTextReportWithEntryID(port, groupID, entryID)
-			if err != nil {
-				return nil, "", err
+			if entry.Snapshot.Datetime.After(latest[groupID]) {
+				latest[groupID] = entry.Snapshot.Datetime
 			}
-			return []byte(result), contentType, nil
 		}
+	}
 
-		result, contentType, err := handlePprofTextReport(port, groupID)
-		if err != nil {
-			return nil, "", err
+	var newestID string
+	var newestTime time.Time
+	for groupID, datetime := range latest {
+		// Group IDs are the time the collection started, which is preferred over the snapshot times
+		if t, err := time.ParseInLocation(group.IDLayout, groupID, time.Local); err == nil {
+			datetime = t
+		}
+		if newestID == "" || datetime.After(newestTime) || (datetime.Equal(newestTime) && groupID > newestID) {
+			newestID, newestTime = groupID, datetime
 		}
-		return []byte(result), contentType, nil
+	}
+	if newestID == "" {
+		return nil, fmt.Errorf("no groups found")
 	}
 
-	// Get ID from metadata first
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%s/api/%s", port, fileType), nil)
-	if err != nil {
-		return nil, "", fmt.Errorf("error creating request for %s: %v", fileType, err)
+	parts := []string{}
+	for _, typ := range collect.Types() {
+		if n := counts[newestID][typ]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %d", typ, n))
+		}
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, "", fmt.Errorf("error fetching from %s: %v", fileType, err)
+	result := map[string]interface{}{
+		"group_id": newestID,
+		"counts":   counts[newestID],
+		"summary":  fmt.Sprintf("Group %s contains %s", newestID, strings.Join(parts, ", ")),
 	}
-	defer resp.Body.Close()
+	if skipped != nil {
+		markTimedOut(result, skipped)
+	}
+	return result, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, "", fmt.Errorf("unexpected status code from %s: %d", fileType, resp.StatusCode)
+// Output formats of pprof files in group_file
+const (
+	formatText         = "text"
+	formatSpeedscope   = "speedscope"
+	formatDetailedJSON = "detailed_json"
+)
+
+// pprofFormats are the formats accepted for pprof files, the first one being the default
+var pprofFormats = []string{formatText, formatSpeedscope, formatDetailedJSON}
+
+// normalizeFormat validates the format of the file type, returning the default one if empty
+func normalizeFormat(fileType, format string) (string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if fileType != "pprof" {
+		if format != "" {
+			return "", fmt.Errorf("format is only supported for pprof, got %q for %s", format, fileType)
+		}
+		return "", nil
 	}
 
-	var entries []*collect.Entry
-	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
-		return nil, "", fmt.Errorf("error decoding response from %s: %v", fileType, err)
+	if format == "" {
+		return pprofFormats[0], nil
 	}
+	for _, f := range pprofFormats {
+		if format == f {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("invalid format: %q, must be one of %s", format, strings.Join(pprofFormats, ", "))
+}
 
-	// Filter by group ID and entry ID
-	var selectedID string
-	for _, entry := range entries {
-		if entry.Snapshot != nil && entry.Snapshot.GroupId == groupID {
-			if entryID == "" || entry.Snapshot.ID == entryID {
-				selectedID = entry.Snapshot.ID
-				break
+// Statuses of the group_data and group_file results
+const (
+	statusOK     = "ok"
+	statusNoData = "no_data"
+)
+
+// errNoEntries is returned when the group has no entries of the type, which is not a failure by itself
+var errNoEntries = errors.New("no matching entry found")
+
+// slowlogFilter narrows the slowlog analysis of group_file to a time range and drops the excluded query patterns
+type slowlogFilter struct {
+	from, to time.Time // Zero means unbounded
+	exclude  []string  // Regexes matched against the query fingerprints
+}
+
+// isZero reports whether the filter leaves the analysis as is
+func (f slowlogFilter) isZero() bool {
+	return f.from.IsZero() && f.to.IsZero() && len(f.exclude) == 0
+}
+
+// parseSlowlogFilter reads the from, to and exclude arguments of group_file, validating the time range and the regexes
+func parseSlowlogFilter(args map[string]interface{}) (slowlogFilter, error) {
+	from, _ := args["from"].(string)
+	to, _ := args["to"].(string)
+	filter := slowlogFilter{}
+	var err error
+	if filter.from, filter.to, err = meta.ParseTimeRange(from, to); err != nil {
+		return slowlogFilter{}, err
+	}
+
+	if raw, ok := args["exclude"]; ok {
+		patterns, ok := raw.([]interface{})
+		if !ok {
+			return slowlogFilter{}, fmt.Errorf("exclude must be an array of regexes")
+		}
+		for _, p := range patterns {
+			pattern, ok := p.(string)
+			if !ok {
+				return slowlogFilter{}, fmt.Errorf("exclude must be an array of regexes, got %v", p)
+			}
+			if _, err := regexp.Compile(pattern); err != nil {
+				return slowlogFilter{}, fmt.Errorf("invalid exclude %q: %v", pattern, err)
 			}
+			filter.exclude = append(filter.exclude, pattern)
 		}
 	}
+	return filter, nil
+}
 
-	if selectedID == "" {
-		return nil, "", fmt.Errorf("no matching entry found for group_id: %s, type: %s", groupID, fileType)
-	}
+// Get group file handler, which recomputes the cached analysis instead of serving it with refresh.
+// A group without entries of the type results in a no_data status, while an unknown group is an error.
+func handleGroupFile(ctx context.Context, src source, groupID, fileType, entryID, format string, refresh bool, filter slowlogFilter) ([]byte, string, error) {
+	log.Printf("Executing group_file function with group_id: %s, type: %s, entry_id: %s, format: %s, refresh: %v", groupID, fileType, entryID, format, refresh)
 
-	// Get data directly - use data API endpoint
-	dataURL := fmt.Sprintf("http://localhost:%s/api/%s/data/%s", port, fileType, selectedID)
-	log.Printf("Fetching file data from: %s", dataURL)
+	format, err := normalizeFormat(fileType, format)
+	if err != nil {
+		return nil, "", err
+	}
+	if fileType != "slowlog" && !filter.isZero() {
+		return nil, "", fmt.Errorf("from, to and exclude are only supported for slowlog, got them for %s", fileType)
+	}
 
-	dataResp, err := http.Get(dataURL)
+	var result string
+	var contentType string
+	switch fileType {
+	case "httplog":
+		// If httplog, return analysis result
+		result, contentType, err = handleHttpLogAnalysis(ctx, src, groupID, fileType, entryID, refresh)
+	case "slowlog":
+		// If slowlog, return analysis result
+		result, contentType, err = handleSlowLogAnalysis(ctx, src, groupID, fileType, entryID, filter)
+	case "pprof":
+		// If pprof, return analysis result in the format
+		result, contentType, err = handlePprofFormat(ctx, src, groupID, entryID, format)
+	case "trace":
+		// If trace, return the summary instead of the binary
+		result, contentType, err = handleTraceAnalysis(ctx, src, groupID, fileType, entryID)
+	default:
+		var content []byte
+		content, contentType, err = handleRawFile(ctx, src, groupID, fileType, entryID)
+		result = string(content)
+	}
+	if errors.Is(err, errNoEntries) {
+		return noDataResult(ctx, src, groupID, fileType)
+	}
 	if err != nil {
-		return nil, "", fmt.Errorf("error fetching file data: %v", err)
+		return nil, "", err
 	}
-	defer dataResp.Body.Close()
+	return []byte(result), contentType, nil
+}
 
-	if dataResp.StatusCode != http.StatusOK {
-		return nil, "", fmt.Errorf("unexpected status code from data endpoint: %d", dataResp.StatusCode)
+// noDataResult reports that the group has no entries of the type, or fails if the group has no entries at all
+func noDataResult(ctx context.Context, src source, groupID, fileType string) ([]byte, string, error) {
+	if !groupExists(ctx, src, groupID) {
+		return nil, "", fmt.Errorf("group not found: group_id=%s", groupID)
 	}
 
-	fileContent, err := io.ReadAll(dataResp.Body)
+	result, err := json.Marshal(map[string]interface{}{
+		"status":   statusNoData,
+		"group_id": groupID,
+		"type":     fileType,
+		"message":  fmt.Sprintf("Group %s has no %s entries", groupID, fileType),
+	})
 	if err != nil {
-		return nil, "", fmt.Errorf("error reading file content: %v", err)
+		return nil, "", fmt.Errorf("failed to marshal result: %v", err)
 	}
+	return result, "application/json", nil
+}
 
-	contentType := determineContentType(fileType, selectedID)
-
-	log.Printf("Successfully fetched file for group_id: %s, type: %s, id: %s, size: %d bytes",
-		groupID, fileType, selectedID, len(fileContent))
-	return fileContent, contentType, nil
+// groupExists tells whether the group has an entry of any type
+func groupExists(ctx context.Context, src source, groupID string) bool {
+	for _, typ := range collect.Types() {
+		entries, err := src.entries(ctx, typ)
+		if err != nil {
+			log.Printf("Error fetching entries of %s: %v", typ, err)
+			continue
+		}
+		for _, entry := range entries {
+			if entry.Snapshot != nil && entry.Snapshot.GroupId == groupID {
+				return true
+			}
+		}
+	}
+	return false
 }
 
-// Determine Content-Type based on file type
-func determineContentType(fileType string, filePath string) string {
-	switch fileType {
-	case "pprof":
-		return "application/octet-stream"
-	case "httplog", "slowlog", "memo":
-		return "text/plain"
+// handlePprofFormat returns the analysis of the pprof entry, or of the latest entry of the group if entryID is empty
+func handlePprofFormat(ctx context.Context, src source, groupID, entryID, format string) (string, string, error) {
+	switch format {
+	case formatSpeedscope:
+		return handlePprofAnalysis(ctx, src, groupID, "pprof", entryID)
+	case formatDetailedJSON:
+		if entryID != "" {
+			return handlePprofDetailedJSONWithEntryID(ctx, src, groupID, entryID)
+		}
+		return handlePprofDetailedJSON(ctx, src, groupID)
 	default:
-		return "application/octet-stream"
+		if entryID != "" {
+			return handlePprofTextReportWithEntryID(ctx, src, groupID, entryID)
+		}
+		return handlePprofTextReport(ctx, src, groupID)
 	}
 }
 
-func handleHttpLogAnalysis(apiPort, groupID, fileType, entryID string) (string, string, error) {
-	// まず適切なエントリIDを取得
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%s/api/%s", apiPort, fileType), nil)
+// handleRawFile returns the stored file of the entry as is
+func handleRawFile(ctx context.Context, src source, groupID, fileType, entryID string) ([]byte, string, error) {
+	selected, err := findEntry(ctx, src, fileType, groupID, entryID)
 	if err != nil {
-		return "", "", fmt.Errorf("error creating request: %v", err)
+		return nil, "", err
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	fileContent, err := src.content(ctx, fileType, selected.Snapshot.ID)
 	if err != nil {
-		return "", "", fmt.Errorf("error fetching from %s: %v", fileType, err)
+		return nil, "", err
 	}
-	defer resp.Body.Close()
 
-	var entries []*collect.Entry
-	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
-		return "", "", fmt.Errorf("error decoding response: %v", err)
+	contentType := determineContentType(fileType, selected.Snapshot.ID)
+
+	log.Printf("Successfully fetched file for group_id: %s, type: %s, id: %s, size: %d bytes",
+		groupID, fileType, selected.Snapshot.ID, len(fileContent))
+	return fileContent, contentType, nil
+}
+
+// findEntry returns the first entry of the group, or the entry with entryID if it is given
+func findEntry(ctx context.Context, src source, fileType, groupID, entryID string) (*collect.Entry, error) {
+	entries, err := src.entries(ctx, fileType)
+	if err != nil {
+		return nil, err
 	}
 
-	// 適切なエントリを選択
-	var selectedID string
 	for _, entry := range entries {
 		if entry.Snapshot != nil && entry.Snapshot.GroupId == groupID {
 			if entryID == "" || entry.Snapshot.ID == entryID {
-				selectedID = entry.Snapshot.ID
-				break
+				return entry, nil
 			}
 		}
 	}
 
-	if selectedID == "" {
-		return "", "", fmt.Errorf("no matching entry found")
+	if entryID != "" {
+		return nil, fmt.Errorf("no matching entry found: group_id=%s, entry_id=%s", groupID, entryID)
+	}
+	return nil, fmt.Errorf("%w: group_id=%s, type=%s", errNoEntries, groupID, fileType)
+}
+
+// findGroupEntries returns the entries of the group from the latest one
+func findGroupEntries(ctx context.Context, src source, fileType, groupID string) ([]*collect.Entry, error) {
+	entries, err := src.entries(ctx, fileType)
+	if err != nil {
+		return nil, err
 	}
 
-	// 解析済みデータを直接取得
-	analysisURL := fmt.Sprintf("http://localhost:%s/api/%s/%s", apiPort, fileType, selectedID)
-	log.Printf("Fetching analysis data from: %s", analysisURL)
+	var found []*collect.Entry
+	for _, entry := range entries {
+		if entry.Snapshot != nil && entry.Snapshot.GroupId == groupID {
+			found = append(found, entry)
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("%w: group_id=%s, type=%s", errNoEntries, groupID, fileType)
+	}
 
-	analysisResp, err := http.Get(analysisURL)
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Snapshot.Datetime.After(found[j].Snapshot.Datetime)
+	})
+	return found, nil
+}
+
+// findLatestEntry returns the latest entry of the group
+func findLatestEntry(ctx context.Context, src source, fileType, groupID string) (*collect.Entry, error) {
+	entries, err := findGroupEntries(ctx, src, fileType, groupID)
 	if err != nil {
-		return "", "", fmt.Errorf("error fetching analysis: %v", err)
+		return nil, err
+	}
+	return entries[0], nil
+}
+
+// Determine Content-Type based on file type
+func determineContentType(fileType string, filePath string) string {
+	switch fileType {
+	case "pprof":
+		return "application/octet-stream"
+	case "httplog", "slowlog", "memo":
+		return "text/plain"
+
+	default:
+		return "application/octet-stream"
 	}
-	defer analysisResp.Body.Close()
+}
 
-	if analysisResp.StatusCode != http.StatusOK {
-		return "", "", fmt.Errorf("unexpected status code: %d", analysisResp.StatusCode)
+func handleHttpLogAnalysis(ctx context.Context, src source, groupID, fileType, entryID string, refresh bool) (string, string, error) {
+	// まず適切なエントリを選択
+	selected, err := findEntry(ctx, src, fileType, groupID, entryID)
+	if err != nil {
+		return "", "", err
 	}
 
-	// 解析済みデータを読み込み
-	analysisData, err := io.ReadAll(analysisResp.Body)
+	// 解析済みデータを取得
+	analysisData, err := src.analysis(ctx, fileType, selected.Snapshot.ID, refresh)
 	if err != nil {
-		return "", "", fmt.Errorf("error reading analysis: %v", err)
+		return "", "", err
 	}
 
 	// ALPの出力をJSONに変換するなどの処理が必要であれば実装
@@ -338,6 +537,7 @@ func handleHttpLogAnalysis(apiPort, groupID, fileType, entryID string) (string,
 	result := map[string]interface{}{
 		"alp_analysis": string(analysisData),
 		"source":       "pre-analyzed",
+		"metadata":     &meta.Metadata{Source: selected.Snapshot.Source()},
 	}
 
 	jsonResult, err := json.MarshalIndent(result, "", "  ")
@@ -348,73 +548,26 @@ func handleHttpLogAnalysis(apiPort, groupID, fileType, entryID string) (string,
 	return string(jsonResult), "application/json", nil
 }
 
-func handleSlowLogAnalysis(port, groupID, fileType, entryID string) (string, string, error) {
-	// Helper function to get raw file content
-	getRawFileContent := func() ([]byte, error) {
-		// Get ID from metadata first
-		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%s/api/%s", port, fileType), nil)
-		if err != nil {
-			return nil, fmt.Errorf("error creating request: %v", err)
-		}
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("error calling API: %v", err)
-		}
-		defer resp.Body.Close()
-
-		// Decode with collect.Entry type
-		var entries []*collect.Entry
-		if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
-			return nil, fmt.Errorf("JSON decode error: %v", err)
-		}
-
-		// Filter by group ID and entry ID
-		var selectedID string
-		for _, entry := range entries {
-			if entry.Snapshot != nil && entry.Snapshot.GroupId == groupID {
-				if entryID == "" || entry.Snapshot.ID == entryID {
-					selectedID = entry.Snapshot.ID
-					break
-				}
-			}
-		}
-
-		if selectedID == "" {
-			return nil, fmt.Errorf("no matching entry found: group_id=%s, type=%s", groupID, fileType)
-		}
-
-		// Get data directly
-		dataURL := fmt.Sprintf("http://localhost:%s/api/%s/data/%s", port, fileType, selectedID)
-		log.Printf("Fetching data from: %s", dataURL)
-
-		dataResp, err := http.Get(dataURL)
-		if err != nil {
-			return nil, fmt.Errorf("error fetching data: %v", err)
-		}
-		defer dataResp.Body.Close()
-
-		if dataResp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("unexpected status code from data endpoint: %d", dataResp.StatusCode)
-		}
-
-		fileContent, err := io.ReadAll(dataResp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("error reading file content: %v", err)
-		}
-
-		return fileContent, nil
+func handleSlowLogAnalysis(ctx context.Context, src source, groupID, fileType, entryID string, filter slowlogFilter) (string, string, error) {
+	selected, err := findEntry(ctx, src, fileType, groupID, entryID)
+	if err != nil {
+		return "", "", err
 	}
 
 	// Get raw file content
-	fileContent, err := getRawFileContent()
+	fileContent, err := src.content(ctx, fileType, selected.Snapshot.ID)
 	if err != nil {
 		return "", "", err
 	}
 
-	// Analyze with slowlog package (threshold 0.5 seconds)
-	result, err := slowlog.Analyze(fileContent, 0.5)
+	// Analyze with slowlog package using the configured threshold
+	result, err := slowlog.AnalyzeWithOptions(ctx, fileContent, slowlog.Options{
+		Threshold: config.Current().SlowlogSeconds,
+		From:      filter.from,
+		To:        filter.to,
+		Exclude:   filter.exclude,
+		Source:    selected.Snapshot.Source(),
+	})
 	if err != nil {
 		return "", "", err
 	}
@@ -422,84 +575,40 @@ func handleSlowLogAnalysis(port, groupID, fileType, entryID string) (string, str
 	return result, "application/json", nil
 }
 
-// pprof file analysis handler
-func handlePprofAnalysis(port, groupID, fileType, entryID string) (string, string, error) {
-	// Helper function to get raw file content
-	getRawFileContent := func() ([]byte, string, error) {
-		// Get ID from metadata first
-		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%s/api/%s", port, fileType), nil)
-		if err != nil {
-			return nil, "", fmt.Errorf("error creating request: %v", err)
-		}
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, "", fmt.Errorf("error calling API: %v", err)
-		}
-		defer resp.Body.Close()
-
-		var entries []*collect.Entry
-		if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
-			return nil, "", fmt.Errorf("JSON decode error: %v", err)
-		}
-
-		// Filter by group ID and entry ID
-		var selectedID string
-		for _, entry := range entries {
-			if entry.Snapshot != nil && entry.Snapshot.GroupId == groupID {
-				if entryID == "" || entry.Snapshot.ID == entryID {
-					selectedID = entry.Snapshot.ID
-					break
-				}
-			}
-		}
-
-		if selectedID == "" {
-			return nil, "", fmt.Errorf("no matching entry found: group_id=%s, type=%s", groupID, fileType)
-		}
-
-		// Get data directly
-		dataURL := fmt.Sprintf("http://localhost:%s/api/%s/data/%s", port, fileType, selectedID)
-		log.Printf("Fetching data from: %s", dataURL)
-
-		dataResp, err := http.Get(dataURL)
-		if err != nil {
-			return nil, "", fmt.Errorf("error fetching data: %v", err)
-		}
-		defer dataResp.Body.Close()
-
-		if dataResp.StatusCode != http.StatusOK {
-			return nil, "", fmt.Errorf("unexpected status code from data endpoint: %d", dataResp.StatusCode)
-		}
+// handleTraceAnalysis summarizes the GC pauses, goroutines and syscalls of the execution trace entry
+func handleTraceAnalysis(ctx context.Context, src source, groupID, fileType, entryID string) (string, string, error) {
+	selected, err := findEntry(ctx, src, fileType, groupID, entryID)
+	if err != nil {
+		return "", "", err
+	}
 
-		fileContent, err := io.ReadAll(dataResp.Body)
-		if err != nil {
-			return nil, "", fmt.Errorf("error reading file content: %v", err)
-		}
+	fileContent, err := src.content(ctx, fileType, selected.Snapshot.ID)
+	if err != nil {
+		return "", "", err
+	}
 
-		// Profile type is inferred from file path
-		var profileType string
-		if strings.Contains(selectedID, "cpu") {
-			profileType = "cpu"
-		} else if strings.Contains(selectedID, "heap") {
-			profileType = "heap"
-		} else {
-			// Default profile type
-			profileType = "unknown"
-		}
+	result, err := trace.AnalyzeWithOptions(fileContent, trace.Options{Source: selected.Snapshot.Source()})
+	if err != nil {
+		return "", "", fmt.Errorf("trace analysis error: %v", err)
+	}
+	return result, "application/json", nil
+}
 
-		return fileContent, profileType, nil
+// pprof file analysis handler
+func handlePprofAnalysis(ctx context.Context, src source, groupID, fileType, entryID string) (string, string, error) {
+	selected, err := findEntry(ctx, src, fileType, groupID, entryID)
+	if err != nil {
+		return "", "", err
 	}
 
 	// Get raw file content
-	fileContent, profileType, err := getRawFileContent()
+	fileContent, err := src.content(ctx, fileType, selected.Snapshot.ID)
 	if err != nil {
 		return "", "", err
 	}
 
 	// Analyze with analyze/pprof package
-	result, err := pprof.Analyze(fileContent, profileType)
+	result, err := pprof.AnalyzeWithOptions(fileContent, profileTypeOf(selected.Snapshot), pprof.Options{Source: selected.Snapshot.Source()})
 	if err != nil {
 		return "", "", fmt.Errorf("pprof analysis error: %v", err)
 	}
@@ -507,166 +616,55 @@ func handlePprofAnalysis(port, groupID, fileType, entryID string) (string, strin
 	return result, "application/json", nil
 }
 
-// pprof file detailed JSON handler
-func handlePprofDetailedJSON(port, groupID string) (string, string, error) {
-	// Helper function to get raw file content
-	getRawFileContent := func() ([]byte, string, error) {
-		// Get ID from metadata first
-		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%s/api/pprof", port), nil)
-		if err != nil {
-			return nil, "", fmt.Errorf("error creating request: %v", err)
-		}
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, "", fmt.Errorf("error calling API: %v", err)
-		}
-		defer resp.Body.Close()
-
-		var entries []*collect.Entry
-		if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
-			return nil, "", fmt.Errorf("JSON decode error: %v", err)
-		}
-
-		// Filter by group ID and get the latest entry
-		var latestEntry *collect.Entry
-		for _, entry := range entries {
-			if entry.Snapshot != nil && entry.Snapshot.GroupId == groupID {
-				if latestEntry == nil || entry.Snapshot.Datetime.After(latestEntry.Snapshot.Datetime) {
-					latestEntry = entry
-				}
-			}
-		}
-
-		if latestEntry == nil {
-			return nil, "", fmt.Errorf("no matching entry found: group_id=%s", groupID)
-		}
-
-		// Get data directly
-		dataURL := fmt.Sprintf("http://localhost:%s/api/pprof/data/%s", port, latestEntry.Snapshot.ID)
-		log.Printf("Fetching data from: %s", dataURL)
-
-		dataResp, err := http.Get(dataURL)
-		if err != nil {
-			return nil, "", fmt.Errorf("error fetching data: %v", err)
-		}
-		defer dataResp.Body.Close()
-
-		if dataResp.StatusCode != http.StatusOK {
-			return nil, "", fmt.Errorf("unexpected status code from data endpoint: %d", dataResp.StatusCode)
-		}
-
-		fileContent, err := io.ReadAll(dataResp.Body)
-		if err != nil {
-			return nil, "", fmt.Errorf("error reading file content: %v", err)
-		}
-
-		// Profile type is inferred from file path
-		var profileType string
-		if strings.Contains(latestEntry.Snapshot.ID, "cpu") {
-			profileType = "cpu"
-		} else if strings.Contains(latestEntry.Snapshot.ID, "heap") {
-			profileType = "heap"
-		} else {
-			// Default profile type
-			profileType = "unknown"
-		}
+// profileTypeOf returns the profile type recorded at collection,
+// falling back to inferring it from the snapshot ID for snapshots collected without one
+func profileTypeOf(snapshot *collect.Snapshot) string {
+	if snapshot.SnapshotTarget != nil && snapshot.ProfileType != "" {
+		return snapshot.ProfileType
+	}
 
-		return fileContent, profileType, nil
+	switch {
+	case strings.Contains(snapshot.ID, "cpu"):
+		return "cpu"
+	case strings.Contains(snapshot.ID, "heap"):
+		return "heap"
+	default:
+		return "unknown"
 	}
+}
 
-	// Get raw file content
-	fileContent, _, err := getRawFileContent()
+// pprof file detailed JSON handler
+func handlePprofDetailedJSON(ctx context.Context, src source, groupID string) (string, string, error) {
+	latestEntry, err := findLatestEntry(ctx, src, "pprof", groupID)
 	if err != nil {
 		return "", "", err
 	}
+	return pprofDetailedJSON(ctx, src, latestEntry)
+}
 
-	// Convert to detailed JSON format
-	detailedJSON, err := pprof.ConvertToDetailedJSON(fileContent)
+// pprof file detailed JSON handler with specific entry ID
+func handlePprofDetailedJSONWithEntryID(ctx context.Context, src source, groupID, entryID string) (string, string, error) {
+	foundEntry, err := findEntry(ctx, src, "pprof", groupID, entryID)
 	if err != nil {
-		return "", "", fmt.Errorf("pprof JSON conversion error: %v", err)
+		return "", "", err
 	}
-
-	return detailedJSON, "application/json", nil
+	return pprofDetailedJSON(ctx, src, foundEntry)
 }
 
-// pprof file detailed JSON handler with specific entry ID
-func handlePprofDetailedJSONWithEntryID(port, groupID, entryID string) (string, string, error) {
-	// Helper function to get raw file content for specific entry ID
-	getRawFileContent := func() ([]byte, string, error) {
-		// Get ID from metadata first
-		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%s/api/pprof", port), nil)
-		if err != nil {
-			return nil, "", fmt.Errorf("error creating request: %v", err)
-		}
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, "", fmt.Errorf("error calling API: %v", err)
-		}
-		defer resp.Body.Close()
-
-		var entries []*collect.Entry
-		if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
-			return nil, "", fmt.Errorf("JSON decode error: %v", err)
-		}
-
-		// 指定されたグループIDとエントリIDの組み合わせを確認
-		var foundEntry *collect.Entry
-		for _, entry := range entries {
-			if entry.Snapshot != nil && entry.Snapshot.GroupId == groupID && entry.Snapshot.ID == entryID {
-				foundEntry = entry
-				break
-			}
-		}
-
-		if foundEntry == nil {
-			return nil, "", fmt.Errorf("no matching entry found: group_id=%s, entry_id=%s", groupID, entryID)
-		}
-
-		// Get data directly
-		dataURL := fmt.Sprintf("http://localhost:%s/api/pprof/data/%s", port, entryID)
-		log.Printf("Fetching data from: %s", dataURL)
-
-		dataResp, err := http.Get(dataURL)
-		if err != nil {
-			return nil, "", fmt.Errorf("error fetching data: %v", err)
-		}
-		defer dataResp.Body.Close()
-
-		if dataResp.StatusCode != http.StatusOK {
-			return nil, "", fmt.Errorf("unexpected status code from data endpoint: %d", dataResp.StatusCode)
-		}
-
-		fileContent, err := io.ReadAll(dataResp.Body)
-		if err != nil {
-			return nil, "", fmt.Errorf("error reading file content: %v", err)
-		}
+// detailedJSONMaxSamples caps the samples in the detailed JSON so that it fits in the context of the client
+const detailedJSONMaxSamples = 1000
 
-		// Profile type is inferred from file path
-		var profileType string
-		if strings.Contains(entryID, "cpu") {
-			profileType = "cpu"
-		} else if strings.Contains(entryID, "heap") {
-			profileType = "heap"
-		} else {
-			// Default profile type
-			profileType = "unknown"
-		}
-
-		return fileContent, profileType, nil
-	}
-
-	// Get raw file content for specific entry
-	fileContent, _, err := getRawFileContent()
+// pprofDetailedJSON converts the profile of the entry to the detailed JSON format
+func pprofDetailedJSON(ctx context.Context, src source, entry *collect.Entry) (string, string, error) {
+	fileContent, err := src.content(ctx, "pprof", entry.Snapshot.ID)
 	if err != nil {
 		return "", "", err
 	}
 
-	// Convert to detailed JSON format
-	detailedJSON, err := pprof.ConvertToDetailedJSON(fileContent)
+	detailedJSON, err := pprof.ConvertToDetailedJSONWithOptions(fileContent, pprof.Options{
+		MaxSamples: detailedJSONMaxSamples,
+		Source:     entry.Snapshot.Source(),
+	})
 	if err != nil {
 		return "", "", fmt.Errorf("pprof JSON conversion error: %v", err)
 	}
@@ -675,17 +673,16 @@ func handlePprofDetailedJSONWithEntryID(port, groupID, entryID string) (string,
 }
 
 // alp config file retrieval handler
-func handleGetAlpConfig(port string) (string, error) {
+func handleGetAlpConfig(ctx context.Context, port string) (string, error) {
 	log.Println("Executing alp_config_get function")
 
 	// Get API endpoint for config file
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%s/api/httplog/config", port), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://localhost:%s/api/httplog/config", port), nil)
 	if err != nil {
 		return "", fmt.Errorf("error creating request: %v", err)
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := doWithRetry(req)
 	if err != nil {
 		return "", fmt.Errorf("error fetching config: %v", err)
 	}
@@ -704,19 +701,18 @@ func handleGetAlpConfig(port string) (string, error) {
 }
 
 // alp config file update handler
-func handleUpdateAlpConfig(port string, config string) error {
+func handleUpdateAlpConfig(ctx context.Context, port string, config string) error {
 	log.Println("Executing alp_config_update function")
 
 	// API endpoint to update config file - use POST method
-	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://localhost:%s/api/httplog/config", port),
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://localhost:%s/api/httplog/config", port),
 		bytes.NewBufferString(config))
 	if err != nil {
 		return fmt.Errorf("error creating request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/yaml")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := doWithRetry(req)
 	if err != nil {
 		return fmt.Errorf("error updating config: %v", err)
 	}
@@ -730,93 +726,65 @@ func handleUpdateAlpConfig(port string, config string) error {
 	return nil
 }
 
-// pprof text report handler
-func handlePprofTextReport(port, groupID string) (string, string, error) {
-	// Helper function to get raw file content
-	getRawFileContent := func() ([]byte, string, error) {
-		// Get ID from metadata first
-		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%s/api/pprof", port), nil)
-		if err != nil {
-			return nil, "", fmt.Errorf("error creating request: %v", err)
-		}
+// pprof text report handler.
+// The report of the latest readable entry is at the top level, and the other pprof entries of the group
+// (e.g. the heap next to the cpu profile, or the profiles of the other servers) follow in other_entries
+// from the newest one, so that no entry is dropped silently.
+// An entry which cannot be reported is listed in other_entries with its error instead of failing the whole report.
+func handlePprofTextReport(ctx context.Context, src source, groupID string) (string, string, error) {
+	entries, err := findGroupEntries(ctx, src, "pprof", groupID)
+	if err != nil {
+		return "", "", err
+	}
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
+	var jsonWrapper map[string]interface{}
+	var firstErr error
+	others := []map[string]interface{}{}
+	for _, entry := range entries {
+		report, err := pprofTextReport(ctx, src, entry)
 		if err != nil {
-			return nil, "", fmt.Errorf("error calling API: %v", err)
-		}
-		defer resp.Body.Close()
-
-		var entries []*collect.Entry
-		if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
-			return nil, "", fmt.Errorf("JSON decode error: %v", err)
-		}
-
-		// Filter by group ID and get the latest entry
-		var latestEntry *collect.Entry
-		for _, entry := range entries {
-			if entry.Snapshot != nil && entry.Snapshot.GroupId == groupID {
-				if latestEntry == nil || entry.Snapshot.Datetime.After(latestEntry.Snapshot.Datetime) {
-					latestEntry = entry
-				}
+			log.Printf("[!] failed to report pprof entry %s: %v", entry.Snapshot.ID, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("entry %s: %w", entry.Snapshot.ID, err)
 			}
+			others = append(others, map[string]interface{}{"entry_id": entry.Snapshot.ID, "error": err.Error()})
+			continue
 		}
-
-		if latestEntry == nil {
-			return nil, "", fmt.Errorf("no matching entry found: group_id=%s", groupID)
-		}
-
-		// Get data directly
-		dataURL := fmt.Sprintf("http://localhost:%s/api/pprof/data/%s", port, latestEntry.Snapshot.ID)
-		log.Printf("Fetching data from: %s", dataURL)
-
-		dataResp, err := http.Get(dataURL)
-		if err != nil {
-			return nil, "", fmt.Errorf("error fetching data: %v", err)
-		}
-		defer dataResp.Body.Close()
-
-		if dataResp.StatusCode != http.StatusOK {
-			return nil, "", fmt.Errorf("unexpected status code from data endpoint: %d", dataResp.StatusCode)
-		}
-
-		fileContent, err := io.ReadAll(dataResp.Body)
-		if err != nil {
-			return nil, "", fmt.Errorf("error reading file content: %v", err)
-		}
-
-		// Profile type is inferred from file path
-		var profileType string
-		if strings.Contains(latestEntry.Snapshot.ID, "cpu") {
-			profileType = "cpu"
-		} else if strings.Contains(latestEntry.Snapshot.ID, "heap") {
-			profileType = "heap"
-		} else {
-			// Default profile type
-			profileType = "unknown"
+		report["entry_id"] = entry.Snapshot.ID
+		if jsonWrapper == nil {
+			jsonWrapper = report
+			continue
 		}
-
-		return fileContent, profileType, nil
+		others = append(others, report)
+	}
+	if jsonWrapper == nil {
+		return "", "", firstErr
+	}
+	if len(others) > 0 {
+		jsonWrapper["other_entries"] = others
 	}
 
-	// Get raw file content
-	fileContent, profileType, err := getRawFileContent()
+	// Convert to JSON
+	jsonData, err := json.MarshalIndent(jsonWrapper, "", "  ")
 	if err != nil {
-		return "", "", err
+		return "", "", fmt.Errorf("JSON marshaling error: %v", err)
 	}
 
-	// Convert to text report format
-	textReport, err := pprof.GenerateTextReport(fileContent)
+	return string(jsonData), "application/json", nil
+}
+
+// pprof text report handler with specific entry ID
+func handlePprofTextReportWithEntryID(ctx context.Context, src source, groupID, entryID string) (string, string, error) {
+	foundEntry, err := findEntry(ctx, src, "pprof", groupID, entryID)
 	if err != nil {
-		return "", "", fmt.Errorf("pprof text report generation error: %v", err)
+		return "", "", err
 	}
 
-	// Wrap the text report in JSON structure
-	jsonWrapper := map[string]interface{}{
-		"format":       "text_report",
-		"profile_type": profileType,
-		"report":       textReport,
+	jsonWrapper, err := pprofTextReport(ctx, src, foundEntry)
+	if err != nil {
+		return "", "", err
 	}
+	jsonWrapper["entry_id"] = entryID
 
 	// Convert to JSON
 	jsonData, err := json.MarshalIndent(jsonWrapper, "", "  ")
@@ -827,99 +795,26 @@ func handlePprofTextReport(port, groupID string) (string, string, error) {
 	return string(jsonData), "application/json", nil
 }
 
-// pprof text report handler with specific entry ID
-func handlePprofTextReportWithEntryID(port, groupID, entryID string) (string, string, error) {
-	// Helper function to get raw file content for specific entry ID
-	getRawFileContent := func() ([]byte, string, error) {
-		// Get ID from metadata first
-		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%s/api/pprof", port), nil)
-		if err != nil {
-			return nil, "", fmt.Errorf("error creating request: %v", err)
-		}
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, "", fmt.Errorf("error calling API: %v", err)
-		}
-		defer resp.Body.Close()
-
-		var entries []*collect.Entry
-		if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
-			return nil, "", fmt.Errorf("JSON decode error: %v", err)
-		}
-
-		// 指定されたグループIDとエントリIDの組み合わせを確認
-		var foundEntry *collect.Entry
-		for _, entry := range entries {
-			if entry.Snapshot != nil && entry.Snapshot.GroupId == groupID && entry.Snapshot.ID == entryID {
-				foundEntry = entry
-				break
-			}
-		}
-
-		if foundEntry == nil {
-			return nil, "", fmt.Errorf("no matching entry found: group_id=%s, entry_id=%s", groupID, entryID)
-		}
-
-		// Get data directly
-		dataURL := fmt.Sprintf("http://localhost:%s/api/pprof/data/%s", port, entryID)
-		log.Printf("Fetching data from: %s", dataURL)
-
-		dataResp, err := http.Get(dataURL)
-		if err != nil {
-			return nil, "", fmt.Errorf("error fetching data: %v", err)
-		}
-		defer dataResp.Body.Close()
-
-		if dataResp.StatusCode != http.StatusOK {
-			return nil, "", fmt.Errorf("unexpected status code from data endpoint: %d", dataResp.StatusCode)
-		}
-
-		fileContent, err := io.ReadAll(dataResp.Body)
-		if err != nil {
-			return nil, "", fmt.Errorf("error reading file content: %v", err)
-		}
-
-		// Profile type is inferred from file path
-		var profileType string
-		if strings.Contains(entryID, "cpu") {
-			profileType = "cpu"
-		} else if strings.Contains(entryID, "heap") {
-			profileType = "heap"
-		} else {
-			// Default profile type
-			profileType = "unknown"
-		}
-
-		return fileContent, profileType, nil
-	}
-
-	// Get raw file content for specific entry
-	fileContent, profileType, err := getRawFileContent()
+// pprofTextReport generates the text report of the entry wrapped in a JSON structure
+func pprofTextReport(ctx context.Context, src source, entry *collect.Entry) (map[string]interface{}, error) {
+	fileContent, err := src.content(ctx, "pprof", entry.Snapshot.ID)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
 	// Convert to text report format
 	textReport, err := pprof.GenerateTextReport(fileContent)
 	if err != nil {
-		return "", "", fmt.Errorf("pprof text report generation error: %v", err)
+		return nil, fmt.Errorf("pprof text report generation error: %v", err)
 	}
 
-	// Wrap the text report in JSON structure
-	jsonWrapper := map[string]interface{}{
+	result := map[string]interface{}{
 		"format":       "text_report",
-		"profile_type": profileType,
-		"entry_id":     entryID,
+		"profile_type": profileTypeOf(entry.Snapshot),
 		"report":       textReport,
 	}
-
-	// Convert to JSON
-	jsonData, err := json.MarshalIndent(jsonWrapper, "", "  ")
-	if err != nil {
-		return "", "", fmt.Errorf("JSON marshaling error: %v", err)
+	if entry.Snapshot.SnapshotTarget != nil && entry.Snapshot.Label != "" {
+		result["label"] = entry.Snapshot.Label
 	}
-
-	return string(jsonData), "application/json", nil
+	return result, nil
 }
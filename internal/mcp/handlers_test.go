@@ -0,0 +1,596 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/kaz/pprotein/internal/analyze/slowlog"
+	"github.com/kaz/pprotein/internal/analyze/trace"
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/kaz/pprotein/internal/event"
+	"github.com/kaz/pprotein/internal/storage"
+)
+
+// nopProcessor leaves snapshots unprocessed
+type nopProcessor struct{}
+
+func (nopProcessor) Process(snapshot *collect.Snapshot) (io.ReadCloser, error) {
+	return nil, nil
+}
+
+func (nopProcessor) Cacheable() bool {
+	return false
+}
+
+func TestPprofAnalysisUsesCollectedProfileType(t *testing.T) {
+	fn := &profile.Function{ID: 1, Name: "sync.(*Mutex).Lock"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "contentions", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}},
+		Function:   []*profile.Function{fn},
+		Location:   []*profile.Location{loc},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{1, 1000}}},
+	}
+	var profBuf bytes.Buffer
+	if err := prof.Write(&profBuf); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+
+	// Application exposing the mutex profile
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(profBuf.Bytes())
+	}))
+	defer app.Close()
+
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	collector, err := collect.New(nopProcessor{}, &collect.Options{
+		Type:     "pprof",
+		Ext:      "-pprof.pb.gz",
+		Store:    store,
+		EventHub: event.NewHub(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+
+	// The snapshot ID says nothing about the profile type
+	target := &collect.SnapshotTarget{GroupId: "group1", Label: "app", URL: app.URL + "/debug/pprof/mutex", Duration: 1, ProfileType: "mutex"}
+	if err := collector.Collect(target); err != nil {
+		t.Fatalf("Failed to collect profile: %v", err)
+	}
+
+	// pprotein API serving the collected snapshot
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := strings.CutPrefix(r.URL.Path, "/api/raw/pprof/"); ok {
+			path, err := store.GetFilePath(id)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			http.ServeFile(w, r, path)
+			return
+		}
+		json.NewEncoder(w).Encode(collector.List())
+	}))
+	defer api.Close()
+
+	apiURL, _ := url.Parse(api.URL)
+	result, _, err := handlePprofAnalysis(context.Background(), httpSource{port: apiURL.Port()}, "group1", "pprof", "")
+	if err != nil {
+		t.Fatalf("Failed to analyze profile: %v", err)
+	}
+
+	var analysis struct {
+		Metadata struct {
+			ProfileType string `json:"profileType"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal([]byte(result), &analysis); err != nil {
+		t.Fatalf("Failed to decode analysis: %v", err)
+	}
+	if analysis.Metadata.ProfileType != "mutex" {
+		t.Errorf("Profile type is different from expected. Expected: mutex, Actual: %s", analysis.Metadata.ProfileType)
+	}
+
+	// The profile type must survive reloading the snapshot metadata
+	snapshots, err := collect.LoadSnapshots(store, "pprof")
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("Failed to load snapshots: %v", err)
+	}
+	if got := profileTypeOf(snapshots[0]); got != "mutex" {
+		t.Errorf("Stored profile type is different from expected. Expected: mutex, Actual: %s", got)
+	}
+}
+
+func TestGroupFileInProcess(t *testing.T) {
+	fn := &profile.Function{ID: 1, Name: "main.handler"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}},
+		Function:   []*profile.Function{fn},
+		Location:   []*profile.Location{loc},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{1}}},
+	}
+	var profBuf bytes.Buffer
+	if err := prof.Write(&profBuf); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	traceContent, err := os.ReadFile("../analyze/trace/testdata/trace.out")
+	if err != nil {
+		t.Fatalf("Failed to read trace: %v", err)
+	}
+	for typ, content := range map[string][]byte{"pprof": profBuf.Bytes(), "memo": []byte("note"), "trace": traceContent} {
+		collector, err := collect.New(nopProcessor{}, &collect.Options{
+			Type:     typ,
+			Ext:      "-" + typ + ".log",
+			Store:    store,
+			EventHub: event.NewHub(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to create collector: %v", err)
+		}
+		target := &collect.SnapshotTarget{GroupId: "group1", Label: "app", ProfileType: "goroutine"}
+		if _, err := collector.Add(target, content); err != nil {
+			t.Fatalf("Failed to add %s: %v", typ, err)
+		}
+	}
+
+	// No API is listening on the port, so everything must be read from the store
+	src := newSource("1", store)
+
+	report, contentType, err := handleGroupFile(context.Background(), src, "group1", "pprof", "", "", false, slowlogFilter{})
+	if err != nil {
+		t.Fatalf("Failed to get pprof report: %v", err)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content type is different from expected. Expected: application/json, Actual: %s", contentType)
+	}
+	var wrapper struct {
+		ProfileType string `json:"profile_type"`
+		Report      string `json:"report"`
+	}
+	if err := json.Unmarshal(report, &wrapper); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if wrapper.ProfileType != "goroutine" || !strings.Contains(wrapper.Report, "main.handler") {
+		t.Errorf("Report is different from expected: %+v", wrapper)
+	}
+
+	memo, _, err := handleGroupFile(context.Background(), src, "group1", "memo", "", "", false, slowlogFilter{})
+	if err != nil {
+		t.Fatalf("Failed to get memo: %v", err)
+	}
+	if string(memo) != "note" {
+		t.Errorf("Memo is different from expected. Expected: note, Actual: %s", memo)
+	}
+
+	summary, contentType, err := handleGroupFile(context.Background(), src, "group1", "trace", "", "", false, slowlogFilter{})
+	if err != nil {
+		t.Fatalf("Failed to get trace summary: %v", err)
+	}
+	traceSummary := &trace.Summary{}
+	if contentType != "application/json" || json.Unmarshal(summary, traceSummary) != nil || traceSummary.Version != "go 1.26" {
+		t.Errorf("Trace summary is different from expected. Content type: %s, Summary: %.100s", contentType, summary)
+	}
+
+	if _, _, err := handleGroupFile(context.Background(), src, "group2", "memo", "", "", false, slowlogFilter{}); err == nil {
+		t.Errorf("Entry of an unknown group is found")
+	}
+}
+
+func TestGroupNoData(t *testing.T) {
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	// group1 only has a memo and group2 only has a pprof
+	for typ, groupID := range map[string]string{"memo": "group1", "pprof": "group2"} {
+		collector, err := collect.New(nopProcessor{}, &collect.Options{
+			Type:     typ,
+			Ext:      "-" + typ + ".log",
+			Store:    store,
+			EventHub: event.NewHub(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to create collector: %v", err)
+		}
+		if _, err := collector.Add(&collect.SnapshotTarget{GroupId: groupID, Label: "app"}, []byte("content")); err != nil {
+			t.Fatalf("Failed to add %s: %v", typ, err)
+		}
+	}
+	src := newSource("1", store)
+
+	tests := []struct {
+		name     string
+		groupID  string
+		fileType string
+		entryID  string
+		wantErr  bool
+	}{
+		{name: "Empty pprof", groupID: "group1", fileType: "pprof"},
+		{name: "Empty slowlog", groupID: "group1", fileType: "slowlog"},
+		{name: "Empty memo", groupID: "group2", fileType: "memo"},
+		{name: "Missing group", groupID: "group3", fileType: "memo", wantErr: true},
+		{name: "Missing entry", groupID: "group1", fileType: "memo", entryID: "unknown", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, contentType, err := handleGroupFile(context.Background(), src, tt.groupID, tt.fileType, tt.entryID, "", false, slowlogFilter{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("handleGroupFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var noData map[string]interface{}
+			if contentType != "application/json" || json.Unmarshal(result, &noData) != nil {
+				t.Fatalf("Result is not JSON: %s", result)
+			}
+			if noData["status"] != statusNoData || noData["group_id"] != tt.groupID || noData["type"] != tt.fileType {
+				t.Errorf("Result is different from expected: %v", noData)
+			}
+		})
+	}
+
+	// pprotein API serving the same entries
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entries, err := src.entries(r.Context(), strings.TrimPrefix(r.URL.Path, "/api/"))
+		if err != nil {
+			entries = []*collect.Entry{}
+		}
+		json.NewEncoder(w).Encode(entries)
+	}))
+	defer api.Close()
+	apiURL, _ := url.Parse(api.URL)
+
+	for groupID, expected := range map[string]string{"group1": statusOK, "group3": statusNoData} {
+		result, err := handleGroupData(context.Background(), apiURL.Port(), groupID)
+		if err != nil {
+			t.Fatalf("Failed to get data of %s: %v", groupID, err)
+		}
+		if status := result.(map[string]interface{})["status"]; status != expected {
+			t.Errorf("Status of %s is different from expected. Expected: %s, Actual: %v", groupID, expected, status)
+		}
+	}
+}
+
+func TestPprofTextReportMultipleEntries(t *testing.T) {
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	collector, err := collect.New(nopProcessor{}, &collect.Options{
+		Type:     "pprof",
+		Ext:      "-pprof.pb.gz",
+		Store:    store,
+		EventHub: event.NewHub(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+
+	// A cpu profile of one server and a heap profile of another in the same group
+	for _, p := range []struct{ label, profileType, function string }{
+		{"web1", "profile", "main.render"},
+		{"web2", "heap", "main.allocate"},
+	} {
+		fn := &profile.Function{ID: 1, Name: p.function}
+		loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+		prof := &profile.Profile{
+			SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}},
+			Function:   []*profile.Function{fn},
+			Location:   []*profile.Location{loc},
+			Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{1}}},
+		}
+		var profBuf bytes.Buffer
+		if err := prof.Write(&profBuf); err != nil {
+			t.Fatalf("Failed to write profile: %v", err)
+		}
+		target := &collect.SnapshotTarget{GroupId: "group1", Label: p.label, ProfileType: p.profileType}
+		if _, err := collector.Add(target, profBuf.Bytes()); err != nil {
+			t.Fatalf("Failed to add profile: %v", err)
+		}
+	}
+
+	result, _, err := handleGroupFile(context.Background(), newSource("1", store), "group1", "pprof", "", "", false, slowlogFilter{})
+	if err != nil {
+		t.Fatalf("Failed to get pprof report: %v", err)
+	}
+
+	type report struct {
+		EntryID     string `json:"entry_id"`
+		Label       string `json:"label"`
+		ProfileType string `json:"profile_type"`
+		Report      string `json:"report"`
+	}
+	var wrapper struct {
+		report
+		OtherEntries []report `json:"other_entries"`
+	}
+	if err := json.Unmarshal(result, &wrapper); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if len(wrapper.OtherEntries) != 1 {
+		t.Fatalf("Other entries are different from expected. Expected: 1, Actual: %d", len(wrapper.OtherEntries))
+	}
+
+	reports := map[string]report{}
+	for _, r := range []report{wrapper.report, wrapper.OtherEntries[0]} {
+		if r.EntryID == "" {
+			t.Errorf("Entry ID is missing: %+v", r)
+		}
+		reports[r.Label] = r
+	}
+	if r := reports["web1"]; r.ProfileType != "profile" || !strings.Contains(r.Report, "main.render") {
+		t.Errorf("Report of web1 is different from expected: %+v", r)
+	}
+	if r := reports["web2"]; r.ProfileType != "heap" || !strings.Contains(r.Report, "main.allocate") {
+		t.Errorf("Report of web2 is different from expected: %+v", r)
+	}
+}
+
+func TestGroupLatest(t *testing.T) {
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	collectors := map[string]*collect.Collector{}
+	for _, typ := range []string{"pprof", "memo"} {
+		collectors[typ], err = collect.New(nopProcessor{}, &collect.Options{
+			Type:     typ,
+			Ext:      "-" + typ + ".log",
+			Store:    store,
+			EventHub: event.NewHub(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to create collector: %v", err)
+		}
+	}
+
+	// The newest group is collected in the middle, so the order of collection must not matter
+	entries := []struct {
+		groupID string
+		typ     string
+	}{
+		{"2024-01-01_10-00-00", "pprof"},
+		{"2024-01-02_09-00-00", "pprof"},
+		{"2024-01-02_09-00-00", "memo"},
+		{"2024-01-02_09-00-00", "memo"},
+		{"2024-01-01_23-00-00", "memo"},
+	}
+	for _, entry := range entries {
+		target := &collect.SnapshotTarget{GroupId: entry.groupID, Label: "app"}
+		if _, err := collectors[entry.typ].Add(target, []byte("content")); err != nil {
+			t.Fatalf("Failed to add %s: %v", entry.typ, err)
+		}
+	}
+
+	result, err := handleGroupLatest(context.Background(), newSource("1", store))
+	if err != nil {
+		t.Fatalf("Failed to get latest group: %v", err)
+	}
+
+	latest := result.(map[string]interface{})
+	if latest["group_id"] != "2024-01-02_09-00-00" {
+		t.Errorf("Group ID is different from expected. Expected: 2024-01-02_09-00-00, Actual: %v", latest["group_id"])
+	}
+	expected := "Group 2024-01-02_09-00-00 contains pprof: 1, memo: 2"
+	if latest["summary"] != expected {
+		t.Errorf("Summary is different from expected. Expected: %s, Actual: %v", expected, latest["summary"])
+	}
+}
+
+func TestGroupFileFormat(t *testing.T) {
+	fn := &profile.Function{ID: 1, Name: "main.handler"}
+	mapping := &profile.Mapping{ID: 1, File: "app"}
+	loc := &profile.Location{ID: 1, Mapping: mapping, Line: []profile.Line{{Function: fn}}}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Mapping:    []*profile.Mapping{mapping},
+		Function:   []*profile.Function{fn},
+		Location:   []*profile.Location{loc},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{1000}}},
+	}
+	var profBuf bytes.Buffer
+	if err := prof.Write(&profBuf); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	collector, err := collect.New(nopProcessor{}, &collect.Options{
+		Type:     "pprof",
+		Ext:      "-pprof.pb.gz",
+		Store:    store,
+		EventHub: event.NewHub(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+	snapshot, err := collector.Add(&collect.SnapshotTarget{GroupId: "group1", Label: "app", ProfileType: "cpu"}, profBuf.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to add profile: %v", err)
+	}
+
+	src := newSource("1", store)
+
+	tests := []struct {
+		name     string
+		fileType string
+		entryID  string
+		format   string
+		key      string
+		wantErr  bool
+	}{
+		{name: "Default", fileType: "pprof", key: "report"},
+		{name: "Text", fileType: "pprof", format: "text", key: "report"},
+		{name: "Text with entry ID", fileType: "pprof", entryID: snapshot.ID, format: "text", key: "entry_id"},
+		{name: "Speedscope", fileType: "pprof", format: "speedscope", key: "metadata"},
+		{name: "Detailed JSON", fileType: "pprof", format: " Detailed_JSON ", key: "sampleType"},
+		{name: "Detailed JSON with entry ID", fileType: "pprof", entryID: snapshot.ID, format: "detailed_json", key: "sampleType"},
+		{name: "Unknown format", fileType: "pprof", format: "flamegraph", wantErr: true},
+		{name: "Format for other types", fileType: "memo", format: "text", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _, err := handleGroupFile(context.Background(), src, "group1", tt.fileType, tt.entryID, tt.format, false, slowlogFilter{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("handleGroupFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var decoded map[string]interface{}
+			if err := json.Unmarshal(result, &decoded); err != nil {
+				t.Fatalf("Failed to decode result: %v", err)
+			}
+			if _, ok := decoded[tt.key]; !ok {
+				t.Errorf("Result does not contain %q: %s", tt.key, result)
+			}
+		})
+	}
+}
+
+func TestGroupFileSlowlogFilter(t *testing.T) {
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	collector, err := collect.New(nopProcessor{}, &collect.Options{Type: "slowlog", Ext: "-slowlog.log", Store: store, EventHub: event.NewHub()})
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+	slowLog := []byte(`# Time: 2023-04-01T12:00:00.000000Z
+# Query_time: 0.300000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 10
+SELECT * FROM users WHERE id = 1;
+# Time: 2023-04-01T12:00:01.000000Z
+# Query_time: 0.100000  Lock_time: 0.000010 Rows_sent: 0  Rows_examined: 0
+COMMIT;
+`)
+	if _, err := collector.Add(&collect.SnapshotTarget{GroupId: "group1", Label: "db"}, slowLog); err != nil {
+		t.Fatalf("Failed to add slowlog: %v", err)
+	}
+	src := newSource("1", store)
+
+	tests := []struct {
+		name     string
+		args     map[string]interface{}
+		fileType string
+		expected int // Queries counted
+		wantErr  bool
+	}{
+		{name: "No filter", args: map[string]interface{}{}, fileType: "slowlog", expected: 2},
+		{name: "From", args: map[string]interface{}{"from": "2023-04-01T12:00:00.5Z"}, fileType: "slowlog", expected: 1},
+		{name: "Exclude", args: map[string]interface{}{"exclude": []interface{}{"^commit"}}, fileType: "slowlog", expected: 1},
+		{name: "Malformed to", args: map[string]interface{}{"to": "noon"}, fileType: "slowlog", wantErr: true},
+		{name: "Invalid exclude", args: map[string]interface{}{"exclude": []interface{}{"("}}, fileType: "slowlog", wantErr: true},
+		{name: "Exclude not an array", args: map[string]interface{}{"exclude": "^commit"}, fileType: "slowlog", wantErr: true},
+		{name: "Filter of another type", args: map[string]interface{}{"exclude": []interface{}{"^commit"}}, fileType: "memo", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := parseSlowlogFilter(tt.args)
+			if err == nil {
+				var result []byte
+				result, _, err = handleGroupFile(context.Background(), src, "group1", tt.fileType, "", "", false, filter)
+				if err == nil {
+					analysis := &slowlog.AnalysisResult{}
+					if err := json.Unmarshal(result, analysis); err != nil {
+						t.Fatalf("Failed to decode analysis: %v", err)
+					}
+					if analysis.TotalQueries != tt.expected {
+						t.Errorf("Query count is different from expected. Expected: %d, Actual: %d", tt.expected, analysis.TotalQueries)
+					}
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Error is different from expected. Expected error: %v, Actual: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPprofTextReportUnreadableEntry(t *testing.T) {
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	collector, err := collect.New(nopProcessor{}, &collect.Options{
+		Type:     "pprof",
+		Ext:      "-pprof.pb.gz",
+		Store:    store,
+		EventHub: event.NewHub(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+
+	fn := &profile.Function{ID: 1, Name: "main.render"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}},
+		Function:   []*profile.Function{fn},
+		Location:   []*profile.Location{loc},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{1}}},
+	}
+	var profBuf bytes.Buffer
+	if err := prof.Write(&profBuf); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+	if _, err := collector.Add(&collect.SnapshotTarget{GroupId: "group1", Label: "web1"}, profBuf.Bytes()); err != nil {
+		t.Fatalf("Failed to add profile: %v", err)
+	}
+	// The latest entry is broken
+	broken, err := collector.Add(&collect.SnapshotTarget{GroupId: "group1", Label: "web2"}, []byte("not a profile"))
+	if err != nil {
+		t.Fatalf("Failed to add profile: %v", err)
+	}
+
+	result, _, err := handleGroupFile(context.Background(), newSource("1", store), "group1", "pprof", "", "", false, slowlogFilter{})
+	if err != nil {
+		t.Fatalf("Failed to get pprof report: %v", err)
+	}
+
+	var wrapper struct {
+		Label        string `json:"label"`
+		Report       string `json:"report"`
+		OtherEntries []struct {
+			EntryID string `json:"entry_id"`
+			Error   string `json:"error"`
+		} `json:"other_entries"`
+	}
+	if err := json.Unmarshal(result, &wrapper); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if wrapper.Label != "web1" || !strings.Contains(wrapper.Report, "main.render") {
+		t.Errorf("Report of the readable entry is different from expected: %+v", wrapper)
+	}
+	if len(wrapper.OtherEntries) != 1 || wrapper.OtherEntries[0].EntryID != broken.ID || wrapper.OtherEntries[0].Error == "" {
+		t.Errorf("Unreadable entry is not listed with its error: %+v", wrapper.OtherEntries)
+	}
+}
@@ -2,25 +2,137 @@ package mcp
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
+	"github.com/kaz/pprotein/internal/libmcp"
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
+// Environment variable specifying how long to wait for the MySQL server on connect as a duration (e.g. 5s)
+const MySQLConnectTimeoutEnv = "PPROTEIN_MYSQL_CONNECT_TIMEOUT"
+
+// Connect timeout used when MySQLConnectTimeoutEnv is not set
+const defaultMySQLConnectTimeout = 10 * time.Second
+
+// mysqlConnectTimeoutFromEnv returns the timeout of connecting to the MySQL server
+func mysqlConnectTimeoutFromEnv() time.Duration {
+	v := os.Getenv(MySQLConnectTimeoutEnv)
+	if v == "" {
+		return defaultMySQLConnectTimeout
+	}
+
+	timeout, err := time.ParseDuration(v)
+	if err != nil || timeout <= 0 {
+		log.Printf("[!] invalid %s %q, using %v", MySQLConnectTimeoutEnv, v, defaultMySQLConnectTimeout)
+		return defaultMySQLConnectTimeout
+	}
+	return timeout
+}
+
+// mysqlDSN returns the DSN of the database on the MySQL server of conn, whose dial gives up after the connect timeout
+func mysqlDSN(conn *MySQLConnection, database string) string {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?timeout=%s",
+		conn.Username, conn.Password, conn.Host, conn.Port, database, mysqlConnectTimeoutFromEnv())
+	if conn.TLS != "" {
+		dsn += "&tls=" + url.QueryEscape(conn.TLS)
+	}
+	return dsn
+}
+
+// TLS modes of mysql_connect and the corresponding tls options of the DSN
+var mysqlTLSModes = map[string]string{
+	"disabled":    "false",
+	"preferred":   "preferred", // TLS if the server supports it, without verifying the certificate
+	"required":    "true",
+	"skip-verify": "skip-verify",
+}
+
+// mysqlTLSOption returns the tls option of the DSN for the TLS mode.
+// With the path of a CA certificate, a TLS config trusting it is registered to the driver and its name is returned,
+// in which case the mode must be required (or empty) since the certificate is always verified.
+func mysqlTLSOption(mode, caPath string) (string, error) {
+	if caPath == "" {
+		if mode == "" {
+			return "", nil
+		}
+		option, ok := mysqlTLSModes[mode]
+		if !ok {
+			return "", fmt.Errorf("Unknown TLS mode '%s', must be one of disabled, preferred, required and skip-verify", mode)
+		}
+		return option, nil
+	}
+
+	if mode != "" && mode != "required" {
+		return "", fmt.Errorf("A CA certificate can only be used with the TLS mode 'required'")
+	}
+	pem, err := os.ReadFile(caPath)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read CA certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return "", fmt.Errorf("No certificate found in %s", caPath)
+	}
+
+	// The same CA is registered under the same name, so reconnecting doesn't pile up configs
+	name := fmt.Sprintf("pprotein-%x", sha256.Sum256(pem))[:25]
+	if err := mysql.RegisterTLSConfig(name, &tls.Config{RootCAs: pool}); err != nil {
+		return "", fmt.Errorf("Failed to register TLS config: %v", err)
+	}
+	return name, nil
+}
+
 // MySQL connection handler
 func handleMySQLConnect(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	log.Println("Connecting to MySQL")
 
 	// Get parameters
+	connectionName, _ := request.Params.Arguments["connection"].(string)
 	host, _ := request.Params.Arguments["host"].(string)
 	port, _ := request.Params.Arguments["port"].(string)
 	username, _ := request.Params.Arguments["username"].(string)
 	password, _ := request.Params.Arguments["password"].(string)
 	database, _ := request.Params.Arguments["database"].(string)
+	tlsMode, _ := request.Params.Arguments["tls"].(string)
+	tlsCA, _ := request.Params.Arguments["tls_ca"].(string)
+
+	tlsOption, err := mysqlTLSOption(tlsMode, tlsCA)
+	if err != nil {
+		return nil, err
+	}
+
+	// If connection name is specified, fill in the missing parameters from it
+	if connectionName != "" {
+		conn, exists := getMySQLConnection(connectionName)
+		if !exists {
+			return nil, fmt.Errorf("The specified connection setting '%s' does not exist", connectionName)
+		}
+
+		host = conn.Host
+		port = conn.Port
+		username = conn.Username
+		if password == "" {
+			password = conn.Password
+		}
+		if database == "" {
+			database = conn.Database
+		}
+		if tlsMode == "" && tlsCA == "" {
+			tlsOption = conn.TLS
+		}
+	}
 
 	// Check required parameters
 	if host == "" || username == "" || password == "" {
@@ -28,17 +140,18 @@ func handleMySQLConnect(ctx context.Context, request mcp.CallToolRequest) (*mcp.
 	}
 
 	// Save connection information
-	activeConnection = &MySQLConnection{
+	conn := &MySQLConnection{
 		Host:     host,
 		Port:     port,
 		Username: username,
 		Password: password,
 		Database: database,
+		TLS:      tlsOption,
 	}
+	setActiveConnection(conn)
 
 	// Test connection
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s",
-		username, password, host, port, database)
+	dsn := mysqlDSN(conn, database)
 
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
@@ -46,8 +159,14 @@ func handleMySQLConnect(ctx context.Context, request mcp.CallToolRequest) (*mcp.
 	}
 	defer db.Close()
 
-	// Test connection (Ping)
-	if err := db.Ping(); err != nil {
+	// Test connection (Ping), giving up on unreachable hosts after the connect timeout
+	timeout := mysqlConnectTimeoutFromEnv()
+	pingCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := db.PingContext(pingCtx); err != nil {
+		if errors.Is(pingCtx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("Timed out connecting to MySQL server %s:%s after %v", host, port, timeout)
+		}
 		return nil, fmt.Errorf("Failed to ping MySQL server: %v", err)
 	}
 
@@ -57,6 +176,7 @@ func handleMySQLConnect(ctx context.Context, request mcp.CallToolRequest) (*mcp.
 		"port":     port,
 		"username": username,
 		"database": database,
+		"tls":      tlsOption,
 	}
 
 	jsonData, err := json.Marshal(result)
@@ -67,86 +187,60 @@ func handleMySQLConnect(ctx context.Context, request mcp.CallToolRequest) (*mcp.
 	return mcp.NewToolResultText(string(jsonData)), nil
 }
 
-// MySQL query execution handler
+// MySQL query execution handler.
+// With format=ndjson, the rows are returned as NDJSON (one JSON object per line) instead of a JSON document.
+// A tool result is held in memory as a whole, so it is capped at ndjsonToolMaxRows rows;
+// larger results have to be streamed with POST /mysql/query.
 func handleMySQLQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	log.Println("Executing MySQL query")
 
 	// Check connection
-	if activeConnection == nil {
+	conn := getActiveConnection()
+	if conn == nil {
 		return nil, fmt.Errorf("Not connected to MySQL. Please run mysql_connect first")
 	}
 
 	// Get parameters
 	sqlQuery, _ := request.Params.Arguments["sql"].(string)
+	sample, _ := request.Params.Arguments["sample"].(float64)
+	format, _ := request.Params.Arguments["format"].(string)
 
 	if sqlQuery == "" {
 		return nil, fmt.Errorf("SQL query is required")
 	}
+	if format != "" && format != "json" && format != "ndjson" {
+		return nil, fmt.Errorf("Unknown format '%s', must be json or ndjson", format)
+	}
 
-	// Create DSN (Data Source Name)
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s",
-		activeConnection.Username,
-		activeConnection.Password,
-		activeConnection.Host,
-		activeConnection.Port,
-		activeConnection.Database)
-
-	// Database connection
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, fmt.Errorf("MySQL connection error: %v", err)
+	// Rewrite simple selects into a random sample if requested
+	sampled := false
+	if sample > 0 {
+		sqlQuery, sampled = buildSampleQuery(sqlQuery, int(sample))
 	}
-	defer db.Close()
 
-	// Execute query
-	rows, err := db.Query(sqlQuery)
+	db, rows, err := queryMySQL(ctx, conn, sqlQuery)
 	if err != nil {
-		return nil, fmt.Errorf("Query execution error: %v", err)
+		return nil, err
 	}
+	defer db.Close()
 	defer rows.Close()
 
-	// Get column names
-	columns, err := rows.Columns()
-	if err != nil {
-		return nil, fmt.Errorf("Error getting column information: %v", err)
+	if format == "ndjson" {
+		result, err := bufferNDJSON(rows)
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(result), nil
 	}
 
 	// Slice to store results
 	var results []map[string]interface{}
-
-	// Buffer for scanning row data
-	values := make([]interface{}, len(columns))
-	valuePtrs := make([]interface{}, len(columns))
-	for i := range columns {
-		valuePtrs[i] = &values[i]
-	}
-
-	// Get row data
-	for rows.Next() {
-		err := rows.Scan(valuePtrs...)
-		if err != nil {
-			return nil, fmt.Errorf("Data scan error: %v", err)
-		}
-
-		// Convert row data to map
-		row := make(map[string]interface{})
-		for i, col := range columns {
-			val := values[i]
-
-			// Convert byte array to string
-			if b, ok := val.([]byte); ok {
-				row[col] = string(b)
-			} else {
-				row[col] = val
-			}
-		}
-
+	columns, err := forEachRow(rows, func(row map[string]interface{}) error {
 		results = append(results, row)
-	}
-
-	// Error check
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("Error during query execution: %v", err)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// Return results in JSON format
@@ -155,6 +249,9 @@ func handleMySQLQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.Ca
 		"rows":    results,
 		"count":   len(results),
 	}
+	if sample > 0 {
+		response["sampled"] = sampled
+	}
 
 	jsonData, err := json.Marshal(response)
 	if err != nil {
@@ -164,21 +261,56 @@ func handleMySQLQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.Ca
 	return mcp.NewToolResultText(string(jsonData)), nil
 }
 
+// registerMySQLConnections registers the named MySQL connections loaded from the connections config file.
+// Connections with invalid TLS settings are skipped.
+func registerMySQLConnections(configs []libmcp.MySQLConnectionConfig) {
+	for _, c := range configs {
+		tlsOption, err := mysqlTLSOption(c.TLS, c.TLSCA)
+		if err != nil {
+			log.Printf("Warning: Skipping MySQL connection '%s' from config: %v", c.Name, err)
+			continue
+		}
+		mysqlConnections.StorePinned(c.Name, &MySQLConnection{
+			Host:     c.Host,
+			Port:     c.Port,
+			Username: c.Username,
+			Password: c.Password,
+			Database: c.Database,
+			TLS:      tlsOption,
+		})
+		log.Printf("MySQL connection setting '%s' has been registered", c.Name)
+	}
+}
+
+// Pattern matching a bare "SELECT * FROM table" statement
+var simpleSelectPattern = regexp.MustCompile("(?is)^\\s*SELECT\\s+\\*\\s+FROM\\s+(`?[\\w$]+`?(?:\\.`?[\\w$]+`?)?)\\s*;?\\s*$")
+
+// buildSampleQuery rewrites a bare "SELECT * FROM table" into a query returning n random rows.
+// Any other statement is returned unchanged.
+func buildSampleQuery(sqlQuery string, n int) (string, bool) {
+	if n <= 0 {
+		return sqlQuery, false
+	}
+
+	m := simpleSelectPattern.FindStringSubmatch(sqlQuery)
+	if m == nil {
+		return sqlQuery, false
+	}
+	return fmt.Sprintf("SELECT * FROM %s ORDER BY RAND() LIMIT %d", m[1], n), true
+}
+
 // Database list retrieval handler
 func handleMySQLListDatabases(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	log.Println("Retrieving MySQL database list")
 
 	// Check connection
-	if activeConnection == nil {
+	conn := getActiveConnection()
+	if conn == nil {
 		return nil, fmt.Errorf("Not connected to MySQL. Please run mysql_connect first")
 	}
 
 	// Create DSN (Data Source Name)
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/",
-		activeConnection.Username,
-		activeConnection.Password,
-		activeConnection.Host,
-		activeConnection.Port)
+	dsn := mysqlDSN(conn, "")
 
 	// Database connection
 	db, err := sql.Open("mysql", dsn)
@@ -188,7 +320,7 @@ func handleMySQLListDatabases(ctx context.Context, request mcp.CallToolRequest)
 	defer db.Close()
 
 	// Database list retrieval query
-	rows, err := db.Query("SHOW DATABASES")
+	rows, err := db.QueryContext(ctx, "SHOW DATABASES")
 	if err != nil {
 		return nil, fmt.Errorf("Error retrieving database list: %v", err)
 	}
@@ -230,7 +362,8 @@ func handleMySQLListTables(ctx context.Context, request mcp.CallToolRequest) (*m
 	log.Println("Retrieving MySQL table list")
 
 	// Check connection
-	if activeConnection == nil {
+	conn := getActiveConnection()
+	if conn == nil {
 		return nil, fmt.Errorf("Not connected to MySQL. Please run mysql_connect first")
 	}
 
@@ -239,19 +372,14 @@ func handleMySQLListTables(ctx context.Context, request mcp.CallToolRequest) (*m
 
 	// If database name is not specified, use the database of the current connection
 	if dbName == "" {
-		dbName = activeConnection.Database
+		dbName = conn.Database
 		if dbName == "" {
 			return nil, fmt.Errorf("Database not specified")
 		}
 	}
 
 	// Create DSN (Data Source Name)
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s",
-		activeConnection.Username,
-		activeConnection.Password,
-		activeConnection.Host,
-		activeConnection.Port,
-		dbName)
+	dsn := mysqlDSN(conn, dbName)
 
 	// Database connection
 	db, err := sql.Open("mysql", dsn)
@@ -261,7 +389,7 @@ func handleMySQLListTables(ctx context.Context, request mcp.CallToolRequest) (*m
 	defer db.Close()
 
 	// Table list retrieval query
-	rows, err := db.Query("SHOW TABLES")
+	rows, err := db.QueryContext(ctx, "SHOW TABLES")
 	if err != nil {
 		return nil, fmt.Errorf("Error retrieving table list: %v", err)
 	}
@@ -304,7 +432,8 @@ func handleMySQLDescribeTable(ctx context.Context, request mcp.CallToolRequest)
 	log.Println("Retrieving MySQL table details")
 
 	// Check connection
-	if activeConnection == nil {
+	conn := getActiveConnection()
+	if conn == nil {
 		return nil, fmt.Errorf("Not connected to MySQL. Please run mysql_connect first")
 	}
 
@@ -316,18 +445,13 @@ func handleMySQLDescribeTable(ctx context.Context, request mcp.CallToolRequest)
 	}
 
 	// Check database name
-	dbName := activeConnection.Database
+	dbName := conn.Database
 	if dbName == "" {
 		return nil, fmt.Errorf("Database not specified")
 	}
 
 	// Create DSN (Data Source Name)
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s",
-		activeConnection.Username,
-		activeConnection.Password,
-		activeConnection.Host,
-		activeConnection.Port,
-		dbName)
+	dsn := mysqlDSN(conn, dbName)
 
 	// Database connection
 	db, err := sql.Open("mysql", dsn)
@@ -337,7 +461,7 @@ func handleMySQLDescribeTable(ctx context.Context, request mcp.CallToolRequest)
 	defer db.Close()
 
 	// Table details retrieval query
-	rows, err := db.Query(fmt.Sprintf("DESCRIBE %s", tableName))
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("DESCRIBE %s", tableName))
 	if err != nil {
 		return nil, fmt.Errorf("Error retrieving table details: %v", err)
 	}
@@ -0,0 +1,269 @@
+package mcp
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/kaz/pprotein/internal/libmcp"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestBuildSampleQuery(t *testing.T) {
+	tests := []struct {
+		name        string
+		sql         string
+		n           int
+		wantSampled bool
+		wantQuery   string
+	}{
+		{
+			name:        "Simple select",
+			sql:         "SELECT * FROM users",
+			n:           10,
+			wantSampled: true,
+			wantQuery:   "SELECT * FROM users ORDER BY RAND() LIMIT 10",
+		},
+		{
+			name:        "Qualified table with trailing semicolon",
+			sql:         "select * from `isupipe`.`livestreams`;",
+			n:           5,
+			wantSampled: true,
+			wantQuery:   "SELECT * FROM `isupipe`.`livestreams` ORDER BY RAND() LIMIT 5",
+		},
+		{
+			name:        "Select with WHERE clause is not rewritten",
+			sql:         "SELECT * FROM users WHERE id = 1",
+			n:           10,
+			wantSampled: false,
+			wantQuery:   "SELECT * FROM users WHERE id = 1",
+		},
+		{
+			name:        "Non-positive sample size is ignored",
+			sql:         "SELECT * FROM users",
+			n:           0,
+			wantSampled: false,
+			wantQuery:   "SELECT * FROM users",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, sampled := buildSampleQuery(tt.sql, tt.n)
+			if sampled != tt.wantSampled {
+				t.Errorf("buildSampleQuery() sampled = %v, want %v", sampled, tt.wantSampled)
+			}
+			if got != tt.wantQuery {
+				t.Errorf("buildSampleQuery() = %q, want %q", got, tt.wantQuery)
+			}
+			if sampled && !strings.HasSuffix(got, fmt.Sprintf(" LIMIT %d", tt.n)) {
+				t.Errorf("Sampled query is not capped at %d rows: %q", tt.n, got)
+			}
+		})
+	}
+}
+
+func TestRegisterMySQLConnections(t *testing.T) {
+	registerMySQLConnections([]libmcp.MySQLConnectionConfig{
+		{Name: "isu1-db", Host: "192.168.0.11", Port: "3306", Username: "isucon", Password: "isucon", Database: "isupipe"},
+	})
+
+	conn, ok := getMySQLConnection("isu1-db")
+	if !ok {
+		t.Fatalf("MySQL connection isu1-db is not registered")
+	}
+	if conn.Host != "192.168.0.11" || conn.Database != "isupipe" {
+		t.Errorf("Unexpected MySQL connection: %+v", conn)
+	}
+}
+
+func TestMySQLConnectionLimits(t *testing.T) {
+	active, named := activeConnections, mysqlConnections
+	t.Cleanup(func() { activeConnections, mysqlConnections = active, named })
+	limits := libmcp.RegistryLimits{MaxEntries: 1, IdleTTL: 10 * time.Millisecond}
+	activeConnections = libmcp.NewRegistry[*MySQLConnection](limits, nil)
+	mysqlConnections = libmcp.NewRegistry[*MySQLConnection](limits, nil)
+
+	registerMySQLConnections([]libmcp.MySQLConnectionConfig{
+		{Name: "isu1-db", Host: "192.168.0.11", Port: "3306", Username: "isucon", Password: "isucon"},
+		{Name: "isu2-db", Host: "192.168.0.12", Port: "3306", Username: "isucon", Password: "isucon"},
+	})
+	setActiveConnection(&MySQLConnection{Host: "192.168.0.11", Port: "3306", Username: "isucon", Password: "isucon"})
+	time.Sleep(20 * time.Millisecond)
+
+	// The runtime connection expires, while the ones from the config file are kept over the limits
+	if conn := getActiveConnection(); conn != nil {
+		t.Errorf("Idle active connection is not dropped: %+v", conn)
+	}
+	for _, name := range []string{"isu1-db", "isu2-db"} {
+		if _, ok := getMySQLConnection(name); !ok {
+			t.Errorf("MySQL connection %s from the config is dropped", name)
+		}
+	}
+}
+
+func TestMySQLConnectByNameWithTLS(t *testing.T) {
+	registerMySQLConnections([]libmcp.MySQLConnectionConfig{
+		{Name: "tls-db", Host: "127.0.0.1", Port: "1", Username: "isucon", Password: "isucon", TLS: "skip-verify"},
+		{Name: "bad-tls-db", Host: "127.0.0.1", Port: "1", Username: "isucon", Password: "isucon", TLS: "always"},
+	})
+	if _, ok := getMySQLConnection("bad-tls-db"); ok {
+		t.Errorf("Connection with an invalid TLS mode is registered")
+	}
+
+	tests := []struct {
+		name    string
+		tls     string
+		wantTLS string
+	}{
+		{name: "TLS of the connection settings", wantTLS: "skip-verify"},
+		{name: "TLS overridden", tls: "required", wantTLS: "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Nothing listens on port 1, so the connection fails after the settings are resolved
+			request := mcp.CallToolRequest{}
+			request.Params.Arguments = map[string]interface{}{"connection": "tls-db"}
+			if tt.tls != "" {
+				request.Params.Arguments["tls"] = tt.tls
+			}
+			handleMySQLConnect(context.Background(), request)
+
+			conn := getActiveConnection()
+			if conn == nil || conn.TLS != tt.wantTLS {
+				t.Fatalf("TLS of the active connection is different from expected. Expected: %s, Actual: %+v", tt.wantTLS, conn)
+			}
+			if dsn := mysqlDSN(conn, ""); !strings.Contains(dsn, "&tls="+tt.wantTLS) {
+				t.Errorf("DSN doesn't carry the tls option: %s", dsn)
+			}
+		})
+	}
+}
+
+func TestMySQLConnectionConcurrentAccess(t *testing.T) {
+	registerMySQLConnections([]libmcp.MySQLConnectionConfig{
+		{Name: "race-db", Host: "127.0.0.1", Port: "1", Username: "isucon", Password: "isucon", Database: "isupipe"},
+	})
+
+	// Nothing listens on port 1, so every call fails fast after touching the shared connection state
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			request := mcp.CallToolRequest{}
+			request.Params.Arguments = map[string]interface{}{"connection": "race-db"}
+			handleMySQLConnect(context.Background(), request)
+		}()
+		go func() {
+			defer wg.Done()
+			request := mcp.CallToolRequest{}
+			request.Params.Arguments = map[string]interface{}{"sql": "SELECT 1"}
+			handleMySQLQuery(context.Background(), request)
+		}()
+		go func() {
+			defer wg.Done()
+			registerMySQLConnections([]libmcp.MySQLConnectionConfig{
+				{Name: fmt.Sprintf("race-db-%d", i), Host: "127.0.0.1", Port: "1", Username: "isucon", Password: "isucon"},
+			})
+		}()
+	}
+	wg.Wait()
+
+	if conn := getActiveConnection(); conn == nil || conn.Port != "1" {
+		t.Errorf("Unexpected active connection: %+v", conn)
+	}
+}
+
+func TestMySQLConnectTimeout(t *testing.T) {
+	t.Setenv(MySQLConnectTimeoutEnv, "300ms")
+
+	conn := &MySQLConnection{Host: "10.255.255.1", Port: "3306", Username: "isucon", Password: "isucon"}
+	if dsn := mysqlDSN(conn, "isupipe"); !strings.HasSuffix(dsn, "?timeout=300ms") {
+		t.Errorf("DSN has no connect timeout: %s", dsn)
+	}
+
+	// Nothing answers on the unroutable address, so the connection would hang without the timeout
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]interface{}{
+		"host":     "10.255.255.1",
+		"port":     "3306",
+		"username": "isucon",
+		"password": "isucon",
+	}
+	start := time.Now()
+	if _, err := handleMySQLConnect(context.Background(), request); err == nil {
+		t.Errorf("Connecting to an unroutable address succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Connecting did not fail promptly. Elapsed: %v", elapsed)
+	}
+}
+
+func TestMySQLTLSOption(t *testing.T) {
+	server := httptest.NewTLSServer(nil)
+	server.Close()
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644); err != nil {
+		t.Fatalf("Failed to write CA certificate: %v", err)
+	}
+	notPEMPath := filepath.Join(t.TempDir(), "ca.txt")
+	if err := os.WriteFile(notPEMPath, []byte("not a certificate"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		mode      string
+		caPath    string
+		wantTLS   string // Suffix of the DSN, empty for no tls option
+		wantError bool
+	}{
+		{name: "No TLS", mode: "", wantTLS: ""},
+		{name: "Disabled", mode: "disabled", wantTLS: "&tls=false"},
+		{name: "Preferred", mode: "preferred", wantTLS: "&tls=preferred"},
+		{name: "Required", mode: "required", wantTLS: "&tls=true"},
+		{name: "Skip verify", mode: "skip-verify", wantTLS: "&tls=skip-verify"},
+		{name: "CA certificate", mode: "", caPath: caPath, wantTLS: "&tls=pprotein-"},
+		{name: "Unknown mode", mode: "always", wantError: true},
+		{name: "CA certificate without verification", mode: "skip-verify", caPath: caPath, wantError: true},
+		{name: "Missing CA certificate", mode: "required", caPath: filepath.Join(t.TempDir(), "missing.pem"), wantError: true},
+		{name: "Invalid CA certificate", mode: "required", caPath: notPEMPath, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			option, err := mysqlTLSOption(tt.mode, tt.caPath)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("Invalid TLS settings are accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to get TLS option: %v", err)
+			}
+
+			dsn := mysqlDSN(&MySQLConnection{Host: "db", Port: "3306", Username: "isucon", Password: "isucon", TLS: option}, "isupipe")
+			if _, err := mysql.ParseDSN(dsn); err != nil {
+				t.Errorf("Failed to parse DSN: %v", err)
+			}
+			_, query, _ := strings.Cut(dsn, "?")
+			if tt.wantTLS == "" {
+				if strings.Contains(query, "tls=") {
+					t.Errorf("DSN has a tls option: %s", dsn)
+				}
+			} else if !strings.Contains("&"+query, tt.wantTLS) {
+				t.Errorf("DSN doesn't carry the tls option. Expected: %s, Actual: %s", tt.wantTLS, dsn)
+			}
+		})
+	}
+}
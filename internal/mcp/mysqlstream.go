@@ -0,0 +1,230 @@
+package mcp
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Number of rows written between flushes of the streamed query results
+const ndjsonFlushRows = 100
+
+// Number of rows held in memory for an NDJSON tool result, the rest of the rows is only available through the stream
+const ndjsonToolMaxRows = 10000
+
+// sqlRows is the part of *sql.Rows the query results are read through
+type sqlRows interface {
+	Columns() ([]string, error)
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+}
+
+// queryMySQL runs the query on the database of the connection.
+// Both the returned DB and rows must be closed by the caller.
+func queryMySQL(ctx context.Context, conn *MySQLConnection, sqlQuery string) (*sql.DB, *sql.Rows, error) {
+	// Database connection
+	db, err := sql.Open("mysql", mysqlDSN(conn, conn.Database))
+	if err != nil {
+		return nil, nil, fmt.Errorf("MySQL connection error: %v", err)
+	}
+
+	// Execute query
+	rows, err := db.QueryContext(ctx, sqlQuery)
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("Query execution error: %v", err)
+	}
+	return db, rows, nil
+}
+
+// forEachRow calls fn with each row converted to a map from the column names to the values, and returns the column names.
+// Byte arrays are converted to strings.
+func forEachRow(rows sqlRows, fn func(row map[string]interface{}) error) ([]string, error) {
+	// Get column names
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting column information: %v", err)
+	}
+
+	// Buffer for scanning row data
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range columns {
+		valuePtrs[i] = &values[i]
+	}
+
+	// Get row data
+	for rows.Next() {
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, fmt.Errorf("Data scan error: %v", err)
+		}
+
+		// Convert row data to map
+		row := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			val := values[i]
+
+			// Convert byte array to string
+			if b, ok := val.([]byte); ok {
+				row[col] = string(b)
+			} else {
+				row[col] = val
+			}
+		}
+
+		if err := fn(row); err != nil {
+			return nil, err
+		}
+	}
+
+	// Error check
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Error during query execution: %v", err)
+	}
+	return columns, nil
+}
+
+// writeNDJSON writes each row as a line of JSON as soon as it is read, calling flush (if not nil) every ndjsonFlushRows rows
+// and at the end. It returns the number of rows written.
+func writeNDJSON(w io.Writer, rows sqlRows, flush func()) (int, error) {
+	enc := json.NewEncoder(w)
+	count := 0
+	_, err := forEachRow(rows, func(row map[string]interface{}) error {
+		if err := enc.Encode(row); err != nil {
+			return fmt.Errorf("Failed to write row: %v", err)
+		}
+		count++
+		if flush != nil && count%ndjsonFlushRows == 0 {
+			flush()
+		}
+		return nil
+	})
+	if flush != nil {
+		flush()
+	}
+	return count, err
+}
+
+// limitedRows stops reading rows after max of them, recording whether more rows were left
+type limitedRows struct {
+	sqlRows
+	max       int
+	read      int
+	truncated bool
+}
+
+func (r *limitedRows) Next() bool {
+	if r.read >= r.max {
+		r.truncated = r.sqlRows.Next()
+		return false
+	}
+	r.read++
+	return r.sqlRows.Next()
+}
+
+// bufferNDJSON returns at most ndjsonToolMaxRows rows as NDJSON for a tool result, which has to be held in memory as a whole.
+// When more rows are left, a last line with the key "truncated" tells the limit.
+func bufferNDJSON(rows sqlRows) (string, error) {
+	var buf strings.Builder
+	limited := &limitedRows{sqlRows: rows, max: ndjsonToolMaxRows}
+	if _, err := writeNDJSON(&buf, limited, nil); err != nil {
+		return "", err
+	}
+	if limited.truncated {
+		if err := json.NewEncoder(&buf).Encode(map[string]interface{}{"truncated": true, "max_rows": ndjsonToolMaxRows}); err != nil {
+			return "", fmt.Errorf("Failed to write row: %v", err)
+		}
+	}
+	return buf.String(), nil
+}
+
+// mysqlQueryStreamRequest is the body of the streaming query endpoint
+type mysqlQueryStreamRequest struct {
+	SQL    string `json:"sql"`
+	Sample int    `json:"sample"`
+}
+
+// handleMySQLQueryStream runs the query in the JSON body (like the arguments of mysql_query) on the active connection
+// and streams the rows as NDJSON without holding the whole result, for result sets too large for a tool result.
+// An error after the rows started is written as a last line with the key "error".
+// Only JSON requests from non-browser clients or local pages are accepted, so that no other site can run queries
+// through the browser of the user, and the query is bounded by the time budget of the tools.
+func handleMySQLQueryStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && !isLocalOrigin(origin) {
+		http.Error(w, fmt.Sprintf("origin %s is not allowed", origin), http.StatusForbidden)
+		return
+	}
+
+	conn := getActiveConnection()
+	if conn == nil {
+		http.Error(w, "Not connected to MySQL. Please run mysql_connect first", http.StatusConflict)
+		return
+	}
+
+	req := &mysqlQueryStreamRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.SQL == "" {
+		http.Error(w, "SQL query is required", http.StatusBadRequest)
+		return
+	}
+	sqlQuery := req.SQL
+	if req.Sample > 0 {
+		sqlQuery, _ = buildSampleQuery(sqlQuery, req.Sample)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), toolTimeoutFromEnv())
+	defer cancel()
+
+	log.Println("Streaming MySQL query")
+	db, rows, err := queryMySQL(ctx, conn, sqlQuery)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer db.Close()
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flush := func() {}
+	if f, ok := w.(http.Flusher); ok {
+		flush = f.Flush
+	}
+	if _, err := writeNDJSON(w, rows, flush); err != nil {
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	}
+}
+
+// isLocalOrigin reports whether the origin of a browser request is a page served from this machine
+func isLocalOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,141 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeRows returns fixed rows like *sql.Rows
+type fakeRows struct {
+	columns []string
+	rows    [][]interface{}
+	next    int
+}
+
+func (r *fakeRows) Columns() ([]string, error) {
+	return r.columns, nil
+}
+
+func (r *fakeRows) Next() bool {
+	r.next++
+	return r.next <= len(r.rows)
+}
+
+func (r *fakeRows) Scan(dest ...interface{}) error {
+	for i, v := range r.rows[r.next-1] {
+		*dest[i].(*interface{}) = v
+	}
+	return nil
+}
+
+func (r *fakeRows) Err() error {
+	return nil
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	rows := &fakeRows{columns: []string{"id", "name"}}
+	for i := 0; i < 250; i++ {
+		rows.rows = append(rows.rows, []interface{}{int64(i), []byte("user")})
+	}
+
+	var buf bytes.Buffer
+	flushes := 0
+	count, err := writeNDJSON(&buf, rows, func() { flushes++ })
+	if err != nil {
+		t.Fatalf("Failed to write rows: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if count != 250 || len(lines) != 250 {
+		t.Fatalf("Lines are different from expected. Expected: 250, Actual: %d lines, count %d", len(lines), count)
+	}
+	for i, line := range lines {
+		var row map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			t.Fatalf("Failed to decode line %d: %v", i, err)
+		}
+		if row["id"] != float64(i) || row["name"] != "user" {
+			t.Errorf("Row %d is different from expected: %v", i, row)
+		}
+	}
+	// Every 100 rows and at the end
+	if flushes != 3 {
+		t.Errorf("Flushes are different from expected. Expected: 3, Actual: %d", flushes)
+	}
+}
+
+func TestMySQLQueryStreamWithoutConnection(t *testing.T) {
+	setActiveConnection(nil)
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		origin      string
+		expected    int
+	}{
+		{name: "Not connected", method: http.MethodPost, contentType: "application/json", expected: http.StatusConflict},
+		{name: "Local origin", method: http.MethodPost, contentType: "application/json; charset=utf-8", origin: "http://localhost:9000", expected: http.StatusConflict},
+		{name: "Wrong method", method: http.MethodGet, contentType: "application/json", expected: http.StatusMethodNotAllowed},
+		{name: "Form post", method: http.MethodPost, contentType: "text/plain", expected: http.StatusUnsupportedMediaType},
+		{name: "No content type", method: http.MethodPost, expected: http.StatusUnsupportedMediaType},
+		{name: "Foreign origin", method: http.MethodPost, contentType: "application/json", origin: "https://example.com", expected: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/mysql/query", strings.NewReader(`{"sql":"SELECT 1"}`))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			handleMySQLQueryStream(rec, req)
+			if rec.Code != tt.expected {
+				t.Errorf("Status is different from expected. Expected: %d, Actual: %d", tt.expected, rec.Code)
+			}
+		})
+	}
+}
+
+func TestBufferNDJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		rows      int
+		lines     int
+		truncated bool
+	}{
+		{name: "Within the limit", rows: 3, lines: 3},
+		{name: "Exactly the limit", rows: ndjsonToolMaxRows, lines: ndjsonToolMaxRows},
+		{name: "Over the limit", rows: ndjsonToolMaxRows + 5, lines: ndjsonToolMaxRows + 1, truncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := &fakeRows{columns: []string{"id"}}
+			for i := 0; i < tt.rows; i++ {
+				rows.rows = append(rows.rows, []interface{}{int64(i)})
+			}
+
+			result, err := bufferNDJSON(rows)
+			if err != nil {
+				t.Fatalf("Failed to buffer rows: %v", err)
+			}
+
+			lines := strings.Split(strings.TrimSuffix(result, "\n"), "\n")
+			if len(lines) != tt.lines {
+				t.Fatalf("Lines are different from expected. Expected: %d, Actual: %d", tt.lines, len(lines))
+			}
+			truncated := strings.Contains(lines[len(lines)-1], `"truncated":true`)
+			if truncated != tt.truncated {
+				t.Errorf("Truncation is different from expected. Expected: %v, Actual: %v", tt.truncated, truncated)
+			}
+		})
+	}
+}
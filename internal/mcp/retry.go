@@ -0,0 +1,51 @@
+package mcp
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// Backoff of the requests to the API, which may not be listening yet right after boot
+var (
+	retryInitialBackoff = 100 * time.Millisecond
+	retryMaxBackoff     = time.Second
+	retryMaxElapsed     = 5 * time.Second
+)
+
+// doWithRetry sends the request, retrying with exponential backoff while the connection is refused.
+// Other errors and responses are returned as is, and the retries stop once the context of the request is done.
+func doWithRetry(req *http.Request) (*http.Response, error) {
+	deadline := time.Now().Add(retryMaxElapsed)
+	backoff := retryInitialBackoff
+
+	for {
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil || !errors.Is(err, syscall.ECONNREFUSED) {
+			return resp, err
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return nil, fmt.Errorf("gave up retrying after %v: %w", retryMaxElapsed, err)
+		}
+
+		log.Printf("API is not ready, retrying in %v: %v", backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		backoff = min(backoff*2, retryMaxBackoff)
+
+		// The body has been consumed by the failed attempt
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind request body: %w", err)
+			}
+			req.Body = body
+		}
+	}
+}
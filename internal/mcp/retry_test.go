@@ -0,0 +1,88 @@
+package mcp
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// freePort returns a port nothing is listening on
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestDoWithRetry(t *testing.T) {
+	initial, maxElapsed := retryInitialBackoff, retryMaxElapsed
+	retryInitialBackoff, retryMaxElapsed = 50*time.Millisecond, 3*time.Second
+	t.Cleanup(func() { retryInitialBackoff, retryMaxElapsed = initial, maxElapsed })
+
+	port := freePort(t)
+
+	// The API starts listening only after the first attempt is refused
+	started := make(chan *http.Server)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		l, err := net.Listen("tcp", "localhost:"+strconv.Itoa(port))
+		if err != nil {
+			close(started)
+			return
+		}
+		srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("[]"))
+		})}
+		go srv.Serve(l)
+		started <- srv
+	}()
+
+	entries, err := httpSource{port: strconv.Itoa(port)}.entries(context.Background(), "pprof")
+	if err != nil {
+		t.Fatalf("Failed to fetch entries: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Entry count is different from expected. Expected: 0, Actual: %d", len(entries))
+	}
+
+	if srv, ok := <-started; ok {
+		srv.Close()
+	}
+}
+
+func TestDoWithRetryGivesUp(t *testing.T) {
+	initial, maxElapsed := retryInitialBackoff, retryMaxElapsed
+	retryInitialBackoff, retryMaxElapsed = 20*time.Millisecond, 200*time.Millisecond
+	t.Cleanup(func() { retryInitialBackoff, retryMaxElapsed = initial, maxElapsed })
+
+	begin := time.Now()
+	if _, err := (httpSource{port: strconv.Itoa(freePort(t))}).entries(context.Background(), "pprof"); err == nil {
+		t.Fatalf("Request to a closed port succeeded")
+	}
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("Retrying took too long: %v", elapsed)
+	}
+}
+
+func TestDoWithRetryCanceled(t *testing.T) {
+	initial, maxElapsed := retryInitialBackoff, retryMaxElapsed
+	retryInitialBackoff, retryMaxElapsed = 20*time.Millisecond, 5*time.Second
+	t.Cleanup(func() { retryInitialBackoff, retryMaxElapsed = initial, maxElapsed })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	begin := time.Now()
+	if _, err := (httpSource{port: strconv.Itoa(freePort(t))}).content(ctx, "pprof", "a.pb.gz"); err == nil {
+		t.Fatalf("Request to a closed port succeeded")
+	}
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("Retrying continued after the context was done: %v", elapsed)
+	}
+}
@@ -6,18 +6,35 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/kaz/pprotein/internal/collect"
 	"github.com/kaz/pprotein/internal/libmcp"
+	"github.com/kaz/pprotein/internal/storage"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
 
-// SetupMCP sets up and starts a new MCP server
-func SetupMCP(port string, apiPort string) {
+// running is whether the MCP server is serving
+var running atomic.Bool
+
+// Running reports whether the MCP server is serving
+func Running() bool {
+	return running.Load()
+}
+
+// SetupMCP sets up and starts a new MCP server.
+// The tools read the collected data from store in-process, or through the API on apiPort if store is nil.
+func SetupMCP(port string, apiPort string, store storage.Storage) {
 	// Debug log
 	log.Println("Setting up MCP server on port", port)
 
+	src := newSource(apiPort, store)
+
 	// Create a new MCP server
 	s := server.NewMCPServer(
 		"pprotein MCP Server",
@@ -26,14 +43,40 @@ func SetupMCP(port string, apiPort string) {
 		server.WithLogging(),
 	)
 
+	// Every tool invocation gets a total time budget shared by all the calls it chains
+	toolTimeout := toolTimeoutFromEnv()
+	addTool := func(tool mcp.Tool, handler server.ToolHandlerFunc) {
+		s.AddTool(tool, withToolTimeout(toolTimeout, handler))
+	}
+
 	// Create a tool to get the group list
 	groupListTool := mcp.NewTool("group_list",
 		mcp.WithDescription("Retrieves a list of group IDs"),
 	)
 
 	// Register handler for the group list retrieval tool
-	s.AddTool(groupListTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		result, err := handleGroupList(apiPort)
+	addTool(groupListTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := handleGroupList(ctx, apiPort)
+		if err != nil {
+			return nil, err
+		}
+
+		jsonData, err := json.Marshal(result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal result: %v", err)
+		}
+
+		return mcp.NewToolResultText(string(jsonData)), nil
+	})
+
+	// Create a tool to get the latest group
+	groupLatestTool := mcp.NewTool("group_latest",
+		mcp.WithDescription("Retrieves the newest group ID and a summary of the entries it contains"),
+	)
+
+	// Register handler for the latest group retrieval tool
+	addTool(groupLatestTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := handleGroupLatest(ctx, src)
 		if err != nil {
 			return nil, err
 		}
@@ -56,13 +99,13 @@ func SetupMCP(port string, apiPort string) {
 	)
 
 	// Register handler for group data retrieval tool
-	s.AddTool(groupDataTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	addTool(groupDataTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		groupID, ok := request.Params.Arguments["group_id"].(string)
 		if !ok || groupID == "" {
 			return nil, fmt.Errorf("group_id is required")
 		}
 
-		result, err := handleGroupData(apiPort, groupID)
+		result, err := handleGroupData(ctx, apiPort, groupID)
 		if err != nil {
 			return nil, err
 		}
@@ -77,22 +120,38 @@ func SetupMCP(port string, apiPort string) {
 
 	// Create group file retrieval tool
 	groupFileTool := mcp.NewTool("group_file",
-		mcp.WithDescription("Retrieves the physical file for a specific group ID and type"),
+		mcp.WithDescription("Retrieves the physical file for a specific group ID and type. Returns status no_data if the group has no entries of the type"),
 		mcp.WithString("group_id",
 			mcp.Description("The ID of the group to retrieve the file for"),
 			mcp.Required(),
 		),
 		mcp.WithString("type",
-			mcp.Description("The type of file to retrieve (pprof, httplog, slowlog, memo)"),
+			mcp.Description(fmt.Sprintf("The type of file to retrieve (%s)", strings.Join(collect.Types(), ", "))),
 			mcp.Required(),
 		),
 		mcp.WithString("entry_id",
-			mcp.Description("The specific entry ID (optional, defaults to the first entry)"),
+			mcp.Description("The specific entry ID (optional, defaults to the first entry, or for pprof the latest one with the reports of the others in other_entries)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Output format for pprof: text (default), speedscope or detailed_json. Not supported for other types"),
+		),
+		mcp.WithBoolean("refresh",
+			mcp.Description("Recompute the cached analysis instead of serving it (optional, defaults to false)"),
+		),
+		mcp.WithString("from",
+			mcp.Description("Ignore slowlog events before this RFC 3339 time (optional, slowlog only)"),
+		),
+		mcp.WithString("to",
+			mcp.Description("Ignore slowlog events after this RFC 3339 time (optional, slowlog only)"),
+		),
+		mcp.WithArray("exclude",
+			mcp.Description("Regexes of the slowlog query fingerprints to drop, e.g. ^commit (optional, slowlog only)"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
 		),
 	)
 
 	// Register handler for group file retrieval tool
-	s.AddTool(groupFileTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	addTool(groupFileTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		groupID, ok := request.Params.Arguments["group_id"].(string)
 		if !ok || groupID == "" {
 			return nil, fmt.Errorf("group_id is required")
@@ -104,14 +163,19 @@ func SetupMCP(port string, apiPort string) {
 		}
 
 		// Check if the type is valid
-		validTypes := map[string]bool{"pprof": true, "httplog": true, "slowlog": true, "memo": true}
-		if !validTypes[fileType] {
-			return nil, fmt.Errorf("invalid type: %s, must be one of pprof, httplog, slowlog, memo", fileType)
+		if !collect.TypeEnabled(fileType) {
+			return nil, fmt.Errorf("invalid type: %s, must be one of %s", fileType, strings.Join(collect.Types(), ", "))
 		}
 
 		entryID, _ := request.Params.Arguments["entry_id"].(string)
+		format, _ := request.Params.Arguments["format"].(string)
+		refresh, _ := request.Params.Arguments["refresh"].(bool)
+		filter, err := parseSlowlogFilter(request.Params.Arguments)
+		if err != nil {
+			return nil, err
+		}
 
-		fileContent, contentType, err := handleGroupFile(apiPort, groupID, fileType, entryID)
+		fileContent, contentType, err := handleGroupFile(ctx, src, groupID, fileType, entryID, format, refresh, filter)
 		if err != nil {
 			return nil, err
 		}
@@ -140,8 +204,8 @@ func SetupMCP(port string, apiPort string) {
 	)
 
 	// Register handler for alp configuration file retrieval tool
-	s.AddTool(alpConfigGetTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		configContent, err := handleGetAlpConfig(apiPort)
+	addTool(alpConfigGetTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		configContent, err := handleGetAlpConfig(ctx, apiPort)
 		if err != nil {
 			return nil, err
 		}
@@ -158,13 +222,13 @@ func SetupMCP(port string, apiPort string) {
 	)
 
 	// Register handler for alp configuration file update tool
-	s.AddTool(alpConfigUpdateTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	addTool(alpConfigUpdateTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		config, ok := request.Params.Arguments["config"].(string)
 		if !ok || config == "" {
 			return nil, fmt.Errorf("config is required")
 		}
 
-		err := handleUpdateAlpConfig(apiPort, config)
+		err := handleUpdateAlpConfig(ctx, apiPort, config)
 		if err != nil {
 			return nil, err
 		}
@@ -175,26 +239,33 @@ func SetupMCP(port string, apiPort string) {
 	// Create MySQL connection tool
 	connectTool := mcp.NewTool("mysql_connect",
 		mcp.WithDescription("Establishes a connection to the MySQL database and saves the connection information for use in subsequent queries"),
+		mcp.WithString("connection",
+			mcp.Description("Name of the connection settings loaded from the connections config file (optional)"),
+		),
 		mcp.WithString("host",
-			mcp.Required(),
-			mcp.Description("MySQL host address"),
+			mcp.Description("MySQL host address (required if connection is not specified)"),
 		),
 		mcp.WithString("port",
 			mcp.Description("MySQL port"),
 			mcp.DefaultString("3306"),
 		),
 		mcp.WithString("username",
-			mcp.Required(),
-			mcp.Description("MySQL username"),
+			mcp.Description("MySQL username (required if connection is not specified)"),
 		),
 		mcp.WithString("password",
-			mcp.Required(),
-			mcp.Description("MySQL password"),
+			mcp.Description("MySQL password (required if connection is not specified)"),
 		),
 		mcp.WithString("database",
 			mcp.Description("MySQL database name (optional)"),
 			mcp.DefaultString(""),
 		),
+		mcp.WithString("tls",
+			mcp.Description("TLS mode (optional, no TLS if omitted, or the one of the connection settings): disabled, preferred, required or skip-verify"),
+			mcp.Enum("disabled", "preferred", "required", "skip-verify"),
+		),
+		mcp.WithString("tls_ca",
+			mcp.Description("Path of the CA certificate (PEM) to verify the server with, which implies tls=required (optional)"),
+		),
 	)
 
 	// Create query tool
@@ -204,6 +275,13 @@ func SetupMCP(port string, apiPort string) {
 			mcp.Required(),
 			mcp.Description("The SQL query to execute"),
 		),
+		mcp.WithNumber("sample",
+			mcp.Description("Return at most this many random rows instead of the full table (optional, only applies to simple \"SELECT * FROM table\" statements)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("json (default) for a document with the columns, rows and count, or ndjson for one JSON object per row (at most 10000 rows). Results too large for a tool result can be streamed as NDJSON with POST /mysql/query on the MCP port"),
+			mcp.Enum("json", "ndjson"),
+		),
 	)
 
 	// Create database list tool
@@ -229,16 +307,16 @@ func SetupMCP(port string, apiPort string) {
 	)
 
 	// Register tool handlers
-	s.AddTool(connectTool, handleMySQLConnect)
-	s.AddTool(queryTool, handleMySQLQuery)
-	s.AddTool(listDatabasesTool, handleMySQLListDatabases)
-	s.AddTool(listTablesTool, handleMySQLListTables)
-	s.AddTool(describeTableTool, handleMySQLDescribeTable)
+	addTool(connectTool, handleMySQLConnect)
+	addTool(queryTool, handleMySQLQuery)
+	addTool(listDatabasesTool, handleMySQLListDatabases)
+	addTool(listTablesTool, handleMySQLListTables)
+	addTool(describeTableTool, handleMySQLDescribeTable)
 
 	// Register resource handler to the server
 	resource := mcp.NewResource("pprotein://groups", "application/json")
 	s.AddResource(resource, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
-		result, err := handleGroupList(apiPort)
+		result, err := handleGroupList(ctx, apiPort)
 		if err != nil {
 			return nil, err
 		}
@@ -261,13 +339,28 @@ func SetupMCP(port string, apiPort string) {
 	// Register tools to the server
 	libmcp.RegisterToolsToServer(s)
 
+	// Load named connections from the connections config file, if specified
+	if path := os.Getenv(libmcp.ConnectionsConfigEnv); path != "" {
+		config, err := libmcp.LoadConnectionsConfig(path)
+		if err != nil {
+			log.Printf("Failed to load connections config: %v", err)
+		} else {
+			registerMySQLConnections(config.MySQL)
+		}
+	}
+
 	// Start server (run in a separate goroutine)
 	go func() {
 		log.Printf("Starting MCP server on port %s", port)
-		sseServer := server.NewSSEServer(s)
-		if err := sseServer.Start(":" + port); err != nil {
+		// The streaming query endpoint is served next to the SSE endpoints
+		mux := http.NewServeMux()
+		mux.HandleFunc("/mysql/query", handleMySQLQueryStream)
+		mux.Handle("/", server.NewSSEServer(s))
+		running.Store(true)
+		if err := http.ListenAndServe(":"+port, mux); err != nil {
 			log.Printf("MCP server error: %v", err)
 		}
+		running.Store(false)
 	}()
 
 	log.Println("MCP server setup complete on port", port)
@@ -0,0 +1,32 @@
+package mcp
+
+import (
+	"github.com/kaz/pprotein/internal/libmcp"
+)
+
+// Settings is the effective configuration of the MCP server. Connection credentials are never included.
+type Settings struct {
+	Running             bool   `json:"running"`
+	ToolTimeout         string `json:"tool_timeout"`
+	MySQLConnectTimeout string `json:"mysql_connect_timeout"`
+	// Limits of the connection registries, where zero means unlimited
+	MaxConnections int    `json:"max_connections"`
+	ConnectionTTL  string `json:"connection_ttl"`
+	// Numbers of the saved connections
+	SSHConnections   int `json:"ssh_connections"`
+	MySQLConnections int `json:"mysql_connections"`
+}
+
+// CurrentSettings returns the settings the MCP server is running with
+func CurrentSettings() Settings {
+	limits := libmcp.RegistryLimitsFromEnv()
+	return Settings{
+		Running:             Running(),
+		ToolTimeout:         toolTimeoutFromEnv().String(),
+		MySQLConnectTimeout: mysqlConnectTimeoutFromEnv().String(),
+		MaxConnections:      limits.MaxEntries,
+		ConnectionTTL:       limits.IdleTTL.String(),
+		SSHConnections:      libmcp.SSHConnectionCount(),
+		MySQLConnections:    mysqlConnections.Len(),
+	}
+}
@@ -0,0 +1,147 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/kaz/pprotein/internal/storage"
+)
+
+type (
+	// source resolves the collected entries and their files for the MCP tools
+	source interface {
+		// entries returns all the entries of the type
+		entries(ctx context.Context, fileType string) ([]*collect.Entry, error)
+		// content returns the raw file of an entry
+		content(ctx context.Context, fileType, id string) ([]byte, error)
+		// analysis returns the processed result of an entry (e.g. the alp output of an httplog),
+		// which is processed again instead of served from the cache with refresh
+		analysis(ctx context.Context, fileType, id string, refresh bool) ([]byte, error)
+	}
+
+	// httpSource goes through the pprotein API, for setups where the storage is not at hand
+	httpSource struct {
+		port string
+	}
+
+	// storeSource reads the storage directly, avoiding the round trips to the API
+	storeSource struct {
+		store storage.Storage
+		// Fallback for results not processed yet, which only the collectors can produce
+		remote httpSource
+	}
+)
+
+// newSource reads the storage in-process when it is given, and uses the API on the port otherwise
+func newSource(port string, store storage.Storage) source {
+	if store == nil {
+		return httpSource{port: port}
+	}
+	return storeSource{store: store, remote: httpSource{port: port}}
+}
+
+func (s httpSource) entries(ctx context.Context, fileType string) ([]*collect.Entry, error) {
+	body, err := s.get(ctx, fmt.Sprintf("http://localhost:%s/api/%s", s.port, fileType))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching from %s: %v", fileType, err)
+	}
+
+	var entries []*collect.Entry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("JSON decode error: %v", err)
+	}
+	return entries, nil
+}
+func (s httpSource) content(ctx context.Context, fileType, id string) ([]byte, error) {
+	dataURL := rawDataURL(s.port, fileType, id)
+	log.Printf("Fetching data from: %s", dataURL)
+
+	body, err := s.get(ctx, dataURL)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching data: %v", err)
+	}
+	return body, nil
+}
+func (s httpSource) analysis(ctx context.Context, fileType, id string, refresh bool) ([]byte, error) {
+	analysisURL := fmt.Sprintf("http://localhost:%s/api/%s/%s", s.port, fileType, id)
+	if refresh {
+		analysisURL += "?refresh=1"
+	}
+	log.Printf("Fetching analysis data from: %s", analysisURL)
+
+	body, err := s.get(ctx, analysisURL)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching analysis: %v", err)
+	}
+	return body, nil
+}
+
+// get returns the body of a successful GET request, which is canceled once ctx is done
+func (s httpSource) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := doWithRetry(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (s storeSource) entries(ctx context.Context, fileType string) ([]*collect.Entry, error) {
+	snapshots, err := collect.LoadSnapshots(s.store, fileType)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*collect.Entry, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		// Only the collectors know the exact status, but an entry with a body is ready to be read
+		status := collect.StatusPending
+		if ok, _ := s.store.ExistsFile(snapshot.ID); ok {
+			status = collect.StatusOk
+		}
+		entries = append(entries, &collect.Entry{Snapshot: snapshot, Status: status})
+	}
+	return entries, nil
+}
+func (s storeSource) content(ctx context.Context, fileType, id string) ([]byte, error) {
+	path, err := s.store.GetFilePath(id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting file path: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file content: %v", err)
+	}
+	return content, nil
+}
+func (s storeSource) analysis(ctx context.Context, fileType, id string, refresh bool) ([]byte, error) {
+	// Only the collectors can process the entry again
+	if refresh {
+		return s.remote.analysis(ctx, fileType, id, true)
+	}
+
+	cached, err := collect.CachedResult(s.store, id)
+	if err != nil {
+		return nil, fmt.Errorf("error reading analysis: %v", err)
+	}
+	if cached != nil {
+		return cached, nil
+	}
+	return s.remote.analysis(ctx, fileType, id, false)
+}
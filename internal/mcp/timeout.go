@@ -0,0 +1,48 @@
+package mcp
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Environment variable specifying the total time budget of a tool invocation as a duration (e.g. 30s)
+const ToolTimeoutEnv = "PPROTEIN_MCP_TOOL_TIMEOUT"
+
+// Budget of a tool invocation used when ToolTimeoutEnv is not set
+const defaultToolTimeout = time.Minute
+
+// toolTimeoutFromEnv returns the time budget of a tool invocation
+func toolTimeoutFromEnv() time.Duration {
+	v := os.Getenv(ToolTimeoutEnv)
+	if v == "" {
+		return defaultToolTimeout
+	}
+
+	timeout, err := time.ParseDuration(v)
+	if err != nil || timeout <= 0 {
+		log.Printf("[!] invalid %s %q, using %v", ToolTimeoutEnv, v, defaultToolTimeout)
+		return defaultToolTimeout
+	}
+	return timeout
+}
+
+// withToolTimeout bounds the whole invocation of the tool handler, including all the calls it chains, by timeout
+func withToolTimeout(timeout time.Duration, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return handler(ctx, request)
+	}
+}
+
+// markTimedOut notes in a partial result that the budget ran out before all the steps were done
+func markTimedOut(result map[string]interface{}, skipped []string) {
+	result["timed_out"] = true
+	result["note"] = "The time budget of the tool was exceeded, so the result is partial"
+	result["skipped"] = skipped
+}
@@ -0,0 +1,81 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestToolTimeoutReturnsPartialResult(t *testing.T) {
+	// pprotein API where listing the httplog entries hangs
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/pprof":
+			json.NewEncoder(w).Encode([]*collect.Entry{{
+				Snapshot: &collect.Snapshot{
+					SnapshotMeta:   &collect.SnapshotMeta{Type: "pprof", ID: "group1-pprof.pb.gz"},
+					SnapshotTarget: &collect.SnapshotTarget{GroupId: "group1", Label: "app"},
+				},
+				Status: collect.StatusOk,
+			}})
+		case "/api/httplog":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		default:
+			w.Write([]byte("[]"))
+		}
+	}))
+	defer api.Close()
+	apiURL, _ := url.Parse(api.URL)
+
+	handler := withToolTimeout(200*time.Millisecond, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := handleGroupData(ctx, apiURL.Port(), "group1")
+		if err != nil {
+			return nil, err
+		}
+		jsonData, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(string(jsonData)), nil
+	})
+
+	start := time.Now()
+	toolResult, err := handler(context.Background(), mcp.CallToolRequest{})
+	if err != nil {
+		t.Fatalf("Failed to call tool: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Tool did not return within the budget. Elapsed: %v", elapsed)
+	}
+
+	var result struct {
+		Data     map[string][]*collect.Entry `json:"data"`
+		TimedOut bool                        `json:"timed_out"`
+		Skipped  []string                    `json:"skipped"`
+	}
+	if err := json.Unmarshal([]byte(toolResult.Content[0].(mcp.TextContent).Text), &result); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+
+	if len(result.Data["pprof"]) != 1 {
+		t.Errorf("Entries fetched within the budget are missing: %+v", result.Data)
+	}
+	if !result.TimedOut {
+		t.Errorf("Result is not marked as timed out")
+	}
+	// Every type after pprof is skipped
+	if skipped, expected := strings.Join(result.Skipped, ","), strings.Join(collect.AllTypes[1:], ","); skipped != expected {
+		t.Errorf("Skipped types are different from expected. Expected: %s, Actual: %s", expected, skipped)
+	}
+}
@@ -1,7 +1,7 @@
 package mcp
 
 import (
-	"database/sql"
+	"github.com/kaz/pprotein/internal/libmcp"
 )
 
 // MCP request structure
@@ -29,8 +29,36 @@ type MySQLConnection struct {
 	Username string
 	Password string
 	Database string
-	Conn     *sql.DB
+	TLS      string // Value of the tls option of the DSN, empty to connect without TLS
 }
 
-// Active MySQL connection
-var activeConnection *MySQLConnection
+// Key of the active MySQL connection in activeConnections
+const activeConnectionKey = "active"
+
+// Active MySQL connection set by mysql_connect, which is dropped once it is unused for the TTL in the environment.
+// The queries open their own pools, so there is nothing to close on eviction.
+var activeConnections = libmcp.NewRegistry[*MySQLConnection](libmcp.RegistryLimitsFromEnv(), nil)
+
+// Named MySQL connections loaded from the connections config file, which are pinned and never dropped by the limits
+var mysqlConnections = libmcp.NewRegistry[*MySQLConnection](libmcp.RegistryLimitsFromEnv(), nil)
+
+// getActiveConnection returns the active MySQL connection, or nil if not connected.
+// The returned value must not be modified; replace it with setActiveConnection instead.
+func getActiveConnection() *MySQLConnection {
+	conn, _ := activeConnections.Get(activeConnectionKey)
+	return conn
+}
+
+// setActiveConnection replaces the active MySQL connection, which is dropped with nil
+func setActiveConnection(conn *MySQLConnection) {
+	if conn == nil {
+		activeConnections.Delete(activeConnectionKey)
+		return
+	}
+	activeConnections.Store(activeConnectionKey, conn)
+}
+
+// getMySQLConnection returns the named MySQL connection setting
+func getMySQLConnection(name string) (*MySQLConnection, bool) {
+	return mysqlConnections.Get(name)
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/goccy/go-json"
 	"github.com/kaz/pprotein/internal/collect"
@@ -25,8 +28,16 @@ type (
 		opts      *collect.Options
 		collector *collect.Collector
 	}
+
+	searchResult struct {
+		Snapshot *collect.Snapshot
+		Snippet  string
+	}
 )
 
+// Number of characters shown around the match in search results
+const snippetContext = 40
+
 func NewHandler(opts *collect.Options) *handler {
 	return &handler{opts: opts}
 }
@@ -42,12 +53,20 @@ func (h *handler) Register(g *echo.Group) error {
 
 	g.GET("", h.getIndex)
 	g.POST("", h.postIndex)
+	g.GET("/search", h.search)
 	g.GET("/:id", h.getId)
+	g.PATCH("/:id", collect.HandlePatch(h.collector))
 	return nil
 }
 
+// getIndex lists the entries with their text, sorted and filtered by the query params of collect.ParseListOptions
 func (h *handler) getIndex(c echo.Context) error {
-	list := h.collector.List()
+	opts, err := collect.ParseListOptions(c.QueryParams())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	list := collect.FilterEntries(h.collector.List(), opts)
 	for _, m := range list {
 		r, err := h.collector.Get(m.Snapshot.ID)
 		if err != nil {
@@ -64,7 +83,7 @@ func (h *handler) getIndex(c echo.Context) error {
 
 		m.Message = v.Text
 	}
-	return c.JSON(http.StatusOK, h.collector.List())
+	return c.JSON(http.StatusOK, list)
 }
 
 func (h *handler) postIndex(c echo.Context) error {
@@ -112,3 +131,68 @@ func (h *handler) getId(c echo.Context) error {
 
 	return c.Stream(http.StatusOK, "application/json", r)
 }
+
+func (h *handler) search(c echo.Context) error {
+	query := strings.ToLower(c.QueryParam("q"))
+	groupID := c.QueryParam("group")
+	if query == "" && groupID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "q or group is required")
+	}
+
+	results := []*searchResult{}
+	for _, ent := range h.collector.List() {
+		if groupID != "" && ent.Snapshot.GroupId != groupID {
+			continue
+		}
+
+		r, err := h.collector.Get(ent.Snapshot.ID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to get entry: %v", err))
+		}
+		buf, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to read entry: %v", err))
+		}
+
+		var v textValue
+		json.Unmarshal(buf, &v)
+
+		idx := strings.Index(strings.ToLower(v.Text), query)
+		if idx < 0 {
+			continue
+		}
+		results = append(results, &searchResult{
+			Snapshot: ent.Snapshot,
+			Snippet:  snippet(v.Text, idx, len(query)),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Snapshot.Datetime.After(results[j].Snapshot.Datetime)
+	})
+	return c.JSON(http.StatusOK, results)
+}
+
+// snippet returns the text around the match at idx
+func snippet(text string, idx, length int) string {
+	start := min(max(0, idx-snippetContext), len(text))
+	end := min(len(text), idx+length+snippetContext)
+
+	// Avoid cutting multibyte characters in half
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	s := text[start:end]
+	if start > 0 {
+		s = "..." + s
+	}
+	if end < len(text) {
+		s = s + "..."
+	}
+	return s
+}
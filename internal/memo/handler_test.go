@@ -0,0 +1,98 @@
+package memo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/kaz/pprotein/internal/event"
+	"github.com/kaz/pprotein/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+func newTestServer(t *testing.T) *echo.Echo {
+	t.Helper()
+
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	e := echo.New()
+	opts := &collect.Options{
+		Type:     "memo",
+		Ext:      "-memo.log",
+		Store:    store,
+		EventHub: event.NewHub(),
+	}
+	if err := NewHandler(opts).Register(e.Group("/api/memo")); err != nil {
+		t.Fatalf("Failed to register handler: %v", err)
+	}
+	return e
+}
+
+func postMemo(t *testing.T, e *echo.Echo, groupID, text string) {
+	t.Helper()
+
+	body, _ := json.Marshal(&requestBody{GroupId: groupID, Label: "memo", Text: text})
+	req := httptest.NewRequest(http.MethodPost, "/api/memo", strings.NewReader(string(body)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Failed to post memo: status=%d, body=%s", rec.Code, rec.Body)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	e := newTestServer(t)
+
+	postMemo(t, e, "2025-04-01_12-00-00", "Added index on livestreams.user_id")
+	postMemo(t, e, "2025-04-01_12-10-00", "Cached the theme lookup in memory")
+
+	tests := []struct {
+		name      string
+		query     string
+		wantCount int
+		wantGroup string
+	}{
+		{name: "Case-insensitive match", query: "q=INDEX", wantCount: 1, wantGroup: "2025-04-01_12-00-00"},
+		{name: "No match", query: "q=redis", wantCount: 0},
+		{name: "Filter by group", query: "group=2025-04-01_12-10-00", wantCount: 1, wantGroup: "2025-04-01_12-10-00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/memo/search?"+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Status code is different from expected. Expected: %d, Actual: %d", http.StatusOK, rec.Code)
+			}
+
+			var results []*searchResult
+			if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if len(results) != tt.wantCount {
+				t.Fatalf("Result count is different from expected. Expected: %d, Actual: %d", tt.wantCount, len(results))
+			}
+			if tt.wantCount > 0 && results[0].Snapshot.GroupId != tt.wantGroup {
+				t.Errorf("Matched group is different from expected. Expected: %s, Actual: %s", tt.wantGroup, results[0].Snapshot.GroupId)
+			}
+		})
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	text := strings.Repeat("a", 100) + "needle" + strings.Repeat("b", 100)
+	got := snippet(text, 100, len("needle"))
+
+	expected := "..." + strings.Repeat("a", snippetContext) + "needle" + strings.Repeat("b", snippetContext) + "..."
+	if got != expected {
+		t.Errorf("Snippet is different from expected. Expected: %q, Actual: %q", expected, got)
+	}
+}
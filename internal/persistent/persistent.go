@@ -3,8 +3,10 @@ package persistent
 import (
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"os"
+	"path/filepath"
 
 	"github.com/kaz/pprotein/internal/storage"
 	"github.com/labstack/echo/v4"
@@ -15,6 +17,8 @@ type (
 		store storage.Storage
 
 		sanitize func([]byte) ([]byte, error)
+		// redact hides secrets from the content served by GET, which is served as is if nil
+		redact func([]byte) ([]byte, error)
 
 		fileName string
 		filePath string
@@ -51,6 +55,12 @@ func New(store storage.Storage, fileName string, defaultContent []byte, sanitize
 	}, nil
 }
 
+// SetRedact sets the function hiding secrets from the content served by GET.
+// The sanitize function is expected to restore them when the redacted content is posted back.
+func (h *Handler) SetRedact(redact func([]byte) ([]byte, error)) {
+	h.redact = redact
+}
+
 func (h *Handler) RegisterHandlers(g *echo.Group) {
 	g.GET("", h.handleGet)
 	g.POST("", h.handlePost)
@@ -68,7 +78,19 @@ func (h *Handler) GetContent() ([]byte, error) {
 }
 
 func (h *Handler) handleGet(c echo.Context) error {
-	return c.File(h.filePath)
+	if h.redact == nil {
+		return c.File(h.filePath)
+	}
+
+	content, err := h.GetContent()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	redacted, err := h.redact(content)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("failed to redact: %v", err))
+	}
+	return c.Blob(http.StatusOK, mime.TypeByExtension(filepath.Ext(h.fileName)), redacted)
 }
 func (h *Handler) handlePost(c echo.Context) error {
 	body, err := io.ReadAll(c.Request().Body)
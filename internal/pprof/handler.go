@@ -35,12 +35,18 @@ func (h *handler) Register(g *echo.Group) error {
 	g.POST("", h.postIndex)
 	g.GET("/data/:id", h.getData)
 	g.GET("/data/latest", h.getLatestData)
+	g.PATCH("/:id", collect.HandlePatch(h.collector))
 
 	return nil
 }
 
+// getIndex lists the entries, sorted and filtered by the query params of collect.ParseListOptions
 func (h *handler) getIndex(c echo.Context) error {
-	return c.JSON(http.StatusOK, h.collector.List())
+	opts, err := collect.ParseListOptions(c.QueryParams())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, collect.FilterEntries(h.collector.List(), opts))
 }
 
 func (h *handler) postIndex(c echo.Context) error {
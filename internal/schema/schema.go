@@ -0,0 +1,161 @@
+package schema
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/kaz/pprotein/internal/analyze/httplog"
+	"github.com/kaz/pprotein/internal/analyze/pprof"
+	"github.com/kaz/pprotein/internal/analyze/slowlog"
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/kaz/pprotein/internal/collect/group"
+	"github.com/labstack/echo/v4"
+)
+
+// Schema is a JSON Schema document
+type Schema map[string]interface{}
+
+// Types published by the schema endpoint, keyed by the name consumers refer to them with
+var publishedTypes = map[string]reflect.Type{
+	"entry":            reflect.TypeOf(collect.Entry{}),
+	"slowlog_analysis": reflect.TypeOf(slowlog.AnalysisResult{}),
+	"httplog_endpoint": reflect.TypeOf(httplog.EndpointStats{}),
+	"pprof_tree":       reflect.TypeOf(pprof.TreeNode{}),
+	"pprof_peek":       reflect.TypeOf([]*pprof.PeekResult{}),
+	"trend":            reflect.TypeOf(group.Trend{}),
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textType      = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// HandleSchema serves the JSON Schema of the entries and the analysis results
+func HandleSchema(c echo.Context) error {
+	return c.JSON(http.StatusOK, Generate())
+}
+
+// Generate builds the JSON Schema of the published types from the Go structs.
+// Each type is a property of the document referring to the struct definitions in $defs.
+func Generate() Schema {
+	g := &generator{defs: Schema{}}
+
+	properties := Schema{}
+	for name, t := range publishedTypes {
+		properties[name] = g.schemaOf(t)
+	}
+
+	return Schema{
+		"$schema":    "https://json-schema.org/draft/2020-12/schema",
+		"$defs":      g.defs,
+		"properties": properties,
+	}
+}
+
+type generator struct {
+	defs Schema
+}
+
+// schemaOf returns the schema of the values of the type as encoding/json marshals them
+func (g *generator) schemaOf(t reflect.Type) Schema {
+	if t == timeType {
+		return Schema{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return Schema{"anyOf": []interface{}{g.schemaOf(t.Elem()), Schema{"type": "null"}}}
+	case reflect.Struct:
+		// Types marshaling themselves have no knowable structure
+		if t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) {
+			return Schema{}
+		}
+		return g.ref(t)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return Schema{"type": "string", "contentEncoding": "base64"}
+		}
+		return Schema{"type": []string{"array", "null"}, "items": g.schemaOf(t.Elem())}
+	case reflect.Array:
+		return Schema{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": []string{"object", "null"}, "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	default:
+		return Schema{}
+	}
+}
+
+// ref registers the definition of the struct and returns the reference to it
+func (g *generator) ref(t reflect.Type) Schema {
+	name := t.String()
+	ref := Schema{"$ref": "#/$defs/" + name}
+	if _, ok := g.defs[name]; ok {
+		return ref
+	}
+
+	// Register a placeholder first so that recursive types refer to themselves
+	g.defs[name] = Schema{}
+
+	properties := Schema{}
+	required := []string{}
+	g.fields(t, properties, &required, true)
+
+	g.defs[name] = Schema{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+	return ref
+}
+
+// fields collects the properties of the struct, flattening embedded structs like encoding/json does.
+// Fields of embedded pointers are omitted when the pointer is nil, so they are never required.
+func (g *generator) fields(t reflect.Type, properties Schema, required *[]string, mayRequire bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			embeddedPointer := ft.Kind() == reflect.Pointer
+			if embeddedPointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && !ft.Implements(textType) {
+				g.fields(ft, properties, required, mayRequire && !embeddedPointer)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.schemaOf(field.Type)
+		if mayRequire && !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/kaz/pprotein/internal/analyze/slowlog"
+	"github.com/kaz/pprotein/internal/collect"
+	"github.com/kaz/pprotein/internal/event"
+	"github.com/kaz/pprotein/internal/storage"
+)
+
+type nopProcessor struct{}
+
+func (nopProcessor) Process(snapshot *collect.Snapshot) (io.ReadCloser, error) {
+	return nil, nil
+}
+
+func (nopProcessor) Cacheable() bool {
+	return false
+}
+
+func TestEntryConformsToSchema(t *testing.T) {
+	store, err := storage.New(t.TempDir(), storage.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	collector, err := collect.New(nopProcessor{}, &collect.Options{
+		Type:     "memo",
+		Ext:      "-memo.log",
+		Store:    store,
+		EventHub: event.NewHub(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create collector: %v", err)
+	}
+	if _, err := collector.Add(&collect.SnapshotTarget{GroupId: "group1", Label: "app"}, []byte("note")); err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+
+	analysis, err := slowlog.Analyze(context.Background(), []byte(`# Time: 2023-04-01T12:00:00.000000Z
+# User@Host: isucon[isucon] @ localhost []
+# Query_time: 1.000000  Lock_time: 0.000010 Rows_sent: 1  Rows_examined: 10000
+SET timestamp=1680350400;
+SELECT * FROM users WHERE id = 1;
+`), 0.5)
+	if err != nil {
+		t.Fatalf("Failed to analyze slowlog: %v", err)
+	}
+
+	entryJSON, err := json.Marshal(collector.List()[0])
+	if err != nil {
+		t.Fatalf("Failed to marshal entry: %v", err)
+	}
+
+	// Round trip the document to validate it in the form consumers see
+	raw, err := json.Marshal(Generate())
+	if err != nil {
+		t.Fatalf("Failed to marshal schema: %v", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("Failed to decode schema: %v", err)
+	}
+	properties := doc["properties"].(map[string]interface{})
+
+	tests := []struct {
+		name  string
+		typ   string
+		value string
+		valid bool
+	}{
+		{name: "Entry", typ: "entry", value: string(entryJSON), valid: true},
+		{name: "Slowlog analysis", typ: "slowlog_analysis", value: analysis, valid: true},
+		{name: "Entry with a wrong field type", typ: "entry", value: strings.Replace(string(entryJSON), `"Label":"app"`, `"Label":1`, 1), valid: false},
+		{name: "Entry with an unknown field", typ: "entry", value: `{"Snapshot":null,"Status":"ok","Message":"","Extra":1}`, valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatalf("Failed to decode value: %v", err)
+			}
+
+			err := validate(doc, properties[tt.typ].(map[string]interface{}), value, "$")
+			if (err == nil) != tt.valid {
+				t.Errorf("Validation result is different from expected. Expected valid: %v, Actual error: %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+// validate checks the value against the subset of JSON Schema the generator emits
+func validate(doc, schema map[string]interface{}, value interface{}, path string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		def := doc["$defs"].(map[string]interface{})[strings.TrimPrefix(ref, "#/$defs/")]
+		return validate(doc, def.(map[string]interface{}), value, path)
+	}
+
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		for _, s := range anyOf {
+			if validate(doc, s.(map[string]interface{}), value, path) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s matches none of anyOf", path)
+	}
+
+	if typ, ok := schema["type"]; ok {
+		types := []interface{}{typ}
+		if list, ok := typ.([]interface{}); ok {
+			types = list
+		}
+		matched := false
+		for _, t := range types {
+			if typeMatches(t.(string), value) {
+				matched = true
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s is not of type %v", path, typ)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := v[name.(string)]; !ok {
+					return fmt.Errorf("%s lacks required %s", path, name)
+				}
+			}
+		}
+		for name, field := range v {
+			if s, ok := properties[name]; ok {
+				if err := validate(doc, s.(map[string]interface{}), field, path+"."+name); err != nil {
+					return err
+				}
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					return fmt.Errorf("%s has unknown property %s", path, name)
+				}
+			case map[string]interface{}:
+				if err := validate(doc, additional, field, path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validate(doc, items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func typeMatches(typ string, value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return typ == "null"
+	case bool:
+		return typ == "boolean"
+	case float64:
+		return typ == "number" || (typ == "integer" && v == math.Trunc(v))
+	case string:
+		return typ == "string"
+	case []interface{}:
+		return typ == "array"
+	case map[string]interface{}:
+		return typ == "object"
+	default:
+		return false
+	}
+}
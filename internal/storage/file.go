@@ -4,24 +4,88 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strings"
+	"sync"
+)
+
+// Layout of the body files in the workdir
+type Layout string
+
+const (
+	// LayoutFlat stores all files directly in the workdir
+	LayoutFlat Layout = "flat"
+	// LayoutGroup stores files of a group in a subdirectory named after the group
+	LayoutGroup Layout = "group"
 )
 
 type (
 	fileStore struct {
 		workdir string
+		limits  Limits
+		layout  Layout
+
+		// Serializes size checks with the writes
+		mu sync.Mutex
+		// Size of each entry body by ID, loaded from the workdir on first use and kept up to date by the writes
+		sizes map[string]int64
+		// Sum of sizes
+		used int64
 	}
 )
 
-func newFile(workdir string) (fileStorage, error) {
+// Files in the workdir which are not entry bodies and don't count toward MaxTotalSize:
+// the database, which never shrinks, and the small settings files
+var unmeteredFiles = map[string]bool{
+	dbFileName:     true,
+	"alp.yml":      true,
+	"slp.yml":      true,
+	"targets.json": true,
+}
+
+func newFile(workdir string, limits Limits, layout Layout) (fileStorage, error) {
 	if err := os.MkdirAll(workdir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create workdir: %w", err)
 	}
 
-	return &fileStore{workdir}, nil
+	return &fileStore{workdir: workdir, limits: limits, layout: layout}, nil
 }
 
 func (s *fileStore) PutFile(id string, data []byte) error {
-	file, err := os.Create(path.Join(s.workdir, id))
+	return s.PutGroupFile("", id, data)
+}
+
+// PutGroupFile stores the file in the subdirectory of the group when the group layout is used
+func (s *fileStore) PutGroupFile(group, id string, data []byte) error {
+	if err := s.limits.CheckFileSize(int64(len(data))); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.limits.MaxTotalSize > 0 && !unmeteredFiles[id] {
+		if err := s.loadUsage(); err != nil {
+			return fmt.Errorf("failed to calculate usage: %w", err)
+		}
+		// Overwriting a file only counts the difference
+		if err := s.limits.checkTotalSize(s.used - s.sizes[id] + int64(len(data))); err != nil {
+			return err
+		}
+	}
+
+	// Drop the previous copy in case the file moves between the flat and the group layout
+	prev := s.locate(id)
+
+	dir := s.workdir
+	if sub := s.groupDir(group); sub != "" {
+		dir = path.Join(s.workdir, sub)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create group directory: %w", err)
+		}
+	}
+
+	filePath := path.Join(dir, id)
+	file, err := os.Create(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
@@ -30,12 +94,156 @@ func (s *fileStore) PutFile(id string, data []byte) error {
 	if _, err := file.Write(data); err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
+
+	if prev != filePath {
+		os.Remove(prev)
+	}
+	s.track(id, int64(len(data)))
 	return nil
 }
 func (s *fileStore) GetFilePath(id string) (string, error) {
-	return path.Join(s.workdir, id), nil
+	return s.locate(id), nil
 }
 func (s *fileStore) ExistsFile(id string) (bool, error) {
-	_, err := os.Stat(path.Join(s.workdir, id))
+	_, err := os.Stat(s.locate(id))
 	return err == nil, nil
 }
+func (s *fileStore) DeleteFile(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.locate(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	s.untrack(id)
+	return nil
+}
+func (s *fileStore) ListFiles() ([]string, error) {
+	ids := []string{}
+	err := s.walk(func(dir string, entry os.DirEntry) {
+		if dir == s.workdir && entry.Name() == dbFileName {
+			return
+		}
+		ids = append(ids, entry.Name())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workdir: %w", err)
+	}
+	return ids, nil
+}
+func (s *fileStore) Usage() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadUsage(); err != nil {
+		return 0, fmt.Errorf("failed to read workdir: %w", err)
+	}
+	return s.used, nil
+}
+func (s *fileStore) Limits() Limits {
+	return s.limits
+}
+
+// groupDir returns the subdirectory for the group, or an empty string when the file goes to the workdir itself
+func (s *fileStore) groupDir(group string) string {
+	if s.layout != LayoutGroup || group == "" || group == "." || group == ".." || strings.ContainsAny(group, `/\`) {
+		return ""
+	}
+	return group
+}
+
+// locate returns the path of the file, looking into the group subdirectories when it is not in the workdir.
+// The path in the workdir is returned for missing files.
+func (s *fileStore) locate(id string) string {
+	flat := path.Join(s.workdir, id)
+	if _, err := os.Stat(flat); err == nil {
+		return flat
+	}
+
+	entries, err := os.ReadDir(s.workdir)
+	if err != nil {
+		return flat
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		p := path.Join(s.workdir, entry.Name(), id)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return flat
+}
+
+// walk calls fn for each file in the workdir and in its group subdirectories
+func (s *fileStore) walk(fn func(dir string, entry os.DirEntry)) error {
+	entries, err := os.ReadDir(s.workdir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			fn(s.workdir, entry)
+			continue
+		}
+
+		dir := path.Join(s.workdir, entry.Name())
+		subEntries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, subEntry := range subEntries {
+			if !subEntry.IsDir() {
+				fn(dir, subEntry)
+			}
+		}
+	}
+	return nil
+}
+
+// loadUsage reads the sizes of the entry bodies in the workdir unless they are loaded already.
+// The caller must hold mu.
+func (s *fileStore) loadUsage() error {
+	if s.sizes != nil {
+		return nil
+	}
+
+	sizes := map[string]int64{}
+	var used int64
+	err := s.walk(func(dir string, entry os.DirEntry) {
+		if unmeteredFiles[entry.Name()] {
+			return
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return
+		}
+		sizes[entry.Name()] = info.Size()
+		used += info.Size()
+	})
+	if err != nil {
+		return err
+	}
+	s.sizes, s.used = sizes, used
+	return nil
+}
+
+// track records the size of a written file. The caller must hold mu.
+func (s *fileStore) track(id string, size int64) {
+	if s.sizes == nil || unmeteredFiles[id] {
+		return
+	}
+	s.used += size - s.sizes[id]
+	s.sizes[id] = size
+}
+
+// untrack forgets the size of a deleted file. The caller must hold mu.
+func (s *fileStore) untrack(id string) {
+	if s.sizes == nil {
+		return
+	}
+	s.used -= s.sizes[id]
+	delete(s.sizes, id)
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestNewFromEnvDataDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "custom")
+	t.Setenv(DataDirEnv, dir)
+	t.Setenv(StorageEnv, "")
+
+	store, err := NewFromEnv(DataDir())
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	if err := store.PutGroupFile("group1", "a-pprof.pb.gz", []byte("body")); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+
+	// The flat layout is the default
+	if _, err := os.Stat(filepath.Join(dir, "a-pprof.pb.gz")); err != nil {
+		t.Errorf("File is not stored in the configured directory: %v", err)
+	}
+}
+
+func TestFileStoreGroupLayout(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(LayoutEnv, string(LayoutGroup))
+	t.Setenv(StorageEnv, "")
+
+	store, err := NewFromEnv(dir)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	if err := store.PutGroupFile("group1", "a-pprof.pb.gz", []byte("body")); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+	if err := store.PutFile("alp.yml", []byte("config")); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+
+	expected := filepath.Join(dir, "group1", "a-pprof.pb.gz")
+	if _, err := os.Stat(expected); err != nil {
+		t.Errorf("File is not stored in the group directory: %v", err)
+	}
+
+	got, err := store.GetFilePath("a-pprof.pb.gz")
+	if err != nil {
+		t.Fatalf("Failed to get file path: %v", err)
+	}
+	if got != expected {
+		t.Errorf("File path is different from expected. Expected: %s, Actual: %s", expected, got)
+	}
+
+	ids, err := store.ListFiles()
+	if err != nil {
+		t.Fatalf("Failed to list files: %v", err)
+	}
+	sort.Strings(ids)
+	if len(ids) != 2 || ids[0] != "a-pprof.pb.gz" || ids[1] != "alp.yml" {
+		t.Errorf("Files are different from expected. Actual: %v", ids)
+	}
+
+	if err := store.DeleteFile("a-pprof.pb.gz"); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+	if ok, _ := store.ExistsFile("a-pprof.pb.gz"); ok {
+		t.Errorf("File is not deleted")
+	}
+}
+
+func TestLayoutFromEnvInvalid(t *testing.T) {
+	t.Setenv(LayoutEnv, "nested")
+	if _, err := LayoutFromEnv(); err == nil {
+		t.Errorf("Invalid layout is accepted")
+	}
+}
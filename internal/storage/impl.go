@@ -1,6 +1,22 @@
 package storage
 
-import "fmt"
+import (
+	"fmt"
+	"net/url"
+	"os"
+)
+
+const (
+	// Environment variable selecting the storage backend (e.g. "s3://bucket/prefix")
+	StorageEnv = "PPROTEIN_STORAGE"
+	// Environment variable overriding the base directory of the local data
+	DataDirEnv = "PPROTEIN_DATA_DIR"
+	// Environment variable selecting the file layout ("flat" or "group")
+	LayoutEnv = "PPROTEIN_DATA_LAYOUT"
+)
+
+// Base directory of the local data used when PPROTEIN_DATA_DIR is not set
+const defaultDataDir = "data"
 
 type (
 	store struct {
@@ -9,16 +25,73 @@ type (
 	}
 )
 
-func New(workdir string) (Storage, error) {
+// DataDir returns the base directory of the local data
+func DataDir() string {
+	if dir := os.Getenv(DataDirEnv); dir != "" {
+		return dir
+	}
+	return defaultDataDir
+}
+
+// LayoutFromEnv reads the file layout from PPROTEIN_DATA_LAYOUT. The flat layout is used when it is not set.
+func LayoutFromEnv() (Layout, error) {
+	switch layout := Layout(os.Getenv(LayoutEnv)); layout {
+	case "", LayoutFlat:
+		return LayoutFlat, nil
+	case LayoutGroup:
+		return LayoutGroup, nil
+	default:
+		return "", fmt.Errorf("invalid %s: %q", LayoutEnv, layout)
+	}
+}
+
+func New(workdir string, limits Limits) (Storage, error) {
+	return NewWithLayout(workdir, limits, LayoutFlat)
+}
+
+// NewWithLayout creates the filesystem storage storing the files in the given layout
+func NewWithLayout(workdir string, limits Limits, layout Layout) (Storage, error) {
 	kvs, err := newKV(workdir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create kvs: %w", err)
 	}
 
-	fs, err := newFile(workdir)
+	fs, err := newFile(workdir, limits, layout)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create fs: %w", err)
 	}
 
 	return &store{kvs, fs}, nil
 }
+
+// NewFromEnv creates the storage backend selected by PPROTEIN_STORAGE with the size limits from the environment.
+// The local filesystem under workdir is used when it is not set.
+func NewFromEnv(workdir string) (Storage, error) {
+	limits, err := LimitsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	layout, err := LayoutFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	raw := os.Getenv(StorageEnv)
+	if raw == "" {
+		return NewWithLayout(workdir, limits, layout)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", StorageEnv, err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return NewWithLayout(u.Path, limits, layout)
+	case "s3":
+		return newS3(u, s3ConfigFromEnv(), limits, workdir)
+	default:
+		return nil, fmt.Errorf("unsupported storage scheme: %q", u.Scheme)
+	}
+}
@@ -8,6 +8,9 @@ import (
 	"go.etcd.io/bbolt"
 )
 
+// Name of the DB file stored in the workdir
+const dbFileName = "pprotein.db"
+
 type (
 	kvStore struct {
 		db *bbolt.DB
@@ -19,7 +22,7 @@ func newKV(workdir string) (kvStorage, error) {
 		return nil, fmt.Errorf("failed to create workdir: %w", err)
 	}
 
-	db, err := bbolt.Open(path.Join(workdir, "pprotein.db"), 0600, nil)
+	db, err := bbolt.Open(path.Join(workdir, dbFileName), 0600, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize DB: %w", err)
 	}
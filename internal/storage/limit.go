@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Environment variables limiting the size of stored files (e.g. "512M", "10G", "0" for unlimited)
+const (
+	MaxFileSizeEnv  = "PPROTEIN_MAX_FILE_SIZE"
+	MaxTotalSizeEnv = "PPROTEIN_MAX_TOTAL_SIZE"
+)
+
+// Environment variable limiting the size of request bodies read into memory by the analyze and import endpoints
+const MaxBodySizeEnv = "PPROTEIN_MAX_BODY_SIZE"
+
+// Default size limits of a single file and a request body
+const (
+	defaultMaxFileSize = 1 << 30
+	defaultMaxBodySize = 256 << 20
+)
+
+// ErrSizeLimitExceeded is returned when writing a file would exceed the configured size limits
+var ErrSizeLimitExceeded = errors.New("size limit exceeded")
+
+type (
+	// Limits are the size limits enforced when writing files. Zero means unlimited.
+	Limits struct {
+		MaxFileSize  int64
+		MaxTotalSize int64
+	}
+)
+
+// LimitsFromEnv reads the size limits from PPROTEIN_MAX_FILE_SIZE and PPROTEIN_MAX_TOTAL_SIZE
+func LimitsFromEnv() (Limits, error) {
+	limits := Limits{MaxFileSize: defaultMaxFileSize}
+
+	if v := os.Getenv(MaxFileSizeEnv); v != "" {
+		size, err := ParseSize(v)
+		if err != nil {
+			return Limits{}, fmt.Errorf("invalid %s: %w", MaxFileSizeEnv, err)
+		}
+		limits.MaxFileSize = size
+	}
+	if v := os.Getenv(MaxTotalSizeEnv); v != "" {
+		size, err := ParseSize(v)
+		if err != nil {
+			return Limits{}, fmt.Errorf("invalid %s: %w", MaxTotalSizeEnv, err)
+		}
+		limits.MaxTotalSize = size
+	}
+	return limits, nil
+}
+
+// MaxBodySizeFromEnv reads the size limit of request bodies from PPROTEIN_MAX_BODY_SIZE, where 0 means unlimited
+func MaxBodySizeFromEnv() int64 {
+	v := os.Getenv(MaxBodySizeEnv)
+	if v == "" {
+		return defaultMaxBodySize
+	}
+	size, err := ParseSize(v)
+	if err != nil {
+		log.Printf("[!] invalid %s %q, using the default of %d bytes", MaxBodySizeEnv, v, defaultMaxBodySize)
+		return defaultMaxBodySize
+	}
+	return size
+}
+
+// ParseSize parses a byte size with an optional K, M, or G suffix (powers of 1024)
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(s, "B")
+
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		unit = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		unit = 1 << 30
+	}
+	if unit != 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("malformed size: %q", s)
+	}
+	return n * unit, nil
+}
+
+// CheckFileSize returns an error if a file of the given size is not allowed to be stored
+func (l Limits) CheckFileSize(size int64) error {
+	if l.MaxFileSize > 0 && size > l.MaxFileSize {
+		return fmt.Errorf("%w: file size %d exceeds the limit of %d bytes", ErrSizeLimitExceeded, size, l.MaxFileSize)
+	}
+	return nil
+}
+
+// checkTotalSize returns an error if the total size after the write exceeds the limit
+func (l Limits) checkTotalSize(total int64) error {
+	if l.MaxTotalSize > 0 && total > l.MaxTotalSize {
+		return fmt.Errorf("%w: total size %d exceeds the limit of %d bytes", ErrSizeLimitExceeded, total, l.MaxTotalSize)
+	}
+	return nil
+}
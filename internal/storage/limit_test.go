@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{name: "Bytes", input: "1024", want: 1024},
+		{name: "Kilobytes", input: "4K", want: 4 << 10},
+		{name: "Megabytes with B suffix", input: "512MB", want: 512 << 20},
+		{name: "Lowercase gigabytes", input: "2g", want: 2 << 30},
+		{name: "Unlimited", input: "0", want: 0},
+		{name: "Malformed", input: "lots", wantErr: true},
+		{name: "Negative", input: "-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSize(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxBodySizeFromEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  int64
+	}{
+		{name: "Unset", value: "", want: defaultMaxBodySize},
+		{name: "Megabytes", value: "64M", want: 64 << 20},
+		{name: "Unlimited", value: "0", want: 0},
+		{name: "Malformed", value: "lots", want: defaultMaxBodySize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(MaxBodySizeEnv, tt.value)
+			if got := MaxBodySizeFromEnv(); got != tt.want {
+				t.Errorf("MaxBodySizeFromEnv() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileStoreMaxFileSize(t *testing.T) {
+	fs, err := newFile(t.TempDir(), Limits{MaxFileSize: 10}, LayoutFlat)
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+
+	if err := fs.PutFile("small", make([]byte, 10)); err != nil {
+		t.Errorf("File within the limit was rejected: %v", err)
+	}
+
+	err = fs.PutFile("large", make([]byte, 11))
+	if !errors.Is(err, ErrSizeLimitExceeded) {
+		t.Errorf("Oversized file was not rejected with ErrSizeLimitExceeded: %v", err)
+	}
+	if exists, _ := fs.ExistsFile("large"); exists {
+		t.Errorf("Oversized file was written")
+	}
+}
+
+func TestFileStoreMaxTotalSize(t *testing.T) {
+	fs, err := newFile(t.TempDir(), Limits{MaxTotalSize: 25}, LayoutFlat)
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+
+	if err := fs.PutFile("a", make([]byte, 10)); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+	if err := fs.PutFile("b", make([]byte, 10)); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+
+	err = fs.PutFile("c", make([]byte, 10))
+	if !errors.Is(err, ErrSizeLimitExceeded) {
+		t.Errorf("File exceeding the total limit was not rejected with ErrSizeLimitExceeded: %v", err)
+	}
+
+	// Overwriting a file only counts the difference
+	if err := fs.PutFile("b", make([]byte, 15)); err != nil {
+		t.Errorf("Overwrite within the total limit was rejected: %v", err)
+	}
+
+	// Deleting frees up space
+	if err := fs.DeleteFile("a"); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+	if err := fs.PutFile("c", make([]byte, 10)); err != nil {
+		t.Errorf("File within the total limit after delete was rejected: %v", err)
+	}
+}
+
+func TestFileStoreMaxTotalSizeCountsOnlyEntries(t *testing.T) {
+	workdir := t.TempDir()
+	// The database and the settings files are much larger than the limit
+	for _, name := range []string{dbFileName, "alp.yml"} {
+		if err := os.WriteFile(path.Join(workdir, name), make([]byte, 100), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	fs, err := newFile(workdir, Limits{MaxTotalSize: 25}, LayoutFlat)
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+
+	if err := fs.PutFile("a", make([]byte, 20)); err != nil {
+		t.Errorf("File within the total limit was rejected: %v", err)
+	}
+	if err := fs.PutFile("targets.json", make([]byte, 100)); err != nil {
+		t.Errorf("Settings file was rejected: %v", err)
+	}
+
+	usage, err := fs.Usage()
+	if err != nil {
+		t.Fatalf("Failed to get usage: %v", err)
+	}
+	if usage != 20 {
+		t.Errorf("Usage is different from expected. Expected: 20, Actual: %d", usage)
+	}
+}
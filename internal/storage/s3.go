@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+type (
+	s3Store struct {
+		client *minio.Client
+		bucket string
+		prefix string
+		limits Limits
+
+		// Local copies of files, since analyzers read them by path
+		cache *fileStore
+	}
+
+	s3Config struct {
+		Endpoint string
+		Secure   bool
+		Region   string
+	}
+)
+
+// s3ConfigFromEnv reads the S3 endpoint settings.
+// AWS_ENDPOINT_URL can point to S3 compatible services such as MinIO or LocalStack.
+func s3ConfigFromEnv() s3Config {
+	cfg := s3Config{
+		Endpoint: "s3.amazonaws.com",
+		Secure:   true,
+		Region:   os.Getenv("AWS_REGION"),
+	}
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+			cfg.Endpoint = u.Host
+			cfg.Secure = u.Scheme != "http"
+		} else {
+			cfg.Endpoint = endpoint
+		}
+	}
+	return cfg
+}
+
+// newS3 creates a storage storing both metadata and files in the bucket given as s3://bucket/prefix
+// Only the per-file limit is enforced, as object storage does not run out of space.
+func newS3(u *url.URL, cfg s3Config, limits Limits, workdir string) (Storage, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("bucket is not specified: %s", u)
+	}
+
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{},
+		}),
+		Secure:       cfg.Secure,
+		Region:       cfg.Region,
+		BucketLookup: minio.BucketLookupPath,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	cache, err := newFile(path.Join(workdir, "s3cache"), Limits{}, LayoutFlat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache: %w", err)
+	}
+
+	s := &s3Store{
+		client: client,
+		bucket: u.Host,
+		prefix: strings.Trim(u.Path, "/"),
+		limits: limits,
+		cache:  cache.(*fileStore),
+	}
+	return &store{s, s}, nil
+}
+
+func (s *s3Store) kvKey(typ, id string) string {
+	return path.Join(s.prefix, "kv", typ, id)
+}
+func (s *s3Store) fileKey(id string) string {
+	return path.Join(s.prefix, "files", id)
+}
+
+func (s *s3Store) putObject(key string, data []byte) error {
+	_, err := s.client.PutObject(context.Background(), s.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		DisableContentSha256: true,
+	})
+	return err
+}
+func (s *s3Store) getObject(key string) ([]byte, error) {
+	obj, err := s.client.GetObject(context.Background(), s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(obj)
+	if isNotFound(err) {
+		return nil, nil
+	}
+	return data, err
+}
+func (s *s3Store) existsObject(key string) (bool, error) {
+	_, err := s.client.StatObject(context.Background(), s.bucket, key, minio.StatObjectOptions{})
+	if isNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+func (s *s3Store) listObjects(prefix string) ([]string, error) {
+	keys := make([]string, 0)
+	for obj := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{Prefix: prefix + "/", Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		keys = append(keys, obj.Key)
+	}
+	return keys, nil
+}
+
+func isNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	code := minio.ToErrorResponse(err).Code
+	return code == "NoSuchKey" || code == "NotFound"
+}
+
+func (s *s3Store) Put(typ, id string, data []byte) error {
+	if err := s.putObject(s.kvKey(typ, id), data); err != nil {
+		return fmt.Errorf("failed to put object: %w", err)
+	}
+	return nil
+}
+func (s *s3Store) Get(typ, id string) ([]byte, error) {
+	data, err := s.getObject(s.kvKey(typ, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	return data, nil
+}
+func (s *s3Store) GetAll(typ string) ([][]byte, error) {
+	keys, err := s.listObjects(path.Join(s.prefix, "kv", typ))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	resp := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		data, err := s.getObject(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get object: %w", err)
+		}
+		if data != nil {
+			resp = append(resp, data)
+		}
+	}
+	return resp, nil
+}
+func (s *s3Store) Exists(typ, id string) (bool, error) {
+	exists, err := s.existsObject(s.kvKey(typ, id))
+	if err != nil {
+		return false, fmt.Errorf("failed to stat object: %w", err)
+	}
+	return exists, nil
+}
+func (s *s3Store) Delete(typ, id string) error {
+	if err := s.client.RemoveObject(context.Background(), s.bucket, s.kvKey(typ, id), minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	return nil
+}
+
+func (s *s3Store) PutFile(id string, data []byte) error {
+	if err := s.limits.CheckFileSize(int64(len(data))); err != nil {
+		return err
+	}
+	if err := s.putObject(s.fileKey(id), data); err != nil {
+		return fmt.Errorf("failed to put object: %w", err)
+	}
+	// Write through so that paths handed out earlier see the new content
+	return s.cache.PutFile(id, data)
+}
+
+// PutGroupFile stores the file like PutFile since object keys have no directory layout
+func (s *s3Store) PutGroupFile(group, id string, data []byte) error {
+	return s.PutFile(id, data)
+}
+func (s *s3Store) GetFilePath(id string) (string, error) {
+	if ok, _ := s.cache.ExistsFile(id); ok {
+		return s.cache.GetFilePath(id)
+	}
+
+	data, err := s.getObject(s.fileKey(id))
+	if err != nil {
+		return "", fmt.Errorf("failed to get object: %w", err)
+	}
+	if data == nil {
+		// Return the path anyway like the filesystem backend does for missing files
+		return s.cache.GetFilePath(id)
+	}
+	if err := s.cache.PutFile(id, data); err != nil {
+		return "", fmt.Errorf("failed to cache file: %w", err)
+	}
+	return s.cache.GetFilePath(id)
+}
+func (s *s3Store) ExistsFile(id string) (bool, error) {
+	exists, err := s.existsObject(s.fileKey(id))
+	if err != nil {
+		return false, fmt.Errorf("failed to stat object: %w", err)
+	}
+	return exists, nil
+}
+func (s *s3Store) DeleteFile(id string) error {
+	if err := s.client.RemoveObject(context.Background(), s.bucket, s.fileKey(id), minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	return s.cache.DeleteFile(id)
+}
+func (s *s3Store) ListFiles() ([]string, error) {
+	prefix := path.Join(s.prefix, "files")
+	keys, err := s.listObjects(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		ids = append(ids, strings.TrimPrefix(key, prefix+"/"))
+	}
+	return ids, nil
+}
+func (s *s3Store) Usage() (int64, error) {
+	var total int64
+	for obj := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{Prefix: path.Join(s.prefix, "files") + "/", Recursive: true}) {
+		if obj.Err != nil {
+			return 0, fmt.Errorf("failed to list objects: %w", obj.Err)
+		}
+		total += obj.Size
+	}
+	return total, nil
+}
+func (s *s3Store) Limits() Limits {
+	return s.limits
+}
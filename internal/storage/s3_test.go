@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a minimal in-memory S3 server supporting the operations used by s3Store
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+type fakeListResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string
+	Prefix      string
+	KeyCount    int
+	MaxKeys     int
+	IsTruncated bool
+	Contents    []fakeListContent
+}
+type fakeListContent struct {
+	Key  string
+	Size int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	if key == "" && r.Method == http.MethodGet {
+		prefix := r.URL.Query().Get("prefix")
+		result := fakeListResult{Name: bucket, Prefix: prefix, MaxKeys: 1000}
+		for k, v := range f.objects {
+			if strings.HasPrefix(k, bucket+"/"+prefix) {
+				result.Contents = append(result.Contents, fakeListContent{Key: strings.TrimPrefix(k, bucket+"/"), Size: len(v)})
+			}
+		}
+		sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+		result.KeyCount = len(result.Contents)
+
+		w.Header().Set("Content-Type", "application/xml")
+		xml.NewEncoder(w).Encode(result)
+		return
+	}
+
+	name := bucket + "/" + key
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.objects[name] = body
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodGet, http.MethodHead:
+		data, ok := f.objects[name]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+			}
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", `"etag"`)
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case http.MethodDelete:
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestS3Store(t *testing.T) (Storage, *fakeS3) {
+	t.Helper()
+
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	endpoint, _ := url.Parse(server.URL)
+	u, _ := url.Parse("s3://pprotein/data")
+	s, err := newS3(u, s3Config{Endpoint: endpoint.Host, Secure: false, Region: "us-east-1"}, Limits{}, t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create S3 storage: %v", err)
+	}
+	return s, fake
+}
+
+func TestS3StorageKV(t *testing.T) {
+	s, fake := newTestS3Store(t)
+
+	if err := s.Put("pprof", "a", []byte("meta-a")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := s.Put("pprof", "b", []byte("meta-b")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if _, ok := fake.objects["pprotein/data/kv/pprof/a"]; !ok {
+		t.Errorf("Object is not stored under the prefix: %v", fake.objects)
+	}
+
+	data, err := s.Get("pprof", "a")
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	if string(data) != "meta-a" {
+		t.Errorf("Value is different from expected. Expected: meta-a, Actual: %s", data)
+	}
+
+	all, err := s.GetAll("pprof")
+	if err != nil {
+		t.Fatalf("Failed to get all: %v", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("Number of values is different from expected. Expected: 2, Actual: %d", len(all))
+	}
+
+	if err := s.Delete("pprof", "a"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if exists, err := s.Exists("pprof", "a"); err != nil || exists {
+		t.Errorf("Deleted value still exists: exists=%v, err=%v", exists, err)
+	}
+	if data, err := s.Get("pprof", "a"); err != nil || data != nil {
+		t.Errorf("Deleted value is still returned: data=%q, err=%v", data, err)
+	}
+}
+
+func TestS3StorageFile(t *testing.T) {
+	s, fake := newTestS3Store(t)
+
+	if err := s.PutFile("abc-pprof.pb.gz", []byte("profile")); err != nil {
+		t.Fatalf("Failed to put file: %v", err)
+	}
+	if exists, err := s.ExistsFile("abc-pprof.pb.gz"); err != nil || !exists {
+		t.Errorf("File does not exist after put: exists=%v, err=%v", exists, err)
+	}
+
+	// Drop the local copy to force a download
+	p, _ := s.GetFilePath("abc-pprof.pb.gz")
+	os.Remove(p)
+
+	p, err := s.GetFilePath("abc-pprof.pb.gz")
+	if err != nil {
+		t.Fatalf("Failed to get file path: %v", err)
+	}
+	content, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("Failed to read downloaded file: %v", err)
+	}
+	if string(content) != "profile" {
+		t.Errorf("Content is different from expected. Expected: profile, Actual: %s", content)
+	}
+
+	ids, err := s.ListFiles()
+	if err != nil {
+		t.Fatalf("Failed to list files: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "abc-pprof.pb.gz" {
+		t.Errorf("File list is different from expected: %v", ids)
+	}
+
+	if err := s.DeleteFile("abc-pprof.pb.gz"); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+	if len(fake.objects) != 0 {
+		t.Errorf("Object remains after delete: %v", fake.objects)
+	}
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Errorf("Local copy remains after delete")
+	}
+}
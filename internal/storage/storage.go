@@ -15,7 +15,12 @@ type (
 	}
 	fileStorage interface {
 		PutFile(id string, data []byte) error
+		PutGroupFile(group, id string, data []byte) error
 		GetFilePath(id string) (string, error)
 		ExistsFile(id string) (bool, error)
+		DeleteFile(id string) error
+		ListFiles() ([]string, error)
+		Usage() (int64, error)
+		Limits() Limits
 	}
 )
@@ -0,0 +1,36 @@
+package trace
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	analyzer "github.com/kaz/pprotein/internal/analyze/trace"
+	"github.com/kaz/pprotein/internal/collect"
+)
+
+type (
+	processor struct{}
+)
+
+func (p *processor) Cacheable() bool {
+	return true
+}
+
+func (p *processor) Process(snapshot *collect.Snapshot) (io.ReadCloser, error) {
+	bodyPath, err := snapshot.BodyPath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find snapshot body: %w", err)
+	}
+
+	content, err := os.ReadFile(bodyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot body: %w", err)
+	}
+	res, err := analyzer.AnalyzeWithOptions(content, analyzer.Options{Source: snapshot.Source()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze trace: %w", err)
+	}
+	return io.NopCloser(bytes.NewBufferString(res)), nil
+}